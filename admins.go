@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// defaultAdministrations are presidential terms by inauguration date. eCFR
+// version history starts in 2017, so earlier terms would be empty.
+const defaultAdministrations = "Obama:2009-01-20,Trump:2017-01-20,Biden:2021-01-20,Trump II:2025-01-20"
+
+type period struct {
+	name       string
+	start, end string // [start, end); end empty for the open current period
+}
+
+// parsePeriods reads "Name:YYYY-MM-DD,…" boundaries; each period runs until
+// the next one starts.
+func parsePeriods(spec string) ([]period, error) {
+	var out []period
+	for _, f := range strings.Split(spec, ",") {
+		name, start, ok := strings.Cut(strings.TrimSpace(f), ":")
+		if !ok {
+			return nil, fmt.Errorf("bad period %q, want Name:YYYY-MM-DD", f)
+		}
+		if _, err := time.Parse("2006-01-02", start); err != nil {
+			return nil, fmt.Errorf("period %s: %w", name, err)
+		}
+		out = append(out, period{name: name, start: start})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].start < out[j].start })
+	for i := 0; i+1 < len(out); i++ {
+		out[i].end = out[i+1].start
+	}
+	return out, nil
+}
+
+// periodStats is one row of the administrations report.
+type periodStats struct {
+	period
+	group                      string
+	amendments, added, removed int
+	wordsStart, wordsEnd       int64
+}
+
+// runAdmins aggregates amendment activity and net word change by
+// presidential administration (or any --periods boundaries).
+//
+//	efcr admins --title 40 [--part 60] [--periods "A:2017-01-20,B:2021-01-20"] [--group-by part]
+func runAdmins(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("admins", flag.ExitOnError)
+	title := fs.Int("title", 0, "title number")
+	part := fs.String("part", "", "restrict to one part")
+	spec := fs.String("periods", defaultAdministrations, "comma separated Name:start-date period boundaries")
+	groupBy := fs.String("group-by", "title", "split rows by title, part or agency")
+	dateField := fs.String("date-field", "amendment", "date axis for assigning amendments to periods: amendment or issue")
+	fs.Parse(args)
+	if *title == 0 {
+		return errors.New("--title is required")
+	}
+	if err := validGroupBy(*groupBy); err != nil {
+		return err
+	}
+	if err := validDateField(*dateField); err != nil {
+		return err
+	}
+	periods, err := parsePeriods(*spec)
+	if err != nil {
+		return err
+	}
+
+	s := scope{*title, *part}
+	versions, err := newAPI(c).Versions(ctx, s.title, ecfr.Hierarchy{Part: s.part})
+	if err != nil {
+		return err
+	}
+	events := amendmentEvents(s.title, versions, *dateField)
+	var dates []string
+	for _, v := range versions {
+		dates = append(dates, v.Date)
+	}
+	sort.Strings(dates)
+	if len(dates) == 0 {
+		return fmt.Errorf("no versions for %s", citation(s.title, s.part, ""))
+	}
+
+	facts := eventFacts(events)
+	var own ownership
+	if *groupBy == "agency" {
+		if own, err = loadOwnership(ctx, c, map[int]bool{s.title: true}); err != nil {
+			return err
+		}
+		setAgencies(facts, own)
+	}
+	rollup := Rollup{GroupBy: []string{*groupBy}, Bucket: periodBucket(periods)}
+	activity, err := rollup.Run(facts)
+	if err != nil {
+		return err
+	}
+
+	// Word levels per group at a boundary. Grouping below title level needs
+	// the parsed tree; otherwise a streaming count is enough.
+	levels := map[string]map[string]int64{}
+	wordsAt := func(boundary string) (map[string]int64, error) {
+		d := snapshotBefore(dates, boundary)
+		if w, ok := levels[d]; ok {
+			return w, nil
+		}
+		var wf []Fact
+		if *groupBy == "title" {
+			n, err := scopeWords(ctx, c, s, d)
+			if err != nil {
+				return nil, err
+			}
+			wf = append(wf, Fact{Title: s.title, Part: s.part, Metric: "words", Value: float64(n)})
+		} else {
+			doc, err := newAPI(c).Document(ctx, s.title, d, ecfr.Hierarchy{Part: s.part})
+			if err != nil {
+				return nil, err
+			}
+			for p, n := range core.PartWords(doc.Root()) {
+				wf = append(wf, Fact{Title: s.title, Part: p, Metric: "words", Value: float64(n)})
+			}
+			setAgencies(wf, own)
+		}
+		rows, err := Rollup{GroupBy: rollup.GroupBy}.Run(wf)
+		if err != nil {
+			return nil, err
+		}
+		w := map[string]int64{}
+		for _, r := range rows {
+			w[r.Key[0]] = int64(r.Value)
+		}
+		levels[d] = w
+		return w, nil
+	}
+
+	var rows []periodStats
+	for _, p := range periods {
+		if p.end != "" && p.end <= dates[0] {
+			continue // entirely before recorded history
+		}
+		stats := map[string]*periodStats{}
+		get := func(g string) *periodStats {
+			if stats[g] == nil {
+				stats[g] = &periodStats{period: p, group: g}
+			}
+			return stats[g]
+		}
+		for _, r := range activity {
+			if r.Period != p.name {
+				continue
+			}
+			st := get(r.Key[0])
+			switch r.Metric {
+			case "amendments":
+				st.amendments = int(r.Value)
+			case "added":
+				st.added = int(r.Value)
+			case "removed":
+				st.removed = int(r.Value)
+			}
+		}
+		start, err := wordsAt(p.start)
+		if err != nil {
+			return err
+		}
+		end, err := wordsAt(p.end)
+		if err != nil {
+			return err
+		}
+		for g, n := range start {
+			get(g).wordsStart = n
+		}
+		for g, n := range end {
+			get(g).wordsEnd = n
+		}
+		var groups []string
+		for g := range stats {
+			groups = append(groups, g)
+		}
+		sort.Strings(groups)
+		for _, g := range groups {
+			rows = append(rows, *stats[g])
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "Group\tPeriod\tStart\tEnd\tAmendments\tAdded\tRemoved\tWordsStart\tWordsEnd\tNetWords")
+	for _, r := range rows {
+		end := r.end
+		if end == "" {
+			end = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%+d\n", r.group, r.name, r.start, end,
+			r.amendments, r.added, r.removed, r.wordsStart, r.wordsEnd, r.wordsEnd-r.wordsStart)
+	}
+	return tw.Flush()
+}
+
+// snapshotBefore returns the latest of the sorted dates strictly before
+// boundary, the earliest date if none is, and the latest if boundary is
+// empty (an open period).
+func snapshotBefore(dates []string, boundary string) string {
+	if boundary == "" {
+		return dates[len(dates)-1]
+	}
+	i := sort.SearchStrings(dates, boundary)
+	if i == 0 {
+		return dates[0]
+	}
+	return dates[i-1]
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+const agenciesURL = "https://www.ecfr.gov/api/admin/v1/agencies.json"
+
+// Agency matches an entry of /api/admin/v1/agencies.json. Sub-agencies are
+// nested under Children.
+type Agency struct {
+	Name          string         `json:"name"`
+	ShortName     string         `json:"short_name"`
+	DisplayName   string         `json:"display_name"`
+	Slug          string         `json:"slug"`
+	Children      []Agency       `json:"children"`
+	CFRReferences []CFRReference `json:"cfr_references"`
+}
+
+// CFRReference is the slice of the CFR an agency is responsible for: a
+// whole title, a chapter or a single part.
+type CFRReference struct {
+	Title      int    `json:"title"`
+	Chapter    string `json:"chapter,omitempty"`
+	Subchapter string `json:"subchapter,omitempty"`
+	Part       string `json:"part,omitempty"`
+}
+
+type agenciesResponse struct {
+	Agencies []Agency `json:"agencies"`
+}
+
+func fetchAgencies(ctx context.Context, c httpclient) ([]Agency, error) {
+	var resp agenciesResponse
+	if err := ecfr.GetJSON(ctx, c, agenciesURL, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Agencies, nil
+}
+
+// findAgency looks slug up among agencies and their children.
+func findAgency(agencies []Agency, slug string) *Agency {
+	for i := range agencies {
+		if agencies[i].Slug == slug {
+			return &agencies[i]
+		}
+		if a := findAgency(agencies[i].Children, slug); a != nil {
+			return a
+		}
+	}
+	return nil
+}
+
+// scope is a unit of the CFR to measure: a whole title or one part of it.
+type scope struct {
+	title int
+	part  string // empty for the whole title
+}
+
+// structures fetches and memoizes the current structure of each title.
+type structures struct {
+	api    *ecfr.Client
+	titles map[int]ecfr.Title
+	roots  map[int]*ecfr.StructureNode
+}
+
+func newStructures(ctx context.Context, c httpclient) (*structures, error) {
+	api := newAPI(c)
+	titles, err := api.Titles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s := &structures{api: api, titles: map[int]ecfr.Title{}, roots: map[int]*ecfr.StructureNode{}}
+	for _, t := range titles {
+		s.titles[t.Number] = t
+	}
+	return s, nil
+}
+
+func (s *structures) get(ctx context.Context, title int) (*ecfr.StructureNode, error) {
+	if root, ok := s.roots[title]; ok {
+		return root, nil
+	}
+	t, ok := s.titles[title]
+	if !ok {
+		return nil, fmt.Errorf("unknown title %d", title)
+	}
+	root, err := s.api.Structure(ctx, title, t.UpToDateAsOf)
+	if err != nil {
+		return nil, err
+	}
+	s.roots[title] = root
+	return root, nil
+}
+
+// parts expands a reference to the parts it covers. A whole-title reference
+// yields a single empty part.
+func (s *structures) parts(ctx context.Context, ref CFRReference) ([]string, error) {
+	switch {
+	case ref.Part != "":
+		return []string{ref.Part}, nil
+	case ref.Chapter != "":
+		root, err := s.get(ctx, ref.Title)
+		if err != nil {
+			return nil, err
+		}
+		node := root.Find("chapter", ref.Chapter)
+		if node != nil && ref.Subchapter != "" {
+			node = node.Find("subchapter", ref.Subchapter)
+		}
+		if node == nil {
+			return nil, fmt.Errorf("chapter %s not found in title %d", ref.Chapter, ref.Title)
+		}
+		return node.Parts(), nil
+	default:
+		return []string{""}, nil
+	}
+}
+
+// agencyScopes expands an agency's CFR references to titles and parts,
+// using the current structure of each title to list a chapter's parts.
+func agencyScopes(ctx context.Context, c httpclient, a *Agency) ([]scope, error) {
+	st, err := newStructures(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	var out []scope
+	for _, ref := range a.CFRReferences {
+		parts, err := st.parts(ctx, ref)
+		if err != nil {
+			return nil, fmt.Errorf("agency %s: %w", a.Slug, err)
+		}
+		for _, p := range parts {
+			out = append(out, scope{ref.Title, p})
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+	"golang.org/x/sync/errgroup"
+)
+
+// AgencySize is one row of the agencies report: how much regulation an
+// agency is responsible for and how often it changes.
+type AgencySize struct {
+	Agency    string `json:"agency"`
+	SubAgency string `json:"sub_agency,omitempty"`
+	Parts     int    `json:"parts"`
+	Words     int64  `json:"words"`
+	// Versions counts substantive section changes, since the report's
+	// --since date if it has one.
+	Versions int `json:"versions"`
+	// PerYear is Versions over the years they span.
+	PerYear float64 `json:"per_year"`
+}
+
+// unowned collects parts no agency's CFR references reach.
+const unowned = "(no agency)"
+
+// runAgencies ranks agencies by the size of their regulations and how fast
+// they change, joining every part's current word count and version history
+// with the agency list's CFR references (see loadOwnership). Parts the
+// config marks as tables count as parts but not words, as in crawl.
+//
+//	efcr agencies
+//	efcr agencies --since 2020-01-01 --sort versions --sub
+func runAgencies(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("agencies", flag.ExitOnError)
+	titleList := fs.String("titles", "", "comma separated title numbers to include (default all)")
+	since := fs.String("since", "", "only count versions from this date YYYY-MM-DD (default all)")
+	sub := fs.Bool("sub", false, "report sub-agencies separately instead of rolling them into their parent")
+	sortBy := fs.String("sort", "words", "order rows by words or versions")
+	asJSON := fs.Bool("json", false, "print one JSON object per agency")
+	fs.Parse(args)
+	switch *sortBy {
+	case "words", "versions":
+	default:
+		return fmt.Errorf("unknown --sort %q (words|versions)", *sortBy)
+	}
+	only, err := parseTitles(*titleList)
+	if err != nil {
+		return err
+	}
+	api := newAPI(c)
+	all, err := api.Titles(ctx)
+	if err != nil {
+		return err
+	}
+	var titles []ecfr.Title
+	numbers := map[int]bool{}
+	for _, t := range all {
+		if !t.Reserved && (len(only) == 0 || only[t.Number]) {
+			titles = append(titles, t)
+			numbers[t.Number] = true
+		}
+	}
+	own, err := loadOwnership(ctx, c, numbers)
+	if err != nil {
+		return err
+	}
+
+	type key struct{ agency, sub string }
+	rows := map[key]*AgencySize{}
+	first, last := "", ""
+	var mu sync.Mutex
+	var g errgroup.Group
+	g.SetLimit(2) // whole titles are parsed at once
+	for _, t := range titles {
+		g.Go(func() error {
+			doc, err := api.Document(ctx, t.Number, t.UpToDateAsOf, ecfr.Hierarchy{})
+			if err != nil {
+				return fmt.Errorf("title %d: %w", t.Number, err)
+			}
+			words := core.PartWords(doc.Root())
+			versions, err := api.Versions(ctx, t.Number, ecfr.Hierarchy{})
+			if err != nil {
+				return fmt.Errorf("title %d: %w", t.Number, err)
+			}
+			slog.Info("measured title", titleAttr(t.Number), "name", t.Name, "parts", len(words), "versions", len(versions))
+
+			mu.Lock()
+			defer mu.Unlock()
+			row := func(part string) *AgencySize {
+				o := own.lookup(t.Number, part)
+				k := key{o.Agency, ""}
+				if *sub {
+					k.sub = o.SubAgency
+				}
+				if k.agency == "" {
+					k.agency = unowned
+				}
+				if rows[k] == nil {
+					rows[k] = &AgencySize{Agency: k.agency, SubAgency: k.sub}
+				}
+				return rows[k]
+			}
+			for part, n := range words {
+				if part == "" {
+					continue // front matter outside any part
+				}
+				r := row(part)
+				r.Parts++
+				if !cfg.isTable(t.Number, part) {
+					r.Words += n
+				}
+			}
+			for _, v := range versions {
+				if !v.Substantive || (*since != "" && v.Date < *since) {
+					continue
+				}
+				row(v.Part).Versions++
+				if first == "" || v.Date < first {
+					first = v.Date
+				}
+				last = max(last, v.Date)
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	years := 1.0
+	if *since != "" {
+		first = *since
+	}
+	from, err1 := time.Parse("2006-01-02", first)
+	to, err2 := time.Parse("2006-01-02", last)
+	if err1 == nil && err2 == nil && to.After(from) {
+		years = to.Sub(from).Hours() / 24 / 365.25
+	}
+	out := make([]AgencySize, 0, len(rows))
+	for _, r := range rows {
+		r.PerYear = float64(r.Versions) / years
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		switch {
+		case *sortBy == "words" && a.Words != b.Words:
+			return a.Words > b.Words
+		case *sortBy == "versions" && a.Versions != b.Versions:
+			return a.Versions > b.Versions
+		case a.Agency != b.Agency:
+			return a.Agency < b.Agency
+		}
+		return a.SubAgency < b.SubAgency
+	})
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, r := range out {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	header := "Agency\tParts\tWords\tVersions\tPerYear"
+	if *sub {
+		header = "Agency\tSubAgency\tParts\tWords\tVersions\tPerYear"
+	}
+	fmt.Fprintln(w, header)
+	for _, r := range out {
+		name := r.Agency
+		if *sub {
+			name += "\t" + r.SubAgency
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.1f\n", name, r.Parts, r.Words, r.Versions, r.PerYear)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// newAPI returns a versioner API client sending requests through d, at the
+// config's api_version, warning once per endpoint if the API says that
+// version is deprecated.
+func newAPI(d ecfr.Doer) *ecfr.Client {
+	return ecfr.NewClient(d, ecfr.WithAPIVersion(cfg.APIVersion), ecfr.WithDeprecationHandler(warnDeprecated))
+}
+
+// deprecationWarned holds the endpoints warnDeprecated has warned about.
+var deprecationWarned sync.Map
+
+func warnDeprecated(endpoint string, d *ecfr.Deprecation) {
+	if _, dup := deprecationWarned.LoadOrStore(endpoint, true); dup {
+		return
+	}
+	attrs := []any{"endpoint", endpoint, "url", d.URL}
+	for _, kv := range [][2]string{{"deprecation", d.Deprecated}, {"sunset", d.Sunset}, {"successor", d.Successor}, {"warning", d.Warning}} {
+		if kv[1] != "" {
+			attrs = append(attrs, kv[0], kv[1])
+		}
+	}
+	slog.Warn("ecfr: API version is deprecated; set api_version in -config to move to its successor", attrs...)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// archiveIndex is the file in an archive directory listing what it holds.
+const archiveIndex = "index.ndjson"
+
+// ArchiveEntry is one line of an archive's index: a part as it stood on a
+// date, rendered to PDF/A and stored under the SHA-256 of the PDF.
+type ArchiveEntry struct {
+	Title        int    `json:"title"`
+	Part         string `json:"part"`
+	Date         string `json:"date"`
+	SHA256       string `json:"sha256"` // of the PDF, stored at objects/<first 2>/<sha256>.pdf
+	Bytes        int64  `json:"bytes"`
+	SourceURL    string `json:"source_url"`
+	SourceSHA256 string `json:"source_sha256"`
+	Archived     string `json:"archived"` // RFC 3339
+}
+
+// Archive is a content-addressed store of part PDFs for records retention.
+// Objects are only ever added, and the index is appended to, so an archive
+// can be replicated with rsync or written to WORM storage.
+type Archive struct {
+	Dir  string
+	Font *trueTypeFont
+
+	entries map[string]ArchiveEntry // title/part/date -> entry
+}
+
+// objectPath returns where the PDF with the given hash is stored.
+func (a *Archive) objectPath(sum string) string {
+	return filepath.Join(a.Dir, "objects", sum[:2], sum+".pdf")
+}
+
+// OpenArchive loads the index of the archive in dir, creating the
+// directory if needed.
+func OpenArchive(dir string, font *trueTypeFont) (*Archive, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "objects"), 0o755); err != nil {
+		return nil, err
+	}
+	a := &Archive{Dir: dir, Font: font, entries: map[string]ArchiveEntry{}}
+	f, err := os.Open(filepath.Join(dir, archiveIndex))
+	if errors.Is(err, os.ErrNotExist) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for dec.More() {
+		var e ArchiveEntry
+		if err := dec.Decode(&e); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name(), err)
+		}
+		a.entries[archiveKey(e.Title, e.Part, e.Date)] = e
+	}
+	return a, nil
+}
+
+func archiveKey(title int, part, date string) string {
+	return fmt.Sprintf("%d/%s/%s", title, part, date)
+}
+
+// Add renders part of title as it stood on date and stores it, unless the
+// archive already has it. It reports whether anything was added.
+func (a *Archive) Add(ctx context.Context, c httpclient, title int, part, date string) (ArchiveEntry, bool, error) {
+	if e, ok := a.entries[archiveKey(title, part, date)]; ok {
+		return e, false, nil
+	}
+	api := newAPI(c)
+	h := ecfr.Hierarchy{Part: part}
+	body, err := api.Open(ctx, title, date, h)
+	if err != nil {
+		return ArchiveEntry{}, false, err
+	}
+	src, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return ArchiveEntry{}, false, err
+	}
+	srcSum := sha256.Sum256(src)
+	now := time.Now().UTC()
+	meta := pdfMeta{
+		Title:        fmt.Sprintf("%s as of %s", citation(title, part, ""), date),
+		SourceURL:    api.FullURL(title, date, h),
+		SourceSHA256: hex.EncodeToString(srcSum[:]),
+		SnapshotDate: date,
+		Retrieved:    now,
+	}
+	var pdf bytes.Buffer
+	footer := fmt.Sprintf("eCFR text as of %s, retrieved %s, source SHA-256 %s", date, now.Format("2006-01-02"), meta.SourceSHA256[:16])
+	text := core.PlainText(io.NopCloser(bytes.NewReader(src)))
+	if err := writePDFA(&pdf, citation(title, part, ""), footer, text, a.Font, meta); err != nil {
+		return ArchiveEntry{}, false, err
+	}
+	sum := sha256.Sum256(pdf.Bytes())
+	e := ArchiveEntry{Title: title, Part: part, Date: date, SHA256: hex.EncodeToString(sum[:]), Bytes: int64(pdf.Len()),
+		SourceURL: meta.SourceURL, SourceSHA256: meta.SourceSHA256, Archived: now.Format(time.RFC3339)}
+	if err := a.store(e.SHA256, pdf.Bytes()); err != nil {
+		return ArchiveEntry{}, false, err
+	}
+	// the object is in place before the index names it
+	idx, err := os.OpenFile(filepath.Join(a.Dir, archiveIndex), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return ArchiveEntry{}, false, err
+	}
+	defer idx.Close()
+	if err := json.NewEncoder(idx).Encode(e); err != nil {
+		return ArchiveEntry{}, false, err
+	}
+	if err := idx.Close(); err != nil {
+		return ArchiveEntry{}, false, err
+	}
+	a.entries[archiveKey(title, part, date)] = e
+	return e, true, nil
+}
+
+// store writes an object unless one with the same hash exists.
+func (a *Archive) store(sum string, b []byte) error {
+	path := a.objectPath(sum)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), tempPrefix+sum+"-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o444)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// runArchive renders parts to PDF/A on each date they changed and stores
+// them in a content-addressed archive (see Archive), each with its source
+// URL, the source's SHA-256 and the retrieval time in its XMP metadata.
+// Dates already archived are skipped, so it can run on a schedule; watch
+// --archive does the same as amendments arrive.
+//
+//	efcr archive --font /usr/share/fonts/truetype/dejavu/DejaVuSans.ttf --part 40/60 --part 40/63 --since 2020-01-01
+func runArchive(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("archive", flag.ExitOnError)
+	dir := fs.String("dir", "archive", "archive directory")
+	fontPath := fs.String("font", "", "TrueType font to embed, as PDF/A requires, e.g. DejaVuSans.ttf")
+	var parts stringsFlag
+	fs.Var(&parts, "part", "TITLE/PART to archive (repeatable)")
+	since := fs.String("since", "", "only archive dates on or after this date YYYY-MM-DD")
+	until := fs.String("until", "", "only archive dates on or before this date YYYY-MM-DD")
+	fs.Parse(args)
+	if *fontPath == "" || len(parts) == 0 {
+		return errors.New("usage: archive --font file.ttf --part title/part… [--dir archive] [--since date] [--until date]")
+	}
+	font, err := loadTrueType(*fontPath)
+	if err != nil {
+		return err
+	}
+	var scopes []scope
+	for _, p := range parts {
+		title, part, ok := strings.Cut(p, "/")
+		n, err := strconv.Atoi(title)
+		if err != nil || !ok || part == "" {
+			return fmt.Errorf("bad --part %q: want TITLE/PART, e.g. 40/60", p)
+		}
+		scopes = append(scopes, scope{n, part})
+	}
+	archive, err := OpenArchive(*dir, font)
+	if err != nil {
+		return err
+	}
+	api := newAPI(c)
+	added := 0
+	for _, s := range scopes {
+		versions, err := api.Versions(ctx, s.title, ecfr.Hierarchy{Part: s.part})
+		if err != nil {
+			return fmt.Errorf("%s: %w", citation(s.title, s.part, ""), err)
+		}
+		dates := map[string]bool{}
+		for _, v := range versions {
+			if v.Substantive && (*since == "" || v.Date >= *since) && (*until == "" || v.Date <= *until) {
+				dates[v.Date] = true
+			}
+		}
+		var sorted []string
+		for d := range dates {
+			sorted = append(sorted, d)
+		}
+		sort.Strings(sorted)
+		for _, d := range sorted {
+			e, isNew, err := archive.Add(ctx, c, s.title, s.part, d)
+			if err != nil {
+				return fmt.Errorf("%s on %s: %w", citation(s.title, s.part, ""), d, err)
+			}
+			if isNew {
+				added++
+				slog.Info("archived", titleAttr(s.title), "part", s.part, dateAttr(d), "sha256", e.SHA256, "bytes", e.Bytes)
+			}
+		}
+	}
+	slog.Info("archive updated", "dir", *dir, "added", added, "held", len(archive.entries))
+	return nil
+}
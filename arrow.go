@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// Apache Arrow IPC stream output, for analysts who want to load millions of
+// rows into pandas, polars or R without parsing CSV. Like the PDF and EPUB
+// writers this is written out by hand: only the handful of column types
+// efcr produces are supported, and the FlatBuffers metadata is built by the
+// small forward-only encoder at the bottom of the file.
+//
+// A stream is a Schema message, any number of RecordBatch messages and an
+// end-of-stream marker; each message is its FlatBuffers metadata followed by
+// a body holding the column buffers.
+
+type arrowType byte
+
+const (
+	arrowInt32 arrowType = iota
+	arrowFloat64
+	arrowBool
+	arrowUtf8
+	arrowDate32 // days since the Unix epoch
+)
+
+type arrowField struct {
+	name     string
+	typ      arrowType
+	nullable bool
+}
+
+// arrowBatchRows is how many rows a writer buffers before emitting a batch.
+const arrowBatchRows = 64 << 10
+
+// arrowColumn accumulates one column of a record batch.
+type arrowColumn struct {
+	typ                     arrowType
+	n, nulls                int
+	validity, data, offsets []byte
+}
+
+func newArrowColumn(t arrowType) *arrowColumn {
+	c := &arrowColumn{typ: t}
+	if t == arrowUtf8 {
+		c.offsets = binary.LittleEndian.AppendUint32(nil, 0)
+	}
+	return c
+}
+
+func setBit(bitmap []byte, i int, v bool) []byte {
+	if i/8 >= len(bitmap) {
+		bitmap = append(bitmap, 0)
+	}
+	if v {
+		bitmap[i/8] |= 1 << (i % 8)
+	}
+	return bitmap
+}
+
+func (c *arrowColumn) next(valid bool) {
+	c.validity = setBit(c.validity, c.n, valid)
+	if !valid {
+		c.nulls++
+	}
+	c.n++
+}
+
+func (c *arrowColumn) Int32(v int32) {
+	c.data = binary.LittleEndian.AppendUint32(c.data, uint32(v))
+	c.next(true)
+}
+
+func (c *arrowColumn) Float64(v float64) {
+	c.data = binary.LittleEndian.AppendUint64(c.data, math.Float64bits(v))
+	c.next(true)
+}
+
+func (c *arrowColumn) Bool(v bool) {
+	c.data = setBit(c.data, c.n, v)
+	c.next(true)
+}
+
+func (c *arrowColumn) String(s string) {
+	c.data = append(c.data, s...)
+	c.offsets = binary.LittleEndian.AppendUint32(c.offsets, uint32(len(c.data)))
+	c.next(true)
+}
+
+// Date appends a YYYY-MM-DD date, or null if s isn't one.
+func (c *arrowColumn) Date(s string) {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		c.Null()
+		return
+	}
+	c.data = binary.LittleEndian.AppendUint32(c.data, uint32(int32(t.Unix()/86400)))
+	c.next(true)
+}
+
+func (c *arrowColumn) Null() {
+	switch c.typ {
+	case arrowInt32, arrowDate32:
+		c.data = append(c.data, 0, 0, 0, 0)
+	case arrowFloat64:
+		c.data = append(c.data, 0, 0, 0, 0, 0, 0, 0, 0)
+	case arrowBool:
+		c.data = setBit(c.data, c.n, false)
+	case arrowUtf8:
+		c.offsets = binary.LittleEndian.AppendUint32(c.offsets, uint32(len(c.data)))
+	}
+	c.next(false)
+}
+
+// buffers lists the column's buffers in Arrow's order. The validity bitmap
+// may be empty when there are no nulls.
+func (c *arrowColumn) buffers() [][]byte {
+	validity := c.validity
+	if c.nulls == 0 {
+		validity = nil
+	}
+	if c.typ == arrowUtf8 {
+		return [][]byte{validity, c.offsets, c.data}
+	}
+	return [][]byte{validity, c.data}
+}
+
+// arrowWriter writes an IPC stream of rows with a fixed schema. Callers
+// append each row to Columns and call Row; batches are flushed as they fill.
+type arrowWriter struct {
+	w       io.Writer
+	fields  []arrowField
+	Columns []*arrowColumn
+	started bool
+}
+
+func newArrowWriter(w io.Writer, fields []arrowField) *arrowWriter {
+	aw := &arrowWriter{w: w, fields: fields}
+	aw.reset()
+	return aw
+}
+
+func (aw *arrowWriter) reset() {
+	aw.Columns = make([]*arrowColumn, len(aw.fields))
+	for i, f := range aw.fields {
+		aw.Columns[i] = newArrowColumn(f.typ)
+	}
+}
+
+// Row marks the end of a row, flushing a batch when enough have built up.
+func (aw *arrowWriter) Row() error {
+	if aw.Columns[0].n < arrowBatchRows {
+		return nil
+	}
+	return aw.flush()
+}
+
+// Close flushes buffered rows and ends the stream. It does not close the
+// underlying writer.
+func (aw *arrowWriter) Close() error {
+	if aw.Columns[0].n > 0 || !aw.started {
+		if err := aw.flush(); err != nil {
+			return err
+		}
+	}
+	_, err := aw.w.Write([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0})
+	return err
+}
+
+func (aw *arrowWriter) flush() error {
+	if !aw.started {
+		if err := aw.message(arrowSchemaMessage, aw.schema(), nil); err != nil {
+			return err
+		}
+		aw.started = true
+	}
+	n := aw.Columns[0].n
+	var nodes, bufs, body []byte
+	nbufs := 0
+	for _, c := range aw.Columns {
+		nodes = binary.LittleEndian.AppendUint64(nodes, uint64(n))
+		nodes = binary.LittleEndian.AppendUint64(nodes, uint64(c.nulls))
+		for _, b := range c.buffers() {
+			bufs = binary.LittleEndian.AppendUint64(bufs, uint64(len(body)))
+			bufs = binary.LittleEndian.AppendUint64(bufs, uint64(len(b)))
+			body = append(body, b...)
+			body = pad8(body)
+			nbufs++
+		}
+	}
+	batch := fbTable{
+		{slot: 0, scalar: le64(uint64(n))},
+		{slot: 1, ref: fbStructs{len(aw.Columns), nodes}},
+		{slot: 2, ref: fbStructs{nbufs, bufs}},
+	}
+	aw.reset()
+	return aw.message(arrowRecordBatchMessage, batch, body)
+}
+
+// Arrow FlatBuffers enum values (Schema.fbs, Message.fbs).
+const (
+	arrowMetadataV5         = 4
+	arrowSchemaMessage      = 1
+	arrowRecordBatchMessage = 3
+
+	arrowTypeInt           = 2
+	arrowTypeFloatingPoint = 3
+	arrowTypeUtf8          = 5
+	arrowTypeBool          = 6
+	arrowTypeDate          = 8
+
+	arrowPrecisionDouble = 2
+	arrowDateUnitDay     = 0
+)
+
+func (aw *arrowWriter) schema() fbTable {
+	var fields fbVector
+	for _, f := range aw.fields {
+		var id byte
+		var typ fbTable
+		switch f.typ {
+		case arrowInt32:
+			id, typ = arrowTypeInt, fbTable{{slot: 0, scalar: le32(32)}, {slot: 1, scalar: []byte{1}}}
+		case arrowFloat64:
+			id, typ = arrowTypeFloatingPoint, fbTable{{slot: 0, scalar: le16(arrowPrecisionDouble)}}
+		case arrowBool:
+			id, typ = arrowTypeBool, fbTable{}
+		case arrowUtf8:
+			id, typ = arrowTypeUtf8, fbTable{}
+		case arrowDate32:
+			id, typ = arrowTypeDate, fbTable{{slot: 0, scalar: le16(arrowDateUnitDay)}}
+		}
+		nullable := byte(0)
+		if f.nullable {
+			nullable = 1
+		}
+		fields = append(fields, fbTable{
+			{slot: 0, ref: fbString(f.name)},
+			{slot: 1, scalar: []byte{nullable}},
+			{slot: 2, scalar: []byte{id}},
+			{slot: 3, ref: typ},
+			{slot: 5, ref: fbVector{}}, // children; readers insist it is present
+		})
+	}
+	return fbTable{{slot: 1, ref: fields}}
+}
+
+// message writes one encapsulated message: continuation marker, metadata
+// length, Message flatbuffer padded to 8 bytes, then the body.
+func (aw *arrowWriter) message(kind byte, header fbTable, body []byte) error {
+	meta := fbFinish(fbTable{
+		{slot: 0, scalar: le16(arrowMetadataV5)},
+		{slot: 1, scalar: []byte{kind}},
+		{slot: 2, ref: header},
+		{slot: 3, scalar: le64(uint64(len(body)))},
+	})
+	meta = pad8(meta)
+	prefix := append([]byte{0xff, 0xff, 0xff, 0xff}, le32(uint32(len(meta)))...)
+	for _, b := range [][]byte{prefix, meta, body} {
+		if _, err := aw.w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func pad8(b []byte) []byte {
+	for len(b)%8 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func le16(v uint16) []byte { return binary.LittleEndian.AppendUint16(nil, v) }
+func le32(v uint32) []byte { return binary.LittleEndian.AppendUint32(nil, v) }
+func le64(v uint64) []byte { return binary.LittleEndian.AppendUint64(nil, v) }
+
+var factArrowFields = []arrowField{
+	{"title", arrowInt32, false},
+	{"chapter", arrowUtf8, false},
+	{"part", arrowUtf8, false},
+	{"section", arrowUtf8, false},
+	{"agency", arrowUtf8, false},
+	{"date", arrowDate32, true},
+	{"metric", arrowUtf8, false},
+	{"value", arrowFloat64, false},
+}
+
+// writeFactsArrow is writeFacts for --facts-format arrow.
+func writeFactsArrow(path string, facts []Fact) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	aw := newArrowWriter(w, factArrowFields)
+	for _, fact := range facts {
+		c := aw.Columns
+		c[0].Int32(int32(fact.Title))
+		c[1].String(fact.Chapter)
+		c[2].String(fact.Part)
+		c[3].String(fact.Section)
+		c[4].String(fact.Agency)
+		c[5].Date(fact.Date)
+		c[6].String(fact.Metric)
+		c[7].Float64(fact.Value)
+		if err := aw.Row(); err != nil {
+			return err
+		}
+	}
+	if err := aw.Close(); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+var versionArrowFields = []arrowField{
+	{"date", arrowDate32, true},
+	{"amendment_date", arrowDate32, true},
+	{"issue_date", arrowDate32, true},
+	{"identifier", arrowUtf8, false},
+	{"name", arrowUtf8, false},
+	{"part", arrowUtf8, false},
+	{"substantive", arrowBool, false},
+	{"removed", arrowBool, false},
+	{"subpart", arrowUtf8, true},
+	{"title", arrowUtf8, false},
+	{"type", arrowUtf8, false},
+}
+
+// writeVersionsArrow writes versions as an Arrow stream.
+func writeVersionsArrow(w io.Writer, versions []ecfr.Version) error {
+	aw := newArrowWriter(w, versionArrowFields)
+	for _, v := range versions {
+		c := aw.Columns
+		c[0].Date(v.Date)
+		c[1].Date(v.AmendmentDate)
+		c[2].Date(v.IssueDate)
+		c[3].String(v.Identifier)
+		c[4].String(v.Name)
+		c[5].String(v.Part)
+		c[6].Bool(v.Substantive)
+		c[7].Bool(v.Removed)
+		if v.Subpart != nil {
+			c[8].String(*v.Subpart)
+		} else {
+			c[8].Null()
+		}
+		c[9].String(v.Title)
+		c[10].String(v.Type)
+		if err := aw.Row(); err != nil {
+			return err
+		}
+	}
+	return aw.Close()
+}
+
+// A minimal FlatBuffers encoder. Objects are laid out front to back with
+// every child after the object that refers to it, so offsets are always
+// forward as the format requires. Tables start 8-byte aligned, which keeps
+// each scalar aligned to its size.
+
+type fbObject interface {
+	writeTo(b *fbBuf) int // returns the position references point at
+}
+
+type fbBuf struct{ buf []byte }
+
+func (b *fbBuf) align(n int) {
+	for len(b.buf)%n != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+// patch stores at position at the forward offset to target.
+func (b *fbBuf) patch(at, target int) {
+	binary.LittleEndian.PutUint32(b.buf[at:], uint32(target-at))
+}
+
+// fbField is a table field: a little-endian scalar of 1, 2, 4 or 8 bytes,
+// or a reference to another object.
+type fbField struct {
+	slot   int
+	scalar []byte
+	ref    fbObject
+}
+
+type fbTable []fbField
+
+func (t fbTable) writeTo(b *fbBuf) int {
+	offsets := make([]int, len(t))
+	size, slots := 4, 0 // the table starts with its vtable offset
+	for i, f := range t {
+		n := len(f.scalar)
+		if f.ref != nil {
+			n = 4
+		}
+		for size%n != 0 {
+			size++
+		}
+		offsets[i] = size
+		size += n
+		slots = max(slots, f.slot+1)
+	}
+	vtable := make([]uint16, 2+slots)
+	vtable[0], vtable[1] = uint16(len(vtable)*2), uint16(size)
+	for i, f := range t {
+		vtable[2+f.slot] = uint16(offsets[i])
+	}
+	b.align(2)
+	vt := len(b.buf)
+	for _, v := range vtable {
+		b.buf = binary.LittleEndian.AppendUint16(b.buf, v)
+	}
+	b.align(8)
+	start := len(b.buf)
+	b.buf = append(b.buf, make([]byte, size)...)
+	binary.LittleEndian.PutUint32(b.buf[start:], uint32(int32(start-vt)))
+	for i, f := range t {
+		copy(b.buf[start+offsets[i]:], f.scalar)
+	}
+	for i, f := range t {
+		if f.ref != nil {
+			b.patch(start+offsets[i], f.ref.writeTo(b))
+		}
+	}
+	return start
+}
+
+type fbString string
+
+func (s fbString) writeTo(b *fbBuf) int {
+	b.align(4)
+	pos := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(s)))
+	b.buf = append(append(b.buf, s...), 0)
+	return pos
+}
+
+// fbVector is a vector of tables or strings.
+type fbVector []fbObject
+
+func (v fbVector) writeTo(b *fbBuf) int {
+	b.align(4)
+	pos := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(v)))
+	b.buf = append(b.buf, make([]byte, 4*len(v))...)
+	for i, o := range v {
+		b.patch(pos+4+4*i, o.writeTo(b))
+	}
+	return pos
+}
+
+// fbStructs is a vector of n inline structs whose fields are 8 bytes wide,
+// placed so the structs themselves are 8-byte aligned.
+type fbStructs struct {
+	n    int
+	data []byte
+}
+
+func (v fbStructs) writeTo(b *fbBuf) int {
+	b.align(4)
+	if len(b.buf)%8 == 0 {
+		b.buf = append(b.buf, 0, 0, 0, 0)
+	}
+	pos := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(v.n))
+	b.buf = append(b.buf, v.data...)
+	return pos
+}
+
+// fbFinish encodes root as a complete flatbuffer.
+func fbFinish(root fbTable) []byte {
+	b := &fbBuf{buf: make([]byte, 4)}
+	binary.LittleEndian.PutUint32(b.buf, uint32(root.writeTo(b)))
+	return b.buf
+}
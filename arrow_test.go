@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFactsArrowGolden(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "facts.arrow")
+	if err := writeFactsArrow(path, testFacts); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "facts.arrow", b)
+}
+
+func TestVersionsArrowGolden(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeVersionsArrow(&b, testVersions); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "versions.arrow", b.Bytes())
+}
+
+// An empty stream still carries its schema, so readers know the columns.
+func TestArrowEmptyStream(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeVersionsArrow(&b, nil); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "versions-empty.arrow", b.Bytes())
+}
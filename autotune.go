@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/paulgmiller/efcr/pipeline"
+)
+
+// WorkerTuner adjusts a running pipeline's worker counts so --workers needn't
+// be tuned by hand. Snapshots are fetched under one limit and parsed and
+// analyzed under another, and every Interval each is nudged by one:
+//
+//   - parse workers grow while snapshots queue for them and the CPU has
+//     room, and shrink once it is saturated, where more only costs memory;
+//   - fetch workers shrink while they mostly sit waiting on the rate
+//     limiter, and otherwise grow while snapshots queue for them and
+//     throughput keeps up, stepping back when a step made it worse.
+type WorkerTuner struct {
+	Interval time.Duration
+	Max      int // upper bound for either count
+	// RateWait, when set, returns the total time requests have spent
+	// waiting on the rate limiter so far.
+	RateWait func() time.Duration
+
+	done atomic.Int64 // snapshots finished
+}
+
+func NewWorkerTuner(rateWait func() time.Duration) *WorkerTuner {
+	return &WorkerTuner{Interval: 5 * time.Second, Max: 8 * maxWorkers, RateWait: rateWait}
+}
+
+// Finished counts one processed snapshot towards throughput.
+func (t *WorkerTuner) Finished() {
+	t.done.Add(1)
+}
+
+// Tune tunes fetch and parse until ctx is done.
+func (t *WorkerTuner) Tune(ctx context.Context, fetch, parse *pipeline.Limiter) {
+	tick := time.NewTicker(t.Interval)
+	defer tick.Stop()
+	rateWait := func() time.Duration {
+		if t.RateWait == nil {
+			return 0
+		}
+		return t.RateWait()
+	}
+	lastCPU, cpuErr := processCPU()
+	lastWait, lastDone, lastAt := rateWait(), t.done.Load(), time.Now()
+	var lastRate float64
+	grew := false // the last fetch change was a step up
+	for {
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+		now := time.Now()
+		elapsed := now.Sub(lastAt)
+		done, wait := t.done.Load(), rateWait()
+		rate := float64(done-lastDone) / elapsed.Seconds()
+		cpu := -1.0 // unknown
+		if c, err := processCPU(); err == nil && cpuErr == nil {
+			cpu = float64(c-lastCPU) / (elapsed.Seconds() * float64(runtime.GOMAXPROCS(0)) * float64(time.Second))
+			lastCPU = c
+		}
+
+		p0, pWaiting := parse.State()
+		p := p0
+		switch {
+		case cpu > 0.95 && p > 1:
+			p--
+		case pWaiting > 0 && cpu >= 0 && cpu < 0.8 && p < t.Max:
+			p++
+		}
+
+		f0, fWaiting := fetch.State()
+		f := f0
+		blocked := float64(wait-lastWait) / (elapsed.Seconds() * float64(f) * float64(time.Second))
+		switch {
+		case blocked > 0.5 && f > 1:
+			f--
+			grew = false
+		case grew && rate < lastRate*0.95 && f > 1:
+			f--
+			grew = false
+		case fWaiting > 0 && pWaiting == 0 && f < t.Max:
+			f++
+			grew = true
+		default:
+			grew = false
+		}
+
+		if p != p0 || f != f0 {
+			slog.Info("workers", "fetch", f, "parse", p, "snapshots_per_second", fmt.Sprintf("%.1f", rate),
+				"cpu", formatCPU(cpu), "rate_limited", fmt.Sprintf("%.0f%%", blocked*100))
+			parse.SetLimit(p)
+			fetch.SetLimit(f)
+		}
+		lastWait, lastDone, lastAt, lastRate = wait, done, now, rate
+	}
+}
+
+func formatCPU(util float64) string {
+	if util < 0 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%.0f%%", util*100)
+}
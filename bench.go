@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// BenchResult is one benchmark's throughput, as printed and saved by
+// `efcr bench`.
+type BenchResult struct {
+	Name        string  `json:"name"`
+	NsPerOp     int64   `json:"ns_per_op"`
+	MBPerSec    float64 `json:"mb_per_s,omitempty"`
+	Rate        float64 `json:"rate,omitempty"` // Unit per second
+	Unit        string  `json:"unit,omitempty"`
+	AllocsPerOp int64   `json:"allocs_per_op"`
+}
+
+// benchmark measures fn, which processes doc once per b.N; bytes and items
+// (of unit) are how much one iteration gets through.
+type benchmark struct {
+	name  string
+	bytes int64
+	items int
+	unit  string
+	fn    func(b *testing.B)
+}
+
+// benchFixture generates a title-shaped document of parts parts, ten
+// sections each, from a fixed seed so every run measures the same input.
+// Paragraph text is drawn from legal boilerplate with the usual nesting
+// markers, a table now and then, and the cross references and deadlines
+// the extractors look for.
+func benchFixture(parts int) []byte {
+	words := strings.Fields(`the of and to in a or shall be any by for this section under such
+		as with not may that is agency Administrator each than person other part applicable
+		within days after date requirements provided except unless if paragraph subpart
+		report information submit notice approval required accordance standards emission
+		facility owner operator permit State program written request public determination`)
+	r := rand.New(rand.NewPCG(40, 1))
+	sentence := func(n int) string {
+		s := make([]string, n)
+		for i := range s {
+			s[i] = words[r.IntN(len(words))]
+		}
+		return strings.Join(s, " ")
+	}
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<DIV1 N="40" NODE="40:1" TYPE="TITLE"><HEAD>Title 40—Protection of Environment</HEAD>` + "\n")
+	b.WriteString(`<DIV3 N="I" NODE="40:1.0.1" TYPE="CHAPTER"><HEAD>CHAPTER I—ENVIRONMENTAL PROTECTION AGENCY</HEAD>` + "\n")
+	for p := 1; p <= parts; p++ {
+		fmt.Fprintf(&b, `<DIV5 N="%d" NODE="40:1.0.1.%d" TYPE="PART"><HEAD>PART %d—%s</HEAD>`+"\n", p, p, p, strings.ToUpper(sentence(4)))
+		for s := 1; s <= 10; s++ {
+			fmt.Fprintf(&b, `<DIV8 N="%d.%d" NODE="40:1.0.1.%d.0.1.%d" TYPE="SECTION"><HEAD>§ %d.%d %s.</HEAD>`+"\n", p, s, p, s, p, s, sentence(5))
+			for i, marker := range []string{"(a)", "(1)", "(i)", "(ii)", "(2)", "(b)"} {
+				fmt.Fprintf(&b, "<P>%s %s", marker, sentence(20+r.IntN(60)))
+				switch i {
+				case 1:
+					fmt.Fprintf(&b, " as described in § %d.%d of this part", 1+r.IntN(parts), 1+r.IntN(10))
+				case 3:
+					fmt.Fprintf(&b, " within %d days after receipt of the request", 10*(1+r.IntN(9)))
+				}
+				b.WriteString(".</P>\n")
+			}
+			if s%4 == 0 {
+				b.WriteString(`<GPOTABLE COLS="3"><BOXHD><CHED H="1">Pollutant</CHED><CHED H="1">Limit</CHED><CHED H="1">Units</CHED></BOXHD>`)
+				for row := 0; row < 8; row++ {
+					fmt.Fprintf(&b, "<ROW><ENT>%s</ENT><ENT>%d.%d</ENT><ENT>mg/dscm</ENT></ROW>", words[r.IntN(len(words))], r.IntN(100), r.IntN(10))
+				}
+				b.WriteString("</GPOTABLE>\n")
+			}
+			fmt.Fprintf(&b, "<CITA>[%d FR %d, %s]</CITA>\n</DIV8>\n", 50+r.IntN(40), r.IntN(60000), "Jan. 1, 2020")
+		}
+		b.WriteString("</DIV5>\n")
+	}
+	b.WriteString("</DIV3>\n</DIV1>\n")
+	return b.Bytes()
+}
+
+// benchmarks builds the suite over doc.
+func benchmarks(doc []byte) ([]benchmark, error) {
+	f, err := core.ParseFile(bytes.NewReader(doc))
+	if err != nil {
+		return nil, fmt.Errorf("parse fixture: %w", err)
+	}
+	root := f.Root()
+	var sections []*core.Div
+	core.WalkSections(root, func(s *core.Div) { sections = append(sections, s) })
+	if len(sections) == 0 {
+		return nil, fmt.Errorf("document has no sections")
+	}
+
+	// each section diffed against a copy with every 50th token changed and
+	// every 97th dropped, roughly what an amendment looks like
+	type pair struct{ a, b []string }
+	pairs := make([]pair, len(sections))
+	for i, s := range sections {
+		a := core.DivTokens(s)
+		var b []string
+		for j, t := range a {
+			switch {
+			case j%97 == 96:
+			case j%50 == 49:
+				b = append(b, t+"ed")
+			default:
+				b = append(b, t)
+			}
+		}
+		pairs[i] = pair{a, b}
+	}
+
+	// a year of monthly snapshots of per-section word counts
+	var facts []Fact
+	for m := 1; m <= 12; m++ {
+		date := fmt.Sprintf("2024-%02d-01", m)
+		for _, s := range sections {
+			part, _, _ := strings.Cut(s.N, ".")
+			facts = append(facts, Fact{Title: 40, Part: part, Section: s.N, Date: date, Metric: "words", Value: float64(len(core.DivTokens(s)))})
+		}
+	}
+	byPartQuarter := Rollup{GroupBy: []string{"part"}}
+	if byPartQuarter.Bucket, err = binBucket("quarter"); err != nil {
+		return nil, err
+	}
+
+	size := int64(len(doc))
+	return []benchmark{
+		{"plaintext", size, len(sections), "sections", func(b *testing.B) {
+			for range b.N {
+				if _, err := core.CountWords(core.PlainText(io.NopCloser(bytes.NewReader(doc)))); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}},
+		{"count", size, len(sections), "sections", func(b *testing.B) {
+			for range b.N {
+				if _, err := core.CountXMLWords(bytes.NewReader(doc)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}},
+		{"parse", size, len(sections), "sections", func(b *testing.B) {
+			for range b.N {
+				if _, err := core.ParseFile(bytes.NewReader(doc)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}},
+		{"tokenize", 0, len(sections), "sections", func(b *testing.B) {
+			for range b.N {
+				core.DivTokens(root)
+			}
+		}},
+		{"diff", 0, len(sections), "sections", func(b *testing.B) {
+			for range b.N {
+				for _, p := range pairs {
+					core.DiffTokens(p.a, p.b)
+				}
+			}
+		}},
+		{"rollup", 0, len(facts), "facts", func(b *testing.B) {
+			for range b.N {
+				if _, err := byPartQuarter.Run(facts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}},
+	}, nil
+}
+
+// runBench times the hot paths over a generated fixture or a real title,
+// and optionally fails when they got slower than a saved baseline. Over the
+// default fixture it runs the same suite as `go test -bench .`.
+//
+//	efcr bench --save bench.json
+//	efcr bench --baseline bench.json --max-regression 0.1
+//	efcr bench --title 40 --date 2024-01-01 --run 'parse|plaintext'
+func runBench(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	parts := fs.Int("parts", 60, "parts in the generated fixture, ten sections each")
+	docPath := fs.String("doc", "", "benchmark this XML file instead of the fixture")
+	title := fs.Int("title", 0, "benchmark this title's full text (with --date) instead of the fixture")
+	date := fs.String("date", "", "snapshot date for --title, YYYY-MM-DD")
+	run := fs.String("run", "", "only run benchmarks matching this regexp")
+	save := fs.String("save", "", "write results as JSON to this file")
+	baseline := fs.String("baseline", "", "compare with results saved by --save, failing on regressions")
+	maxRegression := fs.Float64("max-regression", 0.15, "with --baseline, the slowdown in ns/op tolerated, as a fraction")
+	fs.Parse(args)
+
+	var doc []byte
+	var err error
+	switch {
+	case *docPath != "":
+		doc, err = os.ReadFile(*docPath)
+	case *title != 0:
+		if *date == "" {
+			return fmt.Errorf("--title needs --date")
+		}
+		var body io.ReadCloser
+		body, err = newAPI(c).Open(ctx, *title, *date, ecfr.Hierarchy{})
+		if err == nil {
+			doc, err = io.ReadAll(body)
+			body.Close()
+		}
+	default:
+		doc = benchFixture(*parts)
+	}
+	if err != nil {
+		return err
+	}
+	filter, err := regexp.Compile(*run)
+	if err != nil {
+		return fmt.Errorf("--run: %w", err)
+	}
+	suite, err := benchmarks(doc)
+	if err != nil {
+		return err
+	}
+
+	var results []BenchResult
+	fmt.Printf("Benchmark\tns/op\tMB/s\tRate\tallocs/op\n")
+	for _, bm := range suite {
+		if !filter.MatchString(bm.name) {
+			continue
+		}
+		r := testing.Benchmark(func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(bm.bytes)
+			bm.fn(b)
+		})
+		if r.N == 0 {
+			return fmt.Errorf("benchmark %s failed", bm.name)
+		}
+		res := BenchResult{Name: bm.name, NsPerOp: r.NsPerOp(), AllocsPerOp: r.AllocsPerOp(), Unit: bm.unit}
+		if bm.bytes > 0 {
+			res.MBPerSec = float64(bm.bytes) / 1e6 / r.T.Seconds() * float64(r.N)
+		}
+		res.Rate = float64(bm.items) / r.T.Seconds() * float64(r.N)
+		results = append(results, res)
+		mbs := "-"
+		if res.MBPerSec > 0 {
+			mbs = fmt.Sprintf("%.1f", res.MBPerSec)
+		}
+		fmt.Printf("%s\t%d\t%s\t%.0f %s/s\t%d\n", res.Name, res.NsPerOp, mbs, res.Rate, res.Unit, res.AllocsPerOp)
+	}
+
+	if *save != "" {
+		b, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*save, append(b, '\n'), 0o644); err != nil {
+			return err
+		}
+	}
+	if *baseline != "" {
+		return compareBench(*baseline, results, *maxRegression)
+	}
+	return nil
+}
+
+// compareBench is the regression gate: every benchmark in both runs must
+// be within tolerance of its baseline ns/op.
+func compareBench(path string, results []BenchResult, tolerance float64) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var base []BenchResult
+	if err := json.Unmarshal(b, &base); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	old := map[string]BenchResult{}
+	for _, r := range base {
+		old[r.Name] = r
+	}
+	var slower []string
+	for _, r := range results {
+		o, ok := old[r.Name]
+		if !ok || o.NsPerOp == 0 {
+			continue
+		}
+		change := float64(r.NsPerOp)/float64(o.NsPerOp) - 1
+		fmt.Printf("%s\t%+.1f%% vs baseline\n", r.Name, change*100)
+		if change > tolerance {
+			slower = append(slower, fmt.Sprintf("%s %+.1f%%", r.Name, change*100))
+		}
+	}
+	if len(slower) > 0 {
+		return fmt.Errorf("slower than %s by more than %.0f%%: %s", path, tolerance*100, strings.Join(slower, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+// fixtureSuite is the suite `efcr bench` runs by default, built once for
+// all the benchmarks below.
+var fixtureSuite = sync.OnceValues(func() ([]benchmark, error) {
+	return benchmarks(benchFixture(60))
+})
+
+// runSuite runs the named benchmark from the suite, reporting throughput
+// the way `efcr bench` does.
+func runSuite(b *testing.B, name string) {
+	suite, err := fixtureSuite()
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, bm := range suite {
+		if bm.name != name {
+			continue
+		}
+		b.ReportAllocs()
+		b.SetBytes(bm.bytes)
+		b.ResetTimer()
+		bm.fn(b)
+		b.ReportMetric(float64(bm.items)*float64(b.N)/b.Elapsed().Seconds(), bm.unit+"/s")
+		return
+	}
+	b.Fatalf("no benchmark %q in the suite", name)
+}
+
+func BenchmarkPlainText(b *testing.B) { runSuite(b, "plaintext") }
+func BenchmarkCount(b *testing.B)     { runSuite(b, "count") }
+func BenchmarkParse(b *testing.B)     { runSuite(b, "parse") }
+func BenchmarkTokenize(b *testing.B)  { runSuite(b, "tokenize") }
+func BenchmarkDiff(b *testing.B)      { runSuite(b, "diff") }
+func BenchmarkRollup(b *testing.B)    { runSuite(b, "rollup") }
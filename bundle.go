@@ -0,0 +1,443 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	bundleSchema   = "efcr-bundle"
+	bundleVersion  = 2 // v2: members are cache files as stored, usually gzipped
+	bundleManifest = "bundle.json"
+)
+
+// BundleEntry describes one cached response in a bundle.
+type BundleEntry struct {
+	Key    string `json:"key"` // cache file name, sha256 of URL
+	URL    string `json:"url,omitempty"`
+	SHA256 string `json:"sha256"` // of the content, not the stored file
+	Bytes  int64  `json:"bytes"`
+}
+
+// BundleManifest is the first member of every bundle, so importers can
+// verify each body against it as it streams past.
+type BundleManifest struct {
+	Schema      string    `json:"schema"`
+	Version     int       `json:"version"`
+	ToolVersion string    `json:"tool_version"`
+	Created     time.Time `json:"created"`
+	Titles      []int     `json:"titles,omitempty"` // empty means everything
+	// Base is the creation time of the bundle a delta was cut against.
+	// Deltas import like any bundle; apply them in order after their base.
+	Base    *time.Time    `json:"base,omitempty"`
+	Entries []BundleEntry `json:"entries"`
+}
+
+// delta drops every entry base already has with the same content.
+func (m *BundleManifest) delta(base *BundleManifest) {
+	have := map[string]string{}
+	for _, e := range base.Entries {
+		have[e.Key] = e.SHA256
+	}
+	kept := m.Entries[:0]
+	for _, e := range m.Entries {
+		if have[e.Key] != e.SHA256 {
+			kept = append(kept, e)
+		}
+	}
+	m.Entries = kept
+	created := base.Created
+	m.Base = &created
+}
+
+// runCache manages the response cache as a whole.
+//
+//	efcr cache export [--titles 6,7] --out bundle.tar.gz [--manifest-out bundle.json]
+//	efcr cache export --since last.json --out delta.tar.gz
+//	efcr cache import bundle.tar.gz
+//	efcr cache import --manifest https://example.org/ecfr.json https://example.org/ecfr.tar.gz
+//	efcr cache purge [--all]
+//	efcr cache compress
+//	efcr cache ls [--titles 40] [--expired] [--sort url|fetched|size] [--json]
+//
+// Importing from a URL downloads over plain HTTP with no rate limit: a
+// bundle is one static file, not the eCFR API. Publishing the manifest
+// separately (--manifest-out) lets importers pin the hashes they trust
+// before fetching the much larger bundle.
+//
+// Bundles are gzip-compressed tarballs: a bundle.json manifest followed by
+// one member per cached body. gzip rather than zstd keeps efcr free of
+// dependencies outside the standard library.
+func runCache(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("cache: want export, import, purge, compress or ls")
+	}
+	if *cacheStore != "" {
+		return fmt.Errorf("cache: manages the cache directory, not -cache-store %s", *cacheStore)
+	}
+	switch args[0] {
+	case "import", "purge", "compress":
+		if *readOnly {
+			return fmt.Errorf("cache %s writes the cache; it can't run with -read-only", args[0])
+		}
+	}
+	switch args[0] {
+	case "export":
+		return runCacheExport(ctx, args[1:])
+	case "import":
+		return runCacheImport(ctx, args[1:])
+	case "purge":
+		return runCachePurge(args[1:])
+	case "compress":
+		return runCacheCompress()
+	case "ls":
+		return runCacheLs(args[1:])
+	}
+	return fmt.Errorf("cache: unknown subcommand %q (export|import|purge|compress|ls)", args[0])
+}
+
+func runCacheExport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("cache export", flag.ExitOnError)
+	titles := fs.String("titles", "", "comma separated title numbers to include (default all)")
+	out := fs.String("out", "bundle.tar.gz", "bundle file to write")
+	manifestOut := fs.String("manifest-out", "", "also write the bundle manifest here, for publishing next to the bundle")
+	since := fs.String("since", "", "write a delta: only entries missing from or changed since this manifest or bundle (path or URL)")
+	fs.Parse(args)
+	want, err := parseTitles(*titles)
+	if err != nil {
+		return err
+	}
+
+	m, err := scanCache(cacheDir, want)
+	if err != nil {
+		return err
+	}
+	if *since != "" {
+		base, err := loadManifest(ctx, *since)
+		if err != nil {
+			return err
+		}
+		m.delta(base)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := writeBundle(f, m); err != nil {
+		return err
+	}
+	slog.Info("exported bundle", "entries", len(m.Entries), "path", *out)
+	if *manifestOut != "" {
+		meta, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*manifestOut, meta, 0o644); err != nil {
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// urlTitlePattern finds the title number in eCFR API URLs.
+var urlTitlePattern = regexp.MustCompile(`/title-(\d+)\b`)
+
+// cacheKeyPattern matches what cacheKey produces, the only names a bundle
+// may give its members.
+var cacheKeyPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+func parseTitles(s string) (map[int]bool, error) {
+	if s == "" {
+		return nil, nil
+	}
+	want := map[int]bool{}
+	for _, f := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return nil, fmt.Errorf("--titles: %w", err)
+		}
+		want[n] = true
+	}
+	return want, nil
+}
+
+// scanCache lists the cache entries belonging to the wanted titles (all
+// when want is nil). Entries cached before URLs were recorded can't be
+// attributed to a title and are only included in unfiltered bundles.
+func scanCache(dir string, want map[int]bool) (*BundleManifest, error) {
+	m := &BundleManifest{Schema: bundleSchema, Version: bundleVersion, ToolVersion: toolVersion(), Created: time.Now().UTC()}
+	for t := range want {
+		m.Titles = append(m.Titles, t)
+	}
+	sort.Ints(m.Titles)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || isSidecar(name) || strings.HasPrefix(name, tempPrefix) {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		url, _ := os.ReadFile(path + ".url")
+		if want != nil {
+			match := urlTitlePattern.FindStringSubmatch(string(url))
+			if match == nil {
+				continue
+			}
+			if n, _ := strconv.Atoi(match[1]); !want[n] {
+				continue
+			}
+		}
+		sum, err := contentHash(path)
+		if err != nil {
+			return nil, err
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		m.Entries = append(m.Entries, BundleEntry{Key: name, URL: string(url), SHA256: sum, Bytes: info.Size()})
+	}
+	return m, nil
+}
+
+func writeBundle(w io.Writer, m *BundleManifest) error {
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	meta, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: bundleManifest, Mode: 0o644, Size: int64(len(meta)), ModTime: m.Created}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(meta); err != nil {
+		return err
+	}
+	for _, e := range m.Entries {
+		f, err := os.Open(filepath.Join(cacheDir, e.Key))
+		if err != nil {
+			return err
+		}
+		err = tw.WriteHeader(&tar.Header{Name: e.Key, Mode: 0o644, Size: e.Bytes, ModTime: m.Created})
+		if err == nil {
+			_, err = io.Copy(tw, f)
+		}
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.Key, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func runCacheImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("cache import", flag.ExitOnError)
+	trustedPath := fs.String("manifest", "", "path or URL of a published bundle manifest every entry must match")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: efcr cache import [--manifest M] BUNDLE (path or URL)")
+	}
+	var trusted *BundleManifest
+	if *trustedPath != "" {
+		var err error
+		if trusted, err = loadManifest(ctx, *trustedPath); err != nil {
+			return err
+		}
+	}
+	r, err := openBundleSource(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	imported, skipped, err := importBundle(r, cacheDir, trusted)
+	if err != nil {
+		return err
+	}
+	slog.Info("imported bundle", "entries", imported, "already_cached", skipped)
+	return nil
+}
+
+// readManifest decodes and checks a bundle manifest.
+func readManifest(r io.Reader) (*BundleManifest, error) {
+	var m BundleManifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, err
+	}
+	if m.Schema != bundleSchema {
+		return nil, fmt.Errorf("not an efcr bundle manifest (schema %q)", m.Schema)
+	}
+	if m.Version > bundleVersion {
+		return nil, fmt.Errorf("bundle was written by a newer efcr (%s v%d, this build reads up to v%d); "+
+			"upgrade with `go install github.com/paulgmiller/efcr@latest`", bundleSchema, m.Version, bundleVersion)
+	}
+	return &m, nil
+}
+
+// loadManifest reads a manifest from a path or URL holding either the
+// manifest itself or a whole bundle, whose first member is the manifest.
+func loadManifest(ctx context.Context, src string) (*BundleManifest, error) {
+	rc, err := openBundleSource(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	br := bufio.NewReader(rc)
+	var r io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		tr := tar.NewReader(zr)
+		if hdr, err := tr.Next(); err != nil || hdr.Name != bundleManifest {
+			return nil, fmt.Errorf("%s: not an efcr bundle", src)
+		}
+		r = tr
+	}
+	m, err := readManifest(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", src, err)
+	}
+	return m, nil
+}
+
+// openBundleSource opens a local file or GETs an http(s) URL.
+func openBundleSource(ctx context.Context, src string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		return os.Open(src)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", src, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// importBundle verifies every body against the bundle manifest and moves it
+// into dir atomically; entries already cached with the same hash are left
+// alone. When trusted is set every entry must also appear in it with the
+// same hash. A body that fails verification aborts the import.
+func importBundle(r io.Reader, dir string, trusted *BundleManifest) (imported, skipped int, err error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	tr := tar.NewReader(zr)
+	hdr, err := tr.Next()
+	if err != nil {
+		return 0, 0, err
+	}
+	if hdr.Name != bundleManifest {
+		return 0, 0, fmt.Errorf("not an efcr bundle: first member is %q", hdr.Name)
+	}
+	m, err := readManifest(tr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", bundleManifest, err)
+	}
+	// The manifest comes with the bundle, so its hashes vouch for nothing
+	// but the bodies: a key has to be a cache key (of its URL, if given) or
+	// it could name, and overwrite, any other file in dir.
+	byKey := map[string]BundleEntry{}
+	for _, e := range m.Entries {
+		if !cacheKeyPattern.MatchString(e.Key) || (e.URL != "" && cacheKey(e.URL) != e.Key) {
+			return 0, 0, fmt.Errorf("bundle entry %q (%s) is not a cache key", e.Key, e.URL)
+		}
+		byKey[e.Key] = e
+	}
+	if trusted != nil {
+		pinned := map[string]string{}
+		for _, e := range trusted.Entries {
+			pinned[e.Key] = e.SHA256
+		}
+		for _, e := range m.Entries {
+			if pinned[e.Key] != e.SHA256 {
+				return 0, 0, fmt.Errorf("bundle entry %s (%s) does not match the trusted manifest", e.Key, e.URL)
+			}
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, 0, err
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return imported, skipped, nil
+		}
+		if err != nil {
+			return imported, skipped, err
+		}
+		e, ok := byKey[hdr.Name]
+		if !ok {
+			return imported, skipped, fmt.Errorf("bundle member %q is not in its manifest", hdr.Name)
+		}
+		path := filepath.Join(dir, e.Key)
+		if sum, err := contentHash(path); err == nil && sum == e.SHA256 {
+			skipped++
+			continue
+		}
+		if err := importEntry(tr, path, e); err != nil {
+			return imported, skipped, err
+		}
+		imported++
+	}
+}
+
+func importEntry(r io.Reader, path string, e BundleEntry) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), tempPrefix+e.Key+"-*")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, r)
+	tmp.Close()
+	if err == nil {
+		var sum string
+		if sum, err = hashFile(tmp.Name()); err == nil && sum != e.SHA256 {
+			err = fmt.Errorf("%s: hash %s does not match manifest %s", e.Key, sum, e.SHA256)
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	os.WriteFile(path+".sha256", []byte(e.SHA256), 0o644)
+	os.Remove(path + ".headers") // validators for whatever body was there before
+	if e.URL != "" {
+		os.WriteFile(path+".url", []byte(e.URL), 0o644)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// bundleOf writes a bundle of the given entries, named by key, whose
+// manifest vouches for each body's hash as a crafted one would.
+func bundleOf(t *testing.T, bodies map[string]string, urls map[string]string) *bytes.Buffer {
+	t.Helper()
+	src := t.TempDir()
+	saved := cacheDir
+	cacheDir = src
+	defer func() { cacheDir = saved }()
+	m := &BundleManifest{Schema: bundleSchema, Version: bundleVersion, Created: time.Now().UTC()}
+	for key, body := range bodies {
+		path := filepath.Join(src, key)
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		sum, err := hashFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Entries = append(m.Entries, BundleEntry{Key: key, URL: urls[key], SHA256: sum, Bytes: int64(len(body))})
+	}
+	var b bytes.Buffer
+	if err := writeBundle(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	return &b
+}
+
+func TestImportBundleRefusesNonCacheKeys(t *testing.T) {
+	const url = "https://www.ecfr.gov/api/versioner/v1/titles.json"
+	for _, key := range []string{"watch.json", "crawl.checkpoint", "cache-index.ndjson", cacheKey(url) + ".url", cacheKey("https://elsewhere/")} {
+		t.Run(key, func(t *testing.T) {
+			dir := t.TempDir()
+			victim := filepath.Join(dir, key)
+			os.WriteFile(victim, []byte("original"), 0o644)
+			_, _, err := importBundle(bundleOf(t, map[string]string{key: "planted"}, map[string]string{key: url}), dir, nil)
+			if err == nil {
+				t.Fatal("imported a bundle entry that is not a cache key")
+			}
+			if b, _ := os.ReadFile(victim); string(b) != "original" {
+				t.Errorf("%s was overwritten with %q", key, b)
+			}
+		})
+	}
+}
+
+func TestImportBundle(t *testing.T) {
+	const url = "https://www.ecfr.gov/api/versioner/v1/titles.json"
+	key := cacheKey(url)
+	dir := t.TempDir()
+	imported, skipped, err := importBundle(bundleOf(t, map[string]string{key: `{"titles":[]}`}, map[string]string{key: url}), dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported != 1 || skipped != 0 {
+		t.Errorf("imported %d, skipped %d; want 1, 0", imported, skipped)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, key+".url")); string(b) != url {
+		t.Errorf("url sidecar is %q, want %q", b, url)
+	}
+}
+
+func TestCacheReadOnlyRefusesWrites(t *testing.T) {
+	dir := t.TempDir()
+	body := filepath.Join(dir, cacheKey("https://www.ecfr.gov/api/versioner/v1/titles.json"))
+	os.WriteFile(body, []byte(`{"titles":[]}`), 0o644)
+	savedDir, savedRO := cacheDir, *readOnly
+	cacheDir, *readOnly = dir, true
+	defer func() { cacheDir, *readOnly = savedDir, savedRO }()
+
+	for _, args := range [][]string{{"purge", "--all"}, {"compress"}, {"import", filepath.Join(dir, "bundle.tar.gz")}} {
+		if err := runCache(context.Background(), args); err == nil {
+			t.Errorf("cache %s ran under -read-only", args[0])
+		}
+	}
+	if _, err := os.Stat(body); err != nil {
+		t.Errorf("cache entry gone: %v", err)
+	}
+	if err := runCache(context.Background(), []string{"ls"}); err != nil {
+		t.Errorf("cache ls: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, cacheIndexFile)); !os.IsNotExist(err) {
+		t.Errorf("cache ls wrote the index under -read-only")
+	}
+}
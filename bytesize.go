@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var byteUnits = []struct {
+	suffix string
+	n      int64
+}{
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+}
+
+// parseBytes reads sizes like "500MB", "20GB" or a plain byte count.
+func parseBytes(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" || s == "0" {
+		return 0, nil
+	}
+	for _, u := range byteUnits {
+		if num, ok := strings.CutSuffix(s, u.suffix); ok {
+			f, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+			if err != nil {
+				return 0, fmt.Errorf("bad size %q", s)
+			}
+			return int64(f * float64(u.n)), nil
+		}
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+func formatBytes(n int64) string {
+	for _, u := range byteUnits {
+		if n >= u.n && u.n > 1 {
+			return fmt.Sprintf("%.1f%s", float64(n)/float64(u.n), u.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", n)
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// The cache index maps opaque cache file names back to what they hold. It
+// is an NDJSON journal like the checkpoint: CachingClient appends a record
+// per fetch or revalidation, later records win, and `efcr cache ls`
+// reconciles it with the directory and compacts it.
+const (
+	cacheIndexFile    = "index.ndjson"
+	cacheIndexSchema  = "efcr-cache-index"
+	cacheIndexVersion = 1
+)
+
+// CacheIndexEntry describes one cached response.
+type CacheIndexEntry struct {
+	Key     string    `json:"key"` // cache file name, sha256 of URL
+	URL     string    `json:"url,omitempty"`
+	Fetched time.Time `json:"fetched"`
+	Used    time.Time `json:"used"`             // last served, to the hour
+	Bytes   int64     `json:"bytes"`            // as stored, usually gzipped
+	Status  int       `json:"status,omitempty"` // 200 when fetched, 304 when revalidated; 0 if unknown
+}
+
+// index appends e to the cache index. Failures are logged, not returned:
+// the index only describes the cache, and ls can rebuild it.
+func (c *CachingClient) index(e CacheIndexEntry) {
+	if _, onDisk := c.Store.(*fileCache); !onDisk {
+		return
+	}
+	c.indexMu.Lock()
+	defer c.indexMu.Unlock()
+	if c.uses != nil {
+		c.uses[e.Key] = e
+	}
+	if err := appendCacheIndex(c.CacheDir, e); err != nil {
+		slog.Warn("cache index: not updated", "err", err)
+	}
+}
+
+func appendCacheIndex(dir string, e CacheIndexEntry) error {
+	f, err := os.OpenFile(filepath.Join(dir, cacheIndexFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil && info.Size() == 0 {
+		if err := writeSchemaHeader(f, cacheIndexSchema, cacheIndexVersion); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// readCacheIndex replays the index journal, latest record per key.
+func readCacheIndex(dir string) (map[string]CacheIndexEntry, error) {
+	path := filepath.Join(dir, cacheIndexFile)
+	index := map[string]CacheIndexEntry{}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for i := 0; dec.More(); i++ {
+		var raw json.RawMessage
+		var e CacheIndexEntry
+		if err := dec.Decode(&raw); err == nil {
+			err = json.Unmarshal(raw, &e)
+		}
+		if err != nil {
+			slog.Warn("cache index: ignoring unreadable tail", "err", err)
+			break
+		}
+		if i == 0 {
+			_, isHeader, err := checkSchema(path, raw, cacheIndexSchema, cacheIndexVersion)
+			if err != nil {
+				return nil, err
+			}
+			if isHeader {
+				continue
+			}
+		}
+		index[e.Key] = e
+	}
+	return index, nil
+}
+
+// syncCacheIndex reconciles the index with the cache directory: entries
+// whose body is gone (evicted, purged) are dropped, bodies it doesn't know
+// (imported from bundles, cached before the index) are described from their
+// sidecars, and, unless -read-only, the compacted result is written back.
+func syncCacheIndex(dir string) ([]CacheIndexEntry, error) {
+	index, err := readCacheIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var entries []CacheIndexEntry
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || isSidecar(name) || len(name) != 64 {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		e, ok := index[name]
+		if !ok {
+			path := filepath.Join(dir, name)
+			url, _ := os.ReadFile(path + ".url")
+			fetched, _ := fetchedAt(path)
+			e = CacheIndexEntry{Key: name, URL: string(url), Fetched: fetched.UTC()}
+		}
+		if e.Used.IsZero() {
+			e.Used = info.ModTime().UTC() // hits touch the body
+		}
+		e.Bytes = info.Size()
+		entries = append(entries, e)
+	}
+	if *readOnly {
+		return entries, nil
+	}
+
+	tmp, err := os.CreateTemp(dir, tempPrefix+cacheIndexFile+"-*")
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(tmp)
+	err = writeSchemaHeader(w, cacheIndexSchema, cacheIndexVersion)
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err == nil {
+			err = enc.Encode(e)
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	tmp.Close()
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(dir, cacheIndexFile))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return entries, nil
+}
+
+// runCacheLs lists the cache from its index.
+//
+//	efcr cache ls --title 40 --sort size
+//	efcr cache ls --sort used
+//	efcr cache ls --expired --json
+func runCacheLs(args []string) error {
+	fs := flag.NewFlagSet("cache ls", flag.ExitOnError)
+	titles := fs.String("titles", "", "comma separated title numbers to list (default all)")
+	expiredOnly := fs.Bool("expired", false, "only entries past their TTL")
+	sortBy := fs.String("sort", "url", "order by url, fetched, used (least recently first, as evicted within a kind) or size")
+	asJSON := fs.Bool("json", false, "print index records as NDJSON")
+	fs.Parse(args)
+	want, err := parseTitles(*titles)
+	if err != nil {
+		return err
+	}
+	entries, err := syncCacheIndex(cacheDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	rules := cfg.cacheTTLs()
+	now := time.Now()
+	freshness := func(e CacheIndexEntry) string {
+		switch {
+		case ttl(rules, e.URL) == 0:
+			return "kept"
+		case expired(rules, filepath.Join(cacheDir, e.Key), e.URL, now):
+			return "expired"
+		}
+		return "fresh"
+	}
+	var shown []CacheIndexEntry
+	for _, e := range entries {
+		if want != nil {
+			m := urlTitlePattern.FindStringSubmatch(e.URL)
+			if m == nil {
+				continue
+			}
+			if n, _ := strconv.Atoi(m[1]); !want[n] {
+				continue
+			}
+		}
+		if *expiredOnly && freshness(e) != "expired" {
+			continue
+		}
+		shown = append(shown, e)
+	}
+	switch *sortBy {
+	case "url":
+		sort.Slice(shown, func(i, j int) bool { return shown[i].URL < shown[j].URL })
+	case "fetched":
+		sort.Slice(shown, func(i, j int) bool { return shown[i].Fetched.After(shown[j].Fetched) })
+	case "used":
+		sort.Slice(shown, func(i, j int) bool { return shown[i].Used.Before(shown[j].Used) })
+	case "size":
+		sort.Slice(shown, func(i, j int) bool { return shown[i].Bytes > shown[j].Bytes })
+	default:
+		return fmt.Errorf("unknown --sort %q (url|fetched|used|size)", *sortBy)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, e := range shown {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var total int64
+	fmt.Println("Key\tFetched\tUsed\tSize\tStatus\tTTL\tURL")
+	for _, e := range shown {
+		total += e.Bytes
+		status := "-"
+		if e.Status != 0 {
+			status = strconv.Itoa(e.Status)
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Key[:12], e.Fetched.Local().Format("2006-01-02 15:04"),
+			e.Used.Local().Format("2006-01-02 15:04"), formatBytes(e.Bytes), status, freshness(e), e.URL)
+	}
+	fmt.Printf("%d entries, %s\n", len(shown), formatBytes(total))
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Cache is where CachingClient keeps responses, by cacheKey. Bodies are
+// stored as CachingClient hands them over (gzipped, or plain for entries
+// from before compression) and come back the same way. A missing entry is
+// an error matching fs.ErrNotExist.
+//
+// The filesystem (fileCache) is the default. -cache-store picks a local
+// directory indexed by SQLite (sqliteIndexCache), which SQLite tools can
+// query, or S3-compatible object storage (s3Cache), for containers and CI
+// runs that share a durable cache.
+type Cache interface {
+	// Get opens an entry's stored body, with its metadata.
+	Get(ctx context.Context, key string) (io.ReadCloser, CacheMeta, error)
+	// Put stores an entry, replacing any under key. A nil body keeps the
+	// stored one and replaces only the metadata, as a revalidation does.
+	Put(ctx context.Context, key string, body io.Reader, meta CacheMeta) error
+	Delete(ctx context.Context, key string) error
+	// Stat returns an entry's metadata without its body.
+	Stat(ctx context.Context, key string) (CacheMeta, error)
+}
+
+// CacheMeta describes a stored response.
+type CacheMeta struct {
+	URL     string      `json:"url"`
+	SHA256  string      `json:"sha256"`  // of the content, not the gzipped body
+	Header  http.Header `json:"header"`  // minus transfer headers; see storedHeader
+	Fetched time.Time   `json:"fetched"` // or last revalidated
+	Size    int64       `json:"size"`    // bytes stored
+}
+
+// expired reports whether an entry for url is past its TTL.
+func (m CacheMeta) expired(rules []CacheTTL, url string, now time.Time) bool {
+	d := ttl(rules, url)
+	return d != 0 && !m.Fetched.IsZero() && now.Sub(m.Fetched) > d
+}
+
+// openCacheStore opens the Cache -cache-store names: empty for the
+// filesystem under dir, sqlite-index:PATH for a SQLite index of bodies in
+// files, or s3://BUCKET/PREFIX for object storage (see newS3Cache).
+func openCacheStore(spec, dir string) (Cache, error) {
+	switch {
+	case spec == "":
+		return &fileCache{Dir: dir}, nil
+	case strings.HasPrefix(spec, "sqlite-index:"):
+		return openSQLiteIndex(strings.TrimPrefix(spec, "sqlite-index:"))
+	case strings.HasPrefix(spec, "s3://"):
+		return newS3Cache(spec)
+	}
+	return nil, fmt.Errorf("unknown -cache-store %q (sqlite-index:PATH or s3://BUCKET/PREFIX)", spec)
+}
+
+// fileCache is the default Cache: a directory with a file per body, named
+// by its key, and sidecars holding the rest of its metadata. The body's
+// mtime tracks last use, for eviction; the .url sidecar's, when it was
+// fetched.
+type fileCache struct {
+	Dir string
+}
+
+func (fc *fileCache) path(key string) string { return filepath.Join(fc.Dir, key) }
+
+func (fc *fileCache) Stat(_ context.Context, key string) (CacheMeta, error) {
+	path := fc.path(key)
+	info, err := os.Stat(path)
+	if err != nil {
+		return CacheMeta{}, err
+	}
+	url, _ := os.ReadFile(path + ".url")
+	fetched, _ := fetchedAt(path)
+	sum, _ := contentHash(path)
+	return CacheMeta{URL: string(url), SHA256: sum, Header: readHeaders(path), Fetched: fetched, Size: info.Size()}, nil
+}
+
+func (fc *fileCache) Get(ctx context.Context, key string) (io.ReadCloser, CacheMeta, error) {
+	meta, err := fc.Stat(ctx, key)
+	if err != nil {
+		return nil, CacheMeta{}, err
+	}
+	f, err := os.Open(fc.path(key))
+	if err != nil {
+		return nil, CacheMeta{}, err
+	}
+	return f, meta, nil
+}
+
+func (fc *fileCache) Put(_ context.Context, key string, body io.Reader, meta CacheMeta) error {
+	if body != nil {
+		tmp, err := os.CreateTemp(fc.Dir, tempPrefix+key+"-*")
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tmp, body)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), fc.path(key))
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	fc.writeMeta(key, meta)
+	return nil
+}
+
+// adopt moves a finished download at path into place as key's body, for
+// CachingClient, which writes its downloads in the cache dir to begin with.
+func (fc *fileCache) adopt(path, key string, meta CacheMeta) error {
+	if err := os.Rename(path, fc.path(key)); err != nil {
+		return err
+	}
+	fc.writeMeta(key, meta)
+	return nil
+}
+
+// writeMeta writes an entry's sidecars. Failures are ignored: an entry
+// without them still serves, and contentHash rebuilds the hash.
+func (fc *fileCache) writeMeta(key string, meta CacheMeta) {
+	path := fc.path(key)
+	if meta.SHA256 != "" {
+		os.WriteFile(path+".sha256", []byte(meta.SHA256), 0o644)
+	}
+	os.WriteFile(path+".url", []byte(meta.URL), 0o644) // for bundling by title
+	if !meta.Fetched.IsZero() {
+		os.Chtimes(path+".url", meta.Fetched, meta.Fetched)
+	}
+	if meta.Header != nil {
+		writeHeaders(path, meta.Header)
+	}
+}
+
+func (fc *fileCache) Delete(_ context.Context, key string) error {
+	path := fc.path(key)
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	removeSidecars(path)
+	return nil
+}
+
+// touch marks an entry used now, sparing it from eviction the longest.
+func (fc *fileCache) touch(key string) {
+	now := time.Now()
+	os.Chtimes(fc.path(key), now, now)
+}
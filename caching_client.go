@@ -1,75 +1,321 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"io"
+	"io/fs"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paulgmiller/efcr/pipeline"
 )
 
+// contentHashHeader carries the SHA-256 of a cached body up the client
+// chain so callers can key derived results by content without rehashing.
+const contentHashHeader = pipeline.ContentHashHeader
+
 type CachingClient struct {
+	// CacheDir is where downloads are written as they arrive, and, with
+	// the default Store, where entries are kept.
 	CacheDir string
 	Client   httpclient
+	// Store keeps the entries; see Cache.
+	Store Cache
+
+	// MaxBytes caps the cache size; past it entries are evicted, JSON
+	// before full XML, least recently used first (see evict). Zero means
+	// unlimited. Only the filesystem Store is evicted.
+	MaxBytes int64
+	// MinFreeBytes pauses fetching while the cache filesystem has less
+	// free space than this. Zero disables the check.
+	MinFreeBytes uint64
+	// LowDiskPoll is how often a paused fetch rechecks free space.
+	LowDiskPoll time.Duration
+	// TTLs says how long responses stay fresh, by URL; see CacheTTL.
+	TTLs []CacheTTL
+	// RangeChunk and RangeWorkers size the range requests that finish a
+	// download whose connection broke; see resume.
+	RangeChunk   int64
+	RangeWorkers int
+	// Refresh treats every entry as stale: each is revalidated with the
+	// server, or refetched when it kept no validators.
+	Refresh bool
+	// ReadOnly serves every entry, however stale, and nothing else: misses
+	// fail with errNotCached and the cache directory is never written, so
+	// it can be shared read-only with a process that doesn't crawl.
+	ReadOnly bool
+
+	prepareOnce sync.Once
+	mu          sync.Mutex
+	size        int64
+	indexMu     sync.Mutex
+	uses        map[string]CacheIndexEntry // latest index record per key
 }
 
 func NewCachingClient(cacheDir string, client httpclient) *CachingClient {
 	return &CachingClient{
-		CacheDir: cacheDir,
-		Client:   client,
+		CacheDir:     cacheDir,
+		Client:       client,
+		Store:        &fileCache{Dir: cacheDir},
+		LowDiskPoll:  30 * time.Second,
+		TTLs:         defaultCacheTTLs(),
+		RangeChunk:   8 << 20,
+		RangeWorkers: 4,
+	}
+}
+
+// CacheTTL keeps responses whose URL matches Pattern for TTL after they
+// were fetched; zero means forever. The first matching rule applies and
+// URLs matching none are kept forever.
+type CacheTTL struct {
+	Pattern *regexp.Regexp
+	TTL     time.Duration
+}
+
+// defaultCacheTTLs expires the endpoints that describe "now": the title
+// list, version histories and agency list grow as amendments land, and
+// /current/ URLs move with them. Anything addressed by date never changes.
+func defaultCacheTTLs() []CacheTTL {
+	day := 24 * time.Hour
+	return []CacheTTL{
+		{regexp.MustCompile(`/titles\.json$`), day},
+		{regexp.MustCompile(`/versions/`), day},
+		{regexp.MustCompile(`/agencies\.json$`), day},
+		{regexp.MustCompile(`/current/`), day},
+	}
+}
+
+// ttl returns how long a response for url stays fresh, zero for forever.
+func ttl(rules []CacheTTL, url string) time.Duration {
+	for _, r := range rules {
+		if r.Pattern.MatchString(url) {
+			return r.TTL
+		}
+	}
+	return 0
+}
+
+// fetchedAt is when a cache entry was stored. The body's mtime tracks last
+// use, so this comes from the .url sidecar, which is written once per fetch;
+// entries cached before sidecars fall back to the body.
+func fetchedAt(cachePath string) (time.Time, error) {
+	info, err := os.Stat(cachePath + ".url")
+	if err != nil {
+		info, err = os.Stat(cachePath)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// expired reports whether the entry at cachePath, fetched from url, is past
+// its TTL.
+func expired(rules []CacheTTL, cachePath, url string, now time.Time) bool {
+	at, err := fetchedAt(cachePath)
+	return err == nil && CacheMeta{Fetched: at}.expired(rules, url, now)
+}
+
+// errNotCached is returned for a miss by a ReadOnly cache.
+var errNotCached = errors.New("not in the cache (read-only)")
+
+// tempPrefix marks in-progress downloads. Entries only appear under their
+// real name via rename, so a crash can never leave a truncated cache hit.
+const tempPrefix = ".tmp-"
+
+// prepare creates the cache dir, removes temp files left by a crashed run
+// and measures the current cache size.
+func (c *CachingClient) prepare() {
+	if err := os.MkdirAll(c.CacheDir, 0o755); err != nil {
+		slog.Warn("cache: unavailable", "dir", c.CacheDir, "err", err)
+		return
+	}
+	entries, err := os.ReadDir(c.CacheDir)
+	if err != nil {
+		slog.Warn("cache: unavailable", "dir", c.CacheDir, "err", err)
+		return
+	}
+	removed := 0
+	for _, e := range entries {
+		if e.IsDir() || isSidecar(e.Name()) {
+			continue
+		}
+		if strings.HasPrefix(e.Name(), tempPrefix) {
+			if os.Remove(filepath.Join(c.CacheDir, e.Name())) == nil {
+				removed++
+			}
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			c.size += info.Size()
+		}
+	}
+	if removed > 0 {
+		slog.Info("cache: removed temp files from an interrupted run", "files", removed)
+	}
+	if _, onDisk := c.Store.(*fileCache); !onDisk {
+		return
+	}
+	c.uses, err = readCacheIndex(c.CacheDir)
+	if err != nil {
+		slog.Warn("cache index: unreadable; eviction goes by file times", "err", err)
+		c.uses = map[string]CacheIndexEntry{}
+	}
+	if c.MaxBytes > 0 && c.size > c.MaxBytes {
+		c.mu.Lock()
+		c.evict("")
+		c.mu.Unlock()
 	}
 }
 
 func (c *CachingClient) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	// Generate a cache key based on the request URL
-	cacheKey := cacheKey(req.URL.String())
-	cachePath := filepath.Join(c.CacheDir, cacheKey)
-
-	// gzip?
-	// Check if the response is already cached
-	if cachedResponse, err := os.Open(cachePath); err == nil {
-		return &http.Response{
-			Request:       req,
-			Header:        make(http.Header),
-			Body:          cachedResponse,
-			StatusCode:    http.StatusOK,
-			Status:        "200 OK",
-			Proto:         "HTTP/1.1",
-			ContentLength: -1,
-		}, nil
-	}
-
-	// If not cached, make the request
-	resp, err := c.Client.Do(req)
+	url := req.URL.String()
+	cacheKey := cacheKey(url)
+	if c.ReadOnly {
+		if _, err := c.Store.Stat(ctx, cacheKey); err != nil {
+			return nil, fmt.Errorf("%s: %w", url, errNotCached)
+		}
+		return c.cached(req, cacheKey, "hit")
+	}
+	c.prepareOnce.Do(c.prepare)
+
+	// Serve the cached response while fresh; once stale, ask the server
+	// whether it changed, presenting the validators it sent with it.
+	fetch := req
+	meta, err := c.Store.Stat(ctx, cacheKey)
+	stored := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("cache: lookup failed; fetching", append(urlAttrs(url), "url", url, "err", err)...)
+	}
+	if stored {
+		if !c.Refresh && !meta.expired(c.TTLs, url, time.Now()) {
+			return c.cached(req, cacheKey, "hit")
+		}
+		if cond := conditionalHeaders(meta.Header); len(cond) > 0 {
+			fetch = req.Clone(ctx)
+			for k, v := range cond {
+				fetch.Header[k] = v
+			}
+		}
+	}
+
+	if err := c.waitForDisk(ctx); err != nil {
+		return nil, err
+	}
+
+	// Missing or stale: fetch it, conditionally when there are validators.
+	// A 304 refreshes the stored entry; a 200 replaces it.
+	resp, err := c.Client.Do(fetch)
 	if err != nil {
 		return nil, err
 	}
 
+	if resp.StatusCode == http.StatusNotModified && fetch != req {
+		resp.Body.Close()
+		// unchanged: the entry is good for another TTL
+		meta.URL, meta.Fetched = url, time.Now().UTC()
+		if err := c.Store.Put(ctx, cacheKey, nil, meta); err != nil {
+			slog.Warn("cache: revalidation not stored", append(urlAttrs(url), "url", url, "err", err)...)
+		}
+		c.index(CacheIndexEntry{Key: cacheKey, URL: url, Fetched: meta.Fetched, Used: meta.Fetched, Bytes: meta.Size, Status: http.StatusNotModified})
+		return c.cached(req, cacheKey, "revalidated")
+	}
 	if resp.StatusCode != http.StatusOK {
 		return resp, nil
 	}
 	defer resp.Body.Close()
 
-	// Cache the response body
-	cacheFile, err := os.Create(cachePath)
+	// Download into CacheDir, then hand the finished file to the Store.
+	cacheFile, err := os.CreateTemp(c.CacheDir, tempPrefix+cacheKey+"-*")
 	if err != nil {
 		return nil, err
 	}
-	if _, err := io.Copy(cacheFile, resp.Body); err != nil {
+	// Bodies are stored gzipped; the hash is of the content.
+	h := sha256.New()
+	gz := gzip.NewWriter(cacheFile)
+	w := io.MultiWriter(gz, h)
+	n, err := io.Copy(w, resp.Body)
+	if err != nil && ctx.Err() == nil && resumable(resp) {
+		slog.Warn("cache: download broke off; resuming with range requests", append(urlAttrs(url), "url", url,
+			"got", formatBytes(n), "of", formatBytes(resp.ContentLength), "err", err)...)
+		if err = c.resume(ctx, fetch, resp, w, n); err == nil {
+			err = checkDigest(h.Sum(nil), resp.Header)
+		}
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	var size int64
+	if info, serr := cacheFile.Stat(); serr == nil {
+		size = info.Size()
+	}
+	var replaced int64
+	if stored {
+		replaced = meta.Size
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	meta = CacheMeta{URL: url, SHA256: sum, Header: storedHeader(resp.Header), Fetched: time.Now().UTC(), Size: size}
+	fc, onDisk := c.Store.(*fileCache)
+	switch {
+	case err != nil:
+	case onDisk:
 		cacheFile.Close()
+		err = fc.adopt(cacheFile.Name(), cacheKey, meta)
+	default:
+		if _, err = cacheFile.Seek(0, io.SeekStart); err == nil {
+			err = c.Store.Put(ctx, cacheKey, cacheFile, meta)
+		}
+	}
+	if err != nil {
+		cacheFile.Close()
+		os.Remove(cacheFile.Name())
 		return nil, err
 	}
-	cacheFile.Close()
+	c.index(CacheIndexEntry{Key: cacheKey, URL: url, Fetched: meta.Fetched, Used: meta.Fetched, Bytes: size, Status: http.StatusOK})
+	c.added(size-replaced, cacheKey)
 
-	// Return a new response based on the cached data
-	cachedResponse, err := os.Open(cachePath)
+	// Return a new response based on the cached data: the entry on disk,
+	// or the download itself for other stores, removed once read.
+	var raw io.ReadCloser = removeOnClose{cacheFile}
+	if onDisk {
+		if raw, _, err = c.Store.Get(ctx, cacheKey); err != nil {
+			return nil, err
+		}
+	} else if _, err := cacheFile.Seek(0, io.SeekStart); err != nil {
+		raw.Close()
+		return nil, err
+	}
+	cachedResponse, err := decodeBody(raw)
 	if err != nil {
 		return nil, err
 	}
+	header := resp.Header.Clone()
+	header.Set(contentHashHeader, sum)
 	return &http.Response{
 		Request:       req,
-		Header:        resp.Header.Clone(),
+		Header:        header,
 		Body:          cachedResponse,
 		StatusCode:    http.StatusOK,
 		Status:        "200 OK",
@@ -78,7 +324,428 @@ func (c *CachingClient) Do(req *http.Request) (*http.Response, error) {
 	}, nil
 }
 
+// removeOnClose is a temp file that goes away once read.
+type removeOnClose struct{ *os.File }
+
+func (f removeOnClose) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+// cached serves the entry under key with the headers it was stored with,
+// marking how it was served in cacheHitHeader.
+func (c *CachingClient) cached(req *http.Request, key, how string) (*http.Response, error) {
+	raw, meta, err := c.Store.Get(req.Context(), key)
+	if err != nil {
+		return nil, err
+	}
+	body, err := decodeBody(raw)
+	if err != nil {
+		return nil, err
+	}
+	if fc, ok := c.Store.(*fileCache); ok && !c.ReadOnly {
+		fc.touch(key)
+		c.used(key, meta)
+	}
+	header := meta.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set(cacheHitHeader, how)
+	if meta.SHA256 != "" {
+		header.Set(contentHashHeader, meta.SHA256)
+	}
+	return &http.Response{
+		Request:       req,
+		Header:        header,
+		Body:          body,
+		StatusCode:    http.StatusOK,
+		Status:        "200 OK",
+		Proto:         "HTTP/1.1",
+		ContentLength: -1,
+	}, nil
+}
+
+// storedHeader is what of a response's headers is kept with its entry: all
+// but those that describe the transfer rather than the content.
+func storedHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, k := range []string{"Content-Length", "Content-Encoding", "Transfer-Encoding", "Set-Cookie", "Connection"} {
+		h.Del(k)
+	}
+	return h
+}
+
+// writeHeaders keeps an entry's headers in the .headers sidecar.
+func writeHeaders(cachePath string, h http.Header) {
+	if b, err := json.Marshal(storedHeader(h)); err == nil {
+		os.WriteFile(cachePath+".headers", b, 0o644)
+	}
+}
+
+// readHeaders returns the stored headers of an entry, empty for entries
+// cached before they were kept.
+func readHeaders(cachePath string) http.Header {
+	h := http.Header{}
+	if b, err := os.ReadFile(cachePath + ".headers"); err == nil {
+		json.Unmarshal(b, &h)
+	}
+	return h
+}
+
+// conditionalHeaders turns an entry's ETag and Last-Modified into
+// If-None-Match and If-Modified-Since.
+func conditionalHeaders(stored http.Header) http.Header {
+	cond := http.Header{}
+	if v := stored.Get("ETag"); v != "" {
+		cond.Set("If-None-Match", v)
+	}
+	if v := stored.Get("Last-Modified"); v != "" {
+		cond.Set("If-Modified-Since", v)
+	}
+	return cond
+}
+
+// waitForDisk blocks while free space is below MinFreeBytes, so a long run
+// pauses instead of failing halfway through writing the cache.
+func (c *CachingClient) waitForDisk(ctx context.Context) error {
+	if c.MinFreeBytes == 0 {
+		return nil
+	}
+	warned := false
+	for {
+		free, err := diskFree(c.CacheDir)
+		if err != nil || free >= c.MinFreeBytes {
+			if warned {
+				slog.Info("cache: free space recovered, resuming", "free", formatBytes(int64(free)))
+			}
+			return nil
+		}
+		if !warned {
+			slog.Warn("cache: low on disk; pausing fetches until space is freed",
+				"free", formatBytes(int64(free)), "dir", c.CacheDir, "minimum", formatBytes(int64(c.MinFreeBytes)))
+			warned = true
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.LowDiskPoll):
+		}
+	}
+}
+
+// added accounts for a new entry and evicts if that took the cache past
+// MaxBytes.
+func (c *CachingClient) added(n int64, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size += n
+	if c.MaxBytes > 0 && c.size > c.MaxBytes {
+		c.evict(key)
+	}
+}
+
+// useResolution is how stale an entry's recorded last use may get before a
+// hit records it again, so a hot entry adds at most a line an hour to the
+// index.
+const useResolution = time.Hour
+
+// used records a hit on an entry in the cache index, for eviction.
+func (c *CachingClient) used(key string, meta CacheMeta) {
+	c.indexMu.Lock()
+	e, ok := c.uses[key]
+	c.indexMu.Unlock()
+	now := time.Now().UTC()
+	if c.uses == nil || now.Sub(e.Used) < useResolution {
+		return
+	}
+	if !ok {
+		e = CacheIndexEntry{Key: key, URL: meta.URL, Fetched: meta.Fetched.UTC()}
+	}
+	e.Used, e.Bytes = now, meta.Size
+	c.index(e)
+}
+
+// expendable reports whether an entry is cheap to fetch again: anything
+// but a full XML snapshot, which can run to hundreds of megabytes. Entries
+// of unknown origin are assumed expensive.
+func expendable(url string) bool {
+	return url != "" && !strings.Contains(url, "/full/")
+}
+
+// evict removes entries until the cache is back under 90% of MaxBytes,
+// sparing the entry named keep that is about to be served: expendable ones
+// first, then full XML, each least recently used first. Last use is the
+// index's record, or for entries it doesn't know the body's mtime, which
+// hits refresh. Callers hold c.mu.
+func (c *CachingClient) evict(keep string) {
+	entries, err := os.ReadDir(c.CacheDir)
+	if err != nil {
+		return
+	}
+	type entry struct {
+		name    string
+		size    int64
+		used    time.Time
+		cheaper bool
+	}
+	c.indexMu.Lock()
+	var files []entry
+	for _, e := range entries {
+		if e.IsDir() || e.Name() == keep || strings.HasPrefix(e.Name(), tempPrefix) || isSidecar(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		f := entry{e.Name(), info.Size(), info.ModTime(), false}
+		rec, ok := c.uses[f.name]
+		if ok && !rec.Used.IsZero() {
+			f.used = rec.Used
+		}
+		url := rec.URL
+		if !ok {
+			b, _ := os.ReadFile(filepath.Join(c.CacheDir, f.name+".url"))
+			url = string(b)
+		}
+		f.cheaper = expendable(url)
+		files = append(files, f)
+	}
+	c.indexMu.Unlock()
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].cheaper != files[j].cheaper {
+			return files[i].cheaper
+		}
+		return files[i].used.Before(files[j].used)
+	})
+	target := c.MaxBytes / 10 * 9
+	evicted := 0
+	for _, f := range files {
+		if c.size <= target {
+			break
+		}
+		path := filepath.Join(c.CacheDir, f.name)
+		if os.Remove(path) == nil {
+			removeSidecars(path)
+			c.size -= f.size
+			evicted++
+			c.indexMu.Lock()
+			delete(c.uses, f.name)
+			c.indexMu.Unlock()
+		}
+	}
+	slog.Info("cache: evicted entries", "entries", evicted, "size", formatBytes(c.size))
+}
+
+// contentHash returns the SHA-256 of a cache file from its sidecar, hashing
+// the file (and writing the sidecar) for entries cached before sidecars.
+func contentHash(cachePath string) (string, error) {
+	if b, err := os.ReadFile(cachePath + ".sha256"); err == nil {
+		return strings.TrimSpace(string(b)), nil
+	}
+	sum, err := hashFile(cachePath)
+	if err != nil {
+		return "", err
+	}
+	os.WriteFile(cachePath+".sha256", []byte(sum), 0o644)
+	return sum, nil
+}
+
+// openBody opens a cache entry for reading its content. Entries are
+// gzipped, except those cached before compression (until `efcr cache
+// compress` converts them); gzip's magic number can't begin XML or JSON,
+// so the two are told apart by sniffing.
+func openBody(cachePath string) (io.ReadCloser, error) {
+	f, err := os.Open(cachePath)
+	if err != nil {
+		return nil, err
+	}
+	return decodeBody(f)
+}
+
+// decodeBody reads a stored body as openBody does, closing f with it.
+func decodeBody(f io.ReadCloser) (io.ReadCloser, error) {
+	br := bufio.NewReader(f)
+	if magic, _ := br.Peek(2); !bytes.Equal(magic, gzipMagic) {
+		return struct {
+			io.Reader
+			io.Closer
+		}{br, f}, nil
+	}
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{zr, f}, nil
+}
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// hashFile returns the SHA-256 of a cache entry's content.
+func hashFile(cachePath string) (string, error) {
+	body, err := openBody(cachePath)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sidecars are the suffixes of files holding metadata about a cache entry:
+// its content hash, its URL and its response headers.
+var sidecars = []string{".sha256", ".url", ".headers"}
+
+// isSidecar reports whether a cache dir entry is metadata about another
+// entry, or the index of them all, rather than a cached body.
+func isSidecar(name string) bool {
+	if name == cacheIndexFile {
+		return true
+	}
+	for _, s := range sidecars {
+		if strings.HasSuffix(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func removeSidecars(cachePath string) {
+	for _, s := range sidecars {
+		os.Remove(cachePath + s)
+	}
+}
+
 func cacheKey(url string) string {
 	hash := sha256.Sum256([]byte(url))
 	return hex.EncodeToString(hash[:])
 }
+
+// runCachePurge removes cache entries past their TTL, or every entry with
+// --all. Entries whose URL is unknown (no .url sidecar) are only removed by
+// --all.
+func runCachePurge(args []string) error {
+	fs := flag.NewFlagSet("cache purge", flag.ExitOnError)
+	all := fs.Bool("all", false, "remove every entry, not just expired ones")
+	fs.Parse(args)
+	entries, err := os.ReadDir(cacheDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	rules := cfg.cacheTTLs()
+	now := time.Now()
+	removed, freed := 0, int64(0)
+	for _, e := range entries {
+		if e.IsDir() || isSidecar(e.Name()) || strings.HasPrefix(e.Name(), tempPrefix) {
+			continue
+		}
+		path := filepath.Join(cacheDir, e.Name())
+		if !*all {
+			url, err := os.ReadFile(path + ".url")
+			if err != nil || !expired(rules, path, string(url), now) {
+				continue
+			}
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removeSidecars(path)
+		removed++
+		freed += info.Size()
+	}
+	slog.Info("cache: purged entries", "entries", removed, "freed", formatBytes(freed))
+	return nil
+}
+
+// runCacheCompress gzips entries cached before bodies were compressed.
+// Reading them works either way; this just reclaims the space. Content
+// hashes are unchanged, and so are the mtimes eviction goes by.
+func runCacheCompress() error {
+	entries, err := os.ReadDir(cacheDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	converted, before, after := 0, int64(0), int64(0)
+	for _, e := range entries {
+		if e.IsDir() || isSidecar(e.Name()) || strings.HasPrefix(e.Name(), tempPrefix) {
+			continue
+		}
+		path := filepath.Join(cacheDir, e.Name())
+		n, m, err := compressEntry(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if m > 0 {
+			converted++
+			before += n
+			after += m
+		}
+	}
+	slog.Info("cache: compressed entries", "entries", converted, "before", formatBytes(before), "after", formatBytes(after))
+	return nil
+}
+
+// compressEntry gzips one uncompressed entry in place, returning its old
+// and new sizes; both are zero if it was already compressed.
+func compressEntry(path string) (int64, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	magic := make([]byte, 2)
+	if n, _ := io.ReadFull(f, magic); n == 2 && bytes.Equal(magic, gzipMagic) {
+		return 0, 0, nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), tempPrefix+filepath.Base(path)+"-*")
+	if err != nil {
+		return 0, 0, err
+	}
+	gz := gzip.NewWriter(tmp)
+	_, err = io.Copy(gz, f)
+	if err == nil {
+		err = gz.Close()
+	}
+	var size int64
+	if st, serr := tmp.Stat(); err == nil && serr == nil {
+		size = st.Size()
+	}
+	tmp.Close()
+	if err == nil {
+		err = os.Chtimes(tmp.Name(), info.ModTime(), info.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, 0, err
+	}
+	return info.Size(), size, nil
+}
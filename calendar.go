@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runCalendar turns a deadline dataset into an iCalendar file of one-time
+// and recurring compliance dates, optionally restricted to watched parts.
+//
+//	efcr calendar --deadlines deadlines.ndjson --part 60 --part 63 --out compliance.ics
+//
+// Dates become one-time events and recurrences repeat from their next
+// occurrence after --start. Durations ("within 30 days after ...") count
+// from an event only the reader knows, so they are skipped and counted.
+func runCalendar(args []string) error {
+	fs := flag.NewFlagSet("calendar", flag.ExitOnError)
+	var files, parts stringsFlag
+	fs.Var(&files, "deadlines", "deadline dataset written by `efcr deadlines --out` (repeatable)")
+	fs.Var(&parts, "part", "only include deadlines in this part (repeatable)")
+	start := fs.String("start", time.Now().Format("2006-01-02"), "anchor recurring events on or after this date")
+	name := fs.String("name", "Compliance deadlines", "calendar name")
+	out := fs.String("out", "compliance.ics", "output file")
+	fs.Parse(args)
+	if len(files) == 0 {
+		return errors.New("at least one --deadlines file is required")
+	}
+	from, err := time.Parse("2006-01-02", *start)
+	if err != nil {
+		return fmt.Errorf("--start: %w", err)
+	}
+
+	var events []icsEvent
+	seen := map[string]bool{}
+	relative := 0
+	for _, path := range files {
+		records, err := readDeadlines(path)
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			if len(parts) > 0 && !contains(parts, r.Part) {
+				continue
+			}
+			e, ok := deadlineEvent(r, from)
+			if !ok {
+				relative++
+				continue
+			}
+			if seen[e.UID] {
+				continue
+			}
+			seen[e.UID] = true
+			events = append(events, e)
+		}
+	}
+	if relative > 0 {
+		slog.Info("skipped relative deadlines (durations need a trigger date)", "deadlines", relative)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := writeICS(f, *name, events); err != nil {
+		return err
+	}
+	slog.Info("wrote calendar", "events", len(events), "path", *out)
+	return f.Close()
+}
+
+// deadlineEvent places a record on the calendar; ok is false for durations.
+func deadlineEvent(r DeadlineRecord, from time.Time) (icsEvent, bool) {
+	cite := r.Citation()
+	e := icsEvent{
+		Summary:     fmt.Sprintf("%s: %s", cite, r.Phrase),
+		Description: fmt.Sprintf("%s\n%s\n\"%s\"\nText as of %s.", cite, r.Heading, r.Phrase, r.Snapshot),
+		URL:         fmt.Sprintf("https://www.ecfr.gov/current/title-%d/section-%s", r.Title, r.Section),
+	}
+	switch r.Kind {
+	case "date":
+		t, err := time.Parse("2006-01-02", r.Date)
+		if err != nil {
+			return e, false
+		}
+		e.Start = t
+	case "recurrence":
+		e.RRule = r.Recurrence
+		e.Start = nextOccurrence(r.Recurrence, from)
+		if e.Start.Equal(from) && !strings.Contains(r.Recurrence, "BYMONTHDAY") {
+			e.Description += "\nThe regulation gives no date; this series is anchored at " + from.Format("2006-01-02") + "."
+		}
+	default:
+		return e, false
+	}
+	h := sha256.Sum256([]byte(cite + "\x00" + r.Phrase + "\x00" + r.Date + r.Recurrence))
+	e.UID = hex.EncodeToString(h[:16]) + "@efcr"
+	return e, true
+}
+
+// nextOccurrence returns the first date on or after from matching a yearly
+// BYMONTH/BYMONTHDAY rule, or from itself for rules without a fixed day.
+func nextOccurrence(rule string, from time.Time) time.Time {
+	var month, day int
+	for _, kv := range strings.Split(rule, ";") {
+		k, v, _ := strings.Cut(kv, "=")
+		n, _ := strconv.Atoi(v)
+		switch k {
+		case "BYMONTH":
+			month = n
+		case "BYMONTHDAY":
+			day = n
+		}
+	}
+	if month == 0 || day == 0 {
+		return from
+	}
+	t := time.Date(from.Year(), time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if t.Before(from) {
+		t = t.AddDate(1, 0, 0)
+	}
+	return t
+}
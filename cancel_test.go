@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// promptly bounds how long Do may take to return once its context is
+// cancelled.
+const promptly = time.Second
+
+// blockingClient stands in for the layers below one under test. Each call
+// is announced on entered and then hangs, like a stalled server, until the
+// request's context is done; unless respond is set, when it answers with
+// that status at once.
+type blockingClient struct {
+	entered chan struct{}
+	respond int
+}
+
+func newBlockingClient() *blockingClient {
+	return &blockingClient{entered: make(chan struct{}, 16)}
+}
+
+func (b *blockingClient) Do(req *http.Request) (*http.Response, error) {
+	b.entered <- struct{}{}
+	if b.respond != 0 {
+		return &http.Response{StatusCode: b.respond, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+	}
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+// assertCancels starts c.Do, cancels its context once ready has been
+// received from, and checks Do returns the context's error promptly.
+func assertCancels(t *testing.T, c httpclient, ready <-chan struct{}) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://www.ecfr.gov/api/versioner/v1/titles.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		resp, err := c.Do(req)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		done <- err
+	}()
+	select {
+	case <-ready:
+	case err := <-done:
+		t.Fatalf("Do returned before it was cancelled: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Do never reached the point to cancel it at")
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Do returned %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(promptly):
+		t.Fatalf("Do still running %v after cancellation", promptly)
+	}
+}
+
+// afterDelay is a ready channel for waits that give no signal of their
+// own: it fires once the caller has had time to settle into one.
+func afterDelay() <-chan struct{} {
+	ready := make(chan struct{})
+	time.AfterFunc(50*time.Millisecond, func() { close(ready) })
+	return ready
+}
+
+func TestRateLimitedClientCancelWaitingForToken(t *testing.T) {
+	below := newBlockingClient()
+	below.respond = http.StatusOK
+	rl := NewRateLimitedClient(below, time.Hour)
+	// the first request takes the only token; the next waits an hour
+	req, _ := http.NewRequest(http.MethodGet, "https://www.ecfr.gov/", nil)
+	resp, err := rl.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	<-below.entered
+	assertCancels(t, rl, afterDelay())
+	if len(below.entered) > 0 {
+		t.Error("the cancelled request was sent anyway")
+	}
+}
+
+func TestRateLimitedClientCancelInFlight(t *testing.T) {
+	below := newBlockingClient()
+	assertCancels(t, NewRateLimitedClient(below, time.Millisecond), below.entered)
+}
+
+func TestRetryClientCancelDuringBackoff(t *testing.T) {
+	below := newBlockingClient()
+	below.respond = http.StatusServiceUnavailable
+	rc := NewRetryClient(&RetryBudget{Ratio: 1, Min: 10}, below)
+	rc.Backoff, rc.MaxBackoff = time.Hour, time.Hour
+	// the first attempt fails at once, leaving Do in its backoff wait
+	assertCancels(t, rc, afterDelay())
+	if <-below.entered; len(below.entered) > 0 {
+		t.Error("retried after cancellation")
+	}
+}
+
+func TestCachingClientCancelWaitingForDisk(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := diskFree(dir); err != nil {
+		t.Skipf("no free-space check on this platform: %v", err)
+	}
+	below := newBlockingClient()
+	c := NewCachingClient(dir, below)
+	c.MinFreeBytes = 1 << 62 // never enough, so every miss waits
+	c.LowDiskPoll = time.Hour
+	assertCancels(t, c, afterDelay())
+	if len(below.entered) > 0 {
+		t.Error("fetched while the disk was full")
+	}
+}
+
+func TestCachingClientCancelInFlight(t *testing.T) {
+	below := newBlockingClient()
+	assertCancels(t, NewCachingClient(t.TempDir(), below), below.entered)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/paulgmiller/efcr/pipeline"
+)
+
+// CheckpointEntry is a journal line: one finished snapshot, with the size
+// of its cached body.
+type CheckpointEntry struct {
+	pipeline.Snapshot
+	// Size is the cache file's size when recorded, for a cheap check that it
+	// is the same one on resume; zero if unknown (other stores, older
+	// journals).
+	Size int64 `json:"size,omitempty"`
+}
+
+// Checkpoint is an append-only NDJSON journal of finished snapshots. Appends
+// are cheap and crash safe; the file is periodically compacted (rewritten
+// without superseded lines) so long runs don't grow it without bound.
+type Checkpoint struct {
+	Path string
+	// CompactEvery rewrites the journal after this many appends.
+	CompactEvery int
+
+	store Cache
+
+	mu       sync.Mutex
+	entries  map[string]CheckpointEntry
+	pending  map[string]bool // entries whose bodies Lookup has yet to rehash
+	f        *os.File
+	appends  int
+	resumed  int // entries this run reused
+	recorded int // entries this run added
+}
+
+func checkpointKey(title int, part, date string) string {
+	return fmt.Sprintf("%d/%s/%s", title, part, date)
+}
+
+// OpenCheckpoint loads an existing journal (if any), validates it against
+// the cache store and compacts it. Entries whose cached body is missing or
+// no longer matches the recorded hash are dropped, so the crawl re-plans
+// them. Opening only checks what is cheap (see present), so resuming a big
+// crawl starts at once; Lookup rehashes each body before it is relied on.
+func OpenCheckpoint(ctx context.Context, path string, store Cache) (*Checkpoint, error) {
+	cp := &Checkpoint{Path: path, CompactEvery: 500, store: store, entries: map[string]CheckpointEntry{}, pending: map[string]bool{}}
+	if f, err := os.Open(path); err == nil {
+		dec := json.NewDecoder(bufio.NewReader(f))
+		for i := 0; dec.More(); i++ {
+			var raw json.RawMessage
+			var e CheckpointEntry
+			if err := dec.Decode(&raw); err == nil {
+				err = json.Unmarshal(raw, &e)
+			}
+			if err != nil {
+				// a torn final line from a crash; everything before it is good
+				slog.Warn("checkpoint: ignoring unreadable tail", "path", path, "err", err)
+				break
+			}
+			if i == 0 {
+				// v1 journals just lack the header; the compaction below
+				// rewrites them as v2
+				_, isHeader, err := checkSchema(path, raw, checkpointSchema, checkpointVersion)
+				if err != nil {
+					f.Close()
+					return nil, err
+				}
+				if isHeader {
+					continue
+				}
+			}
+			cp.entries[checkpointKey(e.Title, e.Part, e.Date)] = e
+		}
+		f.Close()
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	_, onDisk := store.(*fileCache)
+	stale := 0
+	for k, e := range cp.entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !present(ctx, store, e) {
+			delete(cp.entries, k)
+			stale++
+		} else if onDisk {
+			cp.pending[k] = true
+		}
+	}
+	if len(cp.entries) > 0 || stale > 0 {
+		slog.Info("checkpoint: resuming", "path", path, "done", len(cp.entries), "replanned", stale)
+	}
+	if err := cp.compact(); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// present reports, without reading the body, whether e's cache entry is
+// still the one it recorded: it exists, at the recorded size, under the
+// recorded hash. On disk the hash is the .sha256 sidecar's; an entry without
+// one passes, to be rehashed by Lookup. Other stores replace entries whole,
+// so their recorded hash is trusted and that is the whole check.
+func present(ctx context.Context, store Cache, e CheckpointEntry) bool {
+	key := cacheKey(e.URL)
+	var size int64
+	var sum string
+	if fc, ok := store.(*fileCache); ok {
+		info, err := os.Stat(fc.path(key))
+		if err != nil {
+			return false
+		}
+		b, _ := os.ReadFile(fc.path(key) + ".sha256")
+		size, sum = info.Size(), strings.TrimSpace(string(b))
+	} else {
+		meta, err := store.Stat(ctx, key)
+		if err != nil {
+			return false
+		}
+		size, sum = meta.Size, meta.SHA256
+	}
+	return (e.Size == 0 || size == e.Size) && (sum == "" || sum == e.SHA256)
+}
+
+// Lookup returns the finished entry for a snapshot; part is empty for the
+// whole title. The first lookup of an entry from the journal rehashes its
+// cached body, rather than trusting the sidecar: the point is to catch
+// entries that were truncated or replaced behind our back. One that fails is
+// dropped, and its snapshot processed again.
+func (cp *Checkpoint) Lookup(ctx context.Context, title int, part, date string) (pipeline.Snapshot, bool) {
+	if cp == nil {
+		return pipeline.Snapshot{}, false
+	}
+	k := checkpointKey(title, part, date)
+	cp.mu.Lock()
+	e, ok := cp.entries[k]
+	verify := ok && cp.pending[k]
+	cp.mu.Unlock()
+	if !verify {
+		return e.Snapshot, ok
+	}
+	if ctx.Err() != nil {
+		return pipeline.Snapshot{}, false
+	}
+	sum, err := hashFile(cp.store.(*fileCache).path(cacheKey(e.URL)))
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	delete(cp.pending, k)
+	if err != nil || sum != e.SHA256 {
+		slog.Info("checkpoint: cached body changed, processing again", titleAttr(title), dateAttr(date), "part", part, "err", err)
+		delete(cp.entries, k)
+		return pipeline.Snapshot{}, false
+	}
+	return e.Snapshot, true
+}
+
+// Resumed notes that an entry returned by Lookup was used in place of
+// processing its snapshot again.
+func (cp *Checkpoint) Resumed() {
+	if cp == nil {
+		return
+	}
+	cp.mu.Lock()
+	cp.resumed++
+	cp.mu.Unlock()
+}
+
+// Record appends a finished snapshot to the journal.
+func (cp *Checkpoint) Record(s pipeline.Snapshot) error {
+	if cp == nil {
+		return nil
+	}
+	e := CheckpointEntry{Snapshot: s}
+	if fc, ok := cp.store.(*fileCache); ok {
+		if info, err := os.Stat(fc.path(cacheKey(s.URL))); err == nil {
+			e.Size = info.Size()
+		}
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.recorded++
+	k := checkpointKey(e.Title, e.Part, e.Date)
+	cp.entries[k] = e
+	delete(cp.pending, k)
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := cp.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if cp.appends++; cp.CompactEvery > 0 && cp.appends >= cp.CompactEvery {
+		return cp.compact()
+	}
+	return nil
+}
+
+// compact rewrites the journal from the in-memory entries via a temp file
+// and rename, then reopens it for appending. Callers hold cp.mu or own cp.
+func (cp *Checkpoint) compact() error {
+	if cp.f != nil {
+		cp.f.Close()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(cp.Path), filepath.Base(cp.Path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	if err := writeSchemaHeader(w, checkpointSchema, checkpointVersion); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	enc := json.NewEncoder(w)
+	for _, e := range cp.entries {
+		if err := enc.Encode(e); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), cp.Path); err != nil {
+		return err
+	}
+	cp.appends = 0
+	cp.f, err = os.OpenFile(cp.Path, os.O_APPEND|os.O_WRONLY, 0o644)
+	return err
+}
+
+// Close compacts one last time and closes the journal.
+func (cp *Checkpoint) Close() error {
+	if cp == nil {
+		return nil
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	slog.Info("checkpoint", "path", cp.Path, "resumed", cp.resumed, "recorded", cp.recorded, "total", len(cp.entries))
+	if err := cp.compact(); err != nil {
+		return err
+	}
+	return cp.f.Close()
+}
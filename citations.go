@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// citationEdge says section From cites To. Both are CFR citation strings;
+// Source and Target are them before formatting, and FromID and ToID their
+// core.SectionIDs once refIDs has placed them in chapters.
+type citationEdge struct {
+	From, To       string
+	Source, Target core.Ref
+	FromID, ToID   string
+}
+
+// refIDs sets the IDs of edges, with chapters per title as
+// core.PartChapters found them. Citations into titles not loaded get no
+// chapter.
+func refIDs(edges []citationEdge, chapters map[int]map[string]string) {
+	id := func(r core.Ref) string {
+		return core.SectionID{Title: r.Title, Chapter: chapters[r.Title][r.Part], Part: r.Part, Section: r.Section}.String()
+	}
+	for i := range edges {
+		edges[i].FromID, edges[i].ToID = id(edges[i].Source), id(edges[i].Target)
+	}
+}
+
+// citationEdges extracts the citation graph of one title's sections.
+// Self-citations and repeats are dropped.
+func citationEdges(root *core.Div, title int) []citationEdge {
+	var edges []citationEdge
+	var walk func(d *core.Div, part string)
+	walk = func(d *core.Div, part string) {
+		if d.Type == "PART" {
+			part = d.N
+		}
+		if d.Type == "SECTION" || d.Type == "APPENDIX" {
+			src := core.Ref{Title: title, Part: part, Section: d.N}
+			from := src.String()
+			seen := map[string]bool{}
+			for _, r := range core.ExtractCitations(core.ParaText(d), title) {
+				to := r.String()
+				if to != from && !seen[to] {
+					seen[to] = true
+					edges = append(edges, citationEdge{From: from, To: to, Source: src, Target: r})
+				}
+			}
+			return
+		}
+		for i := range d.Children {
+			walk(&d.Children[i], part)
+		}
+	}
+	walk(root, "")
+	return edges
+}
+
+// nodeRank is one node's centrality in the citation graph.
+type nodeRank struct {
+	Node     string
+	InDegree int
+	PageRank float64
+}
+
+// rankCitations computes in-degree and PageRank (damping 0.85) for every
+// node, highest PageRank first. Rank from nodes that cite nothing is spread
+// evenly, the usual treatment of dangling nodes.
+func rankCitations(edges []citationEdge) []nodeRank {
+	index := map[string]int{}
+	var nodes []string
+	id := func(n string) int {
+		if i, ok := index[n]; ok {
+			return i
+		}
+		index[n] = len(nodes)
+		nodes = append(nodes, n)
+		return len(nodes) - 1
+	}
+	out := map[int][]int{}
+	in := map[int]int{}
+	for _, e := range edges {
+		f, t := id(e.From), id(e.To)
+		out[f] = append(out[f], t)
+		in[t]++
+	}
+	n := len(nodes)
+	if n == 0 {
+		return nil
+	}
+	const damping = 0.85
+	rank := make([]float64, n)
+	for i := range rank {
+		rank[i] = 1 / float64(n)
+	}
+	for iter := 0; iter < 100; iter++ {
+		next := make([]float64, n)
+		dangling := 0.0
+		for i, r := range rank {
+			if len(out[i]) == 0 {
+				dangling += r
+				continue
+			}
+			share := r / float64(len(out[i]))
+			for _, t := range out[i] {
+				next[t] += share
+			}
+		}
+		delta := 0.0
+		for i := range next {
+			next[i] = (1-damping)/float64(n) + damping*(next[i]+dangling/float64(n))
+			delta += math.Abs(next[i] - rank[i])
+		}
+		rank = next
+		if delta < 1e-9 {
+			break
+		}
+	}
+	ranks := make([]nodeRank, n)
+	for i, name := range nodes {
+		ranks[i] = nodeRank{Node: name, InDegree: in[i], PageRank: rank[i]}
+	}
+	sort.Slice(ranks, func(i, j int) bool {
+		if ranks[i].PageRank != ranks[j].PageRank {
+			return ranks[i].PageRank > ranks[j].PageRank
+		}
+		return ranks[i].Node < ranks[j].Node
+	})
+	return ranks
+}
+
+// runCitations reports the most cited sections per title, and CFR-wide when
+// more than one title is given, by PageRank over the citation graph.
+//
+//	efcr citations --titles 40,49 --date 2024-01-01 --top 20 --edges edges.csv
+//
+// --orphans also lists citations whose target does not exist at --date.
+// --deps reports the parts citing other titles most, and --deps-csv and
+// --deps-dot write that part-to-part graph as a matrix and for Graphviz.
+func runCitations(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("citations", flag.ExitOnError)
+	titles := fs.String("titles", "", "comma separated title numbers")
+	date := fs.String("date", "", "snapshot date YYYY-MM-DD")
+	top := fs.Int("top", 20, "sections to list per ranking")
+	edgesOut := fs.String("edges", "", "also write the edge list as CSV (from,to,from_id,to_id)")
+	orphans := fs.Bool("orphans", false, "list citations to parts and sections that are missing, removed or reserved at --date")
+	deps := fs.Bool("deps", false, "list the parts that cite other titles' parts most")
+	depsCSV := fs.String("deps-csv", "", "write the inter-title part dependency matrix as CSV")
+	depsDOT := fs.String("deps-dot", "", "write the inter-title part dependency graph as Graphviz DOT")
+	fs.Parse(args)
+	want, err := parseTitles(*titles)
+	if err != nil {
+		return err
+	}
+	if len(want) == 0 || *date == "" {
+		return errors.New("--titles and --date are required")
+	}
+	var nums []int
+	for t := range want {
+		nums = append(nums, t)
+	}
+	sort.Ints(nums)
+
+	var all []citationEdge
+	chapters := map[int]map[string]string{}
+	for _, t := range nums {
+		doc, err := newAPI(c).Document(ctx, t, *date, ecfr.Hierarchy{})
+		if err != nil {
+			return err
+		}
+		edges := citationEdges(doc.Root(), t)
+		chapters[t] = core.PartChapters(doc.Root())
+		all = append(all, edges...)
+		printRanks(fmt.Sprintf("Title %d (%d citations)", t, len(edges)), rankCitations(edges), *top)
+	}
+	if len(nums) > 1 {
+		printRanks(fmt.Sprintf("CFR-wide across %d titles (%d citations)", len(nums), len(all)), rankCitations(all), *top)
+	}
+	if *orphans {
+		found, err := orphanedCitations(ctx, newAPI(c), all, *date)
+		if err != nil {
+			return err
+		}
+		printOrphans(found, len(all))
+	}
+	if *deps || *depsCSV != "" || *depsDOT != "" {
+		d := partDependencies(all)
+		if *deps {
+			printDependencies(d, *top)
+		}
+		if *depsCSV != "" {
+			if err := writeCSV(*depsCSV, d.matrix()); err != nil {
+				return err
+			}
+		}
+		if *depsDOT != "" {
+			if err := d.writeDOT(*depsDOT); err != nil {
+				return err
+			}
+		}
+	}
+
+	if *edgesOut != "" {
+		refIDs(all, chapters)
+		rows := [][]string{{"from", "to", "from_id", "to_id"}}
+		for _, e := range all {
+			rows = append(rows, []string{e.From, e.To, e.FromID, e.ToID})
+		}
+		return writeCSV(*edgesOut, rows)
+	}
+	return nil
+}
+
+func printRanks(heading string, ranks []nodeRank, top int) {
+	fmt.Println(heading)
+	fmt.Println("Rank\tCitation\tInDegree\tPageRank")
+	if len(ranks) > top {
+		ranks = ranks[:top]
+	}
+	for i, r := range ranks {
+		fmt.Printf("%d\t%s\t%d\t%.5f\n", i+1, r.Node, r.InDegree, r.PageRank)
+	}
+	fmt.Println()
+}
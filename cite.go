@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// Cite is one resolved citation: where it sits in its title on a date.
+type Cite struct {
+	ID       string      `json:"id"` // core.SectionID
+	Citation string      `json:"citation"`
+	Title    int         `json:"title"`
+	Part     string      `json:"part"`
+	Section  string      `json:"section,omitempty"`
+	Date     string      `json:"date"`
+	Heading  string      `json:"heading"`
+	Ancestry []CiteLevel `json:"ancestry"`
+}
+
+// CiteLevel is one node of a citation's ancestry.
+type CiteLevel struct {
+	Type       string `json:"type"` // title, chapter, subchapter, part, subpart, section, ...
+	Identifier string `json:"identifier"`
+	Label      string `json:"label"`
+	Heading    string `json:"heading"`
+	Reserved   bool   `json:"reserved,omitempty"`
+}
+
+// runCite resolves citations to their place in the CFR hierarchy (title,
+// chapter, part, subpart, section) and current heading, from the
+// versioner's ancestry endpoint.
+//
+//	efcr cite "40 CFR 60.4"
+//	efcr cite --date 2020-01-01 --json "40 CFR part 60" "6 CFR 11.4"
+func runCite(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("cite", flag.ExitOnError)
+	date := fs.String("date", "", "snapshot date YYYY-MM-DD (default: each title's latest)")
+	asJSON := fs.Bool("json", false, "print one JSON object per citation")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errors.New(`give one or more citations, e.g. efcr cite "40 CFR 60.4"`)
+	}
+	api := newAPI(c)
+	enc := json.NewEncoder(os.Stdout)
+	for i, arg := range fs.Args() {
+		ref, err := core.ParseCitation(arg)
+		if err != nil {
+			return err
+		}
+		cite, err := resolveCite(ctx, api, ref, *date)
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			if err := enc.Encode(cite); err != nil {
+				return err
+			}
+			continue
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s (%s)\n", cite.Citation, cite.Date)
+		for depth, l := range cite.Ancestry {
+			fmt.Printf("%s%s\n", strings.Repeat("  ", depth), l.Label)
+		}
+	}
+	return nil
+}
+
+// resolveCite looks ref up as of date, or the title's latest date.
+func resolveCite(ctx context.Context, api *ecfr.Client, ref core.Ref, date string) (Cite, error) {
+	if date == "" {
+		var err error
+		if date, err = latestDate(ctx, api, ref.Title); err != nil {
+			return Cite{}, err
+		}
+	}
+	nodes, err := api.Ancestry(ctx, ref.Title, date, ecfr.Hierarchy{Part: ref.Part, Section: ref.Section})
+	if err != nil {
+		return Cite{}, fmt.Errorf("%s: %w", ref, err)
+	}
+	if len(nodes) == 0 {
+		return Cite{}, fmt.Errorf("%s: not found on %s", ref, date)
+	}
+	cite := Cite{Citation: ref.String(), Title: ref.Title, Part: ref.Part, Section: ref.Section, Date: date}
+	id := core.SectionID{Title: ref.Title, Part: ref.Part, Section: ref.Section}
+	for _, n := range nodes {
+		cite.Ancestry = append(cite.Ancestry, CiteLevel{Type: n.Type, Identifier: n.Identifier, Label: n.Label, Heading: n.LabelDescription, Reserved: n.Reserved})
+		if n.Type == "chapter" {
+			id.Chapter = n.Identifier
+		}
+	}
+	cite.ID = id.String()
+	cite.Heading = cite.Ancestry[len(cite.Ancestry)-1].Heading
+	return cite, nil
+}
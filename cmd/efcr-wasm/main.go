@@ -0,0 +1,142 @@
+//go:build js && wasm
+
+// Command efcr-wasm exposes the core parsing and diffing to JavaScript for a
+// browser demo. There is no cache: documents come from the page, or from the
+// browser's fetch through net/http.
+//
+// Build:
+//
+//	GOOS=js GOARCH=wasm go build -o efcr.wasm ./cmd/efcr-wasm
+//
+// and load with $(go env GOROOT)/lib/wasm/wasm_exec.js.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall/js"
+
+	"github.com/paulgmiller/efcr/core"
+)
+
+// browserFetcher satisfies core.Fetcher; on js/wasm net/http is backed by
+// the Fetch API, so CORS rules of the hosting page apply.
+type browserFetcher struct{}
+
+func (browserFetcher) Fetch(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("HTTP %d %s", resp.StatusCode, url)
+	}
+	return resp.Body, nil
+}
+
+type sectionSummary struct {
+	ID    string `json:"id,omitempty"` // core.SectionID, when the title is known
+	N     string `json:"n"`
+	Head  string `json:"head"`
+	Words int    `json:"words"`
+}
+
+// summarize lists doc's sections. A whole-title document names its title;
+// for others the caller may pass it, or the summaries go without IDs.
+func summarize(doc *core.ECFRFile, title int) []sectionSummary {
+	root := doc.Root()
+	if title == 0 && root.Type == core.TypeTitle {
+		title, _ = strconv.Atoi(root.N)
+	}
+	var out []sectionSummary
+	core.WalkSectionIDs(root, title, func(id core.SectionID, d *core.Div) {
+		s := sectionSummary{N: d.N, Head: d.Head, Words: len(strings.Fields(core.ParaText(d)))}
+		if title > 0 {
+			s.ID = id.String()
+		}
+		out = append(out, s)
+	})
+	return out
+}
+
+// titleArg reads the optional title number argument at i.
+func titleArg(args []js.Value, i int) int {
+	if len(args) > i && args[i].Type() == js.TypeNumber {
+		return args[i].Int()
+	}
+	return 0
+}
+
+func toJS(v any, err error) any {
+	if err != nil {
+		return map[string]any{"error": err.Error()}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return map[string]any{"error": err.Error()}
+	}
+	return string(b)
+}
+
+// efcrSections(xml[, title]) -> JSON [{id, n, head, words}]
+func sections(this js.Value, args []js.Value) any {
+	doc, err := core.ParseFile(strings.NewReader(args[0].String()))
+	if err != nil {
+		return toJS(nil, err)
+	}
+	return toJS(summarize(doc, titleArg(args, 1)), nil)
+}
+
+// efcrDiff(oldXML, newXML, n) -> JSON edit script for the Div numbered n
+// (the whole document when n is empty).
+func diff(this js.Value, args []js.Value) any {
+	var toks [2][]string
+	for i := range toks {
+		doc, err := core.ParseFile(strings.NewReader(args[i].String()))
+		if err != nil {
+			return toJS(nil, err)
+		}
+		root := doc.Root()
+		if n := args[2].String(); n != "" {
+			if root = core.FindDiv(root, n); root == nil {
+				return toJS(nil, fmt.Errorf("%s not found", n))
+			}
+		}
+		toks[i] = core.DivTokens(root)
+	}
+	return toJS(core.DiffTokens(toks[0], toks[1]), nil)
+}
+
+// efcrFetchSections(url[, title]) -> Promise<JSON [{id, n, head, words}]>
+func fetchSections(this js.Value, args []js.Value) any {
+	url, title := args[0].String(), titleArg(args, 1)
+	return js.Global().Get("Promise").New(js.FuncOf(func(this js.Value, p []js.Value) any {
+		resolve, reject := p[0], p[1]
+		go func() {
+			doc, err := core.Load(context.Background(), browserFetcher{}, url)
+			if err != nil {
+				reject.Invoke(err.Error())
+				return
+			}
+			resolve.Invoke(toJS(summarize(doc, title), nil))
+		}()
+		return nil
+	}))
+}
+
+func main() {
+	js.Global().Set("efcrSections", js.FuncOf(sections))
+	js.Global().Set("efcrDiff", js.FuncOf(diff))
+	js.Global().Set("efcrFetchSections", js.FuncOf(fetchSections))
+	select {}
+}
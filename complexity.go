@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// complexityWeights combine a part's raw metrics into one index:
+//
+//	score = words·log10(words+1)
+//	      + restrictions·(restrictions per 1,000 words)
+//	      + crossrefs·(cross-references per 1,000 words)
+//	      + conditionals·(conditionals per 1,000 words)
+//	      + depth·(deepest paragraph nesting level)
+//
+// Size enters logarithmically so long parts don't swamp dense ones; the
+// other terms are densities so they compare across parts of any length.
+type complexityWeights struct {
+	Words, Restrictions, CrossRefs, Conditionals, Depth float64
+}
+
+var defaultComplexityWeights = complexityWeights{Words: 1, Restrictions: 1, CrossRefs: 0.5, Conditionals: 1, Depth: 0.5}
+
+// parseWeights overrides defaults from "name=value,..." pairs.
+func parseWeights(s string) (complexityWeights, error) {
+	w := defaultComplexityWeights
+	if s == "" {
+		return w, nil
+	}
+	fields := map[string]*float64{
+		"words": &w.Words, "restrictions": &w.Restrictions, "crossrefs": &w.CrossRefs,
+		"conditionals": &w.Conditionals, "depth": &w.Depth,
+	}
+	for _, kv := range strings.Split(s, ",") {
+		name, val, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		f, known := fields[name]
+		if !ok || !known {
+			return w, fmt.Errorf("bad weight %q: want name=value with name one of words, restrictions, crossrefs, conditionals, depth", kv)
+		}
+		v, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return w, fmt.Errorf("weight %s: %w", name, err)
+		}
+		*f = v
+	}
+	return w, nil
+}
+
+func (w complexityWeights) score(c *core.Complexity) float64 {
+	perK := func(n int64) float64 {
+		if c.Words == 0 {
+			return 0
+		}
+		return float64(n) * 1000 / float64(c.Words)
+	}
+	return w.Words*math.Log10(float64(c.Words)+1) +
+		w.Restrictions*perK(c.Restrictions) +
+		w.CrossRefs*perK(c.CrossRefs) +
+		w.Conditionals*perK(c.Conditionals) +
+		w.Depth*float64(c.MaxDepth)
+}
+
+// runComplexity scores every part of a title on one date, most complex
+// first, printing the raw metrics next to the score.
+//
+//	efcr complexity --title 6 --date 2024-01-01 --weights crossrefs=1,depth=0
+func runComplexity(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("complexity", flag.ExitOnError)
+	title := fs.Int("title", 0, "title number")
+	date := fs.String("date", "", "snapshot date YYYY-MM-DD")
+	part := fs.String("part", "", "restrict to one part")
+	weights := fs.String("weights", "", "override weights, e.g. restrictions=2,depth=0 (see complexityWeights)")
+	saveFacts := fs.String("save-facts", "", "also write raw metrics and scores as NDJSON for `efcr query`")
+	fs.Parse(args)
+	if *title == 0 || *date == "" {
+		return errors.New("--title and --date are required")
+	}
+	w, err := parseWeights(*weights)
+	if err != nil {
+		return err
+	}
+
+	doc, err := newAPI(c).Document(ctx, *title, *date, ecfr.Hierarchy{Part: *part})
+	if err != nil {
+		return err
+	}
+	byPart := core.PartComplexity(doc.Root())
+	delete(byPart, "") // title-level headings, not a part
+	for p := range byPart {
+		if cfg.isTable(*title, p) {
+			delete(byPart, p) // tabular data, not prose
+		}
+	}
+
+	type row struct {
+		part  string
+		c     *core.Complexity
+		score float64
+	}
+	var rows []row
+	for p, cx := range byPart {
+		rows = append(rows, row{p, cx, w.score(cx)})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].score > rows[j].score })
+
+	var facts []Fact
+	fmt.Println("Part\tWords\tRestrictions\tCrossRefs\tConditionals\tMaxDepth\tScore")
+	for _, r := range rows {
+		fmt.Printf("%s\t%d\t%d\t%d\t%d\t%d\t%.2f\n", r.part, r.c.Words, r.c.Restrictions, r.c.CrossRefs, r.c.Conditionals, r.c.MaxDepth, r.score)
+		for metric, v := range map[string]float64{
+			"words": float64(r.c.Words), "restrictions": float64(r.c.Restrictions), "cross_refs": float64(r.c.CrossRefs),
+			"conditionals": float64(r.c.Conditionals), "max_depth": float64(r.c.MaxDepth), "complexity": r.score,
+		} {
+			facts = append(facts, Fact{Title: *title, Part: r.part, Date: *date, Metric: metric, Value: v})
+		}
+	}
+	if *saveFacts != "" {
+		return writeFacts(*saveFacts, facts)
+	}
+	return nil
+}
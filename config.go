@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// Config is the optional efcr.json settings file; `efcr init` writes one.
+//
+//	{
+//	  "cache_dir": "/var/cache/efcr",
+//	  "cache_max_size": "20GB",
+//	  "request_interval": "4s",
+//	  "api_version": "v1",
+//	  "parts": {
+//	    "49/172": {"handling": "table"},
+//	    "40/180": {"handling": "table"}
+//	  },
+//	  "cache_ttl": [
+//	    {"pattern": "/structure/", "ttl": "720h"}
+//	  ]
+//	}
+type Config struct {
+	// CacheDir holds cached responses and crawl state (default "cache").
+	CacheDir string `json:"cache_dir,omitempty"`
+	// CacheMaxSize caps the cache directory, e.g. 20GB, as -cache-max-size
+	// does when that isn't given.
+	CacheMaxSize string `json:"cache_max_size,omitempty"`
+	// RequestInterval is the time between API requests the rate limit
+	// starts from, a Go duration (default defaultRequestInterval).
+	RequestInterval string `json:"request_interval,omitempty"`
+	// APIVersion is the versioner API version to call (default
+	// ecfr.DefaultAPIVersion), to move to a newer one as it rolls out.
+	APIVersion string `json:"api_version,omitempty"`
+	// Parts holds per-part rules keyed "title/part".
+	Parts map[string]PartRule `json:"parts"`
+	// CacheTTL rules are tried before the built-in ones (defaultCacheTTLs).
+	CacheTTL []TTLRule `json:"cache_ttl,omitempty"`
+
+	ttls     []CacheTTL    // CacheTTL, compiled
+	interval time.Duration // RequestInterval, parsed
+}
+
+// defaultRequestInterval is the rate limit's starting point when the config
+// sets none: a request every four seconds is what the API tolerates.
+const defaultRequestInterval = 4 * time.Second
+
+// TTLRule is the file form of a CacheTTL: a regular expression matched
+// against request URLs and a Go duration, "0" for forever.
+type TTLRule struct {
+	Pattern string `json:"pattern"`
+	TTL     string `json:"ttl"`
+}
+
+// PartRule says how a part's text is treated. Handling "table" marks parts
+// dominated by tabular data (49 CFR 172.101's hazmat table is the classic):
+// they are left out of prose metrics, diffed row by row, and can be
+// extracted to CSV with `efcr tables`. The default is "prose".
+type PartRule struct {
+	Handling string `json:"handling"`
+}
+
+// defaultConfig applies when no config file exists; a file's rules are
+// merged over it.
+func defaultConfig() *Config {
+	return &Config{Parts: map[string]PartRule{
+		"49/172": {Handling: "table"},
+	}, interval: defaultRequestInterval}
+}
+
+// loadConfig reads path over the defaults. A missing file is not an error.
+func loadConfig(path string) (*Config, error) {
+	cfg := defaultConfig()
+	if path == "" {
+		return cfg, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file Config
+	if err := json.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if file.CacheDir != "" {
+		cfg.CacheDir = file.CacheDir
+	}
+	if file.CacheMaxSize != "" {
+		if _, err := parseBytes(file.CacheMaxSize); err != nil {
+			return nil, fmt.Errorf("%s: cache_max_size: %w", path, err)
+		}
+		cfg.CacheMaxSize = file.CacheMaxSize
+	}
+	if file.APIVersion != "" {
+		if !ecfr.ValidAPIVersion(file.APIVersion) {
+			return nil, fmt.Errorf("%s: bad api_version %q: want v1, v2, ...", path, file.APIVersion)
+		}
+		cfg.APIVersion = file.APIVersion
+	}
+	if file.RequestInterval != "" {
+		d, err := time.ParseDuration(file.RequestInterval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%s: bad request_interval %q: want a positive duration, e.g. 4s", path, file.RequestInterval)
+		}
+		cfg.RequestInterval, cfg.interval = file.RequestInterval, d
+	}
+	for k, r := range file.Parts {
+		if _, _, ok := splitPartKey(k); !ok {
+			return nil, fmt.Errorf("%s: part key %q is not title/part", path, k)
+		}
+		if r.Handling != "prose" && r.Handling != "table" {
+			return nil, fmt.Errorf("%s: part %s: unknown handling %q (prose|table)", path, k, r.Handling)
+		}
+		cfg.Parts[k] = r
+	}
+	for _, r := range file.CacheTTL {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: cache_ttl: %w", path, err)
+		}
+		d, err := time.ParseDuration(r.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("%s: cache_ttl %q: %w", path, r.Pattern, err)
+		}
+		cfg.ttls = append(cfg.ttls, CacheTTL{re, d})
+	}
+	cfg.CacheTTL = file.CacheTTL
+	return cfg, nil
+}
+
+// requestInterval is the time between API requests to start from.
+func (c *Config) requestInterval() time.Duration {
+	if c == nil || c.interval == 0 {
+		return defaultRequestInterval
+	}
+	return c.interval
+}
+
+// cacheTTLs returns the file's TTL rules followed by the defaults.
+func (c *Config) cacheTTLs() []CacheTTL {
+	if c == nil {
+		return defaultCacheTTLs()
+	}
+	return append(append([]CacheTTL(nil), c.ttls...), defaultCacheTTLs()...)
+}
+
+func splitPartKey(k string) (int, string, bool) {
+	t, p, ok := strings.Cut(k, "/")
+	n, err := strconv.Atoi(t)
+	return n, p, ok && err == nil && p != ""
+}
+
+// isTable reports whether a part has table handling.
+func (c *Config) isTable(title int, part string) bool {
+	return c != nil && c.Parts[fmt.Sprintf("%d/%s", title, part)].Handling == "table"
+}
+
+// tableParts lists the table-handled parts of every title, sorted.
+func (c *Config) tableParts() map[int][]string {
+	out := map[int][]string{}
+	if c == nil {
+		return out
+	}
+	for k, r := range c.Parts {
+		if r.Handling != "table" {
+			continue
+		}
+		t, p, _ := splitPartKey(k)
+		out[t] = append(out[t], p)
+	}
+	for _, ps := range out {
+		sort.Strings(ps)
+	}
+	return out
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Ref is a citation found in regulatory text. Section is empty for a
+// reference to a whole part.
+type Ref struct {
+	Title   int
+	Part    string
+	Section string
+}
+
+// String formats the reference as a CFR citation, e.g. "6 CFR 11.4" or
+// "6 CFR Part 11".
+func (r Ref) String() string {
+	if r.Section != "" {
+		return fmt.Sprintf("%d CFR %s", r.Title, r.Section)
+	}
+	return fmt.Sprintf("%d CFR Part %s", r.Title, r.Part)
+}
+
+var (
+	// "40 CFR 60.4", "40 CFR part 60", "40 CFR parts 60 and 63": the anchor,
+	// then a list of numbers read up to the next anchor
+	cfrAnchorPattern = regexp.MustCompile(`\b(\d+)\s+CFR\s+(?:(?i:parts?)\s+)?`)
+	cfrListPattern   = regexp.MustCompile(`^(?:\d+(?:\.\d+[a-z]?)?)(?:(?:,\s*|,?\s+(?:and|or|through)\s+)\d+(?:\.\d+[a-z]?)?)*`)
+	// "§ 11.4", "§§ 11.4, 11.5 and 11.7"
+	sectionRefPattern = regexp.MustCompile(`§§?\s*((?:\d+\.\d+[a-z]?)(?:(?:,\s*|,?\s+(?:and|or|through)\s+)(?:§\s*)?\d+\.\d+[a-z]?)*)`)
+	// "part 25", "parts 25 and 27"
+	partRefPattern   = regexp.MustCompile(`(?i)\bparts?\s+((?:\d+)(?:(?:,\s*|,?\s+(?:and|or|through)\s+)\d+)*)\b`)
+	refNumberPattern = regexp.MustCompile(`\d+(?:\.\d+[a-z]?)?`)
+)
+
+// ExtractCitations finds references in text, resolving title-less ones
+// ("§ 11.4", "part 25") against title. Ranges ("11.4 through 11.7") yield
+// their endpoints only, since the sections between need the structure to
+// enumerate.
+func ExtractCitations(text string, title int) []Ref {
+	var out []Ref
+	var taken [][]int
+	overlaps := func(loc []int) bool {
+		for _, t := range taken {
+			if loc[0] < t[1] && t[0] < loc[1] {
+				return true
+			}
+		}
+		return false
+	}
+	addNumbers := func(t int, list string) {
+		for _, n := range refNumberPattern.FindAllString(list, -1) {
+			part, _, isSection := strings.Cut(n, ".")
+			r := Ref{Title: t, Part: part}
+			if isSection {
+				r.Section = n
+			}
+			out = append(out, r)
+		}
+	}
+
+	anchors := cfrAnchorPattern.FindAllStringSubmatchIndex(text, -1)
+	for i, m := range anchors {
+		end := len(text)
+		if i+1 < len(anchors) {
+			end = anchors[i+1][0] // "parts 60 and 40 CFR 63" must not eat the 40
+		}
+		list := cfrListPattern.FindString(text[m[1]:end])
+		if list == "" {
+			continue
+		}
+		t, _ := strconv.Atoi(text[m[2]:m[3]])
+		taken = append(taken, []int{m[0], m[1] + len(list)})
+		addNumbers(t, list)
+	}
+	for _, m := range sectionRefPattern.FindAllStringSubmatchIndex(text, -1) {
+		if overlaps(m) {
+			continue
+		}
+		taken = append(taken, m[:2])
+		addNumbers(title, text[m[2]:m[3]])
+	}
+	for _, m := range partRefPattern.FindAllStringSubmatchIndex(text, -1) {
+		if overlaps(m) {
+			continue
+		}
+		addNumbers(title, text[m[2]:m[3]])
+	}
+	return out
+}
+
+// ParseCitation reads a single citation such as "40 CFR 60.4" or "40 CFR
+// part 60". It fails on text holding no citation or more than one.
+func ParseCitation(s string) (Ref, error) {
+	refs := ExtractCitations(s, 0)
+	if len(refs) != 1 || refs[0].Title == 0 {
+		return Ref{}, fmt.Errorf("%q is not a single CFR citation (like 40 CFR 60.4 or 40 CFR part 60)", s)
+	}
+	return refs[0], nil
+}
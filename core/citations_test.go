@@ -0,0 +1,44 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractCitations(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		want []Ref
+	}{
+		{"as required by 40 CFR 60.4", []Ref{{40, "60", "60.4"}}},
+		{"see 40 CFR parts 60 and 63", []Ref{{40, "60", ""}, {40, "63", ""}}},
+		{"under 40 CFR part 60 and 29 CFR 1910.1200", []Ref{{40, "60", ""}, {29, "1910", "1910.1200"}}},
+		{"40 CFR parts 60 and 40 CFR 63.1", []Ref{{40, "60", ""}, {40, "63", "63.1"}}},
+		{"in §§ 11.4, 11.5 and 11.7a", []Ref{{6, "11", "11.4"}, {6, "11", "11.5"}, {6, "11", "11.7a"}}},
+		{"§ 11.4 through § 11.7", []Ref{{6, "11", "11.4"}, {6, "11", "11.7"}}},
+		{"as provided in part 25 and parts 27, 29", []Ref{{6, "25", ""}, {6, "27", ""}, {6, "29", ""}}},
+		{"in 40 CFR 60.4 (not part 60 again)", []Ref{{40, "60", "60.4"}, {6, "60", ""}}},
+		{"no citations in 2024", nil},
+	} {
+		if got := ExtractCitations(tc.text, 6); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ExtractCitations(%q) = %v, want %v", tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestParseCitation(t *testing.T) {
+	for s, want := range map[string]Ref{
+		"40 CFR 60.4":    {40, "60", "60.4"},
+		"40 CFR part 60": {40, "60", ""},
+		"6 CFR Part 11":  {6, "11", ""},
+	} {
+		if got, err := ParseCitation(s); err != nil || got != want {
+			t.Errorf("ParseCitation(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "§ 60.4", "part 60", "40 CFR 60.4 and 60.5", "40 CFR"} {
+		if r, err := ParseCitation(s); err == nil {
+			t.Errorf("ParseCitation(%q) = %v, want an error", s, r)
+		}
+	}
+}
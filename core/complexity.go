@@ -0,0 +1,112 @@
+package core
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Complexity holds the raw ingredients of a part's complexity score.
+type Complexity struct {
+	Words        int64 `json:"words"`
+	Restrictions int64 `json:"restrictions"` // shall, must, may not, prohibited, required...
+	CrossRefs    int64 `json:"cross_refs"`   // § 11.4, part 25, 6 CFR ...
+	Conditionals int64 `json:"conditionals"` // if, except, unless, provided that...
+	MaxDepth     int   `json:"max_depth"`    // deepest paragraph label, (a)=1 (1)=2 (i)=3 (A)=4
+}
+
+var (
+	restrictionPattern = regexp.MustCompile(`(?i)\b(shall|must|may not|required|prohibited|no person may)\b`)
+	crossRefPattern    = regexp.MustCompile(`(?i)(§§?\s*\d|\bparts?\s+\d|\b\d+\s+CFR\b|\bU\.S\.C\.)`)
+	conditionPattern   = regexp.MustCompile(`(?i)\b(if|provided that|subject to|in the event)\b`)
+	exceptionPattern   = regexp.MustCompile(`(?i)\b(except|unless|notwithstanding)\b`)
+	paraLabelPattern   = regexp.MustCompile(`^\(([a-z]+|\d+|[A-Z]+)\)`)
+	romanPattern       = regexp.MustCompile(`^[ivxl]+$`)
+)
+
+// PartComplexity measures every PART in the tree. Text outside any part is
+// measured under "".
+func PartComplexity(root *Div) map[string]*Complexity {
+	out := map[string]*Complexity{}
+	var walk func(d *Div, part string)
+	walk = func(d *Div, part string) {
+		if d.Type == "PART" {
+			part = d.N
+		}
+		c := out[part]
+		if c == nil {
+			c = &Complexity{}
+			out[part] = c
+		}
+		c.Words += int64(len(strings.Fields(d.Head)))
+		prev := 0
+		for _, p := range d.Paras {
+			c.Words += int64(len(strings.Fields(p.Text)))
+			c.Restrictions += int64(len(restrictionPattern.FindAllStringIndex(p.Text, -1)))
+			c.CrossRefs += int64(len(crossRefPattern.FindAllStringIndex(p.Text, -1)))
+			conditions, exceptions := Conditionals(p.Text)
+			c.Conditionals += int64(conditions + exceptions)
+			if depth := paraDepth(p.Text, prev); depth > 0 {
+				prev = depth
+				c.MaxDepth = max(c.MaxDepth, depth)
+			}
+		}
+		for i := range d.Children {
+			walk(&d.Children[i], part)
+		}
+	}
+	walk(root, "")
+	return out
+}
+
+// paraDepth infers a paragraph's nesting level from its leading label
+// following the CFR scheme (a), (1), (i), (A). Roman numerals and letters
+// overlap, so (i), (v) and (x) count as roman only below a numbered level.
+func paraDepth(text string, prev int) int {
+	m := paraLabelPattern.FindStringSubmatch(strings.TrimSpace(text))
+	if m == nil {
+		return 0
+	}
+	label := m[1]
+	switch {
+	case label[0] >= '0' && label[0] <= '9':
+		return 2
+	case label[0] >= 'A' && label[0] <= 'Z':
+		return 4
+	case romanPattern.MatchString(label) && prev >= 2:
+		return 3
+	default:
+		return 1
+	}
+}
+
+// SectionDepth returns the deepest and the mean enumeration depth of the
+// labelled paragraphs in a section, both zero when none are labelled.
+func SectionDepth(s *Div) (deepest int, mean float64) {
+	var sum, n, prev int
+	var walk func(d *Div)
+	walk = func(d *Div) {
+		for _, p := range d.Paras {
+			if depth := paraDepth(p.Text, prev); depth > 0 {
+				prev = depth
+				deepest = max(deepest, depth)
+				sum += depth
+				n++
+			}
+		}
+		for i := range d.Children {
+			walk(&d.Children[i])
+		}
+	}
+	walk(s)
+	if n > 0 {
+		mean = float64(sum) / float64(n)
+	}
+	return deepest, mean
+}
+
+// Conditionals counts conditional constructs (if, provided that, subject
+// to, in the event) and exception constructs (except, unless,
+// notwithstanding) in text.
+func Conditionals(text string) (conditions, exceptions int) {
+	return len(conditionPattern.FindAllStringIndex(text, -1)), len(exceptionPattern.FindAllStringIndex(text, -1))
+}
@@ -0,0 +1,184 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Deadline is a temporal expression found in regulatory text, normalised so
+// calendars can be built from it. Exactly one of Duration, Date or
+// Recurrence is set, matching Kind.
+type Deadline struct {
+	Phrase     string `json:"phrase"`               // the text as written
+	Kind       string `json:"kind"`                 // duration, date or recurrence
+	Duration   string `json:"duration,omitempty"`   // ISO 8601, e.g. P30D
+	Date       string `json:"date,omitempty"`       // YYYY-MM-DD
+	Recurrence string `json:"recurrence,omitempty"` // iCalendar RRULE, e.g. FREQ=YEARLY;BYMONTH=3;BYMONTHDAY=1
+	Trigger    string `json:"trigger,omitempty"`    // what a duration counts from, e.g. "after receipt of the notice"
+}
+
+const monthNames = `January|February|March|April|May|June|July|August|September|October|November|December`
+
+var (
+	// "within 30 days", "not later than thirty (30) days after ...", "90 days before ..."
+	durationPattern = regexp.MustCompile(`(?i)\b(?:within|not later than|no later than|at least)?\s*` +
+		`(\d+|[a-z]+(?:-[a-z]+)?)(?:\s*\((\d+)\))?\s+(business days|calendar days|days|weeks|months|years)\b` +
+		`((?:\s+(?:after|before|of|from|following|prior to)\b(?:\s+[^\s.;,]+){1,6}))?`)
+	triggerEnd = regexp.MustCompile(`(?i)\s(and|or|by|unless|except|whichever)\b`)
+	// "by January 1, 2026", "on or before March 15, 2025"
+	datePattern = regexp.MustCompile(`(?i)\b(?:by|before|on or before|not later than|no later than|until|effective)\s+(` + monthNames + `)\s+(\d{1,2}),\s+(\d{4})`)
+	// "by March 1 of each year", "on or before April 15 of every year"
+	annualDatePattern = regexp.MustCompile(`(?i)\b(?:by|before|on or before|not later than|no later than)\s+(` + monthNames + `)\s+(\d{1,2})\s+(?:of\s+)?(?:each|every)\s+(?:calendar\s+)?year`)
+	// "annually", "every two years", "quarterly"
+	recurrencePattern = regexp.MustCompile(`(?i)\b(annually|yearly|each year|every year|biennially|semiannually|semi-annually|twice a year|quarterly|monthly|each month|weekly|daily|every\s+(\d+|[a-z]+)\s+(years|months))\b`)
+)
+
+var numberWords = map[string]int{
+	"one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6, "seven": 7, "eight": 8, "nine": 9,
+	"ten": 10, "eleven": 11, "twelve": 12, "fourteen": 14, "fifteen": 15, "twenty": 20, "twenty-one": 21,
+	"thirty": 30, "forty-five": 45, "sixty": 60, "ninety": 90, "one-hundred-twenty": 120, "hundred": 100,
+}
+
+// number reads "30" or "thirty"; ok is false for anything else, which keeps
+// words like "several days" out of the dataset.
+func number(s string) (int, bool) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, true
+	}
+	n, ok := numberWords[strings.ToLower(s)]
+	return n, ok
+}
+
+// ExtractDeadlines finds and normalises the temporal expressions in text,
+// in the order they appear. More specific patterns claim text first, so
+// "by March 1 of each year" is one recurrence rather than a date fragment,
+// and "every two years" a recurrence rather than a duration.
+func ExtractDeadlines(text string) []Deadline {
+	type found struct {
+		at int
+		d  Deadline
+	}
+	var all []found
+	var taken [][]int
+	overlaps := func(loc []int) bool {
+		for _, t := range taken {
+			if loc[0] < t[1] && t[0] < loc[1] {
+				return true
+			}
+		}
+		return false
+	}
+	add := func(loc []int, d Deadline) {
+		if overlaps(loc) {
+			return
+		}
+		taken = append(taken, loc[:2])
+		d.Phrase = strings.TrimSpace(text[loc[0]:loc[1]])
+		all = append(all, found{loc[0], d})
+	}
+
+	for _, m := range annualDatePattern.FindAllStringSubmatchIndex(text, -1) {
+		month, _ := time.Parse("January", text[m[2]:m[3]])
+		day, _ := strconv.Atoi(text[m[4]:m[5]])
+		add(m, Deadline{Kind: "recurrence", Recurrence: fmt.Sprintf("FREQ=YEARLY;BYMONTH=%d;BYMONTHDAY=%d", int(month.Month()), day)})
+	}
+	for _, m := range datePattern.FindAllStringSubmatchIndex(text, -1) {
+		s := fmt.Sprintf("%s %s, %s", text[m[2]:m[3]], text[m[4]:m[5]], text[m[6]:m[7]])
+		t, err := time.Parse("January 2, 2006", s)
+		if err != nil {
+			continue
+		}
+		add(m, Deadline{Kind: "date", Date: t.Format("2006-01-02")})
+	}
+	for _, m := range recurrencePattern.FindAllStringSubmatchIndex(text, -1) {
+		rule, ok := recurrenceRule(text[m[2]:m[3]], m, text)
+		if !ok {
+			continue
+		}
+		add(m, Deadline{Kind: "recurrence", Recurrence: rule})
+	}
+	for _, m := range durationPattern.FindAllStringSubmatchIndex(text, -1) {
+		word := text[m[2]:m[3]]
+		if m[4] >= 0 {
+			word = text[m[4]:m[5]] // "thirty (30)": trust the digits
+		}
+		n, ok := number(word)
+		if !ok {
+			continue
+		}
+		unit := strings.ToLower(text[m[6]:m[7]])
+		d := Deadline{Kind: "duration", Duration: isoDuration(n, unit)}
+		if m[8] >= 0 {
+			// the trigger ends at the next clause, which may hold a
+			// deadline of its own
+			trigger := text[m[8]:m[9]]
+			if i := triggerEnd.FindStringIndex(trigger); i != nil {
+				trigger = trigger[:i[0]]
+				m[1] = m[8] + i[0]
+			}
+			d.Trigger = strings.TrimSpace(trigger)
+		}
+		add(m, d)
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].at < all[j].at })
+	out := make([]Deadline, len(all))
+	for i, f := range all {
+		out[i] = f.d
+	}
+	return out
+}
+
+// isoDuration writes n units as ISO 8601. Business days have no ISO form;
+// they are approximated as calendar weeks of five days, rounded up.
+func isoDuration(n int, unit string) string {
+	switch unit {
+	case "business days":
+		weeks := (n + 4) / 5
+		return fmt.Sprintf("P%dW", weeks)
+	case "weeks":
+		return fmt.Sprintf("P%dW", n)
+	case "months":
+		return fmt.Sprintf("P%dM", n)
+	case "years":
+		return fmt.Sprintf("P%dY", n)
+	default:
+		return fmt.Sprintf("P%dD", n)
+	}
+}
+
+func recurrenceRule(phrase string, m []int, text string) (string, bool) {
+	switch strings.ToLower(phrase) {
+	case "annually", "yearly", "each year", "every year":
+		return "FREQ=YEARLY", true
+	case "biennially":
+		return "FREQ=YEARLY;INTERVAL=2", true
+	case "semiannually", "semi-annually", "twice a year":
+		return "FREQ=MONTHLY;INTERVAL=6", true
+	case "quarterly":
+		return "FREQ=MONTHLY;INTERVAL=3", true
+	case "monthly", "each month":
+		return "FREQ=MONTHLY", true
+	case "weekly":
+		return "FREQ=WEEKLY", true
+	case "daily":
+		return "FREQ=DAILY", true
+	}
+	// every N years|months
+	n, ok := number(text[m[4]:m[5]])
+	if !ok || n < 1 {
+		return "", false
+	}
+	freq := "YEARLY"
+	if strings.EqualFold(text[m[6]:m[7]], "months") {
+		freq = "MONTHLY"
+	}
+	if n == 1 {
+		return "FREQ=" + freq, true
+	}
+	return fmt.Sprintf("FREQ=%s;INTERVAL=%d", freq, n), true
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractDeadlines(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		want []Deadline
+	}{
+		{
+			"The owner shall submit the report within thirty (30) days after receipt of the notice and by January 1, 2026.",
+			[]Deadline{
+				{Phrase: "within thirty (30) days after receipt of the notice", Kind: "duration", Duration: "P30D", Trigger: "after receipt of the notice"},
+				{Phrase: "by January 1, 2026", Kind: "date", Date: "2026-01-01"},
+			},
+		},
+		{
+			"Reports are due by March 1 of each year and must be updated every two years.",
+			[]Deadline{
+				{Phrase: "by March 1 of each year", Kind: "recurrence", Recurrence: "FREQ=YEARLY;BYMONTH=3;BYMONTHDAY=1"},
+				{Phrase: "every two years", Kind: "recurrence", Recurrence: "FREQ=YEARLY;INTERVAL=2"},
+			},
+		},
+		{
+			"Inspect the tank quarterly, or not later than 10 business days following a spill.",
+			[]Deadline{
+				{Phrase: "quarterly", Kind: "recurrence", Recurrence: "FREQ=MONTHLY;INTERVAL=3"},
+				{Phrase: "not later than 10 business days following a spill", Kind: "duration", Duration: "P2W", Trigger: "following a spill"},
+			},
+		},
+		{
+			"Submit no later than 90 days before the start of operation unless the Administrator approves.",
+			[]Deadline{{Phrase: "no later than 90 days before the start of operation", Kind: "duration", Duration: "P90D", Trigger: "before the start of operation"}},
+		},
+		{
+			"Records must be kept for several days; a fee is charged monthly.",
+			[]Deadline{{Phrase: "monthly", Kind: "recurrence", Recurrence: "FREQ=MONTHLY"}},
+		},
+		{"by February 30, 2025", nil},
+		{"No deadline here.", nil},
+	} {
+		got := ExtractDeadlines(tc.text)
+		if len(got) == 0 && len(tc.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ExtractDeadlines(%q)\n got %+v\nwant %+v", tc.text, got, tc.want)
+		}
+	}
+}
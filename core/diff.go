@@ -0,0 +1,175 @@
+package core
+
+import "strings"
+
+// ParaBreak is the token DiffTokens inputs use to mark paragraph ends, so
+// renderers of the edit script can keep the source paragraphing.
+const ParaBreak = "\n"
+
+// EditOp says how a run of tokens moved between the old and new text.
+type EditOp int
+
+const (
+	OpEqual EditOp = iota
+	OpDelete
+	OpInsert
+)
+
+// Edit is a maximal run of tokens sharing one op.
+type Edit struct {
+	Op     EditOp
+	Tokens []string
+}
+
+// DiffTokens returns the shortest Edit script turning a into b (Myers'
+// O(ND) algorithm, in its linear-space divide-and-conquer form), with
+// adjacent tokens of the same op coalesced. Tokens are compared after
+// NormalizeTypography, so curly against straight quotes or an em dash
+// against a hyphen is no edit; equal runs carry b's tokens.
+//
+// A stretch too rewritten to diff within diffCostBudget, such as a large
+// table replaced outright, comes back as a deletion and an insertion of
+// the whole stretch rather than after minutes of search.
+func DiffTokens(a, b []string) []Edit {
+	d := &differ{ra: a, rb: b, a: normalizeTokens(a), b: normalizeTokens(b)}
+	n := len(a) + len(b)
+	d.limit = min((n+1)/2, max(diffMinCost, diffCostBudget/max(1, n)))
+	d.vf = make([]int, 2*d.limit+5)
+	d.vb = make([]int, 2*d.limit+5)
+	d.diff(0, len(a), 0, len(b))
+	return d.out
+}
+
+// diffCostBudget bounds the work of the middle-snake search on one
+// stretch, as edit rounds times tokens; diffMinCost is the fewest rounds
+// any stretch gets.
+const (
+	diffCostBudget = 1 << 27
+	diffMinCost    = 256
+)
+
+// differ holds the state of one DiffTokens: the tokens as written (ra, rb)
+// and as compared (a, b), the search vectors, reused across the recursion,
+// and the script so far.
+type differ struct {
+	ra, rb, a, b []string
+	limit        int // middle-snake rounds before giving up on a stretch
+	vf, vb       []int
+	out          []Edit
+}
+
+func (d *differ) emit(op EditOp, toks []string) {
+	if len(toks) == 0 {
+		return
+	}
+	if n := len(d.out); n > 0 && d.out[n-1].Op == op {
+		d.out[n-1].Tokens = append(d.out[n-1].Tokens, toks...)
+		return
+	}
+	d.out = append(d.out, Edit{Op: op, Tokens: append([]string(nil), toks...)})
+}
+
+// diff emits the script turning a[a0:a1] into b[b0:b1].
+func (d *differ) diff(a0, a1, b0, b1 int) {
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		d.emit(OpEqual, d.rb[b0:b0+1])
+		a0++
+		b0++
+	}
+	suffix := 0
+	for a1-suffix > a0 && b1-suffix > b0 && d.a[a1-suffix-1] == d.b[b1-suffix-1] {
+		suffix++
+	}
+	a1, b1 = a1-suffix, b1-suffix
+
+	switch {
+	case a0 == a1:
+		d.emit(OpInsert, d.rb[b0:b1])
+	case b0 == b1:
+		d.emit(OpDelete, d.ra[a0:a1])
+	default:
+		x, y, u, v, ok := d.middleSnake(a0, a1, b0, b1)
+		if !ok {
+			d.emit(OpDelete, d.ra[a0:a1])
+			d.emit(OpInsert, d.rb[b0:b1])
+			break
+		}
+		d.diff(a0, x, b0, y)
+		d.emit(OpEqual, d.rb[y:v])
+		d.diff(u, a1, v, b1)
+	}
+	d.emit(OpEqual, d.rb[b1:b1+suffix])
+}
+
+// middleSnake finds the diagonal run (x,y)-(u,v) halfway along a shortest
+// path through a[a0:a1] and b[b0:b1], searching forward from the start
+// and backward from the end at once. The caller has trimmed common ends,
+// so both ranges are non-empty and the path has at least two edits,
+// which keeps both halves smaller than the whole. ok is false once the
+// search passes d.limit rounds.
+func (d *differ) middleSnake(a0, a1, b0, b1 int) (x, y, u, v int, ok bool) {
+	n, m := a1-a0, b1-b0
+	delta := n - m
+	odd := delta%2 != 0
+	off := d.limit + 2
+	// vf[off+k] is the furthest x reached on diagonal k = x-y from the
+	// start; vb[off+c] the furthest reached on c = (n-x)-(m-y) from the
+	// end, counted from the end.
+	vf, vb := d.vf, d.vb
+	vf[off+1], vb[off+1] = 0, 0
+	for D := 0; D <= (n+m+1)/2; D++ {
+		if D > d.limit {
+			return 0, 0, 0, 0, false
+		}
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && vf[off+k-1] < vf[off+k+1]) {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && d.a[a0+x] == d.b[b0+y] {
+				x++
+				y++
+			}
+			vf[off+k] = x
+			if c := delta - k; odd && c >= -(D-1) && c <= D-1 && x+vb[off+c] >= n {
+				return a0 + x0, b0 + y0, a0 + x, b0 + y, true
+			}
+		}
+		for c := -D; c <= D; c += 2 {
+			var x int
+			if c == -D || (c != D && vb[off+c-1] < vb[off+c+1]) {
+				x = vb[off+c+1]
+			} else {
+				x = vb[off+c-1] + 1
+			}
+			y := x - c
+			x0, y0 := x, y
+			for x < n && y < m && d.a[a1-1-x] == d.b[b1-1-y] {
+				x++
+				y++
+			}
+			vb[off+c] = x
+			if k := delta - c; !odd && k >= -D && k <= D && x+vf[off+k] >= n {
+				return a1 - x, b1 - y, a1 - x0, b1 - y0, true
+			}
+		}
+	}
+	panic("core: no middle snake") // unreachable: some D <= (n+m+1)/2 meets
+}
+
+// normalizeTokens applies NormalizeTypography to every token. A token that
+// normalizes to nothing (a stray soft hyphen) stays as it was rather than
+// vanishing from the comparison.
+func normalizeTokens(toks []string) []string {
+	out := make([]string, len(toks))
+	for i, t := range toks {
+		if out[i] = strings.Join(strings.Fields(NormalizeTypography(t)), " "); out[i] == "" {
+			out[i] = t
+		}
+	}
+	return out
+}
@@ -0,0 +1,135 @@
+package core
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffTokens(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want []Edit
+	}{
+		{"", "", nil},
+		{"a b c", "a b c", []Edit{{OpEqual, []string{"a", "b", "c"}}}},
+		{"", "a b", []Edit{{OpInsert, []string{"a", "b"}}}},
+		{"a b", "", []Edit{{OpDelete, []string{"a", "b"}}}},
+		{"the rule applies", "the rule no longer applies", []Edit{
+			{OpEqual, []string{"the", "rule"}},
+			{OpInsert, []string{"no", "longer"}},
+			{OpEqual, []string{"applies"}},
+		}},
+		{"shall submit a report", "shall file a report", []Edit{
+			{OpEqual, []string{"shall"}},
+			{OpDelete, []string{"submit"}},
+			{OpInsert, []string{"file"}},
+			{OpEqual, []string{"a", "report"}},
+		}},
+		// Typography alone is no edit, and the new spelling is kept.
+		{"the “owner” — or operator", `the "owner" - or operator`, []Edit{
+			{OpEqual, []string{"the", `"owner"`, "-", "or", "operator"}},
+		}},
+	} {
+		got := DiffTokens(strings.Fields(tc.a), strings.Fields(tc.b))
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("DiffTokens(%q, %q)\n got %v\nwant %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+// TestDiffTokensShortest checks random scripts rebuild both sides and are
+// as short as the edit distance an LCS table gives.
+func TestDiffTokensShortest(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	words := func() []string {
+		w := make([]string, rng.Intn(40))
+		for i := range w {
+			w[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return w
+	}
+	for i := 0; i < 2000; i++ {
+		a, b := words(), words()
+		edits := DiffTokens(a, b)
+		var gotA, gotB []string
+		n := 0
+		for j, e := range edits {
+			if len(e.Tokens) == 0 || j > 0 && edits[j-1].Op == e.Op {
+				t.Fatalf("%v -> %v: uncoalesced script %v", a, b, edits)
+			}
+			if e.Op != OpInsert {
+				gotA = append(gotA, e.Tokens...)
+			}
+			if e.Op != OpDelete {
+				gotB = append(gotB, e.Tokens...)
+			}
+			if e.Op != OpEqual {
+				n += len(e.Tokens)
+			}
+		}
+		if fmt.Sprint(gotA) != fmt.Sprint(a) || fmt.Sprint(gotB) != fmt.Sprint(b) {
+			t.Fatalf("%v -> %v: script %v rebuilds %v -> %v", a, b, edits, gotA, gotB)
+		}
+		if want := len(a) + len(b) - 2*lcsLen(a, b); n != want {
+			t.Fatalf("%v -> %v: %d edits, want %d", a, b, n, want)
+		}
+	}
+}
+
+func lcsLen(a, b []string) int {
+	prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(cur[j], prev[j+1])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// A large section rewritten outright, like a replaced table, must not
+// take memory or time in proportion to its edit distance times its size.
+func TestDiffTokensRewrittenTable(t *testing.T) {
+	const n = 100000
+	a, b := make([]string, n), make([]string, n)
+	for i := range a {
+		a[i] = fmt.Sprintf("old%d", i)
+		b[i] = fmt.Sprintf("new%d", i)
+	}
+	a[n/2], b[n/2] = "kept", "kept"
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	edits := DiffTokens(a, b)
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	deleted, inserted := 0, 0
+	for _, e := range edits {
+		switch e.Op {
+		case OpDelete:
+			deleted += len(e.Tokens)
+		case OpInsert:
+			inserted += len(e.Tokens)
+		}
+	}
+	if deleted < n-1 || inserted < n-1 {
+		t.Errorf("deleted %d and inserted %d tokens, want all %d of each but one", deleted, inserted, n)
+	}
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 64<<20 {
+		t.Errorf("allocated %d MB", alloc>>20)
+	}
+	if elapsed > 10*time.Second {
+		t.Errorf("took %v", elapsed)
+	}
+}
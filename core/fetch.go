@@ -0,0 +1,22 @@
+package core
+
+import (
+	"context"
+	"io"
+)
+
+// Fetcher retrieves a URL. The CLI backs it with its caching, rate limited
+// HTTP stack; the WebAssembly build backs it with the browser's fetch.
+type Fetcher interface {
+	Fetch(ctx context.Context, url string) (io.ReadCloser, error)
+}
+
+// Load fetches a full-title XML document and parses it.
+func Load(ctx context.Context, f Fetcher, url string) (*ECFRFile, error) {
+	body, err := f.Fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return ParseFile(body)
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// Footnote is one note of an FTNT block. Its text is kept out of Paras so
+// it doesn't land in the middle of the sentence that cites it.
+type Footnote struct {
+	Mark string `json:"mark"` // e.g. "1", as in the SU that opens it
+	Text string `json:"text"`
+}
+
+// Anchor is a footnote reference within a Para: the superscript Mark,
+// which followed the first Word words of the Para's Text.
+type Anchor struct {
+	Mark string
+	Word int
+}
+
+// footnoteElement reads an FTNT up to its end tag. Each paragraph is a
+// footnote whose leading SU is its mark.
+func footnoteElement(dec *xml.Decoder) ([]Footnote, error) {
+	var out []Footnote
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("footnote: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			var gs []Graphic
+			s, anchors, err := blockText(dec, t, &gs)
+			if err != nil {
+				return nil, err
+			}
+			f := Footnote{Text: s}
+			if len(anchors) > 0 && anchors[0].Word == 0 {
+				f.Mark = anchors[0].Mark
+				anchors = anchors[1:]
+			}
+			f.Text = spliceMarks(f.Text, anchors)
+			if f.Mark != "" || f.Text != "" {
+				out = append(out, f)
+			}
+		case xml.CharData:
+			if s := strings.Join(strings.Fields(string(t)), " "); s != "" {
+				out = append(out, Footnote{Text: s})
+			}
+		case xml.EndElement:
+			return out, nil
+		}
+	}
+}
+
+// resolveAnchors keeps the anchors in d's paragraphs that refer to one of
+// d's footnotes. Any other SU was a superscript (an exponent, say) and goes
+// back into the text where it was.
+func resolveAnchors(d *Div) {
+	marks := map[string]bool{}
+	for _, f := range d.Footnotes {
+		marks[f.Mark] = true
+	}
+	for i := range d.Paras {
+		p := &d.Paras[i]
+		if p.Anchors == nil {
+			continue
+		}
+		var keep, back []Anchor
+		shift := 0 // words put back ahead of the next kept anchor
+		for _, a := range p.Anchors {
+			if marks[a.Mark] {
+				a.Word += shift
+				keep = append(keep, a)
+			} else {
+				back = append(back, a)
+				shift += len(strings.Fields(a.Mark))
+			}
+		}
+		p.Text = spliceMarks(p.Text, back)
+		p.Anchors = keep
+	}
+}
+
+// spliceMarks puts anchor marks back into text as words of their own.
+func spliceMarks(text string, anchors []Anchor) string {
+	if len(anchors) == 0 {
+		return text
+	}
+	words := strings.Fields(text)
+	var out []string
+	i := 0
+	for _, a := range anchors {
+		for ; i < a.Word && i < len(words); i++ {
+			out = append(out, words[i])
+		}
+		out = append(out, strings.Fields(a.Mark)...)
+	}
+	out = append(out, words[i:]...)
+	return strings.Join(out, " ")
+}
+
+// AllFootnotes returns the footnotes of d and every Div under it, in
+// document order.
+func (d *Div) AllFootnotes() []Footnote {
+	var out []Footnote
+	var walk func(d *Div)
+	walk = func(d *Div) {
+		out = append(out, d.Footnotes...)
+		for i := range d.Children {
+			walk(&d.Children[i])
+		}
+	}
+	walk(d)
+	return out
+}
+
+// String formats a footnote for plain text output, e.g. "[1] See § 60.17."
+func (f Footnote) String() string {
+	if f.Mark == "" {
+		return f.Text
+	}
+	return "[" + f.Mark + "] " + f.Text
+}
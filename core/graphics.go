@@ -0,0 +1,90 @@
+package core
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Graphic is a figure referenced from the text: a GPH or MATH block, which
+// names its image by GID or MID, or an inline img.
+type Graphic struct {
+	Kind string `json:"kind"`          // GPH, MATH or img
+	ID   string `json:"id"`            // GID/MID, or an img's file name
+	Src  string `json:"src,omitempty"` // img src as written
+}
+
+// blockText is elementText for a block element that may carry figures and
+// footnote references: graphics found at any depth are appended to gs, and
+// superscripts (SU) are left out of the text and returned as anchors for
+// resolveAnchors to sort out.
+func blockText(dec *xml.Decoder, start xml.StartElement, gs *[]Graphic) (string, []Anchor, error) {
+	var b strings.Builder
+	open := -1    // index in *gs of the GPH/MATH awaiting its id
+	inID := false // inside that GID/MID
+	seen := func(t xml.StartElement) {
+		switch t.Name.Local {
+		case "GPH", "MATH":
+			*gs = append(*gs, Graphic{Kind: t.Name.Local})
+			open = len(*gs) - 1
+		case "GID", "MID":
+			inID = open >= 0
+		case "img":
+			src := attr(t, "src")
+			if src != "" {
+				*gs = append(*gs, Graphic{Kind: "img", ID: path.Base(src), Src: src})
+			}
+		}
+	}
+	seen(start)
+	var anchors []Anchor
+	for depth := 1; depth > 0; {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", nil, fmt.Errorf("element text: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "SU" {
+				mark, err := elementText(dec)
+				if err != nil {
+					return "", nil, err
+				}
+				if mark != "" {
+					anchors = append(anchors, Anchor{Mark: mark, Word: len(strings.Fields(b.String()))})
+				}
+				continue
+			}
+			depth++
+			seen(t)
+		case xml.EndElement:
+			depth--
+			if t.Name.Local == "GID" || t.Name.Local == "MID" {
+				inID = false
+			}
+		case xml.CharData:
+			if inID {
+				(*gs)[open].ID += strings.TrimSpace(string(t))
+			}
+			b.Write(t)
+			b.WriteByte(' ')
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " "), anchors, nil
+}
+
+// AllGraphics returns the figures of d and every Div under it, in document
+// order.
+func (d *Div) AllGraphics() []Graphic {
+	var out []Graphic
+	var walk func(d *Div)
+	walk = func(d *Div) {
+		out = append(out, d.Graphics...)
+		for i := range d.Children {
+			walk(&d.Children[i])
+		}
+	}
+	walk(d)
+	return out
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Note is an amendment note attached to a Div: an effective date note
+// (EFFDNOT), which usually says when pending or delayed amendments take
+// effect, or an editorial note (EDNOTE).
+type Note struct {
+	Kind    string   `json:"kind"`              // EFFDNOT or EDNOTE
+	Heading string   `json:"heading,omitempty"` // e.g. "Effective Date Note:"
+	Text    string   `json:"text"`              // paragraphs, one per line
+	FR      []string `json:"fr,omitempty"`      // Federal Register citations, e.g. "88 FR 1234"
+	// Effective lists the dates the note says something takes effect or is
+	// delayed until, YYYY-MM-DD in order of appearance.
+	Effective []string `json:"effective,omitempty"`
+}
+
+func isNote(name string) bool {
+	return name == "EFFDNOT" || name == "EDNOTE"
+}
+
+var (
+	frCitePattern = regexp.MustCompile(`\b(\d{1,3}) FR (\d{1,6})\b`)
+	// "effective Jan. 1, 2025", "delayed until March 15, 2025"; the FR's
+	// abbreviated months are as common as full ones here
+	noteDatePattern = regexp.MustCompile(`(?i)\b(?:effective|delayed until|delayed to|stayed until)\b[^.;]{0,40}?` +
+		`\b(Jan|Feb|Mar|Apr|May|June?|July?|Aug|Sept?|Oct|Nov|Dec)[a-z]*\.?\s+(\d{1,2}),\s+(\d{4})`)
+)
+
+// noteElement reads an EFFDNOT or EDNOTE up to its end tag, keeping the
+// heading apart from the paragraphs.
+func noteElement(dec *xml.Decoder, kind string) (Note, error) {
+	n := Note{Kind: kind}
+	var paras []string
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return n, fmt.Errorf("note: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			s, err := elementText(dec)
+			if err != nil {
+				return n, err
+			}
+			if t.Name.Local == "HED" {
+				n.Heading = s
+			} else if s != "" {
+				paras = append(paras, s)
+			}
+		case xml.CharData:
+			if s := strings.Join(strings.Fields(string(t)), " "); s != "" {
+				paras = append(paras, s)
+			}
+		case xml.EndElement:
+			n.Text = strings.Join(paras, "\n")
+			n.FR, n.Effective = noteRefs(n.Text)
+			return n, nil
+		}
+	}
+}
+
+// noteRefs pulls the FR citations and effective dates out of note text.
+func noteRefs(text string) (fr, effective []string) {
+	for _, m := range frCitePattern.FindAllStringSubmatch(text, -1) {
+		fr = append(fr, m[1]+" FR "+m[2])
+	}
+	for _, m := range noteDatePattern.FindAllStringSubmatch(text, -1) {
+		t, err := time.Parse("Jan 2 2006", m[1][:3]+" "+m[2]+" "+m[3])
+		if err != nil {
+			continue
+		}
+		effective = append(effective, t.Format("2006-01-02"))
+	}
+	return fr, effective
+}
+
+// AllNotes returns the amendment notes of d and every Div under it, in
+// document order.
+func (d *Div) AllNotes() []Note {
+	var out []Note
+	var walk func(d *Div)
+	walk = func(d *Div) {
+		out = append(out, d.Notes...)
+		for i := range d.Children {
+			walk(&d.Children[i])
+		}
+	}
+	walk(d)
+	return out
+}
+
+// String formats a note for plain text output: the heading with what was
+// extracted from it, then the text.
+func (n Note) String() string {
+	head := n.Heading
+	if head == "" {
+		head = n.Kind
+	}
+	var refs []string
+	if len(n.Effective) > 0 {
+		refs = append(refs, "effective "+strings.Join(n.Effective, ", "))
+	}
+	refs = append(refs, n.FR...)
+	if len(refs) > 0 {
+		head += " [" + strings.Join(refs, "; ") + "]"
+	}
+	return head + "\n" + n.Text
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseNotes(t *testing.T) {
+	root, err := ParseDocument(strings.NewReader(`<DIV5 N="60" TYPE="PART"><HEAD>PART 60</HEAD>
+<DIV8 N="60.4" TYPE="SECTION"><HEAD>§ 60.4 Address.</HEAD><P>All requests shall be submitted.</P>
+<EFFDNOT><HED>Effective Date Note:</HED><PSPACE>At 88 FR 1234, Jan. 5, 2023, § 60.4 was amended, effective Feb. 6, 2023. At 89 FR 56, the effective date was delayed until March 15, 2025.</PSPACE></EFFDNOT>
+</DIV8>
+<EDNOTE><HED>Editorial Note:</HED><PSPACE>Nomenclature changes to part 60 appear at 65 FR 1000.</PSPACE></EDNOTE>
+</DIV5>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Note{
+		{
+			Kind:      "EFFDNOT",
+			Heading:   "Effective Date Note:",
+			Text:      "At 88 FR 1234, Jan. 5, 2023, § 60.4 was amended, effective Feb. 6, 2023. At 89 FR 56, the effective date was delayed until March 15, 2025.",
+			FR:        []string{"88 FR 1234", "89 FR 56"},
+			Effective: []string{"2023-02-06", "2025-03-15"},
+		},
+		{
+			Kind:    "EDNOTE",
+			Heading: "Editorial Note:",
+			Text:    "Nomenclature changes to part 60 appear at 65 FR 1000.",
+			FR:      []string{"65 FR 1000"},
+		},
+	}
+	got := root.AllNotes()
+	// The part's own note comes before those of its sections.
+	if len(got) == 2 {
+		got[0], got[1] = got[1], got[0]
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AllNotes\n got %+v\nwant %+v", got, want)
+	}
+	// Notes still count as text, heading first.
+	if paras := root.Children[0].Paras; len(paras) != 2 || paras[1].Tag != "EFFDNOT" || !strings.HasPrefix(paras[1].Text, "Effective Date Note: At 88 FR 1234") {
+		t.Errorf("section paragraphs %+v", paras)
+	}
+	if s := want[1].String(); s != "Editorial Note: [65 FR 1000]\nNomenclature changes to part 60 appear at 65 FR 1000." {
+		t.Errorf("String = %q", s)
+	}
+}
@@ -0,0 +1,295 @@
+package core
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseDocument decodes a full-title XML document into its root Div. It
+// accepts both the bulk-data wrapper (<DLPSTEXTCLASS>) and the bare <DIV1>
+// documents returned by the versioner /full endpoint.
+func ParseDocument(r io.Reader) (*Div, error) {
+	f, err := ParseFile(r)
+	if err != nil {
+		return nil, err
+	}
+	return f.Root(), nil
+}
+
+// ParseFile is ParseDocument for callers that want the whole ECFRFile. Bare
+// DIV documents are wrapped so Root works the same for both shapes.
+func ParseFile(r io.Reader) (*ECFRFile, error) {
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		var f ECFRFile
+		if start.Name.Local == "DLPSTEXTCLASS" {
+			err = dec.DecodeElement(&f, &start)
+		} else {
+			err = dec.DecodeElement(&f.Text.Body.Browser.Div, &start)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &f, nil
+	}
+}
+
+// Root returns the top DIV (normally the TITLE) of the document.
+func (f *ECFRFile) Root() *Div {
+	return &f.Text.Body.Browser.Div
+}
+
+func isDiv(name string) bool {
+	return len(name) == 4 && strings.HasPrefix(name, "DIV") && name[3] >= '1' && name[3] <= '9'
+}
+
+// UnmarshalXML keeps DIVn children as a recursive tree and flattens every
+// other block element (P, FP, CITA, …) into Paras in document order.
+// Footnotes (FTNT) go to Footnotes instead, referenced by the Paras'
+// Anchors.
+func (d *Div) UnmarshalXML(dec *xml.Decoder, start xml.StartElement) error {
+	d.XMLName = start.Name
+	for _, a := range start.Attr {
+		switch a.Name.Local {
+		case "N":
+			d.N = a.Value
+		case "NODE":
+			d.Node = a.Value
+		case "TYPE":
+			d.Type = a.Value
+		}
+	}
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case isDiv(t.Name.Local):
+				var c Div
+				if err := dec.DecodeElement(&c, &t); err != nil {
+					return err
+				}
+				d.Children = append(d.Children, c)
+			case t.Name.Local == "HEAD":
+				if d.Head, err = elementText(dec); err != nil {
+					return err
+				}
+			case t.Name.Local == "TEXT":
+				d.Text = &DivText{}
+				if err := dec.DecodeElement(d.Text, &t); err != nil {
+					return err
+				}
+			case isNote(t.Name.Local):
+				n, err := noteElement(dec, t.Name.Local)
+				if err != nil {
+					return err
+				}
+				d.Notes = append(d.Notes, n)
+				if text := strings.Join(strings.Fields(n.Heading+" "+n.Text), " "); text != "" {
+					d.Paras = append(d.Paras, Para{Tag: t.Name.Local, Text: text})
+				}
+			case t.Name.Local == "FTNT":
+				fs, err := footnoteElement(dec)
+				if err != nil {
+					return err
+				}
+				d.Footnotes = append(d.Footnotes, fs...)
+			case t.Name.Local == "GPOTABLE":
+				p, err := tableElement(dec)
+				if err != nil {
+					return err
+				}
+				if p.Text != "" {
+					d.Paras = append(d.Paras, p)
+				}
+			default:
+				s, anchors, err := blockText(dec, t, &d.Graphics)
+				if err != nil {
+					return err
+				}
+				if s != "" || anchors != nil {
+					d.Paras = append(d.Paras, Para{Tag: t.Name.Local, Text: s, Anchors: anchors})
+				}
+			}
+		case xml.EndElement:
+			resolveAnchors(d)
+			return nil
+		}
+	}
+}
+
+// elementText consumes tokens up to the end of the current element and
+// returns its character data with whitespace collapsed.
+func elementText(dec *xml.Decoder) (string, error) {
+	var b strings.Builder
+	for depth := 1; depth > 0; {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", fmt.Errorf("element text: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			b.Write(t)
+			b.WriteByte(' ')
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " "), nil
+}
+
+// tableElement reads a GPOTABLE like elementText, additionally keeping its
+// cells: the CHED column headings as the first row, then each ROW's ENTs.
+func tableElement(dec *xml.Decoder) (Para, error) {
+	p := Para{Tag: "GPOTABLE"}
+	var all, cell strings.Builder
+	var heads, row []string
+	inCell := false
+	for depth := 1; depth > 0; {
+		tok, err := dec.Token()
+		if err != nil {
+			return p, fmt.Errorf("table: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			switch t.Name.Local {
+			case "CHED", "ENT":
+				inCell = true
+				cell.Reset()
+			case "ROW":
+				row = nil
+			}
+		case xml.EndElement:
+			depth--
+			text := strings.Join(strings.Fields(cell.String()), " ")
+			switch t.Name.Local {
+			case "CHED":
+				heads = append(heads, text)
+				inCell = false
+			case "ENT":
+				row = append(row, text)
+				inCell = false
+			case "ROW":
+				p.Rows = append(p.Rows, row)
+			}
+		case xml.CharData:
+			all.Write(t)
+			all.WriteByte(' ')
+			if inCell {
+				cell.Write(t)
+				cell.WriteByte(' ')
+			}
+		}
+	}
+	if heads != nil {
+		p.Rows = append([][]string{heads}, p.Rows...)
+	}
+	p.Text = strings.Join(strings.Fields(all.String()), " ")
+	return p, nil
+}
+
+// FindDiv returns the first Div in the tree (depth first) whose N is n.
+func FindDiv(d *Div, n string) *Div {
+	if d.N == n {
+		return d
+	}
+	for i := range d.Children {
+		if found := FindDiv(&d.Children[i], n); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// DivTokens flattens d's heading, paragraphs and footnotes into words, with
+// ParaBreak after every heading, paragraph and footnote.
+func DivTokens(d *Div) []string {
+	return divTokens(d, false)
+}
+
+// RowTokens is DivTokens except that each table row is a single token, so
+// diffs of table-heavy text report changed rows instead of word soup.
+func RowTokens(d *Div) []string {
+	return divTokens(d, true)
+}
+
+func divTokens(d *Div, rows bool) []string {
+	var toks []string
+	add := func(s string) {
+		if s == "" {
+			return
+		}
+		toks = append(toks, strings.Fields(s)...)
+		toks = append(toks, ParaBreak)
+	}
+	var walk func(d *Div)
+	walk = func(d *Div) {
+		add(d.Head)
+		for _, p := range d.Paras {
+			if rows && p.Rows != nil {
+				for _, r := range p.Rows {
+					toks = append(toks, strings.Join(r, " | "), ParaBreak)
+				}
+				continue
+			}
+			add(p.Text)
+		}
+		for _, f := range d.Footnotes {
+			add(f.String())
+		}
+		for i := range d.Children {
+			walk(&d.Children[i])
+		}
+	}
+	walk(d)
+	return toks
+}
+
+// WalkSections calls fn for every SECTION and APPENDIX Div under d.
+func WalkSections(d *Div, fn func(*Div)) {
+	if d.Type == "SECTION" || d.Type == "APPENDIX" {
+		fn(d)
+		return
+	}
+	for i := range d.Children {
+		WalkSections(&d.Children[i], fn)
+	}
+}
+
+// ParaText returns the paragraphs under d, one per line, without headings.
+// Each Div's footnotes follow its paragraphs.
+func ParaText(d *Div) string {
+	var b strings.Builder
+	var walk func(d *Div)
+	walk = func(d *Div) {
+		for _, p := range d.Paras {
+			b.WriteString(p.Text)
+			b.WriteByte('\n')
+		}
+		for _, f := range d.Footnotes {
+			b.WriteString(f.String())
+			b.WriteByte('\n')
+		}
+		for i := range d.Children {
+			walk(&d.Children[i])
+		}
+	}
+	walk(d)
+	return b.String()
+}
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SectionID is the canonical identifier of a provision, the one every
+// output that names sections or paragraphs carries:
+//
+//	title:chapter:part:section:paraPath
+//	40:I:60:60.4:b/1/i
+//
+// Trailing empty components are left off, so a whole section is
+// "40:I:60:60.4" and a part "40:I:60"; empty middle ones stay ("3::100:100.1"
+// for a title without chapters). Section is the section number or the
+// appendix designation, with spaces as underscores ("Appendix_A_to_Part_60").
+// Para is the paragraph's labels from the top down, joined by "/".
+//
+// Chapter locates the part rather than identifying it: part numbers are
+// unique within a title and survive transfers between chapters. Compare
+// with Same, which ignores it.
+type SectionID struct {
+	Title   int
+	Chapter string
+	Part    string
+	Section string
+	Para    string
+}
+
+// String formats the ID canonically.
+func (id SectionID) String() string {
+	parts := []string{strconv.Itoa(id.Title), idComponent(id.Chapter), idComponent(id.Part), idComponent(id.Section), id.Para}
+	for len(parts) > 1 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	return strings.Join(parts, ":")
+}
+
+// Same reports whether two IDs name the same provision, whatever chapter
+// each places its part in.
+func (id SectionID) Same(other SectionID) bool {
+	id.Chapter, other.Chapter = "", ""
+	return id.String() == other.String()
+}
+
+// ParseSectionID reads an ID formatted by String.
+func ParseSectionID(s string) (SectionID, error) {
+	f := strings.Split(s, ":")
+	if len(f) > 5 {
+		return SectionID{}, fmt.Errorf("section ID %q has more than 5 components", s)
+	}
+	title, err := strconv.Atoi(f[0])
+	if err != nil || title <= 0 {
+		return SectionID{}, fmt.Errorf("section ID %q: title %q is not a number", s, f[0])
+	}
+	f = append(f, make([]string, 5-len(f))...)
+	return SectionID{Title: title, Chapter: f[1], Part: f[2], Section: f[3], Para: f[4]}, nil
+}
+
+// idComponent normalizes a hierarchy identifier for an ID: no section
+// sign, whitespace runs as one underscore and no colons.
+func idComponent(s string) string {
+	s = strings.TrimLeft(strings.TrimSpace(s), "§ ")
+	return strings.ReplaceAll(strings.Join(strings.Fields(s), "_"), ":", "-")
+}
+
+// WalkSectionIDs calls fn for each section and appendix under root, in
+// document order, with its ID in title.
+func WalkSectionIDs(root *Div, title int, fn func(SectionID, *Div)) {
+	var walk func(d *Div, id SectionID)
+	walk = func(d *Div, id SectionID) {
+		switch d.Type {
+		case TypeChapter:
+			id.Chapter = d.N
+		case TypePart:
+			id.Part = d.N
+		case TypeSection, TypeAppendix:
+			id.Section = d.N
+			fn(id, d)
+			return
+		}
+		for i := range d.Children {
+			walk(&d.Children[i], id)
+		}
+	}
+	walk(root, SectionID{Title: title})
+}
+
+// PartChapters maps each part under root to the chapter holding it, for
+// IDs of provisions known only by part and section, like citations.
+func PartChapters(root *Div) map[string]string {
+	out := map[string]string{}
+	var walk func(d *Div, chapter string)
+	walk = func(d *Div, chapter string) {
+		switch d.Type {
+		case TypeChapter:
+			chapter = d.N
+		case TypePart:
+			out[d.N] = chapter
+			return
+		}
+		for i := range d.Children {
+			walk(&d.Children[i], chapter)
+		}
+	}
+	walk(root, "")
+	return out
+}
+
+// leadingLabelsPattern matches the run of labels opening a paragraph, as
+// in "(b)(1)(i) Each owner ...".
+var leadingLabelsPattern = regexp.MustCompile(`^(?:\((?:[a-z]+|\d+|[A-Z]+)\))+`)
+
+// ParaPaths returns the paragraph path of each of d's Paras, aligned with
+// them: "b/1/i" for a paragraph labelled (i) under (1) under (b). Text
+// before the first label has an empty path; unlabelled paragraphs after it
+// continue the labelled one before them.
+func ParaPaths(d *Div) []string {
+	out := make([]string, len(d.Paras))
+	var stack []string // labels by depth - 1
+	prev := 0
+	for i, p := range d.Paras {
+		run := leadingLabelsPattern.FindString(strings.TrimSpace(p.Text))
+		for _, label := range strings.Split(strings.Trim(run, "()"), ")(") {
+			if label == "" {
+				continue
+			}
+			depth := paraDepth("("+label+")", prev)
+			if depth > len(stack)+1 {
+				depth = len(stack) + 1 // a skipped level; keep the path contiguous
+			}
+			stack = append(stack[:depth-1], label)
+			prev = depth
+		}
+		out[i] = strings.Join(stack, "/")
+	}
+	return out
+}
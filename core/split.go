@@ -0,0 +1,79 @@
+package core
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// SplitParts cuts a document into pieces that parse on their own, so a
+// title too big to hold as one tree can be analyzed a PART at a time. fn is
+// called with each PART, nested in copies of its ancestors' start tags, and
+// finally (with part "") with the rest of the document: headings, front
+// matter and anything else outside a part. Pieces are read from r as fn
+// consumes them; SplitParts itself only keeps byte offsets.
+func SplitParts(r io.ReaderAt, size int64, fn func(part string, doc io.Reader) error) error {
+	type span struct{ start, end int64 }
+	type open struct {
+		name string
+		tag  span
+	}
+	dec := xml.NewDecoder(io.NewSectionReader(r, 0, size))
+	var stack []open
+	var cuts []span
+	for {
+		off := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if !isDiv(t.Name.Local) || attr(t, "TYPE") != "PART" {
+				stack = append(stack, open{t.Name.Local, span{off, dec.InputOffset()}})
+				continue
+			}
+			if err := dec.Skip(); err != nil {
+				return err
+			}
+			part := span{off, dec.InputOffset()}
+			cuts = append(cuts, part)
+			var pieces []io.Reader
+			for _, o := range stack {
+				pieces = append(pieces, io.NewSectionReader(r, o.tag.start, o.tag.end-o.tag.start))
+			}
+			pieces = append(pieces, io.NewSectionReader(r, part.start, part.end-part.start))
+			var closing strings.Builder
+			for i := len(stack) - 1; i >= 0; i-- {
+				closing.WriteString("</" + stack[i].name + ">")
+			}
+			pieces = append(pieces, strings.NewReader(closing.String()))
+			if err := fn(attr(t, "N"), io.MultiReader(pieces...)); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	var rest []io.Reader
+	var pos int64
+	for _, c := range cuts {
+		rest = append(rest, io.NewSectionReader(r, pos, c.start-pos))
+		pos = c.end
+	}
+	rest = append(rest, io.NewSectionReader(r, pos, size-pos))
+	return fn("", io.MultiReader(rest...))
+}
+
+func attr(t xml.StartElement, name string) string {
+	for _, a := range t.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
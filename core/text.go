@@ -0,0 +1,163 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PlainText streams the character data of an XML document, one space
+// between text nodes. Footnote text (FTNT) is held back until the end of
+// its DIV rather than interrupting the paragraphs around it. r is closed
+// once the document has been consumed. Counting words doesn't need the
+// text at all; see CountXMLWords.
+func PlainText(r io.ReadCloser) io.Reader {
+	dec := xml.NewDecoder(r)
+	returnedReader, w := io.Pipe()
+
+	go func() {
+		defer r.Close()
+		var notes bytes.Buffer
+		inNote := 0 // FTNT nesting depth
+		for {
+			tok, err := dec.Token()
+			if err == io.EOF {
+				w.Write(notes.Bytes())
+				w.Close()
+				return
+			}
+			if err != nil {
+				w.CloseWithError(err)
+				return
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				if t.Name.Local == "FTNT" {
+					inNote++
+				}
+			case xml.EndElement:
+				switch {
+				case t.Name.Local == "FTNT":
+					inNote--
+				case isDiv(t.Name.Local) && notes.Len() > 0:
+					w.Write(notes.Bytes())
+					notes.Reset()
+				}
+			case xml.CharData:
+				out := io.Writer(w)
+				if inNote > 0 {
+					out = &notes
+				}
+				out.Write(t)           // strips CR/LF/indent
+				out.Write([]byte{' '}) // word boundary
+			}
+		}
+	}()
+	return returnedReader
+}
+
+// CountXMLWords counts the words of an XML document's character data as
+// it is decoded, the same count as CountWords(PlainText(r)) but without a
+// goroutine, a pipe or a copy of the text: only the decoder's buffer and the
+// current text node are ever in memory.
+func CountXMLWords(r io.Reader) (int64, error) {
+	dec := xml.NewDecoder(r)
+	var count int64
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		if ch, ok := tok.(xml.CharData); ok {
+			count += countWords(ch)
+		}
+	}
+}
+
+// countWords counts the runs of non-space runes in b, splitting on the
+// same spaces as bufio.ScanWords.
+func countWords(b []byte) int64 {
+	var n int64
+	inWord := false
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		b = b[size:]
+		if unicode.IsSpace(r) {
+			inWord = false
+		} else if !inWord {
+			inWord = true
+			n++
+		}
+	}
+	return n
+}
+
+// CountWords counts whitespace separated words in r.
+func CountWords(r io.Reader) (int64, error) {
+	var count int64
+	scanner := bufio.NewScanner(r)
+	scanner.Split(bufio.ScanWords) //segment.SplitWords)
+	for scanner.Scan() {
+		count++
+	}
+	return count, scanner.Err()
+}
+
+// PartWords counts the words (headings and footnotes included) under every
+// PART in the tree. Words outside any part are counted under "". Footnote
+// marks aren't words.
+func PartWords(root *Div) map[string]int64 {
+	out := map[string]int64{}
+	var walk func(d *Div, part string)
+	walk = func(d *Div, part string) {
+		if d.Type == "PART" {
+			part = d.N
+		}
+		out[part] += int64(len(strings.Fields(d.Head)))
+		for _, p := range d.Paras {
+			out[part] += int64(len(strings.Fields(p.Text)))
+		}
+		for _, f := range d.Footnotes {
+			out[part] += int64(len(strings.Fields(f.Text)))
+		}
+		for i := range d.Children {
+			walk(&d.Children[i], part)
+		}
+	}
+	walk(root, "")
+	return out
+}
+
+// DivWords is a Div's word count, headings included, rolled up from its
+// descendants.
+type DivWords struct {
+	Type     string     `json:"type"`
+	N        string     `json:"n"`
+	Head     string     `json:"head,omitempty"`
+	Words    int64      `json:"words"` // this Div and everything under it
+	Children []DivWords `json:"children,omitempty"`
+}
+
+// CountDivWords counts words like PartWords, but for every Div in the tree.
+func CountDivWords(d *Div) DivWords {
+	w := DivWords{Type: d.Type, N: d.N, Head: d.Head, Words: int64(len(strings.Fields(d.Head)))}
+	for _, p := range d.Paras {
+		w.Words += int64(len(strings.Fields(p.Text)))
+	}
+	for _, f := range d.Footnotes {
+		w.Words += int64(len(strings.Fields(f.Text)))
+	}
+	for i := range d.Children {
+		c := CountDivWords(&d.Children[i])
+		w.Words += c.Words
+		w.Children = append(w.Children, c)
+	}
+	return w
+}
@@ -0,0 +1,62 @@
+package core
+
+// TYPE attribute values of the Divs the accessors below look for.
+const (
+	TypeTitle    = "TITLE"
+	TypeChapter  = "CHAPTER"
+	TypeSubchap  = "SUBCHAP"
+	TypePart     = "PART"
+	TypeSubpart  = "SUBPART"
+	TypeSection  = "SECTION"
+	TypeAppendix = "APPENDIX"
+)
+
+// OfType returns every Div under d (d included) whose TYPE is typ, in
+// document order. The pointers are into the tree, not copies.
+func (d *Div) OfType(typ string) []*Div {
+	var out []*Div
+	var walk func(d *Div)
+	walk = func(d *Div) {
+		if d.Type == typ {
+			out = append(out, d)
+		}
+		for i := range d.Children {
+			walk(&d.Children[i])
+		}
+	}
+	walk(d)
+	return out
+}
+
+// Parts returns the PARTs under d.
+func (d *Div) Parts() []*Div { return d.OfType(TypePart) }
+
+// Subparts returns the SUBPARTs under d.
+func (d *Div) Subparts() []*Div { return d.OfType(TypeSubpart) }
+
+// Sections returns the SECTIONs under d. Appendices, which WalkSections
+// also visits, are left to Appendices.
+func (d *Div) Sections() []*Div { return d.OfType(TypeSection) }
+
+// Appendices returns the APPENDIX Divs under d.
+func (d *Div) Appendices() []*Div { return d.OfType(TypeAppendix) }
+
+// Find returns the first Div under d of type typ numbered n, or nil.
+// Unlike FindDiv it can't confuse a part with a section of the same N.
+func (d *Div) Find(typ, n string) *Div {
+	if d.Type == typ && d.N == n {
+		return d
+	}
+	for i := range d.Children {
+		if found := d.Children[i].Find(typ, n); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Parts returns the PARTs of the document.
+func (f *ECFRFile) Parts() []*Div { return f.Root().Parts() }
+
+// Sections returns the SECTIONs of the document.
+func (f *ECFRFile) Sections() []*Div { return f.Root().Sections() }
@@ -1,4 +1,40 @@
-package main
+// Package core parses eCFR XML and runs the text analyses shared by the CLI
+// and the WebAssembly build. It never touches the filesystem or network on
+// its own; callers hand it readers or a Fetcher.
+//
+// Parse a full-title snapshot and count the words in each part:
+//
+//	doc, err := core.ParseFile(r)
+//	if err != nil {
+//		return err
+//	}
+//	for part, n := range core.PartWords(doc.Root()) {
+//		fmt.Println(part, n)
+//	}
+//
+// Or walk its typed levels:
+//
+//	for _, part := range doc.Parts() {
+//		for _, s := range part.Sections() {
+//			fmt.Println(part.N, s.N, s.Head)
+//		}
+//	}
+//
+// Diff one section between two snapshots, token by token:
+//
+//	old := core.FindDiv(before.Root(), "11.4")
+//	cur := core.FindDiv(after.Root(), "11.4")
+//	for _, e := range core.DiffTokens(core.DivTokens(old), core.DivTokens(cur)) {
+//		switch e.Op {
+//		case core.OpInsert:
+//			fmt.Println("+", strings.Join(e.Tokens, " "))
+//		case core.OpDelete:
+//			fmt.Println("-", strings.Join(e.Tokens, " "))
+//		}
+//	}
+//
+// Package ecfr's examples run these against recorded API responses.
+package core
 
 // ecfra
 import "encoding/xml"
@@ -94,6 +130,24 @@ type Div struct {
 	Text    *DivText `xml:"TEXT"`      // Optional
 	// Any child DIVn nodes (any depth) land here:
 	Children []Div `xml:",any"` // recursive
+	// Other block content (P, FP, CITA, …) directly under this DIV.
+	Paras []Para `xml:"-"`
+	// Effective date and editorial notes directly under this DIV. They are
+	// in Paras as well, so text and word counts are unchanged.
+	Notes []Note `xml:"-"`
+	// Figures referenced from the block content above (GPH, MATH, img).
+	Graphics []Graphic `xml:"-"`
+	// Footnotes (FTNT) directly under this DIV, referenced by Para anchors.
+	Footnotes []Footnote `xml:"-"`
+}
+
+// Para is one block element flattened to whitespace-collapsed text.
+type Para struct {
+	Tag  string // P, FP, CITA, AUTH, …
+	Text string
+	Rows [][]string // GPOTABLE only: column headings, then one row per ROW
+	// Footnote references, which are not in Text; see Div.Footnotes.
+	Anchors []Anchor
 }
 
 // Inside <TEXT> most of the interesting prose is paragraphs, lists, etc.
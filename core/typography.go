@@ -0,0 +1,23 @@
+package core
+
+import "strings"
+
+// typography maps characters that republication changes without changing
+// meaning to one plain form: curly quotes and primes to straight ones, the
+// dash family to a hyphen, odd spaces to a space, and soft hyphens and
+// zero-width characters to nothing.
+var typography = strings.NewReplacer(
+	"\u2018", "'", "\u2019", "'", "\u201a", "'", "\u201b", "'", "\u2032", "'",
+	"\u201c", `"`, "\u201d", `"`, "\u201e", `"`, "\u201f", `"`, "\u2033", `"`,
+	"\u2010", "-", "\u2011", "-", "\u2012", "-", "\u2013", "-", "\u2014", "-", "\u2015", "-", "\u2212", "-",
+	"\u00a0", " ", "\u2007", " ", "\u2009", " ", "\u202f", " ",
+	"\u00ad", "", "\u200b", "", "\u2060", "", "\ufeff", "",
+	"\u2026", "...",
+)
+
+// NormalizeTypography returns s with typographic variants folded together,
+// so text that was only re-typeset compares equal. It is for comparing, not
+// for display.
+func NormalizeTypography(s string) string {
+	return typography.Replace(s)
+}
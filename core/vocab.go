@@ -0,0 +1,99 @@
+package core
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// stopwords are too common to say anything about a topical shift.
+var stopwords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`a an and are as at be been by for from has have
+		in is it its may must not of on or shall that the this these those to under
+		was were which who will with any each such than other if`) {
+		stopwords[w] = true
+	}
+}
+
+// Term normalises a whitespace token for frequency counting: lower case
+// with surrounding punctuation trimmed. Tokens not starting with a letter
+// (numbers, citations like 11.4(a)) and stopwords return "".
+func Term(tok string) string {
+	t := strings.ToLower(strings.TrimFunc(tok, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}))
+	if stopwords[t] || strings.IndexFunc(t, unicode.IsLetter) != 0 {
+		return ""
+	}
+	return t
+}
+
+// TermCounts counts the Terms in r and returns them with the total number
+// of words read (stopwords and numbers included), so counts can be turned
+// into rates comparable across documents of different length.
+func TermCounts(r io.Reader) (map[string]int64, int64, error) {
+	counts := map[string]int64{}
+	var total int64
+	scanner := bufio.NewScanner(r)
+	scanner.Split(bufio.ScanWords)
+	for scanner.Scan() {
+		total++
+		if t := Term(scanner.Text()); t != "" {
+			counts[t]++
+		}
+	}
+	return counts, total, scanner.Err()
+}
+
+// TermDelta is one term's frequency in two documents. Rates are per 10,000
+// words.
+type TermDelta struct {
+	Term    string
+	Old     int64
+	New     int64
+	OldRate float64
+	NewRate float64
+}
+
+// Change is the difference in rate, positive when the term grew.
+func (d TermDelta) Change() float64 { return d.NewRate - d.OldRate }
+
+// VocabDiff compares two term distributions and returns every term seen at
+// least minCount times in either, largest absolute change in rate first.
+func VocabDiff(old map[string]int64, oldTotal int64, cur map[string]int64, curTotal int64, minCount int64) []TermDelta {
+	rate := func(n, total int64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(n) * 10000 / float64(total)
+	}
+	var out []TermDelta
+	add := func(t string) {
+		o, n := old[t], cur[t]
+		if max(o, n) < minCount {
+			return
+		}
+		out = append(out, TermDelta{Term: t, Old: o, New: n, OldRate: rate(o, oldTotal), NewRate: rate(n, curTotal)})
+	}
+	for t := range old {
+		add(t)
+	}
+	for t := range cur {
+		if _, seen := old[t]; !seen {
+			add(t)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		ci, cj := math.Abs(out[i].Change()), math.Abs(out[j].Change())
+		if ci != cj {
+			return ci > cj
+		}
+		return out[i].Term < out[j].Term
+	})
+	return out
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+	"github.com/paulgmiller/efcr/pipeline"
+)
+
+// corpusTables are the tables crawl --db keeps. Rows carry the run that
+// last wrote them, so `SELECT * FROM runs` explains where a number came
+// from. Columns are only ever added at the end.
+var corpusTables = []struct{ name, sql string }{
+	{"runs", `CREATE TABLE runs (id INTEGER PRIMARY KEY, started TEXT, finished TEXT, efcr_version TEXT, args TEXT, titles INTEGER, snapshots INTEGER, errors INTEGER)`},
+	{"titles", `CREATE TABLE titles (number INTEGER, name TEXT, up_to_date_as_of TEXT, reserved INTEGER, run INTEGER)`},
+	{"versions", `CREATE TABLE versions (title INTEGER, date TEXT, amendment_date TEXT, issue_date TEXT, identifier TEXT, name TEXT, part TEXT, subpart TEXT, type TEXT, substantive INTEGER, removed INTEGER, run INTEGER, section_id TEXT)`},
+	{"word_counts", `CREATE TABLE word_counts (title INTEGER, parts TEXT, excluded TEXT, date TEXT, words INTEGER, run INTEGER)`},
+}
+
+// corpusDB accumulates a crawl into a SQLite database that earlier crawls
+// may have started. Rows are keyed by what they describe (a title, a
+// version, a title's words on a date under given part and table settings),
+// so re-crawling replaces rather than duplicates them.
+type corpusDB struct {
+	path   string
+	other  []sqliteTable // tables, views and triggers added by hand, kept as found
+	Retain Retention     // how many past runs save keeps
+
+	mu    sync.Mutex
+	run   sqliteRow
+	runs  []sqliteRow
+	rows  map[string]map[string][]any // table -> key -> values
+	start time.Time
+}
+
+// openCorpusDB loads the database at path, if there is one, and starts a
+// run in it.
+func openCorpusDB(path string, args []string) (*corpusDB, error) {
+	tables, version, err := readSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+	if version > corpusDBVersion {
+		return nil, fmt.Errorf("%s was written by a newer efcr (%s v%d, this build reads up to v%d); "+
+			"upgrade with `go install github.com/paulgmiller/efcr@latest`", path, corpusDBSchema, version, corpusDBVersion)
+	}
+	db := &corpusDB{path: path, rows: map[string]map[string][]any{}, start: time.Now()}
+	for _, t := range corpusTables {
+		db.rows[t.name] = map[string][]any{}
+	}
+	var lastRun int64
+	for _, t := range tables {
+		if _, ours := db.rows[t.Name]; !ours || t.Type != "table" {
+			db.other = append(db.other, t)
+			continue
+		}
+		if t.Name == "runs" {
+			db.runs = t.Rows
+			for _, r := range t.Rows {
+				lastRun = max(lastRun, r.ID)
+			}
+			continue
+		}
+		for _, r := range t.Rows {
+			db.put(t.Name, r.Values)
+		}
+	}
+	db.run = sqliteRow{ID: lastRun + 1, Values: []any{nil, db.start.UTC().Format(time.RFC3339), nil, toolVersion(), strings.Join(args, " "), nil, nil, nil}}
+	return db, nil
+}
+
+// corpusKey returns the identity of a row of table.
+func corpusKey(table string, v []any) string {
+	col := func(i int) any {
+		if i < len(v) {
+			return v[i]
+		}
+		return nil
+	}
+	switch table {
+	case "titles":
+		return fmt.Sprintf("%v", col(0))
+	case "versions":
+		// The API lists a section more than once on a date when documents
+		// issued on different days amended it, or amended it both
+		// substantively and not.
+		return fmt.Sprintf("%v\x00%v\x00%v\x00%v\x00%v\x00%v", col(0), col(1), col(3), col(4), col(8), col(9))
+	default: // word_counts
+		return fmt.Sprintf("%v\x00%v\x00%v\x00%v", col(0), col(1), col(2), col(3))
+	}
+}
+
+// put stores a row, replacing any with the same key.
+func (db *corpusDB) put(table string, values []any) {
+	db.rows[table][corpusKey(table, values)] = values
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// addVersions records a title's versions as the crawl lists them. It is
+// safe for concurrent use (see pipeline.Pipeline.OnVersions).
+func (db *corpusDB) addVersions(title int, versions []ecfr.Version) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, v := range versions {
+		var subpart any
+		if v.Subpart != nil {
+			subpart = *v.Subpart
+		}
+		db.put("versions", []any{int64(title), v.Date, v.AmendmentDate, v.IssueDate, v.Identifier, v.Name,
+			v.Part, subpart, v.Type, boolInt(v.Substantive), boolInt(v.Removed), db.run.ID})
+	}
+}
+
+// addSectionIDs fills in the section_id (core.SectionID) of the versions
+// of every title crawled without errors, with chapters as the title's
+// latest structure places its parts. Versions from earlier runs get one
+// too.
+func (db *corpusDB) addSectionIDs(ctx context.Context, c httpclient, results []pipeline.TitleResult) error {
+	for _, r := range results {
+		if len(r.Errs) > 0 {
+			continue
+		}
+		chapters, err := partChapters(ctx, c, r.Title.Number, r.Title.UpToDateAsOf)
+		if err != nil {
+			return err
+		}
+		db.mu.Lock()
+		for k, v := range db.rows["versions"] {
+			if len(v) < 12 || v[0] != int64(r.Title.Number) {
+				continue
+			}
+			part, _ := v[6].(string)
+			section, _ := v[4].(string)
+			id := core.SectionID{Title: r.Title.Number, Chapter: chapters[part], Part: part, Section: section}
+			db.rows["versions"][k] = append(v[:12:12], id.String())
+		}
+		db.mu.Unlock()
+	}
+	return nil
+}
+
+// addResults records the crawled titles and their per-date word counts.
+// parts is the crawl's part restriction and excluded its table parts per
+// title, which both change what a count means.
+func (db *corpusDB) addResults(results []pipeline.TitleResult, parts []string, excluded map[int][]string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var snapshots, errs int64
+	for _, r := range results {
+		t := r.Title
+		db.put("titles", []any{int64(t.Number), t.Name, t.UpToDateAsOf, boolInt(t.Reserved), db.run.ID})
+		if len(r.Errs) > 0 {
+			errs++
+		}
+		for date, n := range r.Dates {
+			db.put("word_counts", []any{int64(t.Number), strings.Join(parts, ","), strings.Join(excluded[t.Number], ","), date, n, db.run.ID})
+			snapshots++
+		}
+	}
+	db.run.Values[5], db.run.Values[6], db.run.Values[7] = int64(len(results)), snapshots, errs
+}
+
+// save finishes the run, prunes runs past the Retain policy and writes the
+// database back.
+func (db *corpusDB) save() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.run.Values[2] = time.Now().UTC().Format(time.RFC3339)
+	db.runs = append(db.runs, db.run)
+	db.pruneRuns(time.Now())
+	if err := db.write(); err != nil {
+		return err
+	}
+	slog.Info("stored run", "db", db.path, "run", db.run.ID, "titles", len(db.rows["titles"]), "word_counts", len(db.rows["word_counts"]))
+	return nil
+}
+
+// compact prunes runs past the Retain policy and writes the database back
+// without recording a run.
+func (db *corpusDB) compact(now time.Time) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	n := db.pruneRuns(now)
+	return n, db.write()
+}
+
+func (db *corpusDB) write() error {
+	var tables []sqliteTable
+	for _, t := range corpusTables {
+		table := sqliteTable{Type: "table", Name: t.name, SQL: t.sql}
+		if t.name == "runs" {
+			table.Rows = db.runs
+		} else {
+			table.Rows = sortedCorpusRows(db.rows[t.name])
+		}
+		tables = append(tables, table)
+	}
+	if err := writeSQLite(db.path, append(tables, db.other...), corpusDBVersion); err != nil {
+		return fmt.Errorf("write %s: %w", db.path, err)
+	}
+	return nil
+}
+
+// sortedCorpusRows orders rows by their columns, numbers numerically, and
+// numbers them from 1.
+func sortedCorpusRows(m map[string][]any) []sqliteRow {
+	rows := make([]sqliteRow, 0, len(m))
+	for _, v := range m {
+		rows = append(rows, sqliteRow{Values: v})
+	}
+	compare := func(a, b any) int {
+		switch a := a.(type) {
+		case int64:
+			if b, ok := b.(int64); ok {
+				return int(min(max(a-b, -1), 1))
+			}
+		case string:
+			if b, ok := b.(string); ok {
+				return strings.Compare(a, b)
+			}
+		}
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i].Values, rows[j].Values
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if c := compare(a[k], b[k]); c != 0 {
+				return c < 0
+			}
+		}
+		return len(a) < len(b)
+	})
+	for i := range rows {
+		rows[i].ID = int64(i + 1)
+	}
+	return rows
+}
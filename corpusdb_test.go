@@ -0,0 +1,49 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// The versions API can list a section twice on one date, as it does 40 CFR
+// 25.2 on 2016-12-22; both entries are versions.
+func TestCorpusDBKeepsSameDayVersions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corpus.db")
+	db, err := openCorpusDB(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := ecfr.Version{Date: "2016-12-22", AmendmentDate: "2016-12-22", IssueDate: "2016-12-22", Identifier: "25.2", Name: "§ 25.2 Definitions.", Part: "25", Title: "40", Type: "section"}
+	later, substantive := v, v
+	later.IssueDate = "2016-12-23"
+	substantive.Substantive = true
+	db.addVersions(40, []ecfr.Version{v, later, substantive, v})
+	if err := db.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	tables, _, err := readSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []sqliteRow
+	for _, tb := range tables {
+		if tb.Name == "versions" {
+			rows = tb.Rows
+		}
+	}
+	if len(rows) != 3 {
+		t.Fatalf("versions has %d rows, want the 3 distinct entries: %v", len(rows), rows)
+	}
+	seen := map[[2]any]bool{}
+	for _, r := range rows {
+		seen[[2]any{r.Values[3], r.Values[9]}] = true
+	}
+	for _, want := range [][2]any{{"2016-12-22", int64(0)}, {"2016-12-23", int64(0)}, {"2016-12-22", int64(1)}} {
+		if !seen[want] {
+			t.Errorf("no version issued %s with substantive %d", want[0], want[1])
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+const correctionsURL = "https://www.ecfr.gov/api/admin/v1/corrections.json"
+
+// Correction matches an entry of /api/admin/v1/corrections.json: an
+// editorial error in the eCFR, when it crept in and when it was fixed.
+// Text changes between those dates are corrections, not amendments.
+type Correction struct {
+	ID               int                  `json:"id"`
+	Title            int                  `json:"title"`
+	CFRReferences    []CorrectedReference `json:"cfr_references"`
+	CorrectiveAction string               `json:"corrective_action"`
+	ErrorOccurred    string               `json:"error_occurred"`
+	ErrorCorrected   string               `json:"error_corrected"`
+	FRCitation       string               `json:"fr_citation"`
+	LastModified     string               `json:"last_modified"`
+}
+
+// CorrectedReference is one place a correction touched. Hierarchy levels
+// below the reference are null in the API and empty here.
+type CorrectedReference struct {
+	Citation  string `json:"cfr_reference"`
+	Hierarchy struct {
+		Title   string `json:"title"`
+		Chapter string `json:"chapter"`
+		Part    string `json:"part"`
+		Section string `json:"section"`
+	} `json:"hierarchy"`
+}
+
+// fetchCorrections lists a title's corrections, oldest first.
+func fetchCorrections(ctx context.Context, c httpclient, title int) ([]Correction, error) {
+	var resp struct {
+		Corrections []Correction `json:"ecfr_corrections"`
+	}
+	u := correctionsURL + "?" + url.Values{"title": {strconv.Itoa(title)}}.Encode()
+	if err := ecfr.GetJSON(ctx, c, u, &resp); err != nil {
+		return nil, fmt.Errorf("corrections for title %d: %w", title, err)
+	}
+	sort.SliceStable(resp.Corrections, func(i, j int) bool {
+		return resp.Corrections[i].ErrorCorrected < resp.Corrections[j].ErrorCorrected
+	})
+	return resp.Corrections, nil
+}
+
+// covers reports whether the correction touched section, or the whole of
+// part.
+func (c Correction) covers(part, section string) bool {
+	for _, r := range c.CFRReferences {
+		h := r.Hierarchy
+		if (h.Section != "" && h.Section == section) || (h.Section == "" && h.Part != "" && h.Part == part) {
+			return true
+		}
+	}
+	return false
+}
+
+// correctedBetween returns the FR citations of corrections to a section
+// made after from and on or before to: the ones that explain a change
+// between snapshots on those dates.
+func correctedBetween(corrections []Correction, part, section, from, to string) []string {
+	var out []string
+	for _, c := range corrections {
+		if c.ErrorCorrected > from && c.ErrorCorrected <= to && c.covers(part, section) {
+			out = append(out, c.FRCitation)
+		}
+	}
+	return out
+}
+
+// runCorrections lists the corrections published for a title, optionally
+// within a range of correction dates.
+//
+//	efcr corrections --title 40 --since 2023-01-01
+func runCorrections(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("corrections", flag.ExitOnError)
+	title := fs.Int("title", 0, "title number")
+	since := fs.String("since", "", "only corrections made on or after this date YYYY-MM-DD")
+	until := fs.String("until", "", "only corrections made on or before this date YYYY-MM-DD")
+	asJSON := fs.Bool("json", false, "print one JSON object per correction")
+	fs.Parse(args)
+	if *title == 0 {
+		return errors.New("--title is required")
+	}
+	corrections, err := fetchCorrections(ctx, c, *title)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	if !*asJSON {
+		fmt.Println("Corrected\tOccurred\tFRCitation\tAction\tReferences")
+	}
+	for _, cr := range corrections {
+		if (*since != "" && cr.ErrorCorrected < *since) || (*until != "" && cr.ErrorCorrected > *until) {
+			continue
+		}
+		if *asJSON {
+			if err := enc.Encode(cr); err != nil {
+				return err
+			}
+			continue
+		}
+		var refs []string
+		for _, r := range cr.CFRReferences {
+			refs = append(refs, r.Citation)
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\n", cr.ErrorCorrected, cr.ErrorOccurred, cr.FRCitation, cr.CorrectiveAction, strings.Join(refs, "; "))
+	}
+	return nil
+}
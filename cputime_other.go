@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// processCPU is not implemented here; the worker tuner goes without CPU
+// readings.
+func processCPU() (time.Duration, error) {
+	return 0, errors.New("process CPU time not supported on this platform")
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+const (
+	deadlinesSchema  = "efcr-deadlines"
+	deadlinesVersion = 2 // v1: no id
+)
+
+// DeadlineRecord is one normalised deadline with where it was found.
+type DeadlineRecord struct {
+	ID       string `json:"id"` // core.SectionID down to the paragraph
+	Title    int    `json:"title"`
+	Part     string `json:"part"`
+	Section  string `json:"section"`
+	Heading  string `json:"heading"`
+	Snapshot string `json:"snapshot"` // eCFR date the text was read from
+	core.Deadline
+}
+
+// Citation formats the record's section as a CFR citation.
+func (r DeadlineRecord) Citation() string {
+	return citation(r.Title, r.Part, r.Section)
+}
+
+// runDeadlines extracts deadlines from a title or part and writes them as
+// a dataset (NDJSON) or a table.
+//
+//	efcr deadlines --title 40 --part 60 --date 2024-01-01 --out deadlines.ndjson
+func runDeadlines(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("deadlines", flag.ExitOnError)
+	title := fs.Int("title", 0, "title number")
+	part := fs.String("part", "", "restrict to one part")
+	date := fs.String("date", "", "snapshot date YYYY-MM-DD")
+	out := fs.String("out", "", "write the dataset as NDJSON here instead of a table on stdout")
+	fs.Parse(args)
+	if *title == 0 || *date == "" {
+		return errors.New("--title and --date are required")
+	}
+
+	doc, err := newAPI(c).Document(ctx, *title, *date, ecfr.Hierarchy{Part: *part})
+	if err != nil {
+		return err
+	}
+	records := extractDeadlines(doc.Root(), *title, *date)
+	if *out != "" {
+		return writeDeadlines(*out, records)
+	}
+	fmt.Println("Citation\tKind\tNormalized\tPhrase")
+	for _, r := range records {
+		fmt.Printf("%s\t%s\t%s\t%s\n", r.Citation(), r.Kind, r.Duration+r.Date+r.Recurrence, r.Phrase)
+	}
+	return nil
+}
+
+// extractDeadlines runs core.ExtractDeadlines over each paragraph of every
+// section, so a trigger never runs on into the next paragraph.
+func extractDeadlines(root *core.Div, title int, snapshot string) []DeadlineRecord {
+	var out []DeadlineRecord
+	core.WalkSectionIDs(root, title, func(id core.SectionID, d *core.Div) {
+		paths := core.ParaPaths(d)
+		for i, para := range d.Paras {
+			id.Para = paths[i]
+			for _, dl := range core.ExtractDeadlines(para.Text) {
+				out = append(out, DeadlineRecord{ID: id.String(), Title: title, Part: id.Part, Section: d.N, Heading: d.Head, Snapshot: snapshot, Deadline: dl})
+			}
+		}
+		// footnotes and nested divisions have no paragraph path
+		id.Para = ""
+		rest := *d
+		rest.Paras = nil
+		for _, para := range strings.Split(core.ParaText(&rest), "\n") {
+			for _, dl := range core.ExtractDeadlines(para) {
+				out = append(out, DeadlineRecord{ID: id.String(), Title: title, Part: id.Part, Section: d.N, Heading: d.Head, Snapshot: snapshot, Deadline: dl})
+			}
+		}
+	})
+	return out
+}
+
+func writeDeadlines(path string, records []DeadlineRecord) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	if err := writeSchemaHeader(w, deadlinesSchema, deadlinesVersion); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	for i := range records {
+		if err := enc.Encode(&records[i]); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+func readDeadlines(path string) ([]DeadlineRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []DeadlineRecord
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for i := 0; dec.More(); i++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if i == 0 {
+			_, isHeader, err := checkSchema(path, raw, deadlinesSchema, deadlinesVersion)
+			if err != nil {
+				return nil, err
+			}
+			if isHeader {
+				continue
+			}
+		}
+		var r DeadlineRecord
+		if err := json.Unmarshal(raw, &r); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// writeFactsDelta is writeFacts for --facts-format delta: dir becomes a
+// Delta Lake table of Parquet files partitioned by title and year, which
+// Spark, Databricks, DuckDB's delta extension and Trino can register as is
+// (and Iceberg catalogs can through Delta UniForm or a conversion).
+//
+// Each run is one overwrite commit: the new files are added and those of
+// the previous version removed in the same log entry, so readers see one
+// crawl or the other, never a mix. Removed files stay on disk for time
+// travel until a VACUUM.
+func writeFactsDelta(dir string, facts []Fact) error {
+	logDir := filepath.Join(dir, "_delta_log")
+	if err := os.MkdirAll(logDir, 0o755); err != nil {
+		return err
+	}
+	version, active, err := readDeltaLog(logDir)
+	if err != nil {
+		return err
+	}
+
+	type partition struct{ title, year int }
+	groups := map[partition][]Fact{}
+	for _, f := range facts {
+		year, err := strconv.Atoi(f.Date[:min(4, len(f.Date))])
+		if err != nil {
+			return fmt.Errorf("fact date %q: %w", f.Date, err)
+		}
+		p := partition{f.Title, year}
+		groups[p] = append(groups[p], f)
+	}
+	keys := make([]partition, 0, len(groups))
+	for p := range groups {
+		keys = append(keys, p)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].title != keys[j].title {
+			return keys[i].title < keys[j].title
+		}
+		return keys[i].year < keys[j].year
+	})
+
+	now := time.Now().UnixMilli()
+	var actions []any
+	actions = append(actions, map[string]any{"commitInfo": map[string]any{
+		"timestamp":  now,
+		"operation":  "WRITE",
+		"engineInfo": "efcr/" + toolVersion(),
+		"operationParameters": map[string]string{
+			"mode":        "Overwrite",
+			"partitionBy": `["title","year"]`,
+		},
+	}})
+	if version < 0 {
+		id, err := newUUID()
+		if err != nil {
+			return err
+		}
+		actions = append(actions,
+			map[string]any{"protocol": map[string]int{"minReaderVersion": 1, "minWriterVersion": 2}},
+			map[string]any{"metaData": map[string]any{
+				"id":               id,
+				"format":           map[string]any{"provider": "parquet", "options": map[string]string{}},
+				"schemaString":     deltaFactsSchema,
+				"partitionColumns": []string{"title", "year"},
+				"configuration":    map[string]string{},
+				"createdTime":      now,
+			}})
+	}
+	for _, p := range active {
+		actions = append(actions, map[string]any{"remove": map[string]any{
+			"path":              p,
+			"deletionTimestamp": now,
+			"dataChange":        true,
+		}})
+	}
+	for _, p := range keys {
+		id, err := newUUID()
+		if err != nil {
+			return err
+		}
+		rel := path.Join(fmt.Sprintf("title=%d", p.title), fmt.Sprintf("year=%d", p.year), "part-00000-"+id+".parquet")
+		size, err := writeFactsParquet(filepath.Join(dir, filepath.FromSlash(rel)), groups[p])
+		if err != nil {
+			return err
+		}
+		actions = append(actions, map[string]any{"add": map[string]any{
+			"path":             rel,
+			"partitionValues":  map[string]string{"title": strconv.Itoa(p.title), "year": strconv.Itoa(p.year)},
+			"size":             size,
+			"modificationTime": now,
+			"dataChange":       true,
+		}})
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, a := range actions {
+		if err := enc.Encode(a); err != nil {
+			return err
+		}
+	}
+	// O_EXCL is the commit protocol: a concurrent writer that got there
+	// first makes this fail rather than both claiming the version.
+	name := filepath.Join(logDir, fmt.Sprintf("%020d.json", version+1))
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// deltaFactsSchema is the table schema in Delta's JSON form. The partition
+// columns come last and are not stored in the Parquet files.
+const deltaFactsSchema = `{"type":"struct","fields":[` +
+	`{"name":"chapter","type":"string","nullable":false,"metadata":{}},` +
+	`{"name":"part","type":"string","nullable":false,"metadata":{}},` +
+	`{"name":"section","type":"string","nullable":false,"metadata":{}},` +
+	`{"name":"agency","type":"string","nullable":false,"metadata":{}},` +
+	`{"name":"date","type":"date","nullable":false,"metadata":{}},` +
+	`{"name":"metric","type":"string","nullable":false,"metadata":{}},` +
+	`{"name":"value","type":"double","nullable":false,"metadata":{}},` +
+	`{"name":"title","type":"integer","nullable":false,"metadata":{}},` +
+	`{"name":"year","type":"integer","nullable":false,"metadata":{}}]}`
+
+// writeFactsParquet writes one partition's facts and returns the file size.
+func writeFactsParquet(file string, facts []Fact) (int64, error) {
+	cols := []*parquetColumn{
+		{name: "chapter", typ: arrowUtf8},
+		{name: "part", typ: arrowUtf8},
+		{name: "section", typ: arrowUtf8},
+		{name: "agency", typ: arrowUtf8},
+		{name: "date", typ: arrowDate32},
+		{name: "metric", typ: arrowUtf8},
+		{name: "value", typ: arrowFloat64},
+	}
+	for _, f := range facts {
+		cols[0].String(f.Chapter)
+		cols[1].String(f.Part)
+		cols[2].String(f.Section)
+		cols[3].String(f.Agency)
+		if err := cols[4].Date(f.Date); err != nil {
+			return 0, err
+		}
+		cols[5].String(f.Metric)
+		cols[6].Float64(f.Value)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return 0, err
+	}
+	out, err := os.Create(file)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+	size, err := writeParquet(out, cols)
+	if err != nil {
+		return 0, err
+	}
+	return size, out.Close()
+}
+
+// readDeltaLog replays a table's commits, returning the latest version (-1
+// for a new table) and the data files it contains. Checkpoints are not
+// read: efcr never writes them, and a table another engine checkpointed
+// still has every JSON commit until log cleanup runs.
+func readDeltaLog(logDir string) (int, []string, error) {
+	version := -1
+	active := map[string]bool{}
+	for {
+		f, err := os.Open(filepath.Join(logDir, fmt.Sprintf("%020d.json", version+1)))
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		sc := bufio.NewScanner(f)
+		sc.Buffer(nil, 16<<20)
+		for sc.Scan() {
+			var a struct {
+				Add    *struct{ Path string } `json:"add"`
+				Remove *struct{ Path string } `json:"remove"`
+			}
+			if err := json.Unmarshal(sc.Bytes(), &a); err != nil {
+				f.Close()
+				return 0, nil, fmt.Errorf("%s: %w", f.Name(), err)
+			}
+			if a.Add != nil {
+				active[a.Add.Path] = true
+			}
+			if a.Remove != nil {
+				delete(active, a.Remove.Path)
+			}
+		}
+		f.Close()
+		if err := sc.Err(); err != nil {
+			return 0, nil, err
+		}
+		version++
+	}
+	return version, sortedKeys(active), nil
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFactsDeltaOverwrite(t *testing.T) {
+	dir := t.TempDir()
+	if err := writeFactsDelta(dir, testFacts); err != nil {
+		t.Fatal(err)
+	}
+	version, first, err := readDeltaLog(filepath.Join(dir, "_delta_log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 0 || len(first) != 2 {
+		t.Fatalf("after the first write: version %d with files %q, want version 0 with two partitions", version, first)
+	}
+	for _, p := range first {
+		if !strings.HasPrefix(p, "title=40/year=2024/") && !strings.HasPrefix(p, "title=7/year=1999/") {
+			t.Errorf("%s is not in a title=/year= partition of the facts", p)
+		}
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(p))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err := writeFactsDelta(dir, testFacts[:1]); err != nil {
+		t.Fatal(err)
+	}
+	version, second, err := readDeltaLog(filepath.Join(dir, "_delta_log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 1 || len(second) != 1 || !strings.HasPrefix(second[0], "title=40/year=2024/") {
+		t.Fatalf("after the overwrite: version %d with files %q, want version 1 with the one title 40 file", version, second)
+	}
+
+	// Only the first commit creates the table.
+	b, err := os.ReadFile(filepath.Join(dir, "_delta_log", "00000000000000000001.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var removed int
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var a map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(line), &a); err != nil {
+			t.Fatal(err)
+		}
+		if a["protocol"] != nil || a["metaData"] != nil {
+			t.Errorf("overwrite commit redefines the table: %s", line)
+		}
+		if a["remove"] != nil {
+			removed++
+		}
+	}
+	if removed != len(first) {
+		t.Errorf("overwrite removes %d files, want the %d of version 0", removed, len(first))
+	}
+}
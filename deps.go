@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/paulgmiller/efcr/core"
+)
+
+// dependencies counts citations between parts of different titles: the
+// citation graph with sections collapsed into their parts and citations
+// within a title left out.
+type dependencies map[core.Ref]map[core.Ref]int // from part -> to part -> citations
+
+func partDependencies(edges []citationEdge) dependencies {
+	d := dependencies{}
+	for _, e := range edges {
+		if e.Source.Title == e.Target.Title {
+			continue
+		}
+		from := core.Ref{Title: e.Source.Title, Part: e.Source.Part}
+		to := core.Ref{Title: e.Target.Title, Part: e.Target.Part}
+		if d[from] == nil {
+			d[from] = map[core.Ref]int{}
+		}
+		d[from][to]++
+	}
+	return d
+}
+
+// partDependency summarizes one part's citations to other titles.
+type partDependency struct {
+	Part      core.Ref
+	Citations int
+	Parts     int // distinct parts cited
+	Titles    int // distinct titles cited
+	Top       core.Ref
+	TopCount  int
+}
+
+// ranked lists citing parts, most citations first.
+func (d dependencies) ranked() []partDependency {
+	var out []partDependency
+	for from, tos := range d {
+		pd := partDependency{Part: from, Parts: len(tos)}
+		titles := map[int]bool{}
+		for to, n := range tos {
+			pd.Citations += n
+			titles[to.Title] = true
+			if n > pd.TopCount || (n == pd.TopCount && refLess(to, pd.Top)) {
+				pd.Top, pd.TopCount = to, n
+			}
+		}
+		pd.Titles = len(titles)
+		out = append(out, pd)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Citations != out[j].Citations {
+			return out[i].Citations > out[j].Citations
+		}
+		return refLess(out[i].Part, out[j].Part)
+	})
+	return out
+}
+
+// refLess orders references by title, then part and section numerically
+// where they are numbers.
+func refLess(a, b core.Ref) bool {
+	if a.Title != b.Title {
+		return a.Title < b.Title
+	}
+	if a.Part != b.Part {
+		return numericLess(a.Part, b.Part)
+	}
+	return numericLess(a.Section, b.Section)
+}
+
+func numericLess(a, b string) bool {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil && x != y {
+		return x < y
+	}
+	return a < b
+}
+
+func printDependencies(d dependencies, top int) {
+	ranked := d.ranked()
+	fmt.Printf("Inter-title dependencies (%d citing parts)\n", len(ranked))
+	fmt.Println("Part\tCitations\tParts\tTitles\tMostCited")
+	if len(ranked) > top {
+		ranked = ranked[:top]
+	}
+	for _, pd := range ranked {
+		fmt.Printf("%s\t%d\t%d\t%d\t%s (%d)\n", pd.Part, pd.Citations, pd.Parts, pd.Titles, pd.Top, pd.TopCount)
+	}
+	fmt.Println()
+}
+
+// matrix lays d out as CSV rows: citing parts down, cited parts across.
+func (d dependencies) matrix() [][]string {
+	var froms []core.Ref
+	cited := map[core.Ref]bool{}
+	for from, tos := range d {
+		froms = append(froms, from)
+		for to := range tos {
+			cited[to] = true
+		}
+	}
+	var tos []core.Ref
+	for to := range cited {
+		tos = append(tos, to)
+	}
+	sort.Slice(froms, func(i, j int) bool { return refLess(froms[i], froms[j]) })
+	sort.Slice(tos, func(i, j int) bool { return refLess(tos[i], tos[j]) })
+
+	header := []string{"from"}
+	for _, to := range tos {
+		header = append(header, to.String())
+	}
+	rows := [][]string{header}
+	for _, from := range froms {
+		row := []string{from.String()}
+		for _, to := range tos {
+			row = append(row, strconv.Itoa(d[from][to]))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// writeDOT writes d as a Graphviz digraph with one cluster per title and
+// edge widths scaled by citation count.
+func (d dependencies) writeDOT(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	byTitle := map[int][]core.Ref{}
+	seen := map[core.Ref]bool{}
+	node := func(r core.Ref) {
+		if !seen[r] {
+			seen[r] = true
+			byTitle[r.Title] = append(byTitle[r.Title], r)
+		}
+	}
+	type edge struct {
+		from, to core.Ref
+		n        int
+	}
+	var edges []edge
+	max := 1
+	for from, tos := range d {
+		node(from)
+		for to, n := range tos {
+			node(to)
+			edges = append(edges, edge{from, to, n})
+			if n > max {
+				max = n
+			}
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].from != edges[j].from {
+			return refLess(edges[i].from, edges[j].from)
+		}
+		return refLess(edges[i].to, edges[j].to)
+	})
+	var titles []int
+	for t := range byTitle {
+		titles = append(titles, t)
+	}
+	sort.Ints(titles)
+
+	fmt.Fprintln(w, "digraph dependencies {")
+	fmt.Fprintln(w, "\trankdir=LR;")
+	for _, t := range titles {
+		refs := byTitle[t]
+		sort.Slice(refs, func(i, j int) bool { return refLess(refs[i], refs[j]) })
+		fmt.Fprintf(w, "\tsubgraph cluster_%d {\n\t\tlabel=\"Title %d\";\n", t, t)
+		for _, r := range refs {
+			fmt.Fprintf(w, "\t\t%q;\n", r.String())
+		}
+		fmt.Fprintln(w, "\t}")
+	}
+	for _, e := range edges {
+		width := 1 + 4*float64(e.n)/float64(max)
+		fmt.Fprintf(w, "\t%q -> %q [label=%d, penwidth=%.1f];\n", e.from.String(), e.to.String(), e.n, width)
+	}
+	fmt.Fprintln(w, "}")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// SectionChange is one section that differs between two snapshots.
+type SectionChange struct {
+	ID      string `json:"id"` // core.SectionID, placed as in the newer snapshot
+	Section string `json:"section"`
+	Part    string `json:"part"`
+	Heading string `json:"heading"`
+	Change  string `json:"change"`  // added, removed or modified
+	Added   int    `json:"added"`   // words
+	Removed int    `json:"removed"` // words
+	// Corrections are the FR citations of published corrections to the
+	// section between the snapshots, with diff --corrections: the change
+	// may fix an editorial error rather than amend the rule.
+	Corrections []string    `json:"corrections,omitempty"`
+	Edits       []core.Edit `json:"-"`
+}
+
+// diffSections aligns the sections and appendices of two snapshots of title
+// by ID and diffs each pair. Chapters are ignored, so a part transferred
+// between them diffs as itself (see core.SectionID.Same). Changes come in
+// the new snapshot's order, then sections only the old one had, in its
+// order.
+func diffSections(title int, old, cur *core.Div, tokens func(part string) func(*core.Div) []string) []SectionChange {
+	type entry struct {
+		d  *core.Div
+		id core.SectionID
+	}
+	index := func(root *core.Div) ([]string, map[string]entry) {
+		var order []string
+		m := map[string]entry{}
+		core.WalkSectionIDs(root, title, func(id core.SectionID, d *core.Div) {
+			key := id
+			key.Chapter = ""
+			k := key.String()
+			if _, dup := m[k]; !dup {
+				order = append(order, k)
+				m[k] = entry{d, id}
+			}
+		})
+		return order, m
+	}
+	oldOrder, before := index(old)
+	curOrder, after := index(cur)
+
+	var out []SectionChange
+	for _, n := range curOrder {
+		a := after[n]
+		b, existed := before[n]
+		c := SectionChange{ID: a.id.String(), Section: a.d.N, Part: a.id.Part, Heading: a.d.Head}
+		tok := tokens(a.id.Part)
+		var from []string
+		if existed {
+			from = tok(b.d)
+		}
+		c.Edits = core.DiffTokens(from, tok(a.d))
+		c.Added, c.Removed = editWords(c.Edits)
+		switch {
+		case !existed:
+			c.Change = "added"
+		case c.Added == 0 && c.Removed == 0:
+			continue
+		default:
+			c.Change = "modified"
+		}
+		out = append(out, c)
+	}
+	for _, n := range oldOrder {
+		if _, kept := after[n]; kept {
+			continue
+		}
+		b := before[n]
+		c := SectionChange{ID: b.id.String(), Section: b.d.N, Part: b.id.Part, Heading: b.d.Head, Change: "removed"}
+		c.Edits = core.DiffTokens(tokens(b.id.Part)(b.d), nil)
+		c.Added, c.Removed = editWords(c.Edits)
+		out = append(out, c)
+	}
+	return out
+}
+
+// snapshotChanges fetches h as of from and to and diffs their sections.
+func snapshotChanges(ctx context.Context, c httpclient, title int, h ecfr.Hierarchy, from, to string) ([]SectionChange, error) {
+	var roots [2]*core.Div
+	for i, d := range []string{from, to} {
+		doc, err := newAPI(c).Document(ctx, title, d, h)
+		if err != nil {
+			return nil, err
+		}
+		roots[i] = doc.Root()
+	}
+	// tables diff row by row, as in redline
+	tokens := func(part string) func(*core.Div) []string {
+		if cfg.isTable(title, part) {
+			return core.RowTokens
+		}
+		return core.DivTokens
+	}
+	return diffSections(title, roots[0], roots[1], tokens), nil
+}
+
+// editWords counts the inserted and deleted words of a diff.
+func editWords(edits []core.Edit) (added, removed int) {
+	for _, e := range edits {
+		n := 0
+		for _, t := range e.Tokens {
+			if t != core.ParaBreak {
+				n++
+			}
+		}
+		switch e.Op {
+		case core.OpInsert:
+			added += n
+		case core.OpDelete:
+			removed += n
+		}
+	}
+	return added, removed
+}
+
+// printWordDiff writes edits inline, wdiff style: [-deleted-] {+inserted+},
+// with unchanged runs cut down to around words either side of a change.
+func printWordDiff(w io.Writer, edits []core.Edit, around int) {
+	line := func(toks []string) string {
+		return strings.ReplaceAll(strings.Join(toks, " "), core.ParaBreak, "\n   ")
+	}
+	var out []string
+	for i, e := range edits {
+		switch e.Op {
+		case core.OpEqual:
+			toks := e.Tokens
+			first, last := i == 0, i == len(edits)-1
+			switch {
+			case first && len(toks) > around:
+				out = append(out, "…", line(toks[len(toks)-around:]))
+			case last && len(toks) > around:
+				out = append(out, line(toks[:around]), "…")
+			case !first && !last && len(toks) > 2*around:
+				out = append(out, line(toks[:around]), "…", line(toks[len(toks)-around:]))
+			default:
+				out = append(out, line(toks))
+			}
+		case core.OpDelete:
+			out = append(out, "[-"+line(e.Tokens)+"-]")
+		case core.OpInsert:
+			out = append(out, "{+"+line(e.Tokens)+"+}")
+		}
+	}
+	fmt.Fprintf(w, "    %s\n", strings.Join(out, " "))
+}
+
+// runDiff answers "what changed between these two dates?" for a title or
+// part: sections added, removed and modified, with the words that changed.
+//
+//	efcr diff --title 40 --part 60 --from 2023-01-01 --to 2024-01-01
+//	efcr diff --title 6 --from 2020-01-01 --to 2024-01-01 --summary --corrections
+func runDiff(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	title := fs.Int("title", 0, "title number")
+	part := fs.String("part", "", "restrict to one part")
+	from := fs.String("from", "", "old snapshot date YYYY-MM-DD")
+	to := fs.String("to", "", "new snapshot date YYYY-MM-DD")
+	summary := fs.Bool("summary", false, "list changed sections without their word diffs")
+	contextWords := fs.Int("context", 8, "unchanged words shown either side of a change")
+	asJSON := fs.Bool("json", false, "print one JSON object per changed section, edits included")
+	corrections := fs.Bool("corrections", false, "flag changes to sections a published correction touched between the dates")
+	fs.Parse(args)
+	if *title == 0 || *from == "" || *to == "" {
+		return errors.New("--title, --from and --to are required")
+	}
+
+	changes, err := snapshotChanges(ctx, c, *title, ecfr.Hierarchy{Part: *part}, *from, *to)
+	if err != nil {
+		return err
+	}
+	if *corrections {
+		list, err := fetchCorrections(ctx, c, *title)
+		if err != nil {
+			return err
+		}
+		for i, ch := range changes {
+			changes[i].Corrections = correctedBetween(list, ch.Part, ch.Section, *from, *to)
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, ch := range changes {
+			rec := struct {
+				SectionChange
+				Edits []core.Edit `json:"edits,omitempty"`
+			}{ch, ch.Edits}
+			if err := enc.Encode(rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	counts := map[string]int{}
+	for _, ch := range changes {
+		counts[ch.Change]++
+		mark := map[string]string{"added": "+", "removed": "-", "modified": "~"}[ch.Change]
+		var corrected string
+		if len(ch.Corrections) > 0 {
+			corrected = ", correction " + strings.Join(ch.Corrections, ", ")
+		}
+		fmt.Printf("%s %s %s (%s, +%d -%d words%s)\n", mark, citation(*title, ch.Part, ch.Section), ch.Heading, ch.Change, ch.Added, ch.Removed, corrected)
+		if !*summary && ch.Change == "modified" {
+			printWordDiff(os.Stdout, ch.Edits, *contextWords)
+		}
+	}
+	fmt.Printf("%s, %s to %s: %d added, %d removed, %d modified sections\n",
+		citation(*title, *part, ""), *from, *to, counts["added"], counts["removed"], counts["modified"])
+	return nil
+}
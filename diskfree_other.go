@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+// diskFree is not implemented here; callers skip the low-disk check.
+func diskFree(path string) (uint64, error) {
+	return 0, errors.New("disk free space not supported on this platform")
+}
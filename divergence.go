@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// runDivergence reports versions whose amendment (effective) date and issue
+// (publication) date differ, since time series built on one axis shift
+// those changes relative to the other.
+//
+//	efcr divergence --title 6 [--part 11] [--min-days 1]
+func runDivergence(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("divergence", flag.ExitOnError)
+	title := fs.Int("title", 0, "title number")
+	part := fs.String("part", "", "restrict to one part")
+	minDays := fs.Int("min-days", 1, "only list versions whose dates differ by at least this many days")
+	fs.Parse(args)
+	if *title == 0 {
+		return errors.New("--title is required")
+	}
+
+	versions, err := newAPI(c).Versions(ctx, *title, ecfr.Hierarchy{Part: *part})
+	if err != nil {
+		return err
+	}
+
+	type row struct {
+		v   ecfr.Version
+		lag int // issue - amendment, in days
+	}
+	var rows []row
+	var sum, max int
+	for _, v := range versions {
+		a, err1 := time.Parse("2006-01-02", v.AmendmentDate)
+		i, err2 := time.Parse("2006-01-02", v.IssueDate)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		lag := int(i.Sub(a).Hours() / 24)
+		if abs(lag) < *minDays {
+			continue
+		}
+		rows = append(rows, row{v, lag})
+		sum += abs(lag)
+		if abs(lag) > max {
+			max = abs(lag)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return abs(rows[i].lag) > abs(rows[j].lag) })
+
+	fmt.Printf("%s: %d of %d versions have amendment and issue dates at least %d day(s) apart",
+		citation(*title, *part, ""), len(rows), len(versions), *minDays)
+	if len(rows) > 0 {
+		fmt.Printf(" (mean %.1f, max %d days)", float64(sum)/float64(len(rows)), max)
+	}
+	fmt.Println()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "Section\tAmendmentDate\tIssueDate\tLagDays\tSubstantive")
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%+d\t%t\n", r.v.Identifier, r.v.AmendmentDate, r.v.IssueDate, r.lag, r.v.Substantive)
+	}
+	return tw.Flush()
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
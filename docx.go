@@ -0,0 +1,113 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/paulgmiller/efcr/core"
+)
+
+// redlineNote is an amendment note for the end of a redline; Added marks
+// notes the old version didn't have.
+type redlineNote struct {
+	core.Note
+	Added bool
+}
+
+// writeDOCX renders edits as a Word document whose insertions and deletions
+// are real tracked changes (w:ins / w:del), attributed to author at date,
+// followed by the new version's amendment notes, new ones as insertions.
+func writeDOCX(w io.Writer, heading, author string, date time.Time, edits []core.Edit, notes []redlineNote) error {
+	var body bytes.Buffer
+	body.WriteString(`<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:rPr><w:b/></w:rPr><w:t>`)
+	body.WriteString(xmlEscape(heading))
+	body.WriteString(`</w:t></w:r></w:p>`)
+
+	stamp := date.UTC().Format(time.RFC3339)
+	id := 0
+	body.WriteString("<w:p>")
+	for _, e := range edits {
+		var run []string
+		flush := func() {
+			if len(run) == 0 {
+				return
+			}
+			text := xmlEscape(strings.Join(run, " ") + " ")
+			run = run[:0]
+			switch e.Op {
+			case core.OpEqual:
+				fmt.Fprintf(&body, `<w:r><w:t xml:space="preserve">%s</w:t></w:r>`, text)
+			case core.OpInsert:
+				id++
+				fmt.Fprintf(&body, `<w:ins w:id="%d" w:author="%s" w:date="%s"><w:r><w:t xml:space="preserve">%s</w:t></w:r></w:ins>`,
+					id, xmlEscape(author), stamp, text)
+			case core.OpDelete:
+				id++
+				fmt.Fprintf(&body, `<w:del w:id="%d" w:author="%s" w:date="%s"><w:r><w:delText xml:space="preserve">%s</w:delText></w:r></w:del>`,
+					id, xmlEscape(author), stamp, text)
+			}
+		}
+		for _, tok := range e.Tokens {
+			if tok == core.ParaBreak {
+				flush()
+				body.WriteString("</w:p><w:p>")
+				continue
+			}
+			run = append(run, tok)
+		}
+		flush()
+	}
+	body.WriteString("</w:p>")
+
+	if len(notes) > 0 {
+		body.WriteString(`<w:p><w:pPr><w:pStyle w:val="Heading2"/></w:pPr><w:r><w:rPr><w:b/></w:rPr><w:t>Amendment notes</w:t></w:r></w:p>`)
+	}
+	for _, n := range notes {
+		for _, line := range strings.Split(n.String(), "\n") {
+			run := fmt.Sprintf(`<w:r><w:t xml:space="preserve">%s</w:t></w:r>`, xmlEscape(line))
+			if n.Added {
+				id++
+				run = fmt.Sprintf(`<w:ins w:id="%d" w:author="%s" w:date="%s">%s</w:ins>`, id, xmlEscape(author), stamp, run)
+			}
+			body.WriteString("<w:p>" + run + "</w:p>")
+		}
+	}
+
+	z := zip.NewWriter(w)
+	files := []struct{ name, content string }{
+		{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>
+</Types>`},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>
+</Relationships>`},
+		{"word/document.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+			body.String() + `</w:body></w:document>`},
+	}
+	for _, f := range files {
+		fw, err := z.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.content); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paulgmiller/efcr/core"
+)
+
+func TestDOCX(t *testing.T) {
+	edits := []core.Edit{
+		{Op: core.OpEqual, Tokens: []string{"The", "owner"}},
+		{Op: core.OpDelete, Tokens: []string{"shall"}},
+		{Op: core.OpInsert, Tokens: []string{"must"}},
+		{Op: core.OpEqual, Tokens: []string{"file", "<forms>", core.ParaBreak, "by"}},
+		{Op: core.OpInsert, Tokens: []string{"June", "1."}},
+	}
+	notes := []redlineNote{
+		{Note: core.Note{Kind: "EDNOTE", Heading: "Editorial Note:", Text: "Nomenclature changes."}},
+		{Note: core.Note{Kind: "EFFDNOT", Heading: "Effective Date Note:", Text: "At 89 FR 100, § 60.4 was amended."}, Added: true},
+	}
+	date := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	var b bytes.Buffer
+	if err := writeDOCX(&b, "40 CFR 60.4: changes", "A & B", date, edits, notes); err != nil {
+		t.Fatal(err)
+	}
+	_, files := readZip(t, b.Bytes())
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "word/document.xml"} {
+		content, ok := files[name]
+		if !ok {
+			t.Fatalf("no %s", name)
+		}
+		wellFormed(t, name, content)
+	}
+	if !strings.Contains(files["_rels/.rels"], `Target="word/document.xml"`) {
+		t.Error("package relationships do not point at the document")
+	}
+
+	doc := files["word/document.xml"]
+	for _, want := range []string{
+		`<w:r><w:t xml:space="preserve">The owner </w:t></w:r>`,
+		`<w:del w:id="1" w:author="A &amp; B" w:date="2024-01-02T00:00:00Z"><w:r><w:delText xml:space="preserve">shall </w:delText></w:r></w:del>`,
+		`<w:ins w:id="2" w:author="A &amp; B" w:date="2024-01-02T00:00:00Z"><w:r><w:t xml:space="preserve">must </w:t></w:r></w:ins>`,
+		`<w:t xml:space="preserve">file &lt;forms&gt; </w:t></w:r></w:p><w:p><w:r><w:t xml:space="preserve">by </w:t>`,
+		`<w:ins w:id="3" w:author="A &amp; B" w:date="2024-01-02T00:00:00Z"><w:r><w:t xml:space="preserve">June 1. </w:t></w:r></w:ins>`,
+		`<w:p><w:r><w:t xml:space="preserve">Nomenclature changes.</w:t></w:r></w:p>`,
+		`<w:ins w:id="4" w:author="A &amp; B" w:date="2024-01-02T00:00:00Z"><w:r><w:t xml:space="preserve">Effective Date Note:</w:t></w:r></w:ins>`,
+		`<w:ins w:id="5" w:author="A &amp; B" w:date="2024-01-02T00:00:00Z"><w:r><w:t xml:space="preserve">At 89 FR 100, § 60.4 was amended.</w:t></w:r></w:ins>`,
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("document has no %s", want)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+// Package ecfr is a client for the eCFR versioner API: the title list, a
+// title's version history, its structure tree and its full XML text.
+//
+//	c := ecfr.NewClient(http.DefaultClient)
+//	versions, err := c.Versions(ctx, 6, ecfr.Hierarchy{Part: "11"})
+//	doc, err := c.Document(ctx, 6, "2024-01-01", ecfr.Hierarchy{Part: "11"})
+//
+// Client does no caching or rate limiting of its own; wrap the Doer it is
+// given for that. Services embedding it can plug in their own transport,
+// logger and metrics:
+//
+//	c := ecfr.NewClient(nil,
+//		ecfr.WithTransport(otelhttp.NewTransport(http.DefaultTransport)),
+//		ecfr.WithLogger(slog.Default()),
+//		ecfr.WithMetrics(promRecorder))
+//
+// The API version is part of BaseURL, v1 by default; WithAPIVersion moves a
+// client to another. Responses announcing their version's deprecation are
+// passed to OnDeprecation, and a retired version's 410 Gone matches
+// ErrVersionRetired.
+package ecfr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/paulgmiller/efcr/core"
+)
+
+// DefaultBaseURL is the public versioner API, at DefaultAPIVersion.
+const DefaultBaseURL = "https://www.ecfr.gov/api/versioner/" + DefaultAPIVersion
+
+// Doer sends HTTP requests; *http.Client implements it. Implementations must
+// honour req.Context().
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Client calls the versioner API through HTTP.
+type Client struct {
+	HTTP    Doer
+	BaseURL string // without trailing slash
+	// Logger, when set, gets a debug record per request and a warning per
+	// failed one.
+	Logger *slog.Logger
+	// Metrics, when set, observes every request.
+	Metrics Recorder
+	// OnDeprecation, when set, gets every response, failed or not, whose
+	// headers announce its API version's deprecation (see Deprecation).
+	// Without it such responses are logged to Logger, if set.
+	OnDeprecation func(endpoint string, d *Deprecation)
+}
+
+// Recorder receives one observation per API request. Endpoint is titles,
+// versions, structure or full; status is 0 when no response arrived. The
+// duration runs to the response headers: a full body is still to be read.
+type Recorder interface {
+	ObserveRequest(endpoint string, status int, d time.Duration, err error)
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithTransport sends requests through an http.Client using rt, in place
+// of the Doer passed to NewClient.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) { c.HTTP = &http.Client{Transport: rt} }
+}
+
+// WithLogger sets Client.Logger.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Client) { c.Logger = l }
+}
+
+// WithMetrics sets Client.Metrics.
+func WithMetrics(r Recorder) Option {
+	return func(c *Client) { c.Metrics = r }
+}
+
+// WithBaseURL points the client at another deployment of the API.
+func WithBaseURL(u string) Option {
+	return func(c *Client) { c.BaseURL = strings.TrimSuffix(u, "/") }
+}
+
+// NewClient returns a Client for the public API sending requests through d,
+// or http.DefaultClient if d is nil and no option supplies a transport.
+func NewClient(d Doer, opts ...Option) *Client {
+	c := &Client{HTTP: d, BaseURL: DefaultBaseURL}
+	for _, o := range opts {
+		o(c)
+	}
+	if c.HTTP == nil {
+		c.HTTP = http.DefaultClient
+	}
+	return c
+}
+
+// Hierarchy narrows a request to one part and/or section of a title. The
+// zero value means the whole title.
+type Hierarchy struct {
+	Part    string
+	Section string
+}
+
+// Query returns the ?part=&section= filter for h, or "" for the whole title.
+// The renderer API takes the same filter.
+func (h Hierarchy) Query() string {
+	q := url.Values{}
+	if h.Part != "" {
+		q.Set("part", h.Part)
+	}
+	if h.Section != "" {
+		q.Set("section", h.Section)
+	}
+	if len(q) == 0 {
+		return ""
+	}
+	return "?" + q.Encode()
+}
+
+// StatusError is returned for any response other than 200 OK.
+type StatusError struct {
+	Code       int
+	URL        string
+	RetryAfter string // Retry-After header, if any
+	// Message is the error the body explained itself with, if its shape
+	// was recognised (see errorMessage).
+	Message string
+	// Deprecation is what the headers said about the API version, if
+	// anything.
+	Deprecation *Deprecation
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("HTTP %d %s", e.Code, e.URL)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.RetryAfter != "" {
+		msg += fmt.Sprintf(" (retry after %s)", e.RetryAfter)
+	}
+	return msg
+}
+
+// Unwrap makes a 410 Gone match ErrVersionRetired.
+func (e *StatusError) Unwrap() error {
+	if e.Code == http.StatusGone {
+		return ErrVersionRetired
+	}
+	return nil
+}
+
+// TitlesURL, VersionsURL, StructureURL, AncestryURL and FullURL return the
+// endpoint URLs the corresponding methods fetch.
+func (c *Client) TitlesURL() string { return c.BaseURL + "/titles.json" }
+
+func (c *Client) VersionsURL(title int, h Hierarchy) string {
+	return fmt.Sprintf("%s/versions/title-%d.json%s", c.BaseURL, title, h.Query())
+}
+
+func (c *Client) StructureURL(title int, date string) string {
+	return fmt.Sprintf("%s/structure/%s/title-%d.json", c.BaseURL, date, title)
+}
+
+func (c *Client) AncestryURL(title int, date string, h Hierarchy) string {
+	return fmt.Sprintf("%s/ancestry/%s/title-%d.json%s", c.BaseURL, date, title, h.Query())
+}
+
+func (c *Client) FullURL(title int, date string, h Hierarchy) string {
+	return fmt.Sprintf("%s/full/%s/title-%d.xml%s", c.BaseURL, date, title, h.Query())
+}
+
+// Titles lists every title with its currency date.
+func (c *Client) Titles(ctx context.Context) ([]Title, error) {
+	var resp struct {
+		Titles []Title `json:"titles"`
+	}
+	if err := c.getJSON(ctx, "titles", c.TitlesURL(), &resp); err != nil {
+		return nil, err
+	}
+	return resp.Titles, nil
+}
+
+// Versions lists every content version of a title (or of the part or section
+// in h), one entry per section per change.
+func (c *Client) Versions(ctx context.Context, title int, h Hierarchy) ([]Version, error) {
+	var resp struct {
+		Versions []Version `json:"content_versions"`
+	}
+	if err := c.getJSON(ctx, "versions", c.VersionsURL(title, h), &resp); err != nil {
+		return nil, err
+	}
+	return resp.Versions, nil
+}
+
+// Structure returns a title's hierarchy as of date.
+func (c *Client) Structure(ctx context.Context, title int, date string) (*StructureNode, error) {
+	var root StructureNode
+	if err := c.getJSON(ctx, "structure", c.StructureURL(title, date), &root); err != nil {
+		return nil, err
+	}
+	return &root, nil
+}
+
+// Ancestry returns the chain of nodes from the title down to the part or
+// section in h as of date, outermost first. The nodes have no Children.
+func (c *Client) Ancestry(ctx context.Context, title int, date string, h Hierarchy) ([]StructureNode, error) {
+	var resp struct {
+		Ancestors []StructureNode `json:"ancestors"`
+	}
+	if err := c.getJSON(ctx, "ancestry", c.AncestryURL(title, date, h), &resp); err != nil {
+		return nil, err
+	}
+	return resp.Ancestors, nil
+}
+
+// Full GETs the XML of a title (or the part or section in h) as of date.
+// The response is returned so callers can read headers set by the Doer;
+// the caller closes its Body.
+func (c *Client) Full(ctx context.Context, title int, date string, h Hierarchy) (*http.Response, error) {
+	return c.get(ctx, "full", c.FullURL(title, date, h), "application/xml")
+}
+
+// Open is Full for callers that only want the XML body. Caller closes.
+func (c *Client) Open(ctx context.Context, title int, date string, h Hierarchy) (io.ReadCloser, error) {
+	resp, err := c.Full(ctx, title, date, h)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Text returns the character data of the XML as plain text. The body is
+// closed once the returned reader has been read to the end.
+func (c *Client) Text(ctx context.Context, title int, date string, h Hierarchy) (io.Reader, error) {
+	body, err := c.Open(ctx, title, date, h)
+	if err != nil {
+		return nil, err
+	}
+	return core.PlainText(body), nil
+}
+
+// Document fetches the XML and parses it into an ECFRFile.
+func (c *Client) Document(ctx context.Context, title int, date string, h Hierarchy) (*core.ECFRFile, error) {
+	body, err := c.Open(ctx, title, date, h)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return core.ParseFile(body)
+}
+
+// GetJSON GETs url through d and decodes the JSON response into out. It is
+// exported for the other eCFR APIs (admin, search) that share conventions
+// with the versioner but have no typed methods here.
+func GetJSON(ctx context.Context, d Doer, url string, out any) error {
+	resp, err := get(ctx, d, url, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) getJSON(ctx context.Context, endpoint, url string, out any) error {
+	resp, err := c.get(ctx, endpoint, url, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// get is the package get with the client's logging, metrics and
+// deprecation handling.
+func (c *Client) get(ctx context.Context, endpoint, url, accept string) (*http.Response, error) {
+	start := time.Now()
+	resp, err := get(ctx, c.HTTP, url, accept)
+	d := time.Since(start)
+	status := 0
+	var se *StatusError
+	var dep *Deprecation
+	switch {
+	case err == nil:
+		status = resp.StatusCode
+		dep = DeprecationOf(url, resp.Header)
+	case errors.As(err, &se):
+		status, dep = se.Code, se.Deprecation
+	}
+	switch {
+	case dep == nil:
+	case c.OnDeprecation != nil:
+		c.OnDeprecation(endpoint, dep)
+	case c.Logger != nil:
+		c.Logger.LogAttrs(ctx, slog.LevelWarn, "ecfr API version deprecated", slog.String("endpoint", endpoint), slog.String("url", url),
+			slog.String("deprecation", dep.Deprecated), slog.String("sunset", dep.Sunset), slog.String("successor", dep.Successor))
+	}
+	if c.Metrics != nil {
+		c.Metrics.ObserveRequest(endpoint, status, d, err)
+	}
+	if c.Logger != nil {
+		attrs := []slog.Attr{slog.String("endpoint", endpoint), slog.String("url", url), slog.Int("status", status), slog.Duration("duration", d)}
+		if err != nil {
+			c.Logger.LogAttrs(ctx, slog.LevelWarn, "ecfr request failed", append(attrs, slog.Any("error", err))...)
+		} else {
+			c.Logger.LogAttrs(ctx, slog.LevelDebug, "ecfr request", attrs...)
+		}
+	}
+	return resp, err
+}
+
+func get(ctx context.Context, d Doer, url, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	resp, err := d.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, &StatusError{Code: resp.StatusCode, URL: url, RetryAfter: resp.Header.Get("Retry-After"),
+			Message: errorMessage(resp.Body), Deprecation: DeprecationOf(url, resp.Header)}
+	}
+	return resp, nil
+}
@@ -0,0 +1,82 @@
+package ecfr_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// fixtureAPI serves the responses recorded under testdata, laid out by
+// endpoint path, in place of the versioner API. Queries are ignored, so
+// testdata/versions/title-6.json answers for any part of title 6.
+func fixtureAPI() (*httptest.Server, *ecfr.Client) {
+	srv := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	return srv, ecfr.NewClient(srv.Client(), ecfr.WithBaseURL(srv.URL))
+}
+
+func ExampleClient_Titles() {
+	srv, c := fixtureAPI()
+	defer srv.Close()
+
+	titles, err := c.Titles(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, t := range titles {
+		fmt.Printf("%d %s (amended %s)\n", t.Number, t.Name, t.LatestAmendedOn)
+	}
+	// Output:
+	// 1 General Provisions (amended 2022-12-29)
+	// 2 Federal Financial Assistance (amended 2024-05-16)
+	// 6 Domestic Security (amended 2024-01-05)
+}
+
+func ExampleClient_Versions() {
+	srv, c := fixtureAPI()
+	defer srv.Close()
+
+	versions, err := c.Versions(context.Background(), 6, ecfr.Hierarchy{Part: "5"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, v := range versions {
+		fmt.Printf("%s §%s substantive=%t\n", v.Date, v.Identifier, v.Substantive)
+	}
+	// Output:
+	// 2023-06-12 §5.1 substantive=true
+	// 2023-06-12 §5.2 substantive=true
+	// 2024-01-05 §5.1 substantive=true
+}
+
+// Diff a section between two snapshots: fetch and parse the part as of each
+// date, find the section in both and compare their words.
+func Example_sectionDiff() {
+	srv, c := fixtureAPI()
+	defer srv.Close()
+	ctx := context.Background()
+
+	section := func(date string) *core.Div {
+		doc, err := c.Document(ctx, 6, date, ecfr.Hierarchy{Part: "5"})
+		if err != nil {
+			log.Fatal(err)
+		}
+		return core.FindDiv(doc.Root(), "5.1")
+	}
+	before, after := section("2023-06-12"), section("2024-01-05")
+	for _, e := range core.DiffTokens(core.DivTokens(before), core.DivTokens(after)) {
+		switch e.Op {
+		case core.OpInsert:
+			fmt.Println("+", strings.Join(e.Tokens, " "))
+		case core.OpDelete:
+			fmt.Println("-", strings.Join(e.Tokens, " "))
+		}
+	}
+	// Output:
+	// + and responding to
+}
@@ -0,0 +1,105 @@
+package ecfr
+
+// Title is one entry of /titles.json.
+type Title struct {
+	Number       int    `json:"number"`
+	Name         string `json:"name"`
+	UpToDateAsOf string `json:"up_to_date_as_of"`
+	// LatestAmendedOn is the date of the title's latest amendment; nothing
+	// newer is listed in its versions.
+	LatestAmendedOn string `json:"latest_amended_on"`
+	Reserved        bool   `json:"reserved"`
+}
+
+// Version is one entry of /versions/title-{n}.json:
+//
+//	{
+//	  "date": "2017-01-19",
+//	  "amendment_date": "2017-01-19",
+//	  "issue_date": "2017-01-19",
+//	  "identifier": "3474.20",
+//	  "name": "§ 3474.20   xxx",
+//	  "part": "3474",
+//	  "substantive": true,
+//	  "removed": false,
+//	  "subpart": null,
+//	  "title": "2",
+//	  "type": "section"
+//	}
+type Version struct {
+	Date          string  `json:"date"`
+	AmendmentDate string  `json:"amendment_date"`
+	IssueDate     string  `json:"issue_date"`
+	Identifier    string  `json:"identifier"`
+	Name          string  `json:"name"`
+	Part          string  `json:"part"`
+	Substantive   bool    `json:"substantive"`
+	Removed       bool    `json:"removed"`
+	Subpart       *string `json:"subpart"` // null outside subparts
+	Title         string  `json:"title"`
+	Type          string  `json:"type"`
+}
+
+// DateOf returns the version's date on the requested axis: "amendment" (the
+// effective date) or "issue" (when it was published to the eCFR).
+func (v Version) DateOf(field string) string {
+	d := v.AmendmentDate
+	if field == "issue" {
+		d = v.IssueDate
+	}
+	if d == "" {
+		d = v.Date
+	}
+	return d
+}
+
+// StructureNode matches the recursive /structure/{date}/title-{n}.json tree.
+type StructureNode struct {
+	Identifier       string          `json:"identifier"`
+	Label            string          `json:"label"`
+	LabelDescription string          `json:"label_description"`
+	Type             string          `json:"type"` // title, chapter, subchapter, part, subpart, section
+	Reserved         bool            `json:"reserved"`
+	Children         []StructureNode `json:"children"`
+}
+
+// Find returns the first node (depth first) of type typ with identifier id.
+func (n *StructureNode) Find(typ, id string) *StructureNode {
+	if n.Type == typ && n.Identifier == id {
+		return n
+	}
+	for i := range n.Children {
+		if found := n.Children[i].Find(typ, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Parts lists the identifiers of every non-reserved part under n.
+func (n *StructureNode) Parts() []string {
+	if n.Type == "part" {
+		if n.Reserved {
+			return nil
+		}
+		return []string{n.Identifier}
+	}
+	var out []string
+	for i := range n.Children {
+		out = append(out, n.Children[i].Parts()...)
+	}
+	return out
+}
+
+// Sections counts section and appendix nodes under n, reserved ones
+// included since the XML keeps their placeholders too.
+func (n *StructureNode) Sections() int {
+	if n.Type == "section" || n.Type == "appendix" {
+		return 1
+	}
+	total := 0
+	for i := range n.Children {
+		total += n.Children[i].Sections()
+	}
+	return total
+}
@@ -0,0 +1,121 @@
+package ecfr
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// DefaultAPIVersion is the versioner API version a Client targets unless
+// WithAPIVersion says otherwise.
+const DefaultAPIVersion = "v1"
+
+// ErrVersionRetired is matched (errors.Is) by a StatusError for 410 Gone,
+// the answer an API version gets once it is switched off.
+var ErrVersionRetired = errors.New("API version retired")
+
+var versionSegment = regexp.MustCompile(`/v\d+$`)
+
+// ValidAPIVersion reports whether v names an API version: v1, v2 and so on.
+func ValidAPIVersion(v string) bool {
+	return versionSegment.MatchString("/" + v)
+}
+
+// WithAPIVersion targets another version of the versioner API, e.g. "v2",
+// by replacing the version at the end of BaseURL, or adding one if it has
+// none. Give it after WithBaseURL. The endpoints keep their v1 paths and
+// shapes until a newer version is known to change them.
+func WithAPIVersion(v string) Option {
+	return func(c *Client) {
+		if v == "" {
+			return
+		}
+		c.BaseURL = versionSegment.ReplaceAllString(c.BaseURL, "") + "/" + v
+	}
+}
+
+// WithDeprecationHandler sets Client.OnDeprecation.
+func WithDeprecationHandler(f func(endpoint string, d *Deprecation)) Option {
+	return func(c *Client) { c.OnDeprecation = f }
+}
+
+// APIVersion returns the version BaseURL ends in, "" if none.
+func (c *Client) APIVersion() string {
+	return strings.TrimPrefix(versionSegment.FindString(c.BaseURL), "/")
+}
+
+// Deprecation is what a response says about its API version being phased
+// out: the Deprecation (RFC 9745) and Sunset (RFC 8594) headers, a Link to
+// the successor-version, or a 299 Warning. Empty fields were not sent.
+type Deprecation struct {
+	URL        string
+	Deprecated string // Deprecation header: a date, or "true" in older drafts
+	Sunset     string // when the version stops answering, an HTTP-date
+	Successor  string // URL of the version replacing it
+	Warning    string // text of a 299 (miscellaneous persistent) Warning
+}
+
+// DeprecationOf returns what the headers of a response from url say about
+// deprecation, or nil if they say nothing.
+func DeprecationOf(url string, h http.Header) *Deprecation {
+	d := &Deprecation{URL: url, Deprecated: h.Get("Deprecation"), Sunset: h.Get("Sunset")}
+	for _, link := range h.Values("Link") {
+		for _, l := range strings.Split(link, ",") {
+			target, params, _ := strings.Cut(strings.TrimSpace(l), ";")
+			if strings.Contains(params, `rel="successor-version"`) || strings.Contains(params, "rel=successor-version") {
+				d.Successor = strings.Trim(strings.TrimSpace(target), "<>")
+			}
+		}
+	}
+	for _, w := range h.Values("Warning") {
+		if strings.HasPrefix(w, "299 ") {
+			d.Warning = w
+		}
+	}
+	if d.Deprecated == "" && d.Sunset == "" && d.Successor == "" && d.Warning == "" {
+		return nil
+	}
+	return d
+}
+
+// errorMessage pulls a message out of an error response body in any of the
+// shapes the eCFR APIs have used or are likely to: {"error": "..."},
+// {"message": "..."}, {"error": {"message": "..."}} and JSON:API's
+// {"errors": [{"detail": "..."}]}. It returns "" for anything else.
+func errorMessage(body io.Reader) string {
+	b, err := io.ReadAll(io.LimitReader(body, 8<<10))
+	if err != nil || len(b) == 0 {
+		return ""
+	}
+	var shape struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+		Errors  []struct {
+			Title  string `json:"title"`
+			Detail string `json:"detail"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(b, &shape) != nil {
+		return ""
+	}
+	var s string
+	var nested struct {
+		Message string `json:"message"`
+	}
+	switch {
+	case json.Unmarshal(shape.Error, &s) == nil && s != "":
+		return s
+	case json.Unmarshal(shape.Error, &nested) == nil && nested.Message != "":
+		return nested.Message
+	case shape.Message != "":
+		return shape.Message
+	case len(shape.Errors) > 0 && shape.Errors[0].Detail != "":
+		return shape.Errors[0].Detail
+	case len(shape.Errors) > 0:
+		return shape.Errors[0].Title
+	}
+	return ""
+}
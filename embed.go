@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Embedder turns texts into vectors whose cosine distance says how far
+// apart their meanings are. events --drift scores each section change
+// with one, as a meaning-level signal next to the word-level magnitude.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// newEmbedder picks a backend from an --embedder spec:
+//
+//	hash[:DIMS]        built in: hashed word and word-pair counts (default)
+//	http(s)://…        an OpenAI-style /v1/embeddings endpoint, which
+//	                   Ollama, vLLM and llama.cpp's server also speak
+//	cmd:COMMAND        an external process, one JSON line each way:
+//	                   → {"texts":["…"]}  ← {"vectors":[[…]]} or {"error":"…"}
+//
+// model is sent to HTTP endpoints; EFCR_EMBED_KEY, if set, is sent as a
+// bearer token.
+func newEmbedder(ctx context.Context, spec, model string) (Embedder, error) {
+	switch {
+	case spec == "hash" || strings.HasPrefix(spec, "hash:"):
+		dims := 1024
+		if _, n, ok := strings.Cut(spec, ":"); ok {
+			d, err := strconv.Atoi(n)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("bad --embedder %q: want hash:DIMS", spec)
+			}
+			dims = d
+		}
+		return hashEmbedder{dims}, nil
+	case strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://"):
+		return &httpEmbedder{Client: http.DefaultClient, URL: spec, Model: model, Key: os.Getenv("EFCR_EMBED_KEY")}, nil
+	case strings.HasPrefix(spec, "cmd:"):
+		return startCommandEmbedder(ctx, strings.TrimPrefix(spec, "cmd:"))
+	}
+	return nil, fmt.Errorf("unknown --embedder %q (hash[:DIMS], http(s)://…, cmd:COMMAND)", spec)
+}
+
+// hashEmbedder needs no model: it counts words and adjacent word pairs
+// into dims buckets by hash (sublinearly, with a hashed sign so collisions
+// tend to cancel). That tracks vocabulary rather than meaning, so reworded
+// text with the same sense still drifts, but it is free and deterministic.
+type hashEmbedder struct {
+	dims int
+}
+
+func (h hashEmbedder) Embed(_ context.Context, texts []string) ([][]float64, error) {
+	out := make([][]float64, len(texts))
+	for i, t := range texts {
+		counts := map[string]int{}
+		words := strings.FieldsFunc(strings.ToLower(t), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for j, w := range words {
+			counts[w]++
+			if j > 0 {
+				counts[words[j-1]+" "+w]++
+			}
+		}
+		v := make([]float64, h.dims)
+		for f, n := range counts {
+			sum := fnv.New64a()
+			io.WriteString(sum, f)
+			x := sum.Sum64()
+			sign := 1.0
+			if x>>63 == 1 {
+				sign = -1
+			}
+			v[x%uint64(h.dims)] += sign * (1 + math.Log(float64(n)))
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// httpEmbedder calls an OpenAI-style embeddings endpoint.
+type httpEmbedder struct {
+	Client httpclient
+	URL    string
+	Model  string
+	Key    string
+}
+
+func (h *httpEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	body, err := json.Marshal(map[string]any{"model": h.Model, "input": texts})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.Key != "" {
+		req.Header.Set("Authorization", "Bearer "+h.Key)
+	}
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("embed %s: %s: %s", h.URL, resp.Status, bytes.TrimSpace(msg))
+	}
+	var parsed struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("embed %s: %w", h.URL, err)
+	}
+	out := make([][]float64, len(texts))
+	for _, d := range parsed.Data {
+		if d.Index < 0 || d.Index >= len(out) {
+			return nil, fmt.Errorf("embed %s: index %d out of range", h.URL, d.Index)
+		}
+		out[d.Index] = d.Embedding
+	}
+	for i, v := range out {
+		if v == nil {
+			return nil, fmt.Errorf("embed %s: no embedding for input %d", h.URL, i)
+		}
+	}
+	return out, nil
+}
+
+// commandEmbedder is an external embedding process, started once and
+// spoken to like a Plugin.
+type commandEmbedder struct {
+	command string
+
+	mu  sync.Mutex
+	cmd *exec.Cmd
+	in  io.WriteCloser
+	enc *json.Encoder
+	out *bufio.Scanner
+}
+
+func startCommandEmbedder(ctx context.Context, command string) (*commandEmbedder, error) {
+	argv := strings.Fields(command)
+	if len(argv) == 0 {
+		return nil, errors.New("empty embedder command")
+	}
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start embedder %q: %w", command, err)
+	}
+	scanner := bufio.NewScanner(out)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	return &commandEmbedder{command: command, cmd: cmd, in: in, enc: json.NewEncoder(in), out: scanner}, nil
+}
+
+func (c *commandEmbedder) Embed(_ context.Context, texts []string) ([][]float64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.enc.Encode(map[string][]string{"texts": texts}); err != nil {
+		return nil, fmt.Errorf("embedder %q: %w", c.command, err)
+	}
+	if !c.out.Scan() {
+		if err := c.out.Err(); err != nil {
+			return nil, fmt.Errorf("embedder %q: %w", c.command, err)
+		}
+		return nil, fmt.Errorf("embedder %q exited", c.command)
+	}
+	var resp struct {
+		Vectors [][]float64 `json:"vectors"`
+		Error   string      `json:"error"`
+	}
+	if err := json.Unmarshal(c.out.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("embedder %q: bad response: %w", c.command, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("embedder %q: %s", c.command, resp.Error)
+	}
+	if len(resp.Vectors) != len(texts) {
+		return nil, fmt.Errorf("embedder %q: %d vectors for %d texts", c.command, len(resp.Vectors), len(texts))
+	}
+	return resp.Vectors, nil
+}
+
+// Close ends the embedder's input and waits for it to exit.
+func (c *commandEmbedder) Close() error {
+	c.in.Close()
+	return c.cmd.Wait()
+}
+
+// cosineDistance is 1 minus the cosine similarity of a and b: 0 for the
+// same direction, 1 for unrelated. Empty vectors are 0 apart from each
+// other and 1 from anything else.
+func cosineDistance(a, b []float64) float64 {
+	var dot, na, nb float64
+	for i := range min(len(a), len(b)) {
+		dot += a[i] * b[i]
+	}
+	for _, x := range a {
+		na += x * x
+	}
+	for _, x := range b {
+		nb += x * x
+	}
+	switch {
+	case na == 0 && nb == 0:
+		return 0
+	case na == 0 || nb == 0:
+		return 1
+	}
+	return 1 - dot/math.Sqrt(na*nb)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/paulgmiller/efcr/core"
+)
+
+// epubBook accumulates one XHTML file per part (or per top-level leaf when a
+// title has no parts) plus a nested navigation list mirroring the Div tree.
+type epubBook struct {
+	files []epubFile
+	nav   strings.Builder
+	ids   int
+}
+
+type epubFile struct {
+	name string
+	body strings.Builder
+}
+
+func hasPart(d *core.Div) bool {
+	if d.Type == "PART" {
+		return true
+	}
+	for i := range d.Children {
+		if hasPart(&d.Children[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func divLabel(d *core.Div) string {
+	if d.Head != "" {
+		return d.Head
+	}
+	return strings.TrimSpace(d.Type + " " + d.N)
+}
+
+// add walks d. Above part level it only builds navigation; at a part (or a
+// part-less subtree) it opens a new file and renders everything below it.
+func (b *epubBook) add(d *core.Div, file *epubFile, level int) {
+	if file == nil && (d.Type == "PART" || !hasPart(d)) {
+		b.files = append(b.files, epubFile{name: fmt.Sprintf("f%04d.xhtml", len(b.files)+1)})
+		file = &b.files[len(b.files)-1]
+	}
+
+	b.nav.WriteString("<li>")
+	if file != nil {
+		b.ids++
+		id := fmt.Sprintf("d%d", b.ids)
+		fmt.Fprintf(&b.nav, `<a href="%s#%s">%s</a>`, file.name, id, html.EscapeString(divLabel(d)))
+		h := min(level+1, 6)
+		fmt.Fprintf(&file.body, "<h%d id=\"%s\">%s</h%d>\n", h, id, html.EscapeString(divLabel(d)), h)
+		writeParas(&file.body, d)
+	} else {
+		fmt.Fprintf(&b.nav, "<span>%s</span>", html.EscapeString(divLabel(d)))
+	}
+
+	// Sections are leaves in the table of contents; anything below them is
+	// only rendered inline.
+	if len(d.Children) > 0 && d.Type != "SECTION" {
+		b.nav.WriteString("<ol>")
+		for i := range d.Children {
+			b.add(&d.Children[i], file, level+1)
+		}
+		b.nav.WriteString("</ol>")
+	} else if file != nil {
+		for i := range d.Children {
+			b.addInline(&d.Children[i], file, level+1)
+		}
+	}
+	b.nav.WriteString("</li>\n")
+}
+
+func (b *epubBook) addInline(d *core.Div, file *epubFile, level int) {
+	h := min(level+1, 6)
+	fmt.Fprintf(&file.body, "<h%d>%s</h%d>\n", h, html.EscapeString(divLabel(d)), h)
+	writeParas(&file.body, d)
+	for i := range d.Children {
+		b.addInline(&d.Children[i], file, level+1)
+	}
+}
+
+// writeParas renders d's paragraphs, with footnote references as
+// superscripts, and then its footnotes.
+func writeParas(w *strings.Builder, d *core.Div) {
+	for _, p := range d.Paras {
+		words := strings.Fields(p.Text)
+		var b strings.Builder
+		i := 0
+		for _, a := range p.Anchors {
+			for ; i < a.Word && i < len(words); i++ {
+				b.WriteString(" " + html.EscapeString(words[i]))
+			}
+			b.WriteString("<sup>" + html.EscapeString(a.Mark) + "</sup>")
+		}
+		for ; i < len(words); i++ {
+			b.WriteString(" " + html.EscapeString(words[i]))
+		}
+		fmt.Fprintf(w, "<p class=\"%s\">%s</p>\n", strings.ToLower(p.Tag), strings.TrimSpace(b.String()))
+	}
+	for _, f := range d.Footnotes {
+		fmt.Fprintf(w, "<p class=\"ftnt\"><sup>%s</sup> %s</p>\n", html.EscapeString(f.Mark), html.EscapeString(f.Text))
+	}
+}
+
+// writeEPUB packages root as an EPUB 3 book titled bookTitle.
+func writeEPUB(w io.Writer, root *core.Div, bookTitle, identifier string) error {
+	b := &epubBook{}
+	b.nav.WriteString("<ol>\n")
+	b.add(root, nil, 0)
+	b.nav.WriteString("</ol>\n")
+
+	z := zip.NewWriter(w)
+	// The mimetype entry must come first and be stored uncompressed.
+	mw, err := z.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	io.WriteString(mw, "application/epub+zip")
+
+	put := func(name, content string) error {
+		fw, err := z.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(fw, content)
+		return err
+	}
+	if err := put("META-INF/container.xml", `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>
+`); err != nil {
+		return err
+	}
+
+	var manifest, spine strings.Builder
+	for i, f := range b.files {
+		fmt.Fprintf(&manifest, "<item id=\"c%d\" href=\"%s\" media-type=\"application/xhtml+xml\"/>\n", i, f.name)
+		fmt.Fprintf(&spine, "<itemref idref=\"c%d\"/>\n", i)
+		if err := put("OEBPS/"+f.name, xhtmlPage(bookTitle, "", f.body.String())); err != nil {
+			return err
+		}
+	}
+	if err := put("OEBPS/nav.xhtml", xhtmlPage(bookTitle, ` xmlns:epub="http://www.idpf.org/2007/ops"`,
+		"<nav epub:type=\"toc\" id=\"toc\">\n<h1>Contents</h1>\n"+b.nav.String()+"</nav>\n")); err != nil {
+		return err
+	}
+	opf := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="id">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:identifier id="id">%s</dc:identifier>
+<dc:title>%s</dc:title>
+<dc:language>en</dc:language>
+<meta property="dcterms:modified">%s</meta>
+</metadata>
+<manifest>
+<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+%s</manifest>
+<spine>
+%s</spine>
+</package>
+`, html.EscapeString(identifier), html.EscapeString(bookTitle), time.Now().UTC().Format("2006-01-02T15:04:05Z"), manifest.String(), spine.String())
+	if err := put("OEBPS/content.opf", opf); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+func xhtmlPage(title, nsAttr, body string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml"%s>
+<head><title>%s</title></head>
+<body>
+%s</body>
+</html>
+`, nsAttr, html.EscapeString(title), body)
+}
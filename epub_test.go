@@ -0,0 +1,113 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/paulgmiller/efcr/core"
+)
+
+const testTitleXML = `<DIV1 N="40" TYPE="TITLE"><HEAD>Title 40—Protection of Environment</HEAD>
+<DIV3 N="I" TYPE="CHAPTER"><HEAD>CHAPTER I—ENVIRONMENTAL PROTECTION AGENCY</HEAD>
+<DIV5 N="60" TYPE="PART"><HEAD>PART 60—STANDARDS &amp; PERFORMANCE</HEAD>
+<DIV8 N="60.1" TYPE="SECTION"><HEAD>§ 60.1 Applicability.</HEAD><P>(a) Except as provided in <I>subparts B</I> and C, the provisions apply.</P></DIV8>
+<DIV8 N="60.2" TYPE="SECTION"><HEAD>§ 60.2 Definitions.</HEAD><P>Terms &lt;used&gt; here.</P></DIV8>
+</DIV5>
+<DIV5 N="61" TYPE="PART"><HEAD>PART 61—HAZARDOUS AIR POLLUTANTS</HEAD>
+<DIV8 N="61.01" TYPE="SECTION"><HEAD>§ 61.01 Lists.</HEAD><P>Substances listed.</P></DIV8>
+</DIV5></DIV3></DIV1>`
+
+// readZip returns the entries of a zip archive in order, failing on any
+// the standard reader can't read.
+func readZip(t *testing.T, b []byte) ([]*zip.File, map[string]string) {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		files[f.Name] = string(content)
+	}
+	return zr.File, files
+}
+
+// wellFormed fails unless s parses as XML.
+func wellFormed(t *testing.T, name, s string) {
+	t.Helper()
+	dec := xml.NewDecoder(strings.NewReader(s))
+	for {
+		_, err := dec.Token()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatalf("%s is not well-formed XML: %v", name, err)
+		}
+	}
+}
+
+func TestEPUB(t *testing.T) {
+	root, err := core.ParseDocument(strings.NewReader(testTitleXML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := writeEPUB(&b, root, "Title 40 <2024-01-02>", "urn:efcr:title-40:2024-01-02"); err != nil {
+		t.Fatal(err)
+	}
+	entries, files := readZip(t, b.Bytes())
+	if entries[0].Name != "mimetype" || entries[0].Method != zip.Store || files["mimetype"] != "application/epub+zip" {
+		t.Fatal("the first entry is not the stored mimetype")
+	}
+	for name, content := range files {
+		if name != "mimetype" {
+			wellFormed(t, name, content)
+		}
+	}
+	if !strings.Contains(files["META-INF/container.xml"], `full-path="OEBPS/content.opf"`) {
+		t.Fatal("container.xml does not point at the package document")
+	}
+
+	opf := files["OEBPS/content.opf"]
+	hrefs := regexp.MustCompile(`href="([^"]+)"`).FindAllStringSubmatch(opf, -1)
+	if len(hrefs) != 3 {
+		t.Fatalf("manifest has %d items, want nav and one file per part", len(hrefs))
+	}
+	for _, h := range hrefs {
+		if _, ok := files["OEBPS/"+h[1]]; !ok {
+			t.Errorf("manifest item %s is not in the archive", h[1])
+		}
+	}
+	if !strings.Contains(opf, "<dc:title>Title 40 &lt;2024-01-02&gt;</dc:title>") {
+		t.Error("book title missing or unescaped")
+	}
+
+	// Every contents entry leads to an element of its file.
+	links := regexp.MustCompile(`href="([^"#]+)#([^"]+)"`).FindAllStringSubmatch(files["OEBPS/nav.xhtml"], -1)
+	if len(links) != 5 {
+		t.Errorf("contents has %d links, want the 2 parts and 3 sections", len(links))
+	}
+	for _, l := range links {
+		if !strings.Contains(files["OEBPS/"+l[1]], `id="`+l[2]+`"`) {
+			t.Errorf("contents link %s#%s has no target", l[1], l[2])
+		}
+	}
+	if !strings.Contains(files["OEBPS/f0001.xhtml"], "Except as provided in subparts B and C") {
+		t.Error("section text missing from the part's file")
+	}
+}
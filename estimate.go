@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+	"github.com/paulgmiller/efcr/pipeline"
+	"golang.org/x/sync/errgroup"
+)
+
+// Estimate extrapolates a total from a simple random sample.
+type Estimate struct {
+	Total      float64
+	HalfWidth  float64 // of the 95% confidence interval
+	Sampled    int
+	Population int
+}
+
+// estimateTotal extrapolates the total over population items from the
+// values of a sample of them: population times the sample mean, with a 95%
+// interval from the normal approximation and the finite population
+// correction, so a complete sample has no uncertainty.
+func estimateTotal(values []float64, population int) Estimate {
+	e := Estimate{Sampled: len(values), Population: population}
+	n, N := float64(len(values)), float64(population)
+	if n == 0 {
+		return e
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / n
+	e.Total = N * mean
+	if n >= N {
+		return e // everything counted
+	}
+	if n < 2 {
+		e.HalfWidth = math.Inf(1)
+		return e
+	}
+	var ss float64
+	for _, v := range values {
+		ss += (v - mean) * (v - mean)
+	}
+	sd := math.Sqrt(ss / (n - 1))
+	e.HalfWidth = 1.96 * N * sd / math.Sqrt(n) * math.Sqrt(max(0, 1-n/N))
+	return e
+}
+
+// format prints the estimate with its interval and how it was sampled; of
+// says what the population is (parts, snapshots).
+func (e Estimate) format(of string) string {
+	return fmt.Sprintf("~%.0f\t±%.0f (95%%, %d of %d %s sampled)", e.Total, e.HalfWidth, e.Sampled, e.Population, of)
+}
+
+// estimateParts estimates a title's words on date from a sample of its
+// parts, reserved ones aside, each counted as wordcount --part would.
+func estimateParts(ctx context.Context, api *ecfr.Client, title int, date string, fraction float64, seed int64) (Estimate, error) {
+	root, err := api.Structure(ctx, title, date)
+	if err != nil {
+		return Estimate{}, fmt.Errorf("title %d structure: %w", title, err)
+	}
+	var parts []string
+	var walk func(n *ecfr.StructureNode)
+	walk = func(n *ecfr.StructureNode) {
+		if n.Type == "part" {
+			if !n.Reserved {
+				parts = append(parts, n.Identifier)
+			}
+			return
+		}
+		for i := range n.Children {
+			walk(&n.Children[i])
+		}
+	}
+	walk(root)
+	sample := pipeline.SampleItems(parts, fraction, seed, title)
+	words := make([]float64, len(sample))
+	// The first failed fetch cancels the rest rather than letting them run
+	// on against the rate limit.
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(maxWorkers)
+	for i, p := range sample {
+		g.Go(func() error {
+			text, err := api.Text(ctx, title, date, ecfr.Hierarchy{Part: p})
+			if err != nil {
+				return fmt.Errorf("part %s: %w", p, err)
+			}
+			n, err := core.CountWords(text)
+			words[i] = float64(n)
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return Estimate{}, err
+	}
+	return estimateTotal(words, len(parts)), nil
+}
+
+// printEstimates writes crawl --estimate's table: each title's words summed
+// over every snapshot, extrapolated from those sampled, and the total,
+// whose interval treats the titles' as independent.
+func printEstimates(w io.Writer, results []pipeline.TitleResult) {
+	fmt.Fprintln(w, "Title\tWords\tInterval")
+	var total, variance float64
+	sampled, planned := 0, 0
+	for _, r := range results {
+		if r.Errs != nil {
+			continue
+		}
+		var words []float64
+		for _, n := range r.Dates {
+			words = append(words, float64(n))
+		}
+		e := estimateTotal(words, r.Planned)
+		fmt.Fprintf(w, "%s\t%s\n", r.Title.Name, e.format("snapshots"))
+		total += e.Total
+		variance += e.HalfWidth * e.HalfWidth
+		sampled, planned = sampled+e.Sampled, planned+e.Population
+	}
+	all := Estimate{Total: total, HalfWidth: math.Sqrt(variance), Sampled: sampled, Population: planned}
+	fmt.Fprintf(w, "Total\t%s\n", all.format("snapshots"))
+}
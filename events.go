@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// AmendmentEvent is one line of the `events` NDJSON stream: a single change
+// to a single section on a single date.
+type AmendmentEvent struct {
+	ID            string `json:"id"`   // core.SectionID, chapter as of the title's latest date
+	Date          string `json:"date"` // on the --date-field axis
+	AmendmentDate string `json:"amendment_date"`
+	IssueDate     string `json:"issue_date"`
+	Title         int    `json:"title"`
+	Part          string `json:"part"`
+	Section       string `json:"section"`
+	Name          string `json:"name"`
+	Type          string `json:"type"` // added, modified, removed
+	Substantive   bool   `json:"substantive"`
+	Magnitude     *int   `json:"magnitude,omitempty"` // words inserted + deleted
+	// Drift is the embedding cosine distance between the modified section
+	// and its previous version (--drift): near 0 for the same meaning.
+	Drift  *float64 `json:"drift,omitempty"`
+	FRCite string   `json:"fr_cite,omitempty"` // latest FR citation in the source note
+	owner
+
+	snapshot string // versioner date to fetch this version's text at
+	prevDate string // snapshot of the previous version of the section, if any
+}
+
+// runEvents writes one AmendmentEvent per section version as NDJSON.
+//
+//	efcr events --title 6 [--part 11] [--magnitude] [--out events.ndjson]
+//	efcr events --title 6 --drift --embedder http://localhost:11434/v1/embeddings --embed-model nomic-embed-text
+//
+// `events replay` re-sends what watch has journaled instead; see
+// runEventsReplay.
+func runEvents(ctx context.Context, c httpclient, args []string) error {
+	if len(args) > 0 && args[0] == "replay" {
+		return runEventsReplay(ctx, args[1:])
+	}
+	fs := flag.NewFlagSet("events", flag.ExitOnError)
+	title := fs.Int("title", 0, "title number")
+	part := fs.String("part", "", "restrict to one part")
+	dateField := fs.String("date-field", "amendment", "date axis for events: amendment or issue")
+	magnitude := fs.Bool("magnitude", false, "fetch section text to compute change magnitude and FR citation (slow)")
+	drift := fs.Bool("drift", false, "also score how far each modified section's meaning moved, by embedding distance (implies --magnitude)")
+	embedder := fs.String("embedder", "hash", "--drift backend: hash[:DIMS], an http(s) embeddings URL, or cmd:COMMAND")
+	embedModel := fs.String("embed-model", "", "model name sent to an http --embedder")
+	out := fs.String("out", "", "output file (default stdout)")
+	saveFacts := fs.String("save-facts", "", "also write amendment count facts as NDJSON for `efcr query`")
+	fs.Parse(args)
+	if *title == 0 {
+		return errors.New("--title is required")
+	}
+	if err := validDateField(*dateField); err != nil {
+		return err
+	}
+
+	versions, err := newAPI(c).Versions(ctx, *title, ecfr.Hierarchy{Part: *part})
+	if err != nil {
+		return err
+	}
+	events := amendmentEvents(*title, versions, *dateField)
+	own, err := loadOwnership(ctx, c, map[int]bool{*title: true})
+	if err != nil {
+		return err
+	}
+	latest, err := latestDate(ctx, newAPI(c), *title)
+	if err != nil {
+		return err
+	}
+	chapters, err := partChapters(ctx, c, *title, latest)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	sf := &sectionFetcher{c: c, title: *title, cache: map[string][]string{}}
+	if *drift {
+		if sf.embedder, err = newEmbedder(ctx, *embedder, *embedModel); err != nil {
+			return err
+		}
+		if cl, ok := sf.embedder.(io.Closer); ok {
+			defer cl.Close()
+		}
+		sf.vectors = map[string][]float64{}
+	}
+	for i := range events {
+		e := &events[i]
+		e.owner = own.lookup(e.Title, e.Part)
+		e.ID = core.SectionID{Title: e.Title, Chapter: chapters[e.Part], Part: e.Part, Section: e.Section}.String()
+		if *magnitude || *drift {
+			if err := sf.enrich(ctx, e); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	if *saveFacts != "" {
+		return writeFacts(*saveFacts, eventFacts(events))
+	}
+	return nil
+}
+
+// amendmentEvents classifies versions chronologically per section along the
+// dateField axis. The title's earliest date is the start of eCFR history,
+// not an amendment, so versions on it only seed state.
+func amendmentEvents(title int, versions []ecfr.Version, dateField string) []AmendmentEvent {
+	sort.SliceStable(versions, func(i, j int) bool { return versions[i].DateOf(dateField) < versions[j].DateOf(dateField) })
+	if len(versions) == 0 {
+		return nil
+	}
+	baseline := versions[0].DateOf(dateField)
+	last := map[string]string{} // section -> snapshot of its previous version
+	var events []AmendmentEvent
+	for _, v := range versions {
+		prev, seen := last[v.Identifier]
+		typ := "modified"
+		switch {
+		case v.Removed:
+			typ = "removed"
+		case !seen:
+			typ = "added"
+		}
+		last[v.Identifier] = v.Date
+		date := v.DateOf(dateField)
+		if date == baseline {
+			continue
+		}
+		events = append(events, AmendmentEvent{
+			Date: date, AmendmentDate: v.AmendmentDate, IssueDate: v.IssueDate,
+			Title: title, Part: v.Part, Section: v.Identifier, Name: v.Name,
+			Type: typ, Substantive: v.Substantive, snapshot: v.Date, prevDate: prev,
+		})
+	}
+	return events
+}
+
+var frCitePattern = regexp.MustCompile(`\d+ FR \d+`)
+
+// sectionFetcher fetches section text per date, remembering the previous
+// version of each section so magnitude (and drift, with an embedder) is
+// measured against it.
+type sectionFetcher struct {
+	c     httpclient
+	title int
+	cache map[string][]string // section -> tokens at the last date fetched
+
+	embedder Embedder
+	vectors  map[string][]float64 // section -> embedding of cache[section]
+}
+
+func (sf *sectionFetcher) enrich(ctx context.Context, e *AmendmentEvent) error {
+	old, ok := sf.cache[e.Section]
+	if !ok && e.prevDate != "" {
+		var err error
+		if old, _, err = sf.section(ctx, e.prevDate, e.Section); err != nil {
+			return err
+		}
+	}
+	var toks []string
+	if e.Type != "removed" {
+		var err error
+		if toks, e.FRCite, err = sf.section(ctx, e.snapshot, e.Section); err != nil {
+			return err
+		}
+	}
+	n := 0
+	for _, ed := range core.DiffTokens(old, toks) {
+		if ed.Op != core.OpEqual {
+			n += len(ed.Tokens)
+		}
+	}
+	e.Magnitude = &n
+	if sf.embedder != nil && e.Type == "modified" && len(old) > 0 && len(toks) > 0 {
+		vecs, err := sf.embed(ctx, e.Section, old, toks)
+		if err != nil {
+			return err
+		}
+		d := cosineDistance(vecs[0], vecs[1])
+		e.Drift = &d
+		sf.vectors[e.Section] = vecs[1]
+	} else {
+		delete(sf.vectors, e.Section)
+	}
+	sf.cache[e.Section] = toks
+	return nil
+}
+
+// embed returns the embeddings of a section's old and new text, reusing
+// the old one's from the previous change when there was one.
+func (sf *sectionFetcher) embed(ctx context.Context, section string, old, cur []string) ([][]float64, error) {
+	texts := []string{strings.Join(cur, " ")}
+	prev, ok := sf.vectors[section]
+	if !ok {
+		texts = append(texts, strings.Join(old, " "))
+	}
+	vecs, err := sf.embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vecs) != len(texts) {
+		return nil, fmt.Errorf("embedder returned %d vectors for %d texts", len(vecs), len(texts))
+	}
+	if ok {
+		return [][]float64{prev, vecs[0]}, nil
+	}
+	return [][]float64{vecs[1], vecs[0]}, nil
+}
+
+// section returns the words of a section on date and the last FR citation
+// in its source note.
+func (sf *sectionFetcher) section(ctx context.Context, date, section string) ([]string, string, error) {
+	doc, err := newAPI(sf.c).Document(ctx, sf.title, date, ecfr.Hierarchy{Section: section})
+	if err != nil {
+		return nil, "", err
+	}
+	d := core.FindDiv(doc.Root(), section)
+	if d == nil {
+		d = doc.Root()
+	}
+	var cite string
+	for _, p := range d.Paras {
+		if p.Tag == "CITA" {
+			if cites := frCitePattern.FindAllString(p.Text, -1); len(cites) > 0 {
+				cite = cites[len(cites)-1]
+			}
+		}
+	}
+	return core.DivTokens(d), cite, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// runExport writes a title, part or section snapshot in an offline-reading
+// format, as plain text or Markdown for NLP and publishing pipelines (see
+// textWriter), or as protobuf Section messages (proto/efcr.proto) for bulk
+// consumers. The text and proto formats also carry the sections removed by
+// the date, as tombstones (see Tombstone).
+//
+//	efcr export epub --title 21 --date 2024-01-01
+//	efcr export proto --title 21 --date 2024-01-01
+//	efcr export markdown --title 40 --part 60 --date 2024-01-01
+//	efcr export text --title 40 --section 60.4 --date 2024-01-01 --out -
+func runExport(ctx context.Context, c httpclient, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: export epub|proto|text|markdown --title N [--part P] [--section S] --date YYYY-MM-DD [--out file]")
+	}
+	format := args[0]
+	ext, ok := map[string]string{"epub": "epub", "proto": "proto", "text": "txt", "markdown": "md"}[format]
+	if !ok {
+		return fmt.Errorf("unknown export format %q", format)
+	}
+	fs := flag.NewFlagSet("export "+format, flag.ExitOnError)
+	title := fs.Int("title", 0, "title number")
+	part := fs.String("part", "", "export just this part")
+	section := fs.String("section", "", "export just this section, e.g. 60.4")
+	date := fs.String("date", "", "snapshot date YYYY-MM-DD")
+	out := fs.String("out", "", "output file, or - for stdout (default title-N[-part-P|-section-S]-DATE.<ext>)")
+	fs.Parse(args[1:])
+	if *title == 0 || *date == "" {
+		return errors.New("--title and --date are required")
+	}
+	h := ecfr.Hierarchy{Part: *part, Section: *section}
+	scope := fmt.Sprintf("title-%d", *title)
+	switch {
+	case *section != "":
+		scope += "-section-" + *section
+	case *part != "":
+		scope += "-part-" + *part
+	}
+	if *out == "" {
+		*out = fmt.Sprintf("%s-%s.%s", scope, *date, ext)
+	}
+
+	api := newAPI(c)
+	// Removed sections go out as tombstones, so consumers can tell them
+	// from ones that never existed; a removed --section is only that.
+	var root *core.Div
+	var removed []Tombstone
+	var err error
+	if format == "epub" {
+		var doc *core.ECFRFile
+		if doc, err = api.Document(ctx, *title, *date, h); err == nil {
+			root = doc.Root()
+		}
+	} else {
+		root, removed, err = documentWithRemoved(ctx, c, *title, h, *date)
+	}
+	if err != nil {
+		return err
+	}
+	var f *os.File
+	if *out == "-" {
+		f = os.Stdout
+	} else {
+		if f, err = os.Create(*out); err != nil {
+			return err
+		}
+		defer f.Close()
+	}
+	name := fmt.Sprintf("%s as of %s", citation(*title, *part, *section), *date)
+	switch format {
+	case "epub":
+		err = writeEPUB(f, root, name, fmt.Sprintf("urn:ecfr:%s:%s", scope, *date))
+	case "proto":
+		w := bufio.NewWriter(f)
+		if err = writeSectionsProto(w, root, *title, *date, removed); err == nil {
+			err = w.Flush()
+		}
+	case "text", "markdown":
+		err = writeText(f, root, name, *date, api.FullURL(*title, *date, h), removed, format == "markdown")
+	}
+	if err != nil || f == os.Stdout {
+		return err
+	}
+	return f.Close()
+}
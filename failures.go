@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/paulgmiller/efcr/pipeline"
+)
+
+// Exit codes, so scripts can tell a clean run from one with gaps. Flag
+// errors exit 2, as the flag package does.
+const (
+	exitOK      = 0
+	exitFailure = 1 // nothing usable: a fatal error, or every title failed
+	exitPartial = 3 // the output is complete except for the titles that failed
+)
+
+// PartialFailure is returned by a crawl that reported what it could but
+// had titles fail. The report leaves them out; printErrorSummary lists
+// them.
+type PartialFailure struct {
+	Failed []pipeline.TitleResult
+	Total  int // titles crawled, failed included
+}
+
+func (e *PartialFailure) Error() string {
+	return fmt.Sprintf("%d of %d titles failed", len(e.Failed), e.Total)
+}
+
+// exitCode is the exit status for a failed run: exitPartial unless every
+// title failed.
+func (e *PartialFailure) exitCode() int {
+	if len(e.Failed) < e.Total {
+		return exitPartial
+	}
+	return exitFailure
+}
+
+// partialFailure returns the PartialFailure for results, or nil if every
+// title succeeded.
+func partialFailure(results []pipeline.TitleResult) *PartialFailure {
+	pf := &PartialFailure{Total: len(results)}
+	for _, r := range results {
+		if len(r.Errs) > 0 {
+			pf.Failed = append(pf.Failed, r)
+		}
+	}
+	if len(pf.Failed) == 0 {
+		return nil
+	}
+	return pf
+}
+
+// orPartial returns err, or pf when the run otherwise succeeded. A typed
+// nil pf comes back as a nil error.
+func orPartial(err error, pf *PartialFailure) error {
+	if err != nil || pf == nil {
+		return err
+	}
+	return pf
+}
+
+// printErrorSummary lists the failed titles and their errors, apart from
+// the report.
+func printErrorSummary(w io.Writer, pf *PartialFailure) {
+	if pf == nil {
+		return
+	}
+	fmt.Fprintf(w, "\nErrors: %s\n", pf.Error())
+	for _, r := range pf.Failed {
+		fmt.Fprintf(w, "  Title %d, %s:\n", r.Title.Number, r.Title.Name)
+		for _, err := range r.Errs {
+			fmt.Fprintf(w, "    %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// runGet prints one title, part or section as it stood on --date.
+//
+//	efcr get --title 6 --date 2024-01-01 --section 11.4 --format html
+func runGet(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	title := fs.Int("title", 0, "title number")
+	date := fs.String("date", "", "snapshot date YYYY-MM-DD")
+	part := fs.String("part", "", "part number")
+	section := fs.String("section", "", "section identifier, e.g. 11.4")
+	format := fs.String("format", "text", "output format: text|html|pdf")
+	notes := fs.Bool("notes", false, "with --format text, follow the text with its effective date and editorial notes")
+	fs.Parse(args)
+	if *title == 0 || *date == "" {
+		return errors.New("--title and --date are required")
+	}
+	h := ecfr.Hierarchy{Part: *part, Section: *section}
+
+	switch *format {
+	case "text":
+		r, err := newAPI(c).Text(ctx, *title, *date, h)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(os.Stdout, r); err != nil || !*notes {
+			return err
+		}
+		// a second fetch, but of a response the cache just stored
+		doc, err := newAPI(c).Document(ctx, *title, *date, h)
+		if err != nil {
+			return err
+		}
+		for _, n := range doc.Root().AllNotes() {
+			fmt.Printf("\n\n%s", n)
+		}
+		fmt.Println()
+		return nil
+	case "html":
+		body, err := fetchHTML(ctx, c, fmt.Sprintf(rendererURL, *date, *title)+h.Query())
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+		_, err = io.Copy(os.Stdout, body)
+		return err
+	case "pdf":
+		r, err := newAPI(c).Text(ctx, *title, *date, h)
+		if err != nil {
+			return err
+		}
+		header := citation(*title, *part, *section)
+		footer := fmt.Sprintf("eCFR text as of %s, retrieved %s", *date, time.Now().Format("2006-01-02"))
+		return writePDF(os.Stdout, header, footer, r)
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+}
+
+// citation formats the most specific CFR citation for the given hierarchy,
+// e.g. "6 CFR 11.4" or "6 CFR Part 11".
+func citation(title int, part, section string) string {
+	switch {
+	case section != "":
+		return fmt.Sprintf("%d CFR %s", title, section)
+	case part != "":
+		return fmt.Sprintf("%d CFR Part %s", title, part)
+	default:
+		return fmt.Sprintf("Title %d CFR", title)
+	}
+}
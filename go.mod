@@ -5,5 +5,6 @@ go 1.22.2
 require (
 	github.com/blevesearch/segment v0.9.1 // indirect
 	github.com/samber/lo v1.49.1 // indirect
+	golang.org/x/sync v0.10.0
 	golang.org/x/text v0.21.0 // indirect
 )
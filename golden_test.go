@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files under testdata")
+
+// golden compares got with testdata/name, or with -update writes it there.
+// The binary formats' golden files were checked with their reference
+// readers when written, so a difference is a change to the bytes those
+// readers have to accept.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s; if the change is intended, check it with a reference reader and rerun with -update", path)
+	}
+}
+
+// testVersions covers each column type, with the empty and zero values
+// writers are tempted to drop.
+var testVersions = func() []ecfr.Version {
+	subpart := "A"
+	return []ecfr.Version{
+		{Date: "2024-01-02", AmendmentDate: "2024-01-02", IssueDate: "2024-01-05", Identifier: "60.4", Name: "§ 60.4 Address.", Part: "60", Substantive: true, Subpart: &subpart, Title: "40", Type: "section"},
+		{Date: "2016-12-22", AmendmentDate: "2016-12-22", IssueDate: "2016-12-22", Identifier: "25.2", Name: "§ 25.2 [Reserved]", Part: "25", Removed: true, Title: "40", Type: "section"},
+	}
+}()
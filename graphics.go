@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+const (
+	graphicsSchema  = "efcr-graphics"
+	graphicsVersion = 1
+
+	// ecfrSite serves the figures the XML refers to.
+	ecfrSite = "https://www.ecfr.gov"
+)
+
+// GraphicRecord is one figure with the section that references it.
+type GraphicRecord struct {
+	Title    int    `json:"title"`
+	Part     string `json:"part"`
+	Section  string `json:"section"`
+	Snapshot string `json:"snapshot"`
+	core.Graphic
+	URL    string `json:"url"`
+	Status string `json:"status,omitempty"` // with --download: "cached" or the error
+}
+
+// graphicURL is where eCFR serves a figure: img srcs are paths on the site,
+// and GPH and MATH ids name GIFs under /graphics.
+func graphicURL(g core.Graphic) string {
+	switch {
+	case strings.HasPrefix(g.Src, "http://"), strings.HasPrefix(g.Src, "https://"):
+		return g.Src
+	case g.Src != "":
+		return ecfrSite + "/" + strings.TrimPrefix(g.Src, "/")
+	}
+	return ecfrSite + "/graphics/" + strings.ToLower(g.ID) + ".gif"
+}
+
+// runGraphics inventories the figures a title, part or section refers to,
+// so exports of sections with figures can be checked for completeness, and
+// with --download fetches them into the cache.
+//
+//	efcr graphics --title 40 --part 60 --date 2024-01-01 --download --out graphics.ndjson
+func runGraphics(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("graphics", flag.ExitOnError)
+	title := fs.Int("title", 0, "title number")
+	date := fs.String("date", "", "snapshot date YYYY-MM-DD")
+	part := fs.String("part", "", "restrict to one part")
+	section := fs.String("section", "", "restrict to one section, e.g. 60.5")
+	download := fs.Bool("download", false, "fetch every referenced figure into the cache")
+	out := fs.String("out", "", "write the dataset as NDJSON here instead of a table on stdout")
+	fs.Parse(args)
+	if *title == 0 || *date == "" {
+		return errors.New("--title and --date are required")
+	}
+
+	doc, err := newAPI(c).Document(ctx, *title, *date, ecfr.Hierarchy{Part: *part, Section: *section})
+	if err != nil {
+		return err
+	}
+	records := graphicRecords(doc.Root(), *title, *date)
+	if *download {
+		failed := 0
+		for i := range records {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			records[i].Status = "cached"
+			if err := fetchGraphic(ctx, c, records[i].URL); err != nil {
+				records[i].Status = err.Error()
+				failed++
+			}
+		}
+		slog.Info("downloaded figures", "downloaded", len(records)-failed, "figures", len(records))
+	}
+	if *out != "" {
+		return writeGraphics(*out, records)
+	}
+	fmt.Println("Citation\tKind\tID\tStatus\tURL")
+	for _, r := range records {
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\n", citation(r.Title, r.Part, r.Section), r.Kind, r.ID, r.Status, r.URL)
+	}
+	return nil
+}
+
+// graphicRecords lists the figures of every section and appendix. Figures
+// outside any section (in a part's front matter, say) are listed under the
+// part with an empty section.
+func graphicRecords(root *core.Div, title int, snapshot string) []GraphicRecord {
+	var out []GraphicRecord
+	add := func(gs []core.Graphic, part, section string) {
+		for _, g := range gs {
+			out = append(out, GraphicRecord{Title: title, Part: part, Section: section, Snapshot: snapshot, Graphic: g, URL: graphicURL(g)})
+		}
+	}
+	var walk func(d *core.Div, part string)
+	walk = func(d *core.Div, part string) {
+		if d.Type == "PART" {
+			part = d.N
+		}
+		if d.Type == "SECTION" || d.Type == "APPENDIX" {
+			add(d.AllGraphics(), part, d.N)
+			return
+		}
+		add(d.Graphics, part, "")
+		for i := range d.Children {
+			walk(&d.Children[i], part)
+		}
+	}
+	walk(root, "")
+	return out
+}
+
+// fetchGraphic GETs url through the client chain, which caches it.
+func fetchGraphic(ctx context.Context, c httpclient, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
+
+func writeGraphics(path string, records []GraphicRecord) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	if err := writeSchemaHeader(w, graphicsSchema, graphicsVersion); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	for i := range records {
+		if err := enc.Encode(&records[i]); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+)
+
+// icsEvent is one all-day calendar entry. RRule, when set, makes it repeat.
+type icsEvent struct {
+	UID         string
+	Start       time.Time
+	RRule       string
+	Summary     string
+	Description string
+	URL         string
+}
+
+// writeICS renders events as an iCalendar (RFC 5545) file that Outlook and
+// Google Calendar import directly.
+func writeICS(w io.Writer, name string, events []icsEvent) error {
+	bw := bufio.NewWriter(w)
+	line := func(s string) { bw.WriteString(icsFold(s)) }
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//efcr//compliance calendar//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:" + icsEscape(name))
+	for _, e := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + e.UID)
+		line("DTSTAMP:" + stamp)
+		line("DTSTART;VALUE=DATE:" + e.Start.Format("20060102"))
+		line("DTEND;VALUE=DATE:" + e.Start.AddDate(0, 0, 1).Format("20060102"))
+		if e.RRule != "" {
+			line("RRULE:" + e.RRule)
+		}
+		line("SUMMARY:" + icsEscape(e.Summary))
+		line("DESCRIPTION:" + icsEscape(e.Description))
+		if e.URL != "" {
+			line("URL:" + e.URL)
+		}
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return bw.Flush()
+}
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+func icsEscape(s string) string { return icsEscaper.Replace(s) }
+
+// icsFold terminates a content line with CRLF, folding it at 75 octets
+// without splitting a UTF-8 sequence.
+func icsFold(s string) string {
+	var b strings.Builder
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		limit = 74 // continuation lines start with a space
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+	return b.String()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestICS(t *testing.T) {
+	desc := "40 CFR 60.4\n" + strings.Repeat("§ Submit the report; see (a), (b) and “(c)”. ", 4)
+	events := []icsEvent{
+		{UID: "a@efcr", Start: time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), Summary: "40 CFR 60.4: by December 31, 2024", Description: desc, URL: "https://www.ecfr.gov/current/title-40/section-60.4"},
+		{UID: "b@efcr", Start: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), RRule: "FREQ=YEARLY;BYMONTH=3;BYMONTHDAY=1", Summary: "annually, by March 1", Description: "d"},
+	}
+	var b bytes.Buffer
+	if err := writeICS(&b, "Title 40, deadlines", events); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	if !strings.HasSuffix(out, "\r\n") || strings.Contains(strings.ReplaceAll(out, "\r\n", ""), "\n") {
+		t.Fatal("content lines are not all CRLF terminated")
+	}
+	for _, l := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if len(l) > 75 {
+			t.Errorf("line of %d octets: %q", len(l), l)
+		}
+		if !utf8.ValidString(l) {
+			t.Errorf("fold split a character: %q", l)
+		}
+	}
+
+	// Unfolded, the properties are the events'.
+	var depth int
+	var props []string
+	for _, l := range strings.Split(strings.ReplaceAll(strings.TrimSuffix(out, "\r\n"), "\r\n ", ""), "\r\n") {
+		switch {
+		case strings.HasPrefix(l, "BEGIN:"):
+			depth++
+		case strings.HasPrefix(l, "END:"):
+			depth--
+		}
+		props = append(props, l)
+	}
+	if depth != 0 {
+		t.Error("BEGIN and END do not balance")
+	}
+	for _, want := range []string{
+		`X-WR-CALNAME:Title 40\, deadlines`,
+		"DTSTART;VALUE=DATE:20241231",
+		"DTEND;VALUE=DATE:20250101",
+		"DESCRIPTION:" + strings.NewReplacer(";", `\;`, ",", `\,`, "\n", `\n`).Replace(desc),
+		"RRULE:FREQ=YEARLY;BYMONTH=3;BYMONTHDAY=1",
+	} {
+		found := false
+		for _, p := range props {
+			found = found || p == want
+		}
+		if !found {
+			t.Errorf("no property %q", want)
+		}
+	}
+}
+
+func TestNextOccurrence(t *testing.T) {
+	from := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+	for rule, want := range map[string]string{
+		"FREQ=YEARLY;BYMONTH=3;BYMONTHDAY=1":   "2025-03-01",
+		"FREQ=YEARLY;BYMONTH=3;BYMONTHDAY=2":   "2024-03-02",
+		"FREQ=YEARLY;BYMONTH=12;BYMONTHDAY=31": "2024-12-31",
+		"FREQ=MONTHLY":                         "2024-03-02",
+	} {
+		if got := nextOccurrence(rule, from).Format("2006-01-02"); got != want {
+			t.Errorf("nextOccurrence(%s) = %s, want %s", rule, got, want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// yearPattern matches the bare years many external datasets are keyed by.
+var yearPattern = regexp.MustCompile(`^\d{4}$`)
+
+// factColumns are the Fact fields an imported CSV can supply, besides the
+// measurements themselves.
+var factColumns = []string{"title", "chapter", "part", "section", "agency", "date"}
+
+// runImport adds an externally produced dataset, such as RegData's
+// restriction counts or OFR's page counts, to a facts file under a source
+// tag, so `efcr query` can set it beside efcr's own measurements:
+//
+//	efcr import --facts crawl.ndjson --source regdata --col date=year --col title=cfr_title --metric restrictions=restrictions regdata.csv
+//	efcr query --facts crawl.ndjson "select title, source, sum(value) per year"
+//
+// Columns are matched by header name; by default each Fact field reads the
+// column of the same name, and --col renames them. Wide files name a
+// column per metric with --metric; long ones have "metric" and "value"
+// columns. Bare years are dated December 31st. Importing a source again
+// replaces what it imported before.
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	factsPath := fs.String("facts", "", "facts file to add to, created if missing")
+	source := fs.String("source", "", "name to tag the imported facts with, e.g. regdata")
+	var cols, metrics stringsFlag
+	fs.Var(&cols, "col", "FIELD=COLUMN: read a fact field (title, chapter, part, section, agency, date) from COLUMN (repeatable)")
+	fs.Var(&metrics, "metric", "NAME=COLUMN: import COLUMN as metric NAME (repeatable; default the file's metric and value columns)")
+	fs.Parse(args)
+	if *factsPath == "" || *source == "" || fs.NArg() == 0 {
+		return errors.New("usage: import --facts file --source name [--col field=column] [--metric name=column] data.csv…")
+	}
+	if *source == ownSource {
+		return fmt.Errorf("--source %s is reserved for efcr's own facts", ownSource)
+	}
+	fieldCols := map[string]string{}
+	for _, f := range factColumns {
+		fieldCols[f] = f
+	}
+	for _, c := range cols {
+		field, col, ok := strings.Cut(c, "=")
+		if _, known := fieldCols[field]; !ok || !known {
+			return fmt.Errorf("bad --col %q: want FIELD=COLUMN with FIELD one of %s", c, strings.Join(factColumns, ", "))
+		}
+		fieldCols[field] = col
+	}
+	metricCols := map[string]string{}
+	var metricNames []string
+	for _, m := range metrics {
+		name, col, ok := strings.Cut(m, "=")
+		if !ok || name == "" || col == "" {
+			return fmt.Errorf("bad --metric %q: want NAME=COLUMN", m)
+		}
+		metricCols[name] = col
+		metricNames = append(metricNames, name)
+	}
+
+	var facts []Fact
+	if _, err := os.Stat(*factsPath); err == nil {
+		existing, err := readFacts(*factsPath)
+		if err != nil {
+			return err
+		}
+		replaced := 0
+		for _, f := range existing {
+			if f.Source == *source {
+				replaced++
+				continue
+			}
+			facts = append(facts, f)
+		}
+		if replaced > 0 {
+			slog.Info("replacing facts", "path", *factsPath, "facts", replaced, "source", *source)
+		}
+	}
+	for _, path := range fs.Args() {
+		imported, err := importCSV(path, *source, fieldCols, metricNames, metricCols)
+		if err != nil {
+			return err
+		}
+		slog.Info("read facts", "path", path, "facts", len(imported))
+		facts = append(facts, imported...)
+	}
+	return writeFacts(*factsPath, facts)
+}
+
+// importCSV reads one CSV file into facts. Rows with an empty measurement
+// are skipped for that metric only.
+func importCSV(path, source string, fieldCols map[string]string, metricNames []string, metricCols map[string]string) ([]Fact, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: header: %w", path, err)
+	}
+	index := map[string]int{}
+	for i, h := range header {
+		index[strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))] = i
+	}
+	colOf := func(name string, required bool) (int, error) {
+		i, ok := index[name]
+		if !ok && required {
+			return -1, fmt.Errorf("%s: no column %q (columns: %s)", path, name, strings.Join(header, ", "))
+		}
+		if !ok {
+			return -1, nil
+		}
+		return i, nil
+	}
+	fields := map[string]int{}
+	for field, col := range fieldCols {
+		if fields[field], err = colOf(col, field == "title" || field == "date"); err != nil {
+			return nil, err
+		}
+	}
+	long := len(metricNames) == 0
+	var metricIdx, valueIdx int
+	valueCols := make([]int, len(metricNames))
+	if long {
+		if metricIdx, err = colOf("metric", true); err != nil {
+			return nil, fmt.Errorf("%w; name value columns with --metric", err)
+		}
+		if valueIdx, err = colOf("value", true); err != nil {
+			return nil, err
+		}
+	}
+	for i, name := range metricNames {
+		if valueCols[i], err = colOf(metricCols[name], true); err != nil {
+			return nil, err
+		}
+	}
+
+	var facts []Fact
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		line, _ := r.FieldPos(0)
+		cell := func(i int) string {
+			if i < 0 || i >= len(rec) {
+				return ""
+			}
+			return strings.TrimSpace(rec[i])
+		}
+		title, err := strconv.Atoi(cell(fields["title"]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: title %q is not a number", path, line, cell(fields["title"]))
+		}
+		date := cell(fields["date"])
+		if yearPattern.MatchString(date) {
+			date += "-12-31"
+		}
+		if len(date) != len("2006-01-02") {
+			return nil, fmt.Errorf("%s:%d: date %q: want YYYY-MM-DD or a year", path, line, date)
+		}
+		base := Fact{Title: title, Chapter: cell(fields["chapter"]), Part: cell(fields["part"]), Section: cell(fields["section"]),
+			Agency: cell(fields["agency"]), Date: date, Source: source}
+		add := func(metric, raw string) error {
+			if raw == "" {
+				return nil
+			}
+			v, err := strconv.ParseFloat(strings.ReplaceAll(raw, ",", ""), 64)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %s %q is not a number", path, line, metric, raw)
+			}
+			fact := base
+			fact.Metric, fact.Value = metric, v
+			facts = append(facts, fact)
+			return nil
+		}
+		if long {
+			if err := add(cell(metricIdx), cell(valueIdx)); err != nil {
+				return nil, err
+			}
+		}
+		for i, name := range metricNames {
+			if err := add(name, cell(valueCols[i])); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return facts, nil
+}
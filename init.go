@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// initProbes is how many requests `efcr init` spaces at the configured
+// interval to check the API answers at that rate.
+const initProbes = 3
+
+// runInit writes the -config file for a first run: where the cache lives,
+// how big it may grow and how fast to ask the API, which it then tests, and
+// optionally a bundle (see `efcr cache export`) to seed the cache so the
+// first crawl doesn't start from nothing. On a terminal it asks for each setting not given as
+// a flag; --yes takes the defaults instead.
+//
+//	efcr init
+//	efcr init --yes --cache-dir /var/cache/efcr --seed https://example.org/ecfr.tar.gz
+//	efcr -config /etc/efcr.json init --request-interval 8s --test=false
+func runInit(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	dir := fs.String("cache-dir", cacheDir, "directory for cached responses and crawl state")
+	maxSize := fs.String("cache-max-size", cfg.CacheMaxSize, "largest the cache may grow, e.g. 20GB, before least recently used entries are evicted (empty for no limit)")
+	interval := fs.Duration("request-interval", cfg.requestInterval(), "time between API requests to start from; the rate adapts from there")
+	seed := fs.String("seed", "", "bundle (path or URL) to seed the cache from, e.g. one published with `efcr cache export`")
+	seedManifest := fs.String("seed-manifest", "", "published manifest the --seed bundle must match, as for `efcr cache import --manifest`")
+	test := fs.Bool("test", true, "test that the API answers at --request-interval")
+	yes := fs.Bool("yes", false, "take the defaults for settings not given as flags instead of asking")
+	force := fs.Bool("force", false, "overwrite an existing config file")
+	fs.Parse(args)
+	if *readOnly {
+		return errors.New("init writes a config, seeds the cache and tests the API; it can't run with -read-only")
+	}
+	if *configPath == "" {
+		return errors.New("-config is empty; init has nowhere to write")
+	}
+	if _, err := os.Stat(*configPath); err == nil && !*force {
+		return fmt.Errorf("%s already exists; pass --force to overwrite it", *configPath)
+	}
+
+	if !*yes && isTerminal(os.Stdin) {
+		given := map[string]bool{}
+		fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+		in := bufio.NewReader(os.Stdin)
+		var err error
+		if !given["cache-dir"] {
+			*dir = ask(in, "Cache directory", *dir)
+		}
+		for !given["cache-max-size"] {
+			*maxSize = ask(in, "Largest the cache may grow, e.g. 20GB (empty for no limit)", *maxSize)
+			if _, err = parseBytes(*maxSize); err == nil {
+				break
+			}
+			fmt.Printf("  %v\n", err)
+		}
+		for !given["request-interval"] {
+			s := ask(in, "Time between API requests", interval.String())
+			if *interval, err = time.ParseDuration(s); err == nil && *interval > 0 {
+				break
+			}
+			fmt.Printf("  %q is not a positive duration, e.g. 4s\n", s)
+		}
+		if !given["seed"] {
+			*seed = ask(in, "Bundle to seed the cache from (path or URL, empty for none)", "")
+		}
+		if !given["test"] {
+			*test = strings.HasPrefix(strings.ToLower(ask(in, "Test the API now", "y")), "y")
+		}
+	}
+	if *interval <= 0 {
+		return fmt.Errorf("bad --request-interval %v: want a positive duration", *interval)
+	}
+	if _, err := parseBytes(*maxSize); err != nil {
+		return fmt.Errorf("bad --cache-max-size: %w", err)
+	}
+
+	// Keep the API version, parts and TTL rules of the file being replaced.
+	file := Config{Parts: cfg.Parts, CacheTTL: cfg.CacheTTL, CacheDir: *dir, CacheMaxSize: *maxSize, APIVersion: cfg.APIVersion}
+	if *interval != defaultRequestInterval {
+		file.RequestInterval = interval.String()
+	}
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*configPath, append(b, '\n'), 0o644); err != nil {
+		return err
+	}
+	limit := "no size limit"
+	if *maxSize != "" {
+		limit = "at most " + *maxSize
+	}
+	fmt.Printf("wrote %s (cache in %s, %s; a request every %v)\n", *configPath, *dir, limit, *interval)
+
+	if *seed != "" {
+		if err := seedCache(ctx, *dir, *seed, *seedManifest); err != nil {
+			return fmt.Errorf("seed cache: %w", err)
+		}
+	}
+	if *test {
+		if err := probeAPI(ctx, os.Stdout, *interval); err != nil {
+			return fmt.Errorf("API test failed, but %s is written; check the network or raise --request-interval and run init --force again: %w", *configPath, err)
+		}
+	}
+	return nil
+}
+
+// ask prompts for a setting on stdout and reads the answer, def if blank.
+func ask(in *bufio.Reader, prompt, def string) string {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", prompt, def)
+	} else {
+		fmt.Printf("%s: ", prompt)
+	}
+	line, _ := in.ReadString('\n')
+	if line = strings.TrimSpace(line); line != "" {
+		return line
+	}
+	return def
+}
+
+// seedCache imports a bundle into dir as `efcr cache import` does.
+func seedCache(ctx context.Context, dir, src, manifest string) error {
+	var trusted *BundleManifest
+	if manifest != "" {
+		var err error
+		if trusted, err = loadManifest(ctx, manifest); err != nil {
+			return err
+		}
+	}
+	r, err := openBundleSource(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	imported, skipped, err := importBundle(r, dir, trusted)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("seeded %s with %d responses (%d already cached)\n", dir, imported, skipped)
+	return nil
+}
+
+// probeAPI asks for the title list initProbes times through a rate limit
+// starting at interval, bypassing the cache and retries, and reports each
+// answer, so a first run learns of a blocked network or a 429 up front.
+func probeAPI(ctx context.Context, w io.Writer, interval time.Duration) error {
+	rl := NewRateLimitedClient(&http.Client{Timeout: requestLimit}, interval)
+	api := newAPI(rl)
+	fmt.Fprintf(w, "testing %s with %d requests, one every %v\n", api.TitlesURL(), initProbes, interval)
+	for i := range initProbes {
+		start, waited := time.Now(), rl.Waited()
+		titles, err := api.Titles(ctx)
+		var status *ecfr.StatusError
+		if errors.As(err, &status) && status.Code == http.StatusTooManyRequests {
+			return fmt.Errorf("request %d was refused as too many (429): %w", i+1, err)
+		}
+		if err != nil {
+			return err
+		}
+		took := time.Since(start) - (rl.Waited() - waited)
+		fmt.Fprintf(w, "  request %d: %d titles in %v\n", i+1, len(titles), took.Round(time.Millisecond))
+	}
+	fmt.Fprintln(w, "the API is reachable at this rate")
+	return nil
+}
@@ -0,0 +1,35 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// lockFile takes an exclusive lock on path by creating it, holding the
+// process ID. Without flock a crash leaves the file behind, and it has to
+// be removed by hand.
+func lockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		pid, _ := os.ReadFile(path)
+		return nil, fmt.Errorf("%s is held by another efcr (pid %s); remove it if that process is gone", path, strings.TrimSpace(string(pid)))
+	}
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+	return f, nil
+}
+
+// unlockFile releases a lockFile lock.
+func unlockFile(f *os.File) error {
+	err := f.Close()
+	if rerr := os.Remove(f.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
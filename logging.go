@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// setupLogging makes a slog logger on stderr, above any progress bar, the
+// default, at level (debug, info, warn or error) in format (text or json).
+// Debug adds a line per request (see requestRecord.log). It also takes over
+// the log package, at info level, for anything still writing there.
+func setupLogging(level, format string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("unknown -log-level %q (debug|info|warn|error)", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	var h slog.Handler
+	switch format {
+	case "text":
+		h = slog.NewTextHandler(stderr, opts)
+	case "json":
+		h = slog.NewJSONHandler(stderr, opts)
+	default:
+		return fmt.Errorf("unknown -log-format %q (text|json)", format)
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// fatal logs msg at error level and exits. Only main calls it; everything
+// else returns its errors.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// titleAttr and dateAttr are the attributes every line about a title or
+// snapshot carries, so logs filter on them.
+func titleAttr(title int) slog.Attr  { return slog.Int("title", title) }
+func dateAttr(date string) slog.Attr { return slog.String("date", date) }
+
+var (
+	urlTitle = regexp.MustCompile(`/title-(\d+)`)
+	urlDate  = regexp.MustCompile(`/(\d{4}-\d{2}-\d{2})/`)
+)
+
+// urlAttrs picks the title and snapshot date out of an eCFR API URL, for
+// the attributes of a request's log line.
+func urlAttrs(url string) []any {
+	var attrs []any
+	if m := urlTitle.FindStringSubmatch(url); m != nil {
+		if n, err := strconv.Atoi(m[1]); err == nil {
+			attrs = append(attrs, titleAttr(n))
+		}
+	}
+	if m := urlDate.FindStringSubmatch(url); m != nil {
+		attrs = append(attrs, dateAttr(m[1]))
+	}
+	return attrs
+}
+
+// round2 rounds v to two decimal places, for rates in log lines.
+func round2(v float64) float64 { return math.Round(v*100) / 100 }
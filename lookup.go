@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// runTitles lists every title with the date its text is current to.
+//
+//	efcr titles
+func runTitles(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("titles", flag.ExitOnError)
+	fs.Parse(args)
+	titles, err := newAPI(c).Titles(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Title\tName\tUpToDateAsOf\tReserved")
+	for _, t := range titles {
+		fmt.Printf("%d\t%s\t%s\t%t\n", t.Number, t.Name, t.UpToDateAsOf, t.Reserved)
+	}
+	return nil
+}
+
+// runVersions lists the content versions of a title, part or section, as
+// a table, as delimited protobuf Version messages (proto/efcr.proto) or as
+// an Arrow IPC stream.
+//
+//	efcr versions --title 6 --part 11 --substantive
+//	efcr versions --title 6 --format proto > versions.pb
+//	efcr versions --title 6 --format arrow > versions.arrows
+func runVersions(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("versions", flag.ExitOnError)
+	title := fs.Int("title", 0, "title number")
+	part := fs.String("part", "", "part number")
+	section := fs.String("section", "", "section identifier, e.g. 11.4")
+	substantive := fs.Bool("substantive", false, "only list substantive versions")
+	format := fs.String("format", "table", "output format: table|proto|arrow")
+	fs.Parse(args)
+	if *title == 0 {
+		return errors.New("--title is required")
+	}
+	if *format != "table" && *format != "proto" && *format != "arrow" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	versions, err := newAPI(c).Versions(ctx, *title, ecfr.Hierarchy{Part: *part, Section: *section})
+	if err != nil {
+		return err
+	}
+	if *substantive {
+		kept := versions[:0]
+		for _, v := range versions {
+			if v.Substantive {
+				kept = append(kept, v)
+			}
+		}
+		versions = kept
+	}
+	switch *format {
+	case "proto":
+		w := bufio.NewWriter(os.Stdout)
+		for _, v := range versions {
+			if err := writeDelimited(w, versionProto(v)); err != nil {
+				return err
+			}
+		}
+		return w.Flush()
+	case "arrow":
+		w := bufio.NewWriter(os.Stdout)
+		if err := writeVersionsArrow(w, versions); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+	fmt.Println("Date\tIssueDate\tIdentifier\tSubstantive\tRemoved\tName")
+	for _, v := range versions {
+		fmt.Printf("%s\t%s\t%s\t%t\t%t\t%s\n", v.Date, v.IssueDate, v.Identifier, v.Substantive, v.Removed, v.Name)
+	}
+	return nil
+}
+
+// runWordcount counts the words in a title, part or section. With --depth
+// it breaks the count down the hierarchy, and --compare adds each level's
+// change since an earlier snapshot, to see which parts are growing.
+// --estimate counts a random fraction of a title's parts instead and
+// extrapolates (see estimateParts), for a quick answer on a big title.
+//
+//	efcr wordcount --title 40 --part 60
+//	efcr wordcount --title 40 --depth part --compare 2020-01-01
+//	efcr wordcount --title 26 --estimate 0.1
+func runWordcount(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("wordcount", flag.ExitOnError)
+	title := fs.Int("title", 0, "title number")
+	date := fs.String("date", "", "snapshot date YYYY-MM-DD (default: the title's latest)")
+	part := fs.String("part", "", "part number")
+	section := fs.String("section", "", "section identifier, e.g. 11.4")
+	depth := fs.String("depth", "", "break the count down to title, chapter, part or section")
+	compare := fs.String("compare", "", "with --depth, also show the change since this date")
+	asJSON := fs.Bool("json", false, "with --depth, print the count tree as JSON")
+	estimate := fs.Float64("estimate", 0, "count this fraction of the title's parts, chosen at random, and extrapolate the total")
+	seed := fs.Int64("seed", 1, "random seed for --estimate's sample")
+	fs.Parse(args)
+	if *title == 0 {
+		return errors.New("--title is required")
+	}
+	if *estimate < 0 || *estimate > 1 {
+		return fmt.Errorf("bad --estimate %g: want a fraction between 0 and 1", *estimate)
+	}
+	if *estimate > 0 && (*part != "" || *section != "" || *depth != "") {
+		return errors.New("--estimate samples a whole title's parts; it can't be combined with --part, --section or --depth")
+	}
+	api := newAPI(c)
+	if *date == "" {
+		var err error
+		if *date, err = latestDate(ctx, api, *title); err != nil {
+			return err
+		}
+	}
+	if *estimate > 0 {
+		e, err := estimateParts(ctx, api, *title, *date, *estimate, *seed)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\t%s\t%s\n", citation(*title, "", ""), *date, e.format("parts"))
+		return nil
+	}
+	h := ecfr.Hierarchy{Part: *part, Section: *section}
+	if *depth != "" {
+		return printWordTree(ctx, api, *title, *date, *compare, h, *depth, *asJSON)
+	}
+	text, err := api.Text(ctx, *title, *date, h)
+	if err != nil {
+		return err
+	}
+	n, err := core.CountWords(text)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\t%s\t%d\n", citation(*title, *part, *section), *date, n)
+	return nil
+}
+
+// wordLevels are the levels --depth can stop at, outermost first; other
+// Divs (subchapters, subparts, subject groups) are rolled into the level
+// above. Appendices count as sections.
+var wordLevels = []string{core.TypeTitle, core.TypeChapter, core.TypePart, core.TypeSection}
+
+func wordLevel(typ string) int {
+	if typ == core.TypeAppendix {
+		typ = core.TypeSection
+	}
+	for i, l := range wordLevels {
+		if l == typ {
+			return i
+		}
+	}
+	return -1
+}
+
+func wordLabel(w core.DivWords) string {
+	switch w.Type {
+	case core.TypeSection:
+		return "§ " + w.N
+	case core.TypeAppendix:
+		if w.N != "" {
+			return w.N
+		}
+		return w.Head
+	}
+	return strings.ToUpper(w.Type[:1]) + strings.ToLower(w.Type[1:]) + " " + w.N
+}
+
+// printWordTree prints per-level word counts down to depth, indented, with
+// the change since compare when it is set.
+func printWordTree(ctx context.Context, api *ecfr.Client, title int, date, compare string, h ecfr.Hierarchy, depth string, asJSON bool) error {
+	limit := wordLevel(strings.ToUpper(depth))
+	if limit < 0 {
+		return fmt.Errorf("unknown --depth %q (title|chapter|part|section)", depth)
+	}
+	doc, err := api.Document(ctx, title, date, h)
+	if err != nil {
+		return err
+	}
+	tree := core.CountDivWords(doc.Root())
+	if asJSON {
+		return json.NewEncoder(os.Stdout).Encode(tree)
+	}
+
+	// earlier counts by path of Type/N keys, so renumbered or new Divs
+	// simply have no baseline
+	var before map[string]int64
+	if compare != "" {
+		old, err := api.Document(ctx, title, compare, h)
+		if err != nil {
+			return fmt.Errorf("--compare: %w", err)
+		}
+		before = map[string]int64{}
+		var index func(w core.DivWords, path string)
+		index = func(w core.DivWords, path string) {
+			path += "/" + w.Type + " " + w.N
+			before[path] = w.Words
+			for _, c := range w.Children {
+				index(c, path)
+			}
+		}
+		index(core.CountDivWords(old.Root()), "")
+		fmt.Printf("Level\t%s\t%s\tChange\n", date, compare)
+	} else {
+		fmt.Printf("Level\t%s\n", date)
+	}
+
+	var walk func(w core.DivWords, path string, indent int)
+	walk = func(w core.DivWords, path string, indent int) {
+		path += "/" + w.Type + " " + w.N
+		level := wordLevel(w.Type)
+		if level >= 0 {
+			label := strings.Repeat("  ", indent) + wordLabel(w)
+			if before == nil {
+				fmt.Printf("%s\t%d\n", label, w.Words)
+			} else if n, ok := before[path]; ok {
+				fmt.Printf("%s\t%d\t%d\t%+d\n", label, w.Words, n, w.Words-n)
+			} else {
+				fmt.Printf("%s\t%d\t-\tnew\n", label, w.Words)
+			}
+			if level >= limit {
+				return
+			}
+			indent++
+		}
+		for _, c := range w.Children {
+			walk(c, path, indent)
+		}
+	}
+	walk(tree, "", 0)
+	return nil
+}
+
+// runStructure prints a title's hierarchy as an indented outline.
+//
+//	efcr structure --title 37 --depth 3
+func runStructure(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("structure", flag.ExitOnError)
+	title := fs.Int("title", 0, "title number")
+	date := fs.String("date", "", "snapshot date YYYY-MM-DD (default: the title's latest)")
+	depth := fs.Int("depth", 0, "levels to print below the title; 0 prints everything")
+	fs.Parse(args)
+	if *title == 0 {
+		return errors.New("--title is required")
+	}
+	api := newAPI(c)
+	if *date == "" {
+		var err error
+		if *date, err = latestDate(ctx, api, *title); err != nil {
+			return err
+		}
+	}
+	root, err := api.Structure(ctx, *title, *date)
+	if err != nil {
+		return err
+	}
+	var walk func(n *ecfr.StructureNode, level int)
+	walk = func(n *ecfr.StructureNode, level int) {
+		fmt.Printf("%s%s\n", strings.Repeat("  ", level), n.Label)
+		if *depth > 0 && level >= *depth {
+			return
+		}
+		for i := range n.Children {
+			walk(&n.Children[i], level+1)
+		}
+	}
+	walk(root, 0)
+	return nil
+}
+
+// latestDate returns the date a title's text is current to.
+func latestDate(ctx context.Context, api *ecfr.Client, title int) (string, error) {
+	titles, err := api.Titles(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, t := range titles {
+		if t.Number == title {
+			return t.UpToDateAsOf, nil
+		}
+	}
+	return "", fmt.Errorf("unknown title %d", title)
+}
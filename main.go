@@ -1,257 +1,634 @@
-// Command ecfr_title_versions counts versions (“works”) for every eCFR title.
+// Command efcr crawls the eCFR versioner API and reports on the Code of
+// Federal Regulations over time: versions and words per title, section
+// diffs, citations, deadlines and more.
 //
-// Build & run:
+// Install and run:
 //
-//	go mod init example.com/ecfr_title_versions
-//	go mod tidy
-//	go run .
+//	go install github.com/paulgmiller/efcr@latest
+//	efcr init
+//	efcr [global flags] <subcommand> [flags]
+//
+// Global flags (-config, -cache-store, -read-only, -log-level, ...) go
+// before the subcommand; `efcr -h` lists them and `efcr <subcommand> -h`
+// the subcommand's own. With no subcommand efcr runs crawl. The
+// subcommands are:
+//
+//	init                   write the config file, test the API, seed the cache
+//	crawl                  count versions and words for every title
+//	titles, versions       list titles, or a title's versions
+//	wordcount, structure   words, or the hierarchy, of a title on a date
+//	get, export, redline   fetch text as HTML, PDF, EPUB, Markdown or DOCX
+//	diff, events, watch    section changes between dates, as they land
+//	serve                  timelines and reports over HTTP
+//	stats, agencies, admins, complexity, vocab-diff, transfers, corrections,
+//	divergence, citations, tables, deadlines, graphics, cite, search,
+//	searchcheck, archive, calendar
+//	                       reports and datasets; see each one's -h
+//	query, import, compact work with saved fact files and crawl databases
+//	cache                  ls, purge, compress, export and import the cache
+//	schema                 print the JSON Schemas of machine-readable output
+//	bench, version
+//
+// Responses are cached in the directory named by the config's cache_dir
+// (default ./cache), so reruns only fetch what changed.
 package main
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
-	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+	"github.com/paulgmiller/efcr/pipeline"
 )
 
 const (
-	baseURL      = "https://www.ecfr.gov/api/versioner/v1"
-	titlesURL    = baseURL + "/titles.json"
-	versionsURL  = baseURL + "/versions/title-%d.json" // %s = title number
-	structureURL = baseURL + "/structure/%s/title-%d.json"
-	fullURL      = baseURL + "/full/%s/title-%d.xml"
-	maxWorkers   = 6 // tweak for desired parallelism
-	requestLimit = 10 * time.Second
+	maxWorkers = 6 // tweak for desired parallelism
+	// checkpointFile, in cacheDir, is where crawl --resume journals
+	// finished snapshots.
+	checkpointFile = "crawl.checkpoint"
+	requestLimit   = 10 * time.Second
 )
 
-type Title struct {
-	Number int    `json:"number"`
-	Name   string `json:"name"`
-}
+// cacheDir holds cached responses and crawl state; the config's cache_dir
+// moves it.
+var cacheDir = "cache"
 
-//https://www.ecfr.gov/api/versioner/v1/api/versioner/v1/structure/2025-03-31/title-37.json
-//https://www.ecfr.gov/api/versioner/v1/structure/2025-03-31/title-37.json
-
-// titlesResponse matches /titles.json
-type titlesResponse struct {
-	Titles []Title `json:"titles"`
-}
-
-/*
-	{
-	     "date": "2017-01-19",
-	     "amendment_date": "2017-01-19",
-	     "issue_date": "2017-01-19",
-	     "identifier": "3474.20",
-	     "name": "§ 3474.20   xxx",
-	     "part": "3474",
-	     "substantive": true,
-	     "removed": false,
-	     "subpart": null,
-	     "title": "2",
-	     "type": "section"
-	   },
-*/
-type titleversion struct {
-	Date          string  `json:"date"`
-	AmendmentDate string  `json:"amendment_date"`
-	IssueDate     string  `json:"issue_date"`
-	Identifier    string  `json:"identifier"`
-	Name          string  `json:"name"`
-	Part          string  `json:"part"`
-	Substantive   bool    `json:"substantive"`
-	Removed       bool    `json:"removed"`
-	Subpart       *string `json:"subpart"` // Pointer to handle null values
-	Title         string  `json:"title"`
-	Type          string  `json:"type"`
-}
-
-// versionsResponse matches /versions/title-{n}.json
-type versionsResponse struct {
-	Versions []titleversion `json:"content_versions"` // we only need the count
+func validDateField(field string) error {
+	if field != "amendment" && field != "issue" {
+		return fmt.Errorf("unknown date field %q (amendment|issue)", field)
+	}
+	return nil
 }
 
-//var testdata string = `{"content_versions":[{"date":"2016-12-22","amendment_date":"2016-12-22","issue_date":"2016-12-22","identifier":"11.4","name":"§ 11.4   Collection by administrative offset.","part":"11","substantive":true,"removed":false,"subpart":"A","title":"6","type":"section"},{"date":"2016-12-22","amendment_date":"2016-12-22","issue_date":"2016-12-22","identifier":"115.5","name":"§ 115.5   General definitions.","part":"115","substantive":true,"removed":false,"subpart":null,"title":"6","type":"section"},{"date":"2016-12-22","amendment_date":"2016-12-22","issue_date":"2016-12-22","identifier":"115.6","name":"§ 115.6   Definitions related to sexual abuse and assault.","part":"115","substantive":true,"removed":false,"subpart":null,"title":"6","type":"section"},{"date":"2016-12-22","amendment_date":"2016-12-22","issue_date":"2016-12-22","identifier":"21.4","name":"§ 21.4   Definitions.","part":"21","substantive":true,"removed":false,"subpart":null,"title":"6","type":"section"},{"date":"2016-12-22","amendment_date":"2016-12-22","issue_date":"2016-12-22","identifier":"Appendix A to Part 21","name":"Appendix A to Part 21 - Activities to Which This Part Applies","part":"21","substantive":true,"removed":false,"subpart":null,"title":"6","type":"appendix"},{"date":"2016-12-22","amendment_date":"2016-12-22","issue_date":"2016-12-22","identifier":"Appendix B to Part 21","name":"Appendix B to Part 21 - Activities to Which This Part Applies When a Primary Objective of the Federal Financial Assistance Is To Provide Employment","part":"21","substantive":true,"removed":false,"subpart":null,"title":"6","type":"appendix"},{"date":"2016-12-22","amendment_date":"2016-12-22","issue_date":"2022-03-15","identifier":"25.2","name":"§ 25.2   Definitions.","part":"25","substantive":false,"removed":false,"subpart":null,"title":"6","type":"section"},{"date":"2016-12-22","amendment_date":"2016-12-22","issue_date":"2016-12-22","identifier":"25.2","name":"§ 25.2   Definitions.","part":"25","substantive":true,"removed":false,"subpart":null,"title":"6","type":"section"},{"date":"2016-12-22","amendment_date":"2016-12-22","issue_date":"2016-12-22","identifier":"25.6","name":"§ 25.6   Procedures for designation of qualified anti-terrorism technologies.","part":"25","substantive":true,"removed":false,"subpart":null,"title":"6","type":"section"},{"date":"2016-12-22","amendment_date":"2016-12-22","issue_date":"2016-12-22","identifier":"Appendix A to Part 27","name":"Appendix A to Part 27 - DHS Chemicals of Interest","part":"27","substantive":true,"removed":false,"subpart":null,"title":"6","type":"appendix"},{"date":"2016-12-22","amendment_date":"2016-12-22","issue_date":"2016-12-22","identifier":"29.4","name":"§ 29.4   Protected Critical Infrastructure Information Program administration.","part":"29","substantive":true,"removed":false,"subpart":null,"title":"6","type":"section"},{"date":"2016-12-22","amendment_date":"2016-12-22","issue_date":"2016-12-22","identifier":"3.3","name":"§ 3.3   Applicability.","part":"3","substantive":true,"removed":false,"subpart":null,"title":"6","type":"section"}]}`
-
+// httpclient is implemented by every layer of the fetch chain. Each layer
+// must honour req.Context(): once it is done, Do returns ctx.Err() promptly
+// instead of waiting on a rate limit, free disk or the layer below. It has
+// ecfr.Doer's method set, so any layer can back an ecfr.Client.
 type httpclient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
-type RateLimitedClient struct {
-	Client      httpclient
-	RateLimiter *time.Ticker
-}
+var (
+	manifestPath = flag.String("manifest", "", "write a reproducibility manifest of every fetch to this file, if the command made any (default manifest.json in the cache directory; none to disable)")
+	cacheMaxSize = flag.String("cache-max-size", "", "evict cache entries beyond this size, e.g. 20GB: JSON before full XML, least recently used first (default the config's cache_max_size, else unlimited)")
+	minFreeDisk  = flag.String("min-free-disk", "1GB", "pause fetching while the cache filesystem has less free space than this")
+	configPath   = flag.String("config", "efcr.json", "settings file with per-part rules (optional)")
+	slowRequest  = flag.Duration("slow-request", 30*time.Second, "warn about requests slower than this (0 to disable)")
+	retryBudget  = flag.Float64("retry-budget", 0.05, "abort the run once retries exceed this fraction of requests (beyond the first 10)")
+	refresh      = flag.Bool("refresh", false, "treat cached responses as stale, revalidating or refetching each one")
+	readOnly     = flag.Bool("read-only", false, "answer only from the cache, however stale: never fetch upstream or write the cache or manifest (e.g. for a public serve next to a separate crawler)")
+	retries      = flag.Int("retry-attempts", 4, "tries per request, the first included, for 429s, 5xx and network errors")
+	retryWait    = flag.Duration("retry-deadline", 5*time.Minute, "give up retrying a request once this much time has gone into it (0 for no limit)")
+	cacheStore   = flag.String("cache-store", "", "keep cached responses in a local SQLite index, sqlite-index:PATH (bodies in PATH.bodies, one process at a time), or shared in s3://BUCKET/PREFIX (credentials from AWS_* variables) instead of the cache directory")
+	logLevel     = flag.String("log-level", "info", "least severe log lines to write: debug (adds one per request), info, warn or error")
+	logFormat    = flag.String("log-format", "text", "log line format on stderr: text (key=value) or json")
+	eventsPath   = flag.String("progress-events", "", "write NDJSON progress events (schema: progress) to this file, or fd:N for an inherited file descriptor")
+)
 
-func NewRateLimitedClient(client httpclient, rate time.Duration) *RateLimitedClient {
-	return &RateLimitedClient{
-		Client:      client,
-		RateLimiter: time.NewTicker(rate),
-	}
-}
+// limited is the rate limit in front of the API, for the worker tuner.
+var limited *RateLimitedClient
 
-func (rlc *RateLimitedClient) Do(req *http.Request) (*http.Response, error) {
-	<-rlc.RateLimiter.C
-	return rlc.Client.Do(req)
-}
+// responseCache is the cache layer, for commands that need fresher
+// responses than its TTLs give.
+var responseCache *CachingClient
+
+// cfg holds the settings loaded from -config.
+var cfg = defaultConfig()
+
+// fetchMetrics collects per-endpoint latency and request counters for the
+// end-of-run summary and the /metrics endpoints of serve and watch.
+var fetchMetrics *Metrics
 
 func main() {
+	flag.Parse()
+	if err := setupLogging(*logLevel, *logFormat); err != nil {
+		fatal(err.Error())
+	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// Ctrl-C cancels in-flight work; every client layer gives up on ctx.
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// So does running out of retry budget, which is reported as the cause.
+	ctx, abort := context.WithCancelCause(sigCtx)
+	defer abort(nil)
 
+	var err error
+	if cfg, err = loadConfig(*configPath); err != nil {
+		fatal("bad -config", "err", err)
+	}
+	if cfg.CacheDir != "" {
+		cacheDir = cfg.CacheDir
+	}
+	manifest := NewManifest(os.Args[1:])
+	fetchMetrics = NewMetrics(*slowRequest)
+	api := NewMetricsClient(fetchMetrics, "api", &http.Client{})
+	budget := &RetryBudget{Ratio: *retryBudget, Min: 10, Abort: abort}
+	limited = NewRateLimitedClient(api, cfg.requestInterval())
+	retry := NewRetryClient(budget, limited)
+	retry.Attempts, retry.Deadline = *retries, *retryWait
+	cache := NewCachingClient(cacheDir, retry)
+	responseCache = cache
+	maxSize := *cacheMaxSize
+	if maxSize == "" && *cacheStore == "" {
+		maxSize = cfg.CacheMaxSize
+	}
+	if cache.MaxBytes, err = parseBytes(maxSize); err != nil {
+		fatal("bad -cache-max-size", "err", err)
+	}
+	minFree, err := parseBytes(*minFreeDisk)
+	if err != nil {
+		fatal("bad -min-free-disk", "err", err)
+	}
+	cache.MinFreeBytes = uint64(minFree)
+	if cache.Store, err = openCacheStore(*cacheStore, cacheDir); err != nil {
+		fatal("bad -cache-store", "err", err)
+	}
+	if *cacheStore != "" && cache.MaxBytes > 0 {
+		fatal("-cache-max-size evicts from the cache directory; it can't be combined with -cache-store")
+	}
+	cache.TTLs = cfg.cacheTTLs()
+	cache.Refresh = *refresh
+	cache.ReadOnly = *readOnly
+	if *readOnly && *refresh {
+		fatal("-read-only and -refresh contradict each other")
+	}
 	// reusable HTTP client with timeout
-	client := NewCachingClient("cache", NewRateLimitedClient(&http.Client{}, 4*time.Second))
+	client := NewManifestClient(manifest, NewMetricsClient(fetchMetrics, "cache", cache))
 
-	// 1. Fetch all titles
-	var tResp titlesResponse
-	if err := fetchJSON(ctx, client, titlesURL, &tResp); err != nil {
-		log.Fatalf("fetch titles: %v", err)
+	args := flag.Args()
+	cmd := "crawl"
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
 	}
-
-	// 2. Concurrently fetch versions per title
-	type result struct {
-		title string
-		count int32
-		err   []error
+	if *eventsPath != "" {
+		if progressEvents, err = openEventStream(*eventsPath, cmd); err != nil {
+			fatal("bad -progress-events", "err", err)
+		}
 	}
-	results := make(chan result)
-
-	for _, t := range tResp.Titles {
-		go func(title Title) {
-			url := fmt.Sprintf(versionsURL, title.Number)
-			var vResp versionsResponse
-			dates := map[string]bool{}
-			if err := fetchJSON(ctx, client, url, &vResp); err != nil {
-				results <- result{title: title.Name, count: 0, err: []error{err}}
-			}
-			for _, v := range vResp.Versions {
-				if v.Substantive && !v.Removed {
-					dates[v.Date] = true
-				}
-			}
-			log.Printf("Title %d, %s has %d dates\n", title.Number, title.Name, len(dates))
-			dateresults := make(chan result)
-			for d := range dates {
-				go func(d string) {
-					furl := fmt.Sprintf(fullURL, d, title.Number)
-					os.ReadFile(cacheKey(furl))
-
-					reader, err := fetchXML(ctx, client, furl)
-					if err != nil {
-						log.Printf("fetch %s: %v", furl, err)
-						dateresults <- result{title: title.Name, count: 0, err: []error{err}}
-						return
-					}
-
-					var count int32
-					scanner := bufio.NewScanner(reader)
-					scanner.Split(bufio.ScanWords) //segment.SplitWords)
-					for scanner.Scan() {
-						count++
-					}
-					if err := scanner.Err(); err != nil {
-						log.Fatalf("scanner fail , %d %s %v", count, cacheKey(furl), err)
-						dateresults <- result{title: title.Name, count: 0, err: []error{err}}
-					}
-
-					//fmt.Printf("Fetched date %d, %s,  wordcount %d %s %s\n", title.Number, d, count, cacheKey(url), url)
-					dateresults <- result{count: count, err: nil}
-				}(d)
-			}
-
-			titleresult := result{title: title.Name}
-			for range len(dates) {
-				r := <-dateresults
-				if r.err != nil {
-					titleresult.err = append(titleresult.err, r.err...)
-					continue
-				}
-				titleresult.count += r.count
-			}
-
-			results <- titleresult
-
-		}(t)
+	progressEvents.start()
+	switch cmd {
+	case "crawl":
+		err = runCrawl(ctx, client, args)
+	case "titles":
+		err = runTitles(ctx, client, args)
+	case "versions":
+		err = runVersions(ctx, client, args)
+	case "wordcount":
+		err = runWordcount(ctx, client, args)
+	case "structure":
+		err = runStructure(ctx, client, args)
+	case "cite":
+		err = runCite(ctx, client, args)
+	case "get":
+		err = runGet(ctx, client, args)
+	case "export":
+		err = runExport(ctx, client, args)
+	case "redline":
+		err = runRedline(ctx, client, args)
+	case "diff":
+		err = runDiff(ctx, client, args)
+	case "events":
+		err = runEvents(ctx, client, args)
+	case "serve":
+		err = runServe(ctx, client, args)
+	case "watch":
+		err = runWatch(ctx, client, args)
+	case "archive":
+		err = runArchive(ctx, client, args)
+	case "agencies":
+		err = runAgencies(ctx, client, args)
+	case "admins":
+		err = runAdmins(ctx, client, args)
+	case "transfers":
+		err = runTransfers(ctx, client, args)
+	case "corrections":
+		err = runCorrections(ctx, client, args)
+	case "divergence":
+		err = runDivergence(ctx, client, args)
+	case "search":
+		err = runSearch(ctx, client, args)
+	case "searchcheck":
+		err = runSearchCheck(ctx, client, args)
+	case "citations":
+		err = runCitations(ctx, client, args)
+	case "tables":
+		err = runTables(ctx, client, args)
+	case "deadlines":
+		err = runDeadlines(ctx, client, args)
+	case "graphics":
+		err = runGraphics(ctx, client, args)
+	case "init":
+		err = runInit(ctx, args)
+	case "calendar":
+		err = runCalendar(args)
+	case "stats":
+		err = runStats(ctx, client, args)
+	case "complexity":
+		err = runComplexity(ctx, client, args)
+	case "vocab-diff":
+		err = runVocabDiff(ctx, client, args)
+	case "query":
+		err = runQuery(args)
+	case "import":
+		err = runImport(args)
+	case "cache":
+		err = runCache(ctx, args)
+	case "compact":
+		err = runCompact(args)
+	case "schema":
+		err = runSchema(args)
+	case "bench":
+		err = runBench(ctx, client, args)
+	case "version":
+		printVersion()
+		progressEvents.finish(nil)
+		return
+	default:
+		err = fmt.Errorf("unknown command %q", cmd)
+		progressEvents.finish(err)
+		fatal("unknown command", "command", cmd)
 	}
 
-	// 3. Print report
-	fmt.Println("Title\tVersionCount")
-	for range len(tResp.Titles) {
-		r := <-results
-		if r.err != nil {
-			fmt.Printf("%s\tERROR: %v\n", r.title, r.err)
-			continue
+	fetchMetrics.Log()
+	limited.Log()
+	if path := runManifestPath(); path != "" && !*readOnly && manifest.fetched() {
+		if werr := manifest.WriteFile(path); werr != nil {
+			slog.Warn("write manifest", "path", path, "err", werr)
+		}
+	}
+	if c, ok := cache.Store.(io.Closer); ok {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
 		}
-		fmt.Printf("%s\t%d\n", r.title, r.count)
+	}
+	if cause := context.Cause(ctx); errors.Is(cause, errRetryBudget) {
+		err = cause
+	}
+	if errors.Is(err, ecfr.ErrVersionRetired) {
+		err = fmt.Errorf("%w; set api_version in %s to a current one", err, *configPath)
+	}
+	progressEvents.finish(err)
+	var partial *PartialFailure
+	switch {
+	case errors.As(err, &partial):
+		slog.Error(cmd+" finished with failures", "err", err)
+		os.Exit(partial.exitCode())
+	case err != nil:
+		fatal(cmd+" failed", "err", err)
 	}
 }
 
-// fetchJSON GETs url and decodes JSON into out.
-func fetchJSON(ctx context.Context, c httpclient, url string, out interface{}) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
+// runCrawl counts words across every snapshot of every title.
+func runCrawl(ctx context.Context, client httpclient, args []string) error {
+	fs := flag.NewFlagSet("crawl", flag.ExitOnError)
+	var pluginCmds, measureNames stringsFlag
+	fs.Var(&pluginCmds, "plugin", "external analyzer command speaking the JSON plugin protocol (repeatable)")
+	fs.Var(&measureNames, "measure", "built-in per-section measure to report per title: depth, conditionals (repeatable)")
+	normalize := fs.String("normalize", "", "report --plugin metrics and --measure columns per-1000 words, as a pct of the metric's total, or as a zscore against the mean over titles; --group-by rows as a pct or zscore (default raw totals)")
+	precision := fs.Int("precision", -1, "decimal places for --plugin metrics, --measure columns and --group-by rows (default as many as needed for plugins, 2 for measures, 0 for raw group words)")
+	groupBy := fs.String("group-by", "title", "aggregate rows by title, part or agency")
+	saveFacts := fs.String("save-facts", "", "also write per-part word facts as NDJSON for `efcr query`")
+	factsFormat := fs.String("facts-format", "ndjson", "--save-facts format: ndjson, proto (delimited Measurement messages), arrow (IPC stream) or delta (Delta Lake table directory)")
+	workers := fs.Int("workers", maxWorkers, "snapshots to fetch and analyze concurrently")
+	adaptive := fs.Bool("adaptive", false, "tune fetch and parse worker counts while running, starting from --workers")
+	ordered := fs.Bool("ordered", false, "report titles in title order instead of completion order")
+	checkpoint := fs.String("checkpoint", "", "journal finished snapshots here and skip them when re-run")
+	defaultCheckpoint := filepath.Join(cacheDir, checkpointFile)
+	resume := fs.Bool("resume", false, "like --checkpoint "+defaultCheckpoint+", unless --checkpoint names another file")
+	sanity := fs.Bool("sanity", true, "compare parsed section counts with the structure endpoint")
+	sanityThreshold := fs.Float64("sanity-threshold", 0.02, "flag snapshots whose section counts differ by more than this fraction")
+	titles := fs.String("titles", "", "comma separated title numbers to crawl (default all)")
+	partList := fs.String("parts", "", "comma separated parts to crawl in each title (default whole titles)")
+	since := fs.String("since", "", "skip snapshots before this date YYYY-MM-DD")
+	until := fs.String("until", "", "skip snapshots after this date YYYY-MM-DD")
+	output := fs.String("output", "table", "per-title report format: table, json or csv")
+	dbPath := fs.String("db", "", "also store titles, versions, per-date word counts and run metadata in this SQLite database, adding to earlier runs")
+	retain := fs.String("retain", "", "prune --db runs and delete --facts-format delta versions past this policy, DAYSd[,MONTHSm]: one a day for DAYS, then one a month (see `efcr compact`)")
+	failFast := fs.Bool("fail-fast", false, "stop at the first title that fails instead of reporting the rest")
+	estimate := fs.Float64("estimate", 0, "crawl this fraction of each title's snapshots, chosen at random, and extrapolate its words with a 95% interval")
+	seed := fs.Int64("seed", 1, "random seed for --estimate's sample")
+	progress := fs.String("progress", progressAuto, "show progress: bar (a status line on stderr), log (a line every 30s), off, or auto for bar on a terminal and log otherwise")
+	spillThreshold := fs.String("spill-threshold", "256MB", "analyze documents bigger than this a part at a time from a temp file (0 to always parse whole)")
+	fs.Parse(args)
+	if err := validGroupBy(*groupBy); err != nil {
 		return err
 	}
-	req.Header.Set("Accept", "application/json")
-	resp, err := c.Do(req)
-	if err != nil {
+	if err := validUnit(*normalize); err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP %d %s", resp.StatusCode, url)
+	if *readOnly && (*checkpoint != "" || *resume || *dbPath != "") {
+		return errors.New("--checkpoint, --resume and --db write crawl state; they can't be combined with -read-only")
+	}
+	if *normalize != "" && len(pluginCmds) == 0 && len(measureNames) == 0 && *groupBy == "title" {
+		return errors.New("--normalize applies to --plugin metrics, --measure columns and --group-by rows; there are none")
+	}
+	if *normalize == unitPer1000 && *groupBy != "title" {
+		return errors.New("--group-by rows count words, so per-1000 would make every one 1000; use --normalize pct or zscore")
+	}
+	if *estimate < 0 || *estimate > 1 {
+		return fmt.Errorf("bad --estimate %g: want a fraction between 0 and 1", *estimate)
+	}
+	if *estimate > 0 && (*output != "table" || *groupBy != "title") {
+		return errors.New("--estimate reports titles as a table; it can't be combined with --output or --group-by")
+	}
+	switch *progress {
+	case progressAuto, progressBar, progressLog, progressOff:
+	default:
+		return fmt.Errorf("unknown --progress %q (auto|bar|log|off)", *progress)
+	}
+	switch *factsFormat {
+	case "ndjson", "proto", "arrow", "delta":
+	default:
+		return fmt.Errorf("unknown --facts-format %q (ndjson|proto|arrow|delta)", *factsFormat)
+	}
+	switch *output {
+	case "table":
+	case "json", "csv":
+		if *groupBy != "title" {
+			return fmt.Errorf("--output %s reports titles; it can't be combined with --group-by %s", *output, *groupBy)
+		}
+	default:
+		return fmt.Errorf("unknown --output %q (table|json|csv)", *output)
+	}
+	for _, d := range []string{*since, *until} {
+		if _, err := time.Parse("2006-01-02", d); d != "" && err != nil {
+			return fmt.Errorf("bad date %q: want YYYY-MM-DD", d)
+		}
 	}
-	return json.NewDecoder(resp.Body).Decode(out)
-}
 
-// fetchJSON GETs url and decodes JSON into out.
-func fetchXML(ctx context.Context, c httpclient, url string) (io.Reader, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	crawler := pipeline.New(newAPI(client))
+	crawler.Logger = slog.Default()
+	if !*readOnly {
+		crawler.Results = NewResultCache(filepath.Join(cacheDir, "results"))
+	}
+	crawler.Ordered = *ordered
+	crawler.Workers = *workers
+	if *adaptive {
+		crawler.Tuner = NewWorkerTuner(limited.Waited)
+	}
+	crawler.TableParts = cfg.tableParts()
+	crawler.Since, crawler.Until = *since, *until
+	crawler.FailFast = *failFast
+	crawler.Sample, crawler.Seed = *estimate, *seed
+	crawler.Metrics = fetchMetrics
+	var err error
+	if crawler.SpillBytes, err = parseBytes(*spillThreshold); err != nil {
+		return err
+	}
+	if crawler.Titles, err = parseTitles(*titles); err != nil {
+		return err
+	}
+	for _, p := range strings.Split(*partList, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			crawler.Parts = append(crawler.Parts, p)
+		}
+	}
+	if *resume && *checkpoint == "" {
+		*checkpoint = defaultCheckpoint
+	}
+	if *checkpoint != "" {
+		cp, err := OpenCheckpoint(ctx, *checkpoint, responseCache.Store)
+		if err != nil {
+			return err
+		}
+		defer cp.Close()
+		crawler.Checkpoint = cp
+	}
+	policy, err := parseRetention(*retain)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	var db *corpusDB
+	if *dbPath != "" {
+		if db, err = openCorpusDB(*dbPath, append([]string{"crawl"}, args...)); err != nil {
+			return err
+		}
+		db.Retain = policy
+		crawler.OnVersions = db.addVersions
+	}
+	var plugins []*Plugin
+	for _, cmd := range pluginCmds {
+		p, err := StartPlugin(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		defer p.Close()
+		plugins = append(plugins, p)
+	}
+	var metrics pluginMetrics
+	if len(plugins) > 0 {
+		crawler.AddAnalyzer(metrics.analyzer(plugins, pluginCmds))
 	}
-	req.Header.Set("Accept", "application/xml")
-	resp, err := c.Do(req)
+	parts := partFacts{tables: cfg}
+	if *groupBy != "title" || *saveFacts != "" {
+		crawler.AddAnalyzer(parts.analyzer())
+	}
+	var measures *sectionMeasures
+	if len(measureNames) > 0 {
+		if measures, err = newSectionMeasures(measureNames); err != nil {
+			return err
+		}
+		crawler.AddAnalyzer(measures.analyzer())
+	}
+	var sections sectionSanity
+	if *sanity {
+		crawler.AddAnalyzer(sections.analyzer(ctx, client))
+	}
+
+	prog := &Progress{}
+	crawler.Progress = prog
+	stopProgress := showProgress(ctx, prog, fetchMetrics, *progress)
+	progressEvents.enter("crawl")
+	stopEvents := progressEvents.track(ctx, prog)
+	results, err := crawler.Run(ctx)
+	stopEvents()
+	stopProgress()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	// Failed titles are left out of the report and listed after it, on
+	// stderr, and turn a run that otherwise succeeded into a PartialFailure.
+	failed := partialFailure(results)
+	defer printErrorSummary(os.Stderr, failed)
+	if db != nil {
+		progressEvents.enter("store")
+		db.addResults(results, crawler.Parts, crawler.TableParts)
+		if err := db.addSectionIDs(ctx, client, results); err != nil {
+			return err
+		}
+		if err := db.save(); err != nil {
+			return err
+		}
+	}
+	if *saveFacts != "" {
+		progressEvents.enter("facts")
+		write := writeFacts
+		switch *factsFormat {
+		case "proto":
+			write = writeFactsProto
+		case "arrow":
+			write = writeFactsArrow
+		case "delta":
+			write = writeFactsDelta
+		}
+		if err := write(*saveFacts, parts.facts); err != nil {
+			return err
+		}
+		if *factsFormat == "delta" && policy.Days > 0 {
+			if err := applyRetention(policy, "", *saveFacts, time.Now()); err != nil {
+				return err
+			}
+		}
+	}
+	progressEvents.enter("report")
+	// Side tables go to stderr when stdout is machine-readable.
+	side := io.Writer(os.Stdout)
+	if *output != "table" {
+		side = os.Stderr
+	}
+	if *sanity {
+		defer sections.printMismatches(side, *sanityThreshold)
 	}
-	if resp.StatusCode != http.StatusOK {
-		if resp.StatusCode == http.StatusTooManyRequests {
-			retryAfter := resp.Header.Get("Retry-After")
-			log.Printf("HTTP 429 Too Many Requests. Retry-After: %s", retryAfter)
+	if measures != nil {
+		defer measures.print(side, results, *normalize, *precision)
+	}
+	if *groupBy != "title" {
+		return orPartial(printGroups(ctx, client, *groupBy, results, &parts, *normalize, *precision), failed)
+	}
+	if *output != "table" {
+		var ss *sectionSanity
+		if *sanity {
+			ss = &sections
+		}
+		var pm *pluginMetrics
+		if len(plugins) > 0 {
+			pm = &metrics
+			pm.byTitle = normalizeMetrics(results, titleWords(results), pm.byTitle, pm.names, *normalize)
+			roundMetrics(pm.byTitle, *precision)
+		}
+		reports := titleReports(results, ss, pm)
+		if *output == "csv" {
+			return orPartial(writeReportCSV(os.Stdout, reports), failed)
+		}
+		return orPartial(writeReportJSON(os.Stdout, reports), failed)
+	}
+
+	if *estimate > 0 {
+		printEstimates(os.Stdout, results)
+		return orPartial(nil, failed)
+	}
+
+	var names []string
+	for n := range metrics.names {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	byTitle := normalizeMetrics(results, titleWords(results), metrics.byTitle, metrics.names, *normalize)
+	header := []string{"Title", "Versions", "Words"}
+	if *sanity {
+		header = append(header, "Sections", "StructureSections")
+	}
+	fmt.Println(strings.Join(append(header, names...), "\t"))
+	for _, r := range results {
+		if r.Errs != nil {
+			continue
 		}
-		return nil, fmt.Errorf("HTTP %d %s", resp.StatusCode, url)
+		fmt.Printf("%s\t%d\t%d", r.Title.Name, len(r.Dates), r.Words)
+		if *sanity {
+			xml, structure := sections.totals(r.Title.Number)
+			fmt.Printf("\t%d\t%d", xml, structure)
+		}
+		for _, n := range names {
+			fmt.Printf("\t%s", formatMetric(byTitle[r.Title.Number][n], *precision))
+		}
+		fmt.Println()
 	}
-	return plainText(resp.Body), nil
+	return orPartial(nil, failed)
 }
 
-func plainText(r io.ReadCloser) io.Reader {
-	dec := xml.NewDecoder(r)
-	returnedReader, w := io.Pipe()
+// partFacts records per-part word counts of every snapshot as facts,
+// skipping parts the config treats as tables.
+type partFacts struct {
+	tables *Config
 
-	go func() {
-		defer r.Close()
-		for {
-			tok, err := dec.Token()
-			if err == io.EOF {
-				w.Close()
-				return
-			}
-			if err != nil {
-				w.CloseWithError(err)
-				return
+	mu    sync.Mutex
+	facts []Fact
+}
+
+func (pf *partFacts) analyzer() pipeline.Analyzer {
+	return pipeline.Analyzer{
+		Name: "part-words",
+		Compute: func(meta pipeline.DocMeta, doc *core.ECFRFile) (any, error) {
+			return core.PartWords(doc.Root()), nil
+		},
+		Apply: func(meta pipeline.DocMeta, result json.RawMessage) error {
+			var counts map[string]int64
+			if err := json.Unmarshal(result, &counts); err != nil {
+				return err
 			}
-			if ch, ok := tok.(xml.CharData); ok {
-				w.Write(ch)          // strips CR/LF/indent
-				w.Write([]byte{' '}) // word boundary
+			pf.mu.Lock()
+			defer pf.mu.Unlock()
+			for p, n := range counts {
+				if pf.tables.isTable(meta.Title, p) {
+					continue
+				}
+				pf.facts = append(pf.facts, Fact{Title: meta.Title, Part: p, Date: meta.Date, Metric: "words", Value: float64(n)})
 			}
+			return nil
+		},
+	}
+}
+
+// printGroups rolls per-part counts up to --group-by rows, in unit (see
+// normalizeRows) to precision decimal places: by default whole words, or
+// two for a unit.
+func printGroups(ctx context.Context, c httpclient, by string, results []pipeline.TitleResult, pf *partFacts, unit string, precision int) error {
+	if by == "agency" {
+		titles := map[int]bool{}
+		for _, r := range results {
+			titles[r.Title.Number] = true
+		}
+		own, err := loadOwnership(ctx, c, titles)
+		if err != nil {
+			return err
+		}
+		setAgencies(pf.facts, own)
+	}
+	rows, err := Rollup{GroupBy: []string{by}}.Run(pf.facts)
+	if err != nil {
+		return err
+	}
+	normalizeRows(rows, unit)
+	if precision < 0 {
+		precision = 0
+		if unit != "" {
+			precision = 2
 		}
-	}()
-	return returnedReader
+	}
+	fmt.Println("Group\tWords")
+	for _, r := range rows {
+		fmt.Printf("%s\t%s\n", r.Key[0], formatMetric(r.Value, precision))
+	}
+	return nil
 }
+
+// stringsFlag collects every occurrence of a repeatable flag.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string     { return strings.Join(*s, ",") }
+func (s *stringsFlag) Set(v string) error { *s = append(*s, v); return nil }
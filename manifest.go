@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// version is stamped at build time with -ldflags "-X main.version=…"; when
+// unset we fall back to the module/VCS info embedded by the go tool.
+var version = ""
+
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	v := info.Main.Version
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			v += "+" + s.Value
+		}
+	}
+	return v
+}
+
+// Manifest records everything needed to reproduce a run: every URL fetched
+// with the hash of what came back, the snapshot dates involved, the tool
+// version and the settings the run was invoked with.
+type Manifest struct {
+	mu sync.Mutex
+
+	SchemaVersion int                 `json:"schema_version"`
+	ToolVersion   string              `json:"tool_version"`
+	Args          []string            `json:"args"`
+	Settings      map[string]string   `json:"settings"`
+	Started       time.Time           `json:"started"`
+	Finished      time.Time           `json:"finished"`
+	Snapshots     map[string][]string `json:"snapshots"` // title number -> dates
+	Fetches       []FetchRecord       `json:"fetches"`
+}
+
+// FetchRecord is one response as seen by the caller (cache hits included).
+type FetchRecord struct {
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+func NewManifest(args []string) *Manifest {
+	return &Manifest{
+		SchemaVersion: manifestVersion,
+		ToolVersion:   toolVersion(),
+		Args:          args,
+		Settings:      map[string]string{},
+		Started:       time.Now().UTC(),
+		Snapshots:     map[string][]string{},
+	}
+}
+
+var snapshotPattern = regexp.MustCompile(`/(\d{4}-\d{2}-\d{2})/title-(\d+)\b`)
+
+func (m *Manifest) record(r FetchRecord) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Fetches = append(m.Fetches, r)
+	if sm := snapshotPattern.FindStringSubmatch(r.URL); sm != nil {
+		date, title := sm[1], sm[2]
+		for _, d := range m.Snapshots[title] {
+			if d == date {
+				return
+			}
+		}
+		m.Snapshots[title] = append(m.Snapshots[title], date)
+	}
+}
+
+// fetched reports whether anything was requested during the run, so that
+// commands working only on local files leave no manifest behind.
+func (m *Manifest) fetched() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.Fetches) > 0
+}
+
+// runManifestPath is where -manifest says to write the run's manifest, ""
+// for nowhere.
+func runManifestPath() string {
+	switch *manifestPath {
+	case "":
+		return filepath.Join(cacheDir, "manifest.json")
+	case "none":
+		return ""
+	}
+	return *manifestPath
+}
+
+// WriteFile stamps the finish time and the final flag values and writes the
+// manifest as indented JSON.
+func (m *Manifest) WriteFile(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Finished = time.Now().UTC()
+	flag.VisitAll(func(f *flag.Flag) { m.Settings[f.Name] = f.Value.String() })
+	for _, dates := range m.Snapshots {
+		sort.Strings(dates)
+	}
+	sort.Slice(m.Fetches, func(i, j int) bool { return m.Fetches[i].URL < m.Fetches[j].URL })
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// ManifestClient records every request that passes through it in a Manifest.
+// The body hash is taken as the caller reads, so nothing is buffered.
+type ManifestClient struct {
+	Manifest *Manifest
+	Client   httpclient
+}
+
+func NewManifestClient(m *Manifest, client httpclient) *ManifestClient {
+	return &ManifestClient{Manifest: m, Client: client}
+}
+
+func (mc *ManifestClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := mc.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	rec := FetchRecord{URL: req.URL.String(), Status: resp.StatusCode}
+	if resp.StatusCode != http.StatusOK {
+		mc.Manifest.record(rec)
+		return resp, nil
+	}
+	resp.Body = &hashingBody{ReadCloser: resp.Body, h: sha256.New(), done: func(n int64, sum []byte) {
+		rec.Bytes, rec.SHA256 = n, hex.EncodeToString(sum)
+		mc.Manifest.record(rec)
+	}}
+	return resp, nil
+}
+
+type hashingBody struct {
+	io.ReadCloser
+	h    hash.Hash
+	n    int64
+	done func(n int64, sum []byte)
+	once sync.Once
+}
+
+func (b *hashingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.h.Write(p[:n])
+	b.n += int64(n)
+	return n, err
+}
+
+func (b *hashingBody) Close() error {
+	b.once.Do(func() { b.done(b.n, b.h.Sum(nil)) })
+	return b.ReadCloser.Close()
+}
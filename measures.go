@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/pipeline"
+)
+
+// sectionMeasure is a built-in per-section analysis: it returns named values
+// for one section, and stats says how each title summarises them.
+type sectionMeasure struct {
+	fn    func(s *core.Div) map[string]float64
+	stats []string // any of sum, mean, p50, p90, max
+}
+
+// builtinMeasures is the registry behind crawl --measure.
+var builtinMeasures = map[string]sectionMeasure{
+	"depth": {
+		fn: func(s *core.Div) map[string]float64 {
+			deepest, mean := core.SectionDepth(s)
+			return map[string]float64{"max_depth": float64(deepest), "avg_depth": mean}
+		},
+		stats: []string{"mean", "p90", "max"},
+	},
+	"conditionals": {
+		fn: func(s *core.Div) map[string]float64 {
+			conditions, exceptions := core.Conditionals(core.ParaText(s))
+			return map[string]float64{"conditions": float64(conditions), "exceptions": float64(exceptions)}
+		},
+		stats: []string{"sum", "mean", "p90", "max"},
+	},
+}
+
+func knownMeasures() string {
+	var names []string
+	for n := range builtinMeasures {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// sectionMeasures collects per-section values for the latest measured date
+// of each title (every crawled part of it, with --parts) and reports their
+// distribution.
+type sectionMeasures struct {
+	names []string
+
+	mu      sync.Mutex
+	latest  map[int]string
+	byTitle map[int]map[string][]float64
+}
+
+func newSectionMeasures(names []string) (*sectionMeasures, error) {
+	for _, n := range names {
+		if _, ok := builtinMeasures[n]; !ok {
+			return nil, fmt.Errorf("unknown measure %q (have %s)", n, knownMeasures())
+		}
+	}
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	return &sectionMeasures{names: sorted, latest: map[int]string{}, byTitle: map[int]map[string][]float64{}}, nil
+}
+
+func (sm *sectionMeasures) analyzer() pipeline.Analyzer {
+	return pipeline.Analyzer{
+		Name:     "measures",
+		Settings: strings.Join(sm.names, ","),
+		Compute: func(meta pipeline.DocMeta, doc *core.ECFRFile) (any, error) {
+			values := map[string][]float64{}
+			core.WalkSections(doc.Root(), func(s *core.Div) {
+				for _, n := range sm.names {
+					for k, v := range builtinMeasures[n].fn(s) {
+						values[k] = append(values[k], v)
+					}
+				}
+			})
+			return values, nil
+		},
+		Apply: func(meta pipeline.DocMeta, result json.RawMessage) error {
+			var values map[string][]float64
+			if err := json.Unmarshal(result, &values); err != nil {
+				return err
+			}
+			sm.mu.Lock()
+			defer sm.mu.Unlock()
+			switch latest := sm.latest[meta.Title]; {
+			case meta.Date > latest:
+				sm.latest[meta.Title] = meta.Date
+				sm.byTitle[meta.Title] = values
+			case meta.Date == latest:
+				for k, v := range values {
+					sm.byTitle[meta.Title][k] = append(sm.byTitle[meta.Title][k], v...)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// columns lists metric.stat headers in a stable order.
+func (sm *sectionMeasures) columns() [][2]string {
+	var cols [][2]string
+	for _, n := range sm.names {
+		m := builtinMeasures[n]
+		var metrics []string
+		for k := range m.fn(&core.Div{}) {
+			metrics = append(metrics, k)
+		}
+		sort.Strings(metrics)
+		for _, k := range metrics {
+			for _, s := range m.stats {
+				cols = append(cols, [2]string{k, s})
+			}
+		}
+	}
+	return cols
+}
+
+// table summarises each measured title's values by metric.stat column, in
+// unit (see normalizeMetrics). Per-1000 is against the words of the date
+// measured.
+func (sm *sectionMeasures) table(results []pipeline.TitleResult, unit string) map[int]map[string]float64 {
+	names := map[string]bool{}
+	for _, c := range sm.columns() {
+		names[c[0]+"."+c[1]] = true
+	}
+	byTitle := map[int]map[string]float64{}
+	words := map[int]int64{}
+	for _, r := range results {
+		values, ok := sm.byTitle[r.Title.Number]
+		if !ok {
+			continue
+		}
+		byTitle[r.Title.Number] = map[string]float64{}
+		for name := range names {
+			metric, s, _ := strings.Cut(name, ".")
+			byTitle[r.Title.Number][name] = stat(values[metric], s)
+		}
+		words[r.Title.Number] = r.Dates[sm.latest[r.Title.Number]]
+	}
+	return normalizeMetrics(results, words, byTitle, names, unit)
+}
+
+// print writes one row per title: the date measured, the section count and
+// every metric.stat column, in unit to precision decimal places (two if
+// negative).
+func (sm *sectionMeasures) print(w io.Writer, results []pipeline.TitleResult, unit string, precision int) {
+	if precision < 0 {
+		precision = 2
+	}
+	cols := sm.columns()
+	header := []string{"Title", "Date", "Sections"}
+	for _, c := range cols {
+		header = append(header, c[0]+"."+c[1])
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	table := sm.table(results, unit)
+	for _, r := range results {
+		values, ok := sm.byTitle[r.Title.Number]
+		if !ok {
+			continue
+		}
+		sections := 0
+		for _, v := range values {
+			sections = len(v)
+			break
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d", r.Title.Name, sm.latest[r.Title.Number], sections)
+		for _, c := range cols {
+			fmt.Fprintf(w, "\t%s", formatMetric(table[r.Title.Number][c[0]+"."+c[1]], precision))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// stat summarises values; percentiles use nearest rank.
+func stat(values []float64, name string) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	rank := func(p int) float64 { return nearestRank(sorted, p) }
+	switch name {
+	case "sum", "mean":
+		sum := 0.0
+		for _, v := range sorted {
+			sum += v
+		}
+		if name == "mean" {
+			return sum / float64(len(sorted))
+		}
+		return sum
+	case "p50":
+		return rank(50)
+	case "p90":
+		return rank(90)
+	case "max":
+		return sorted[len(sorted)-1]
+	}
+	return math.NaN()
+}
+
+// nearestRank is the pth percentile of sorted, which must not be empty.
+func nearestRank(sorted []float64, p int) float64 {
+	return sorted[max(1, (len(sorted)*p+99)/100)-1]
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheHitHeader marks responses CachingClient served from disk, so metrics
+// can tell disk time apart from API time.
+const cacheHitHeader = "X-Efcr-Cache"
+
+// endpointClass buckets a request URL by the API it hits.
+func endpointClass(u string) string {
+	switch {
+	case strings.HasSuffix(u, "/titles.json"):
+		return "titles"
+	case strings.Contains(u, "/versions/"):
+		return "versions"
+	case strings.Contains(u, "/structure/"):
+		return "structure"
+	case strings.Contains(u, "/full/"):
+		return "full"
+	case strings.Contains(u, "/renderer/"):
+		return "renderer"
+	case strings.Contains(u, "/agencies"):
+		return "agencies"
+	}
+	return "other"
+}
+
+// EndpointStats summarises one endpoint class from one source.
+type EndpointStats struct {
+	Endpoint  string  `json:"endpoint"`
+	Source    string  `json:"source"` // api or cache
+	Requests  int     `json:"requests"`
+	Errors    int     `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+	P50       string  `json:"p50"`
+	P95       string  `json:"p95"`
+}
+
+// Metrics collects request latencies. Durations run until the body is
+// closed, since for full XML the download is most of the time.
+type Metrics struct {
+	// Slow, when positive, logs a warning for any request taking longer.
+	Slow time.Duration
+
+	mu      sync.Mutex
+	samples map[[2]string][]time.Duration
+	errors  map[[2]string]int
+	codes   map[[3]string]int // endpoint, source, status code or "error"
+	bytes   map[string]int64  // body bytes downloaded from the API per endpoint
+	cache   map[string]int    // lookups by how the cache answered: hit, revalidated or miss
+	titles  map[string]int    // titles processed, ok or failed
+}
+
+func NewMetrics(slow time.Duration) *Metrics {
+	return &Metrics{Slow: slow, samples: map[[2]string][]time.Duration{}, errors: map[[2]string]int{},
+		codes: map[[3]string]int{}, bytes: map[string]int64{}, cache: map[string]int{}, titles: map[string]int{}}
+}
+
+// requestRecord is a finished request as MetricsClient saw it.
+type requestRecord struct {
+	URL    string
+	Source string // api or cache
+	Cache  string // how the cache answered (see cacheHitHeader); miss for API requests
+	Code   string // status code, or "error" for no response
+	Failed bool
+	Bytes  int64 // body bytes read
+	Took   time.Duration
+}
+
+// log writes the request at debug level, or as a warning past slow.
+func (r requestRecord) log(endpoint string, slow time.Duration) {
+	level, msg := slog.LevelDebug, "request"
+	if slow > 0 && r.Took > slow {
+		level, msg = slog.LevelWarn, "slow request"
+	}
+	if !slog.Default().Enabled(context.Background(), level) {
+		return
+	}
+	args := append(urlAttrs(r.URL), "url", r.URL, "endpoint", endpoint, "source", r.Source, "cache", r.Cache,
+		"status", r.Code, "bytes", r.Bytes, "duration", r.Took.Round(time.Millisecond))
+	slog.Log(context.Background(), level, msg, args...)
+}
+
+func (m *Metrics) record(r requestRecord) {
+	key := [2]string{endpointClass(r.URL), r.Source}
+	m.mu.Lock()
+	m.samples[key] = append(m.samples[key], r.Took)
+	if r.Failed {
+		m.errors[key]++
+	}
+	m.codes[[3]string{key[0], r.Source, r.Code}]++
+	if r.Source == "api" {
+		m.bytes[key[0]] += r.Bytes
+	}
+	m.mu.Unlock()
+	r.log(key[0], m.Slow)
+}
+
+// cacheLookup counts a request through the cache, how being the
+// cacheHitHeader it came back with or miss.
+func (m *Metrics) cacheLookup(how string) {
+	m.mu.Lock()
+	m.cache[how]++
+	m.mu.Unlock()
+}
+
+// cacheCounts returns the cache lookups served from disk, revalidated or
+// not, and all lookups.
+func (m *Metrics) cacheCounts() (hits, lookups int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for how, n := range m.cache {
+		if how != "miss" {
+			hits += n
+		}
+		lookups += n
+	}
+	return hits, lookups
+}
+
+// TitleDone counts a title the pipeline finished, failed or not.
+func (m *Metrics) TitleDone(failed bool) {
+	result := "ok"
+	if failed {
+		result = "failed"
+	}
+	m.mu.Lock()
+	m.titles[result]++
+	m.mu.Unlock()
+}
+
+// Stats returns one row per endpoint class and source, sorted.
+func (m *Metrics) Stats() []EndpointStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []EndpointStats
+	for key, ds := range m.samples {
+		sorted := append([]time.Duration(nil), ds...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		s := EndpointStats{
+			Endpoint: key[0],
+			Source:   key[1],
+			Requests: len(sorted),
+			Errors:   m.errors[key],
+			P50:      percentile(sorted, 50).Round(time.Millisecond).String(),
+			P95:      percentile(sorted, 95).Round(time.Millisecond).String(),
+		}
+		s.ErrorRate = float64(s.Errors) / float64(s.Requests)
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Endpoint != out[j].Endpoint {
+			return out[i].Endpoint < out[j].Endpoint
+		}
+		return out[i].Source < out[j].Source
+	})
+	return out
+}
+
+// percentile uses nearest rank on sorted durations.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := (len(sorted)*p + 99) / 100
+	if i < 1 {
+		i = 1
+	}
+	return sorted[i-1]
+}
+
+// Log writes the stats to the log, a line per endpoint and source.
+func (m *Metrics) Log() {
+	for _, s := range m.Stats() {
+		slog.Info("request latency", "endpoint", s.Endpoint, "source", s.Source, "requests", s.Requests,
+			"error_rate", fmt.Sprintf("%.1f%%", 100*s.ErrorRate), "p50", s.P50, "p95", s.P95)
+	}
+}
+
+// MetricsClient times requests through Client. Source labels the rows:
+// place an "api" instance beneath the rate limiter so waiting for a slot
+// doesn't count against the API, and a "cache" instance above CachingClient,
+// which counts hits and misses but only times hits (misses are already
+// timed beneath it).
+type MetricsClient struct {
+	Client  httpclient
+	Metrics *Metrics
+	Source  string
+}
+
+func NewMetricsClient(m *Metrics, source string, client httpclient) *MetricsClient {
+	return &MetricsClient{Client: client, Metrics: m, Source: source}
+}
+
+func (mc *MetricsClient) Do(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	url := req.URL.String()
+	resp, err := mc.Client.Do(req)
+	rec := requestRecord{URL: url, Source: mc.Source, Cache: "miss"}
+	if mc.Source == "cache" {
+		if err == nil && resp.Header.Get(cacheHitHeader) != "" {
+			rec.Cache = resp.Header.Get(cacheHitHeader)
+		}
+		mc.Metrics.cacheLookup(rec.Cache)
+		if rec.Cache == "miss" {
+			return resp, err
+		}
+	}
+	if err != nil {
+		rec.Code, rec.Failed, rec.Took = "error", true, time.Since(start)
+		mc.Metrics.record(rec)
+		return nil, err
+	}
+	rec.Code = strconv.Itoa(resp.StatusCode)
+	resp.Body = &timedBody{ReadCloser: resp.Body, done: func(readErr bool, n int64) {
+		rec.Failed, rec.Bytes, rec.Took = resp.StatusCode >= 400 || readErr, n, time.Since(start)
+		mc.Metrics.record(rec)
+	}}
+	return resp, nil
+}
+
+// timedBody reports once, on Close, whether reading failed and how many
+// bytes were read.
+type timedBody struct {
+	io.ReadCloser
+	failed bool
+	n      int64
+	once   sync.Once
+	done   func(failed bool, n int64)
+}
+
+func (b *timedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if err != nil && err != io.EOF {
+		b.failed = true
+	}
+	return n, err
+}
+
+func (b *timedBody) Close() error {
+	b.once.Do(func() { b.done(b.failed, b.n) })
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/paulgmiller/efcr/pipeline"
+)
+
+// Metric units crawl --normalize can report plugin metrics, measures and
+// group rows in, since raw totals from titles of very different sizes don't
+// compare.
+const (
+	unitPer1000 = "per-1000" // per 1,000 of the title's words
+	unitPct     = "pct"      // the title's percentage of the metric's total
+	unitZScore  = "zscore"   // standard deviations from the mean over titles
+)
+
+func validUnit(unit string) error {
+	switch unit {
+	case "", unitPer1000, unitPct, unitZScore:
+		return nil
+	}
+	return fmt.Errorf("unknown --normalize %q (per-1000|pct|zscore)", unit)
+}
+
+// titleWords is each title's words summed over every snapshot crawled, the
+// per-1000 basis for metrics summed over the same snapshots.
+func titleWords(results []pipeline.TitleResult) map[int]int64 {
+	words := map[int]int64{}
+	for _, r := range results {
+		words[r.Title.Number] = r.Words
+	}
+	return words
+}
+
+// normalizeMetrics re-expresses per-title metric values in unit, in a new
+// map; unit "" returns byTitle as it is. Per-1000 divides by each title's
+// words, which should count the same snapshots as its metrics. Totals,
+// means and deviations are over the titles that succeeded, a title without
+// a metric counting as zero; failed titles are normalized against them but
+// don't move them.
+func normalizeMetrics(results []pipeline.TitleResult, words map[int]int64, byTitle map[int]map[string]float64, names map[string]bool, unit string) map[int]map[string]float64 {
+	if unit == "" {
+		return byTitle
+	}
+	var ok []int
+	for _, r := range results {
+		if r.Errs == nil {
+			ok = append(ok, r.Title.Number)
+		}
+	}
+	out := map[int]map[string]float64{}
+	for name := range names {
+		values := make([]float64, len(ok))
+		for i, t := range ok {
+			values[i] = byTitle[t][name]
+		}
+		sum, mean, sd := spread(values)
+		for t, m := range byTitle {
+			v, found := m[name]
+			if !found {
+				continue
+			}
+			switch unit {
+			case unitPer1000:
+				v = ratio(v*1000, float64(words[t]))
+			case unitPct:
+				v = ratio(v*100, sum)
+			case unitZScore:
+				v = ratio(v-mean, sd)
+			}
+			if out[t] == nil {
+				out[t] = map[string]float64{}
+			}
+			out[t][name] = v
+		}
+	}
+	return out
+}
+
+// normalizeRows re-expresses --group-by rows in unit, in place: as a pct of
+// the total over the rows, or a zscore against their mean. Rows are word
+// counts, so per-1000 doesn't apply to them.
+func normalizeRows(rows []RollupRow, unit string) {
+	if unit == "" {
+		return
+	}
+	values := make([]float64, len(rows))
+	for i, r := range rows {
+		values[i] = r.Value
+	}
+	sum, mean, sd := spread(values)
+	for i := range rows {
+		switch unit {
+		case unitPct:
+			rows[i].Value = ratio(rows[i].Value*100, sum)
+		case unitZScore:
+			rows[i].Value = ratio(rows[i].Value-mean, sd)
+		}
+	}
+}
+
+// spread is the sum, mean and population standard deviation of values.
+func spread(values []float64) (sum, mean, sd float64) {
+	var sumSq float64
+	for _, v := range values {
+		sum += v
+		sumSq += v * v
+	}
+	if n := float64(len(values)); n > 0 {
+		mean = sum / n
+		sd = math.Sqrt(max(0, sumSq/n-mean*mean))
+	}
+	return sum, mean, sd
+}
+
+// ratio is a/b, or 0 when b is: a title with no words, a metric that is
+// zero everywhere or the same for every title.
+func ratio(a, b float64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return a / b
+}
+
+// formatMetric prints v with precision decimal places, or as few digits as
+// represent it exactly when precision is negative.
+func formatMetric(v float64, precision int) string {
+	if precision < 0 {
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return strconv.FormatFloat(v, 'f', precision, 64)
+}
+
+// roundMetrics rounds every value to precision decimal places for machine
+// output, leaving them as they are when precision is negative.
+func roundMetrics(byTitle map[int]map[string]float64, precision int) {
+	if precision < 0 {
+		return
+	}
+	scale := math.Pow(10, float64(precision))
+	for _, m := range byTitle {
+		for k, v := range m {
+			m[k] = math.Round(v*scale) / scale
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/paulgmiller/efcr/ecfr"
+	"github.com/paulgmiller/efcr/pipeline"
+)
+
+func TestNormalizeRows(t *testing.T) {
+	for _, tc := range []struct {
+		unit string
+		want []float64
+	}{
+		{"", []float64{100, 300}},
+		{unitPct, []float64{25, 75}},
+		{unitZScore, []float64{-1, 1}},
+	} {
+		rows := []RollupRow{{Key: []string{"a"}, Value: 100}, {Key: []string{"b"}, Value: 300}}
+		normalizeRows(rows, tc.unit)
+		for i, r := range rows {
+			if r.Value != tc.want[i] {
+				t.Errorf("%q: row %s = %g, want %g", tc.unit, r.Key[0], r.Value, tc.want[i])
+			}
+		}
+	}
+}
+
+func TestMeasuresPer1000(t *testing.T) {
+	sm, err := newSectionMeasures([]string{"conditionals"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm.latest[40] = "2024-02-01"
+	sm.byTitle[40] = map[string][]float64{"conditions": {3, 7}, "exceptions": {0, 1}}
+	results := []pipeline.TitleResult{{
+		Title: ecfr.Title{Number: 40},
+		// per-1000 is against the words measured, not every snapshot's
+		Dates: map[string]int64{"2024-01-01": 9000, "2024-02-01": 2000},
+		Words: 11000,
+	}}
+	table := sm.table(results, unitPer1000)
+	if got := table[40]["conditions.sum"]; got != 5 {
+		t.Errorf("conditions.sum per-1000 = %g, want 5", got)
+	}
+	if got := table[40]["exceptions.max"]; got != 0.5 {
+		t.Errorf("exceptions.max per-1000 = %g, want 0.5", got)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Notifier tells someone about a new amendment found by watch.
+type Notifier interface {
+	Notify(ctx context.Context, e WatchEvent) error
+}
+
+// newNotifier picks a backend from a --notify spec:
+//
+//	https://…          POST the event's JSON (watch.schema.json) to a webhook;
+//	                   EFCR_WEBHOOK_TOKEN, if set, is sent as a bearer token
+//	slack:https://…    post a one-message summary to a Slack incoming webhook
+//	cmd:COMMAND        run COMMAND with the event's JSON on stdin, as --exec
+//	file:PATH          append the event's JSON as a line to PATH
+func newNotifier(spec string) (Notifier, error) {
+	switch {
+	case strings.HasPrefix(spec, "file:"):
+		if strings.TrimPrefix(spec, "file:") == "" {
+			return nil, fmt.Errorf("bad notifier %q: no path", spec)
+		}
+		return fileNotifier(strings.TrimPrefix(spec, "file:")), nil
+	case strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://"):
+		return &webhookNotifier{Client: http.DefaultClient, URL: spec, Token: os.Getenv("EFCR_WEBHOOK_TOKEN")}, nil
+	case strings.HasPrefix(spec, "slack:"):
+		url := strings.TrimPrefix(spec, "slack:")
+		if !strings.HasPrefix(url, "https://") {
+			return nil, fmt.Errorf("bad notifier %q: want slack:https://hooks.slack.com/…", spec)
+		}
+		return &slackNotifier{Client: http.DefaultClient, URL: url}, nil
+	case strings.HasPrefix(spec, "cmd:"):
+		argv := strings.Fields(strings.TrimPrefix(spec, "cmd:"))
+		if len(argv) == 0 {
+			return nil, fmt.Errorf("bad notifier %q: no command", spec)
+		}
+		return commandNotifier(argv), nil
+	}
+	return nil, fmt.Errorf("unknown notifier %q (http(s)://…, slack:https://…, cmd:COMMAND, file:PATH)", spec)
+}
+
+// summary is the one-line account of an event that chat notifiers post.
+func (e WatchEvent) summary() string {
+	sections := fmt.Sprintf("%d sections", len(e.Sections))
+	if len(e.Sections) == 1 {
+		sections = "1 section"
+	}
+	parts := "parts " + strings.Join(e.Parts, ", ")
+	if len(e.Parts) == 1 {
+		parts = "part " + e.Parts[0]
+	}
+	return fmt.Sprintf("Title %d (%s) amended %s: %s changed in %s, %+d words (%d total).",
+		e.Title, e.Name, e.Date, sections, parts, e.WordDelta, e.Words)
+}
+
+// commandNotifier runs a command per event with the event's JSON on stdin.
+type commandNotifier []string
+
+func (cmd commandNotifier) Notify(ctx context.Context, e WatchEvent) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	c := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	c.Stdin = bytes.NewReader(b)
+	c.Stdout, c.Stderr = os.Stderr, os.Stderr
+	return c.Run()
+}
+
+// fileNotifier appends each event to an NDJSON file, synced before it
+// reports success.
+type fileNotifier string
+
+func (path fileNotifier) Notify(_ context.Context, e WatchEvent) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(string(path), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// webhookNotifier POSTs each event as JSON.
+type webhookNotifier struct {
+	Client httpclient
+	URL    string
+	Token  string
+}
+
+func (h *webhookNotifier) Notify(ctx context.Context, e WatchEvent) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, h.Client, h.URL, h.Token, b)
+}
+
+// slackNotifier posts each event's summary and link to a Slack incoming
+// webhook.
+type slackNotifier struct {
+	Client httpclient
+	URL    string
+}
+
+func (s *slackNotifier) Notify(ctx context.Context, e WatchEvent) error {
+	// Slack's mrkdwn wants &, < and > escaped outside links.
+	esc := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	text := fmt.Sprintf("%s <%s|View on eCFR>", esc.Replace(e.summary()), e.URL)
+	b, err := json.Marshal(map[string]any{"text": text, "unfurl_links": false})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, s.Client, s.URL, "", b)
+}
+
+// postJSON POSTs body to url and fails on anything but a 2xx.
+func postJSON(ctx context.Context, c httpclient, url, token string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("POST %s: %s: %s", req.URL.Host, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// orphan is a citation whose target is not in force at the snapshot date.
+type orphan struct {
+	citationEdge
+	Status string // missing, removed or reserved
+}
+
+// targetIndex is what a title contains at one date: parts and sections from
+// the structure endpoint, and sections the versions history shows removed.
+type targetIndex struct {
+	parts    map[string]bool // identifier -> reserved
+	sections map[string]bool // identifier -> reserved
+	removed  map[string]bool
+}
+
+func loadTargets(ctx context.Context, api *ecfr.Client, title int, date string) (*targetIndex, error) {
+	root, err := api.Structure(ctx, title, date)
+	if err != nil {
+		return nil, err
+	}
+	ix := &targetIndex{parts: map[string]bool{}, sections: map[string]bool{}, removed: map[string]bool{}}
+	var walk func(n *ecfr.StructureNode)
+	walk = func(n *ecfr.StructureNode) {
+		switch n.Type {
+		case "part":
+			ix.parts[n.Identifier] = n.Reserved
+		case "section":
+			ix.sections[n.Identifier] = n.Reserved
+		}
+		for i := range n.Children {
+			walk(&n.Children[i])
+		}
+	}
+	walk(root)
+
+	versions, err := api.Versions(ctx, title, ecfr.Hierarchy{})
+	if err != nil {
+		return nil, err
+	}
+	latest := map[string]ecfr.Version{}
+	for _, v := range versions {
+		if v.Type == "section" && v.Date <= date && v.Date >= latest[v.Identifier].Date {
+			latest[v.Identifier] = v
+		}
+	}
+	for id, v := range latest {
+		if v.Removed {
+			ix.removed[id] = true
+		}
+	}
+	return ix, nil
+}
+
+// status classifies r, returning "" when it resolves to a live part or
+// section.
+func (ix *targetIndex) status(r core.Ref) string {
+	ids, id := ix.sections, r.Section
+	if r.Section == "" {
+		ids, id = ix.parts, r.Part
+	}
+	reserved, ok := ids[id]
+	switch {
+	case ok && reserved:
+		return "reserved"
+	case ok:
+		return ""
+	case ix.removed[id]:
+		return "removed"
+	}
+	return "missing"
+}
+
+// orphanedCitations checks every edge's target against its title as of
+// date. Titles that can't be loaded at that date (not yet in the eCFR, say)
+// are logged and their citations left unchecked.
+func orphanedCitations(ctx context.Context, api *ecfr.Client, edges []citationEdge, date string) ([]orphan, error) {
+	indexes := map[int]*targetIndex{}
+	var out []orphan
+	for _, e := range edges {
+		t := e.Target.Title
+		ix, seen := indexes[t]
+		if !seen {
+			var err error
+			if ix, err = loadTargets(ctx, api, t, date); err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				slog.Warn("orphans: citations unchecked", titleAttr(t), dateAttr(date), "err", err)
+			}
+			indexes[t] = ix
+		}
+		if ix == nil {
+			continue
+		}
+		if s := ix.status(e.Target); s != "" {
+			out = append(out, orphan{e, s})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].To != out[j].To {
+			return out[i].To < out[j].To
+		}
+		return out[i].From < out[j].From
+	})
+	return out, nil
+}
+
+func printOrphans(orphans []orphan, total int) {
+	fmt.Printf("Orphaned citations (%d of %d)\n", len(orphans), total)
+	fmt.Println("From\tTo\tStatus")
+	for _, o := range orphans {
+		fmt.Printf("%s\t%s\t%s\n", o.From, o.To, o.Status)
+	}
+}
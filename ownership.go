@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// owner is the agency responsible for a part. SubAgency is set when the
+// reference comes from a nested agency.
+type owner struct {
+	Agency    string `json:"agency,omitempty"`
+	SubAgency string `json:"sub_agency,omitempty"`
+}
+
+// ownership maps title -> part -> owner. Part "" holds whole-title owners and
+// is the fallback for parts nobody claims explicitly.
+type ownership map[int]map[string]owner
+
+// loadOwnership joins agency CFR references with title structure for the
+// given titles. Sub-agencies are applied after their parent so the more
+// specific owner wins.
+func loadOwnership(ctx context.Context, c httpclient, titles map[int]bool) (ownership, error) {
+	agencies, err := fetchAgencies(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	st, err := newStructures(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	own := ownership{}
+	assign := func(a Agency, o owner) {
+		for _, ref := range a.CFRReferences {
+			if !titles[ref.Title] {
+				continue
+			}
+			parts, err := st.parts(ctx, ref)
+			if err != nil {
+				// agency references lag reorganisations; don't fail the report
+				slog.Warn("ownership: agency reference unresolved", "agency", a.Slug, "err", err)
+				continue
+			}
+			if own[ref.Title] == nil {
+				own[ref.Title] = map[string]owner{}
+			}
+			for _, p := range parts {
+				own[ref.Title][p] = o
+			}
+		}
+	}
+	for _, a := range agencies {
+		assign(a, owner{Agency: a.DisplayName})
+		for _, sub := range a.Children {
+			assign(sub, owner{Agency: a.DisplayName, SubAgency: sub.DisplayName})
+		}
+	}
+	return own, nil
+}
+
+func (o ownership) lookup(title int, part string) owner {
+	if w, ok := o[title][part]; ok {
+		return w
+	}
+	return o[title][""]
+}
+
+func validGroupBy(by string) error {
+	switch by {
+	case "title", "part", "agency":
+		return nil
+	}
+	return fmt.Errorf("unknown --group-by %q (title|part|agency)", by)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+// A minimal Apache Parquet writer for the lakehouse export: required
+// (non-null) flat columns, one row group per file, one uncompressed PLAIN
+// data page per column. That is enough for Spark, DuckDB, pandas and Trino
+// to read, and keeps efcr on the standard library. The file metadata is
+// Thrift compact protocol, written by the small encoder below.
+
+// parquetColumn accumulates the PLAIN encoded values of one column. Types
+// are those of arrow.go: int32, float64, bool, utf8 and date32.
+type parquetColumn struct {
+	name string
+	typ  arrowType
+	n    int
+	data []byte
+}
+
+func (c *parquetColumn) Int32(v int32) {
+	c.data = binary.LittleEndian.AppendUint32(c.data, uint32(v))
+	c.n++
+}
+
+func (c *parquetColumn) Float64(v float64) {
+	c.data = binary.LittleEndian.AppendUint64(c.data, math.Float64bits(v))
+	c.n++
+}
+
+func (c *parquetColumn) Bool(v bool) {
+	c.data = setBit(c.data, c.n, v)
+	c.n++
+}
+
+func (c *parquetColumn) String(s string) {
+	c.data = binary.LittleEndian.AppendUint32(c.data, uint32(len(s)))
+	c.data = append(c.data, s...)
+	c.n++
+}
+
+// Date appends a YYYY-MM-DD date as days since the Unix epoch.
+func (c *parquetColumn) Date(s string) error {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return err
+	}
+	c.Int32(int32(t.Unix() / 86400))
+	return nil
+}
+
+// Parquet Thrift enum values (parquet.thrift).
+const (
+	parquetBoolean   = 0
+	parquetInt32     = 1
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetUTF8     = 0 // ConvertedType
+	parquetDate     = 6 // ConvertedType
+
+	parquetPlain        = 0
+	parquetRLE          = 3
+	parquetUncompressed = 0
+	parquetDataPage     = 0
+)
+
+func (c *parquetColumn) physical() int32 {
+	switch c.typ {
+	case arrowBool:
+		return parquetBoolean
+	case arrowFloat64:
+		return parquetDouble
+	case arrowUtf8:
+		return parquetByteArray
+	}
+	return parquetInt32
+}
+
+// writeParquet writes cols, which must all hold the same number of values,
+// as a Parquet file and returns its size.
+func writeParquet(w io.Writer, cols []*parquetColumn) (int64, error) {
+	rows := 0
+	if len(cols) > 0 {
+		rows = cols[0].n
+	}
+	out := []byte("PAR1")
+	type chunk struct {
+		offset, size int64
+	}
+	chunks := make([]chunk, len(cols))
+	var total int64
+	for i, c := range cols {
+		var h thrift
+		h.I32(1, parquetDataPage)
+		h.I32(2, int32(len(c.data)))
+		h.I32(3, int32(len(c.data)))
+		h.Begin(5) // DataPageHeader
+		h.I32(1, int32(c.n))
+		h.I32(2, parquetPlain)
+		h.I32(3, parquetRLE)
+		h.I32(4, parquetRLE)
+		h.End()
+		h.Stop()
+		chunks[i] = chunk{int64(len(out)), int64(len(h.b) + len(c.data))}
+		total += chunks[i].size
+		out = append(out, h.b...)
+		out = append(out, c.data...)
+	}
+
+	var m thrift // FileMetaData
+	m.I32(1, 1)
+	m.List(2, thriftStruct, len(cols)+1)
+	m.Elem() // root
+	m.Binary(4, "schema")
+	m.I32(5, int32(len(cols)))
+	m.End()
+	for _, c := range cols {
+		m.Elem()
+		m.I32(1, c.physical())
+		m.I32(3, parquetRequired)
+		m.Binary(4, c.name)
+		switch c.typ {
+		case arrowUtf8:
+			m.I32(6, parquetUTF8)
+		case arrowDate32:
+			m.I32(6, parquetDate)
+		}
+		m.End()
+	}
+	m.I64(3, int64(rows))
+	m.List(4, thriftStruct, 1)
+	m.Elem() // RowGroup
+	m.List(1, thriftStruct, len(cols))
+	for i, c := range cols {
+		m.Elem() // ColumnChunk
+		m.I64(2, chunks[i].offset)
+		m.Begin(3) // ColumnMetaData
+		m.I32(1, c.physical())
+		m.List(2, thriftI32, 1)
+		m.ListI32(parquetPlain)
+		m.List(3, thriftBinary, 1)
+		m.ListBinary(c.name)
+		m.I32(4, parquetUncompressed)
+		m.I64(5, int64(c.n))
+		m.I64(6, chunks[i].size)
+		m.I64(7, chunks[i].size)
+		m.I64(9, chunks[i].offset)
+		m.End()
+		m.End()
+	}
+	m.I64(2, total)
+	m.I64(3, int64(rows))
+	m.End()
+	m.Binary(6, "efcr "+toolVersion())
+	m.Stop()
+
+	out = append(out, m.b...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(m.b)))
+	out = append(out, "PAR1"...)
+	n, err := w.Write(out)
+	return int64(n), err
+}
+
+// Thrift compact protocol type ids.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thrift encodes one struct in the Thrift compact protocol. Field ids are
+// delta encoded against the previous field of the enclosing struct, so
+// nested structs save and restore it.
+type thrift struct {
+	b     []byte
+	last  int16
+	stack []int16
+}
+
+func (t *thrift) varint(v uint64) { t.b = binary.AppendUvarint(t.b, v) }
+
+func (t *thrift) zigzag(v int64) { t.varint(uint64(v<<1 ^ v>>63)) }
+
+func (t *thrift) field(id int16, typ byte) {
+	if d := id - t.last; d > 0 && d <= 15 {
+		t.b = append(t.b, byte(d)<<4|typ)
+	} else {
+		t.b = append(t.b, typ)
+		t.zigzag(int64(id))
+	}
+	t.last = id
+}
+
+func (t *thrift) I32(id int16, v int32) { t.field(id, thriftI32); t.zigzag(int64(v)) }
+func (t *thrift) I64(id int16, v int64) { t.field(id, thriftI64); t.zigzag(v) }
+
+func (t *thrift) Binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.ListBinary(s)
+}
+
+// Begin starts a struct-valued field; End closes it.
+func (t *thrift) Begin(id int16) {
+	t.field(id, thriftStruct)
+	t.Elem()
+}
+
+// List starts a list field of n elements, which follow as ListI32,
+// ListBinary or Elem...End.
+func (t *thrift) List(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.b = append(t.b, byte(n)<<4|elem)
+	} else {
+		t.b = append(t.b, 0xf0|elem)
+		t.varint(uint64(n))
+	}
+}
+
+func (t *thrift) ListI32(v int32) { t.zigzag(int64(v)) }
+
+func (t *thrift) ListBinary(s string) {
+	t.varint(uint64(len(s)))
+	t.b = append(t.b, s...)
+}
+
+// Elem starts a struct list element.
+func (t *thrift) Elem() {
+	t.stack = append(t.stack, t.last)
+	t.last = 0
+}
+
+func (t *thrift) End() {
+	t.Stop()
+	t.last = t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+// Stop ends the outermost struct.
+func (t *thrift) Stop() { t.b = append(t.b, 0) }
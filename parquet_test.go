@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFactsParquetGolden(t *testing.T) {
+	defer func(v string) { version = v }(version)
+	version = "test" // created_by
+	path := filepath.Join(t.TempDir(), "facts.parquet")
+	size, err := writeFactsParquet(path, testFacts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(b)) {
+		t.Errorf("size = %d, file has %d bytes", size, len(b))
+	}
+	// PAR1, the pages, the footer, its length and PAR1 again
+	n := len(b)
+	if n < 12 || string(b[:4]) != "PAR1" || string(b[n-4:]) != "PAR1" {
+		t.Fatalf("no PAR1 magic at both ends of %d bytes", n)
+	}
+	if footer := int(binary.LittleEndian.Uint32(b[n-8:])); footer <= 0 || footer > n-12 {
+		t.Errorf("footer length %d does not fit a %d byte file", footer, n)
+	}
+	golden(t, "facts.parquet", b)
+}
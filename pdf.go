@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Minimal direct-layout PDF writer: US Letter pages, built-in Helvetica, one
+// header and one footer line per page. Good enough for archiving
+// point-in-time regulation text without pulling in a layout engine.
+const (
+	pdfPageWidth  = 612 // points, 8.5in
+	pdfPageHeight = 792 // points, 11in
+	pdfMargin     = 54
+	pdfFontSize   = 10
+	pdfLeading    = 12
+	pdfTextWidth  = pdfPageWidth - 2*pdfMargin
+	pdfPageLines  = (pdfPageHeight - 2*pdfMargin - 2*pdfLeading) / pdfLeading
+)
+
+// writePDF lays text out as paragraphs (one per non-blank input line) with
+// header at the top and footer plus page numbers at the bottom of every page.
+func writePDF(w io.Writer, header, footer string, text io.Reader) error {
+	return layoutPDF(w, header, footer, text, nil)
+}
+
+// layoutPDF is writePDF, written as PDF/A when a is set (see writePDFA).
+func layoutPDF(w io.Writer, header, footer string, text io.Reader, a *pdfA) error {
+	wrap := func(words []string) []string { return wrapMeasured(words, pdfTextWidth, helveticaMeasure) }
+	if a != nil {
+		header = a.Font.cover(header)
+		wrap = func(words []string) []string {
+			for i := range words {
+				words[i] = a.Font.cover(words[i])
+			}
+			return wrapMeasured(words, pdfTextWidth, a.Font.measure)
+		}
+	}
+	// Paragraphs are read whole, however long: a Scanner's token limit
+	// would cut the text short.
+	var lines []string
+	r := bufio.NewReader(text)
+	for {
+		line, err := r.ReadString('\n')
+		if para := strings.Fields(line); len(para) > 0 {
+			lines = append(lines, wrap(para)...)
+			lines = append(lines, "")
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	var pages [][]string
+	for len(lines) > 0 {
+		n := min(pdfPageLines, len(lines))
+		pages = append(pages, lines[:n])
+		lines = lines[n:]
+	}
+	if len(pages) == 0 {
+		pages = [][]string{nil}
+	}
+
+	// Objects: 1 catalog, 2 page tree, 3 font, then a page/content pair per
+	// page, then for PDF/A the font descriptor, font program and metadata.
+	var buf bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	extra := 4 + 2*len(pages)
+	resources := "/Font << /F1 3 0 R >>"
+	if a == nil {
+		buf.WriteString("%PDF-1.4\n")
+		obj("<< /Type /Catalog /Pages 2 0 R >>")
+	} else {
+		buf.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n") // binary marker comment
+		obj(fmt.Sprintf("<< /Type /Catalog /Pages 2 0 R /Metadata %d 0 R >>", extra+2))
+		resources += " /ColorSpace << /CS0 " + pdfCalGray + " >>"
+	}
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	if a == nil {
+		obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	} else {
+		obj(a.Font.fontDict(extra))
+	}
+	for i, page := range pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << %s >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, resources, 5+2*i))
+
+		var cs bytes.Buffer
+		if a != nil {
+			cs.WriteString("/CS0 cs 0 sc\n")
+		}
+		pdfLine(&cs, pdfMargin, pdfPageHeight-pdfMargin, header)
+		y := pdfPageHeight - pdfMargin - 2*pdfLeading
+		for _, l := range page {
+			pdfLine(&cs, pdfMargin, y, l)
+			y -= pdfLeading
+		}
+		pageFooter := fmt.Sprintf("%s    Page %d of %d", footer, i+1, len(pages))
+		if a != nil {
+			pageFooter = a.Font.cover(pageFooter)
+		}
+		pdfLine(&cs, pdfMargin, pdfMargin-pdfLeading, pageFooter)
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", cs.Len(), cs.String()))
+	}
+	trailer := ""
+	if a != nil {
+		descriptor, program, err := a.Font.embed(extra + 1)
+		if err != nil {
+			return err
+		}
+		obj(descriptor)
+		obj(program)
+		xmp := a.Meta.xmp()
+		obj(fmt.Sprintf("<< /Type /Metadata /Subtype /XML /Length %d >>\nstream\n%s\nendstream", len(xmp), xmp))
+		id := a.Meta.id()
+		trailer = fmt.Sprintf(" /ID [<%x> <%x>]", id, id)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R%s >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, trailer, xref)
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func pdfLine(w *bytes.Buffer, x, y int, s string) {
+	if s == "" {
+		return
+	}
+	fmt.Fprintf(w, "BT /F1 %d Tf %d %d Td (%s) Tj ET\n", pdfFontSize, x, y, pdfEscape(s))
+}
+
+// winAnsiPunct maps the typographic punctuation eCFR text uses to its
+// WinAnsi codes, which sit outside Latin-1.
+var winAnsiPunct = map[rune]byte{'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97}
+
+// pdfEscape encodes s as a WinAnsi literal string body. Runes the encoding
+// can't represent become '?'.
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(byte(r))
+		case r < 0x80 || (r >= 0xA0 && r <= 0xFF):
+			b.WriteByte(byte(r))
+		case winAnsiPunct[r] != 0:
+			b.WriteByte(winAnsiPunct[r])
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// helveticaWidths are the advance widths of built-in Helvetica for WinAnsi
+// codes 32 to 255, from the standard AFM, in 1/1000 em. Codes WinAnsi
+// leaves undefined are 0.
+var helveticaWidths = [224]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278, // 32
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556, // 48
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778, // 64
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556, // 80
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556, // 96
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584, 0, // 112
+	556, 0, 222, 556, 333, 1000, 556, 556, 333, 1000, 667, 333, 1000, 0, 611, 0, // 128
+	0, 222, 222, 333, 333, 350, 556, 1000, 333, 1000, 500, 333, 944, 0, 500, 667, // 144
+	278, 333, 556, 556, 556, 556, 260, 556, 333, 737, 370, 556, 584, 333, 737, 333, // 160
+	400, 584, 333, 333, 333, 556, 537, 278, 333, 333, 365, 556, 834, 834, 834, 611, // 176
+	667, 667, 667, 667, 667, 667, 1000, 722, 667, 667, 667, 667, 278, 278, 278, 278, // 192
+	722, 722, 778, 778, 778, 778, 778, 584, 778, 722, 722, 722, 722, 667, 667, 611, // 208
+	556, 556, 556, 556, 556, 556, 889, 500, 556, 556, 556, 556, 278, 278, 278, 278, // 224
+	556, 556, 556, 556, 556, 556, 556, 584, 611, 556, 556, 556, 556, 500, 556, 500, // 240
+}
+
+// helveticaMeasure returns the width of s in points at the body font size,
+// as pdfEscape encodes it.
+func helveticaMeasure(s string) float64 {
+	w := 0
+	for _, r := range s {
+		code, ok := winAnsiCode(r)
+		if !ok {
+			code = '?'
+		}
+		w += helveticaWidths[code-32]
+	}
+	return float64(w) * pdfFontSize / 1000
+}
+
+// wrapMeasured greedily packs words into lines no wider than width, as
+// measure sizes them.
+func wrapMeasured(words []string, width float64, measure func(string) float64) []string {
+	var lines []string
+	var cur strings.Builder
+	n, space := 0.0, measure(" ")
+	for _, w := range words {
+		wl := measure(w)
+		if n > 0 && n+space+wl > width {
+			lines = append(lines, cur.String())
+			cur.Reset()
+			n = 0
+		}
+		if n > 0 {
+			cur.WriteByte(' ')
+			n += space
+		}
+		cur.WriteString(w)
+		n += wl
+	}
+	if n > 0 {
+		lines = append(lines, cur.String())
+	}
+	return lines
+}
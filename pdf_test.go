@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// checkPDF checks the cross-reference table of a PDF efcr wrote and
+// returns its objects by number.
+func checkPDF(t *testing.T, b []byte) map[int]string {
+	t.Helper()
+	if !bytes.HasPrefix(b, []byte("%PDF-1.")) || !bytes.HasSuffix(b, []byte("%%EOF\n")) {
+		t.Fatal("no PDF header or EOF marker")
+	}
+	m := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(b)
+	if m == nil {
+		t.Fatal("no startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(b[xref:], []byte("xref\n0 ")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+	lines := strings.Split(string(b[xref:]), "\n")
+	var size int
+	fmt.Sscanf(lines[1], "0 %d", &size)
+	if !strings.Contains(string(b[xref:]), fmt.Sprintf("/Size %d ", size)) {
+		t.Errorf("trailer /Size does not match the %d xref entries", size)
+	}
+	objs := map[int]string{}
+	for i := 1; i < size; i++ {
+		off, err := strconv.Atoi(lines[2+i][:10])
+		if err != nil {
+			t.Fatalf("xref entry %d: %v", i, err)
+		}
+		head := fmt.Sprintf("%d 0 obj\n", i)
+		if !bytes.HasPrefix(b[off:], []byte(head)) {
+			t.Fatalf("xref entry %d points at %q", i, b[off:min(off+20, len(b))])
+		}
+		body := b[off+len(head):]
+		objs[i] = string(body[:bytes.Index(body, []byte("\nendobj\n"))])
+	}
+	return objs
+}
+
+func TestPDFLayout(t *testing.T) {
+	var text strings.Builder
+	text.WriteString("§ 1.1 Purpose (and scope).\n\n")
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&text, "Paragraph %d of a section long enough to need two pages.\n", i)
+	}
+	var b bytes.Buffer
+	if err := writePDF(&b, "Title 40 — Part 60", "eCFR as of 2024-01-02", strings.NewReader(text.String())); err != nil {
+		t.Fatal(err)
+	}
+	objs := checkPDF(t, b.Bytes())
+	if !strings.Contains(objs[2], "/Count 2") {
+		t.Fatalf("page tree %s, want two pages", objs[2])
+	}
+	for page := 1; page <= 2; page++ {
+		content := objs[3+2*page]
+		if !strings.Contains(content, "(Title 40 \x97 Part 60) Tj") {
+			t.Errorf("page %d has no header", page)
+		}
+		if !strings.Contains(content, fmt.Sprintf("(eCFR as of 2024-01-02    Page %d of 2) Tj", page)) {
+			t.Errorf("page %d has no footer", page)
+		}
+	}
+	if !strings.Contains(objs[5], "(\xa7 1.1 Purpose \\(and scope\\).) Tj") {
+		t.Error("first paragraph not escaped as WinAnsi")
+	}
+	if !strings.Contains(objs[7], "(Paragraph 39 of") {
+		t.Error("last paragraph missing from page 2")
+	}
+}
+
+// Lines wrap by Helvetica's glyph widths, so capitals and wide glyphs
+// stay inside the margins.
+func TestPDFWrapsByWidth(t *testing.T) {
+	para := strings.Repeat("WWW MMM § 172.101 HAZARDOUS MATERIALS TABLE — ", 20)
+	var b bytes.Buffer
+	if err := writePDF(&b, "h", "f", strings.NewReader(para)); err != nil {
+		t.Fatal(err)
+	}
+	objs := checkPDF(t, b.Bytes())
+	shown := regexp.MustCompile(`\((.*)\) Tj`).FindAllStringSubmatch(objs[5], -1)
+	if len(shown) < 10 {
+		t.Fatalf("%d lines shown, want the paragraph wrapped", len(shown))
+	}
+	for _, m := range shown {
+		w := 0
+		for _, c := range []byte(strings.NewReplacer(`\(`, "(", `\)`, ")", `\\`, `\`).Replace(m[1])) {
+			w += helveticaWidths[c-32]
+		}
+		if pt := float64(w) * pdfFontSize / 1000; pt > pdfTextWidth {
+			t.Errorf("%q is %.1fpt wide, more than %dpt", m[1], pt, pdfTextWidth)
+		}
+	}
+}
+
+// A paragraph longer than any line buffer is laid out whole.
+func TestPDFLongParagraph(t *testing.T) {
+	para := strings.Repeat("word ", 20000) + "last"
+	var b bytes.Buffer
+	if err := writePDF(&b, "h", "f", strings.NewReader(para)); err != nil {
+		t.Fatal(err)
+	}
+	objs := checkPDF(t, b.Bytes())
+	var content strings.Builder
+	for i := 1; i <= len(objs); i++ {
+		content.WriteString(objs[i] + "\n")
+	}
+	if !strings.Contains(content.String(), "last) Tj") {
+		t.Error("the paragraph's last word is missing")
+	}
+	if n := strings.Count(content.String(), "word"); n != 20000 {
+		t.Errorf("%d words laid out, want 20000", n)
+	}
+}
+
+// A read error is returned, not taken as the end of the text.
+func TestPDFReadError(t *testing.T) {
+	want := errors.New("connection reset")
+	text := io.MultiReader(strings.NewReader("§ 1.1 Purpose.\n"), iotest.ErrReader(want))
+	if err := writePDF(io.Discard, "h", "f", text); !errors.Is(err, want) {
+		t.Errorf("writePDF = %v, want %v", err, want)
+	}
+}
+
+func TestPDFEmpty(t *testing.T) {
+	var b bytes.Buffer
+	if err := writePDF(&b, "h", "f", strings.NewReader("")); err != nil {
+		t.Fatal(err)
+	}
+	if objs := checkPDF(t, b.Bytes()); !strings.Contains(objs[2], "/Count 1") {
+		t.Errorf("page tree %s, want one blank page", objs[2])
+	}
+}
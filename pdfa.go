@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// PDF/A-2b, the archival profile of PDF, asks more of a file than writePDF
+// gives: every font embedded, colour in a device-independent space, XMP
+// metadata declaring the conformance, and a file identifier. Text is drawn
+// in a CalGray black, so no ICC output intent is needed.
+const pdfCalGray = "[/CalGray << /WhitePoint [0.9505 1 1.089] >>]"
+
+// pdfA is what writePDFA needs beyond writePDF's arguments.
+type pdfA struct {
+	Font *trueTypeFont
+	Meta pdfMeta
+}
+
+// pdfMeta is the provenance an archived PDF carries in its XMP metadata.
+type pdfMeta struct {
+	Title        string // dc:title, e.g. "40 CFR Part 60 as of 2024-03-01"
+	SourceURL    string // dc:source, the versioner URL the text came from
+	SourceSHA256 string // of the source XML as fetched
+	SnapshotDate string
+	Retrieved    time.Time
+}
+
+// writePDFA is writePDF as a PDF/A-2b file, in font, with meta embedded.
+func writePDFA(w io.Writer, header, footer string, text io.Reader, font *trueTypeFont, meta pdfMeta) error {
+	return layoutPDF(w, header, footer, text, &pdfA{Font: font, Meta: meta})
+}
+
+// id is the file identifier the trailer must carry: stable for the same
+// source and snapshot.
+func (m pdfMeta) id() []byte {
+	sum := sha256.Sum256([]byte(m.SourceURL + "\x00" + m.SourceSHA256))
+	return sum[:16]
+}
+
+// xmp returns the metadata packet. The efcr properties are declared in a
+// PDF/A extension schema, as custom XMP properties must be.
+func (m pdfMeta) xmp() string {
+	e := html.EscapeString
+	created := m.Retrieved.UTC().Format(time.RFC3339)
+	var b strings.Builder
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/">
+<pdfaid:part>2</pdfaid:part>
+<pdfaid:conformance>B</pdfaid:conformance>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:format>application/pdf</dc:format>
+`)
+	fmt.Fprintf(&b, "<dc:title><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:title>\n", e(m.Title))
+	fmt.Fprintf(&b, "<dc:source>%s</dc:source>\n", e(m.SourceURL))
+	b.WriteString(`</rdf:Description>
+<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/">
+`)
+	fmt.Fprintf(&b, "<xmp:CreateDate>%s</xmp:CreateDate>\n<xmp:CreatorTool>efcr %s</xmp:CreatorTool>\n", created, e(toolVersion()))
+	b.WriteString(`</rdf:Description>
+<rdf:Description rdf:about="" xmlns:efcr="` + efcrXMPNamespace + `">
+`)
+	fmt.Fprintf(&b, "<efcr:snapshotDate>%s</efcr:snapshotDate>\n<efcr:sourceSHA256>%s</efcr:sourceSHA256>\n<efcr:retrieved>%s</efcr:retrieved>\n",
+		e(m.SnapshotDate), e(m.SourceSHA256), created)
+	b.WriteString(`</rdf:Description>
+<rdf:Description rdf:about="" xmlns:pdfaExtension="http://www.aiim.org/pdfa/ns/extension/" xmlns:pdfaSchema="http://www.aiim.org/pdfa/ns/schema#" xmlns:pdfaProperty="http://www.aiim.org/pdfa/ns/property#">
+<pdfaExtension:schemas><rdf:Bag><rdf:li rdf:parseType="Resource">
+<pdfaSchema:schema>efcr provenance</pdfaSchema:schema>
+<pdfaSchema:namespaceURI>` + efcrXMPNamespace + `</pdfaSchema:namespaceURI>
+<pdfaSchema:prefix>efcr</pdfaSchema:prefix>
+<pdfaSchema:property><rdf:Seq>
+`)
+	for _, p := range [][3]string{
+		{"snapshotDate", "Date", "eCFR point-in-time date of the text"},
+		{"sourceSHA256", "Text", "SHA-256 of the source XML as fetched"},
+		{"retrieved", "Date", "when the source was fetched"},
+	} {
+		fmt.Fprintf(&b, "<rdf:li rdf:parseType=\"Resource\"><pdfaProperty:name>%s</pdfaProperty:name><pdfaProperty:valueType>%s</pdfaProperty:valueType>"+
+			"<pdfaProperty:category>external</pdfaProperty:category><pdfaProperty:description>%s</pdfaProperty:description></rdf:li>\n", p[0], p[1], p[2])
+	}
+	b.WriteString(`</rdf:Seq></pdfaSchema:property>
+</rdf:li></rdf:Bag></pdfaExtension:schemas>
+</rdf:Description>
+</rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`)
+	return b.String()
+}
+
+const efcrXMPNamespace = "https://github.com/paulgmiller/efcr/ns/provenance/"
+
+// trueTypeFont is a TrueType font program read for embedding as a simple
+// WinAnsi font. Metrics are in PDF glyph space, 1000 units to the em.
+type trueTypeFont struct {
+	data                       []byte
+	name                       string // PostScript name
+	widths                     [256]int
+	glyph                      [256]bool // WinAnsi codes the font has a glyph for
+	bbox                       [4]int
+	ascent, descent, capHeight int
+	italicAngle                float64
+}
+
+// loadTrueType reads a .ttf file for embedding. CFF-flavoured OpenType
+// and fonts whose licence forbids embedding are refused.
+func loadTrueType(path string) (*trueTypeFont, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := parseTrueType(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+func parseTrueType(b []byte) (*trueTypeFont, error) {
+	errShort := errors.New("truncated font")
+	if len(b) < 12 {
+		return nil, errShort
+	}
+	if string(b[:4]) == "OTTO" {
+		return nil, errors.New("CFF-based OpenType fonts can't be embedded; use a TrueType .ttf")
+	}
+	u16 := func(off int) int {
+		if off < 0 || off+2 > len(b) {
+			return 0
+		}
+		return int(binary.BigEndian.Uint16(b[off:]))
+	}
+	i16 := func(off int) int { return int(int16(u16(off))) }
+	tables := map[string][2]int{} // tag -> offset, length
+	for i := 0; i < u16(4); i++ {
+		rec := 12 + 16*i
+		if rec+16 > len(b) {
+			return nil, errShort
+		}
+		off, n := int(binary.BigEndian.Uint32(b[rec+8:])), int(binary.BigEndian.Uint32(b[rec+12:]))
+		if off+n > len(b) {
+			return nil, errShort
+		}
+		tables[string(b[rec:rec+4])] = [2]int{off, n}
+	}
+	for _, tag := range []string{"head", "hhea", "hmtx", "cmap", "glyf"} {
+		if _, ok := tables[tag]; !ok {
+			return nil, fmt.Errorf("no %s table; not a TrueType font", tag)
+		}
+	}
+	head, hhea, hmtx := tables["head"][0], tables["hhea"][0], tables["hmtx"][0]
+	unitsPerEm := u16(head + 18)
+	if unitsPerEm == 0 {
+		return nil, errors.New("unitsPerEm is zero")
+	}
+	scale := func(v int) int { return int(math.Round(float64(v) * 1000 / float64(unitsPerEm))) }
+	f := &trueTypeFont{data: b}
+	f.bbox = [4]int{scale(i16(head + 36)), scale(i16(head + 38)), scale(i16(head + 40)), scale(i16(head + 42))}
+	f.ascent, f.descent = scale(i16(hhea+4)), scale(i16(hhea+6))
+	f.capHeight = f.ascent
+	if os2, ok := tables["OS/2"]; ok {
+		if u16(os2[0]+8)&0x000f == 0x0002 {
+			return nil, errors.New("the font's licence restricts embedding")
+		}
+		if u16(os2[0]) >= 2 {
+			f.capHeight = scale(i16(os2[0] + 88))
+		}
+	}
+	if post, ok := tables["post"]; ok && post[1] >= 8 {
+		f.italicAngle = float64(int32(binary.BigEndian.Uint32(b[post[0]+4:]))) / 65536
+	}
+	f.name = trueTypeName(b, tables["name"], u16)
+
+	glyphOf, err := trueTypeCmap(b, tables["cmap"][0], u16)
+	if err != nil {
+		return nil, err
+	}
+	metrics := u16(hhea + 34)
+	if metrics == 0 {
+		return nil, errors.New("no horizontal metrics")
+	}
+	advance := func(gid int) int { return u16(hmtx + 4*min(gid, metrics-1)) }
+	for code := 32; code < 256; code++ {
+		r, ok := winAnsiRune(byte(code))
+		if !ok {
+			continue
+		}
+		if gid := glyphOf(r); gid != 0 {
+			f.glyph[code] = true
+			f.widths[code] = scale(advance(gid))
+		}
+	}
+	if !f.glyph['?'] || !f.glyph[' '] {
+		return nil, errors.New("no glyphs for basic Latin text")
+	}
+	return f, nil
+}
+
+// winAnsiCode returns the printable WinAnsi code pdfEscape writes for r.
+func winAnsiCode(r rune) (byte, bool) {
+	switch {
+	case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+		return byte(r), true
+	case winAnsiPunct[r] != 0:
+		return winAnsiPunct[r], true
+	}
+	return 0, false
+}
+
+// winAnsiRune is the inverse of winAnsiCode.
+func winAnsiRune(code byte) (rune, bool) {
+	switch {
+	case code >= 0x20 && code < 0x7f, code >= 0xa0:
+		return rune(code), true
+	}
+	for r, c := range winAnsiPunct {
+		if c == code {
+			return r, true
+		}
+	}
+	return 0, false
+}
+
+// trueTypeCmap returns a lookup from character to glyph ID using the
+// Windows Unicode (3,1) format 4 subtable, which a WinAnsi font needs.
+func trueTypeCmap(b []byte, cmap int, u16 func(int) int) (func(rune) int, error) {
+	sub := -1
+	for i := 0; i < u16(cmap+2); i++ {
+		rec := cmap + 4 + 8*i
+		if u16(rec) == 3 && u16(rec+2) == 1 {
+			sub = cmap + int(binary.BigEndian.Uint32(b[rec+4:]))
+		}
+	}
+	if sub < 0 || u16(sub) != 4 {
+		return nil, errors.New("no Windows Unicode (3,1) format 4 cmap")
+	}
+	segs := u16(sub+6) / 2
+	ends, starts := sub+14, sub+16+2*segs
+	deltas, ranges := starts+2*segs, starts+4*segs
+	return func(r rune) int {
+		c := int(r)
+		for i := 0; i < segs; i++ {
+			if c > u16(ends+2*i) {
+				continue
+			}
+			if c < u16(starts+2*i) {
+				return 0
+			}
+			ro := u16(ranges + 2*i)
+			if ro == 0 {
+				return (c + u16(deltas+2*i)) & 0xffff
+			}
+			gid := u16(ranges + 2*i + ro + 2*(c-u16(starts+2*i)))
+			if gid == 0 {
+				return 0
+			}
+			return (gid + u16(deltas+2*i)) & 0xffff
+		}
+		return 0
+	}, nil
+}
+
+// trueTypeName returns the font's PostScript name (name ID 6), or a
+// placeholder when it has none.
+func trueTypeName(b []byte, name [2]int, u16 func(int) int) string {
+	if name[1] == 0 {
+		return "EmbeddedFont"
+	}
+	base := name[0]
+	storage := base + u16(base+4)
+	for i := 0; i < u16(base+2); i++ {
+		rec := base + 6 + 12*i
+		platform, id, n, off := u16(rec), u16(rec+6), u16(rec+8), storage+u16(rec+10)
+		if id != 6 || off+n > len(b) {
+			continue
+		}
+		raw := b[off : off+n]
+		if platform == 3 || platform == 0 {
+			units := make([]uint16, len(raw)/2)
+			for j := range units {
+				units[j] = binary.BigEndian.Uint16(raw[2*j:])
+			}
+			return string(utf16.Decode(units))
+		}
+		return string(raw)
+	}
+	return "EmbeddedFont"
+}
+
+// cover replaces characters the font (or WinAnsi) can't show with '?', so
+// no text falls back to the missing glyph, which PDF/A forbids.
+func (f *trueTypeFont) cover(s string) string {
+	return strings.Map(func(r rune) rune {
+		if code, ok := winAnsiCode(r); !ok || !f.glyph[code] {
+			return '?'
+		}
+		return r
+	}, s)
+}
+
+// measure returns the width of covered text at the body font size, in
+// points.
+func (f *trueTypeFont) measure(s string) float64 {
+	w := 0
+	for _, r := range s {
+		if code, ok := winAnsiCode(r); ok {
+			w += f.widths[code]
+		}
+	}
+	return float64(w) * pdfFontSize / 1000
+}
+
+// fontDict returns the font dictionary, whose descriptor is object
+// descriptor.
+func (f *trueTypeFont) fontDict(descriptor int) string {
+	widths := make([]string, 0, 224)
+	for code := 32; code < 256; code++ {
+		widths = append(widths, fmt.Sprint(f.widths[code]))
+	}
+	return fmt.Sprintf("<< /Type /Font /Subtype /TrueType /BaseFont /%s /FirstChar 32 /LastChar 255 /Widths [%s] /FontDescriptor %d 0 R /Encoding /WinAnsiEncoding >>",
+		f.pdfName(), strings.Join(widths, " "), descriptor)
+}
+
+// embed returns the font descriptor and the compressed font program, which
+// is object program.
+func (f *trueTypeFont) embed(program int) (descriptor, stream string, err error) {
+	flags := 32 // nonsymbolic
+	if f.italicAngle != 0 {
+		flags |= 64
+	}
+	descriptor = fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags %d /FontBBox [%d %d %d %d] /ItalicAngle %g /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+		f.pdfName(), flags, f.bbox[0], f.bbox[1], f.bbox[2], f.bbox[3], f.italicAngle, f.ascent, f.descent, f.capHeight, program)
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	if _, err := zw.Write(f.data); err != nil {
+		return "", "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", "", err
+	}
+	stream = fmt.Sprintf("<< /Length %d /Length1 %d /Filter /FlateDecode >>\nstream\n%s\nendstream", z.Len(), len(f.data), z.Bytes())
+	return descriptor, stream, nil
+}
+
+// pdfName is the PostScript name reduced to what a PDF name may hold
+// unescaped.
+func (f *trueTypeFont) pdfName() string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || strings.ContainsRune("()<>[]{}/%#", r) {
+			return -1
+		}
+		return r
+	}, f.name)
+}
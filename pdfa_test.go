@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// testTrueType builds the smallest TrueType font parseTrueType accepts:
+// glyphs 1-95 for ASCII space to tilde, 1000 units to the em, 'W' 1000
+// wide, 'i' 250 and the rest 500, PostScript name TestSans.
+func testTrueType() []byte {
+	be16 := func(b []byte, vs ...int) []byte {
+		for _, v := range vs {
+			b = binary.BigEndian.AppendUint16(b, uint16(v))
+		}
+		return b
+	}
+	head := make([]byte, 54)
+	binary.BigEndian.PutUint16(head[18:], 1000)
+	be16(head[36:36], -50, -200, 1000, 900)
+
+	hhea := make([]byte, 36)
+	be16(hhea[4:4], 800, -200)
+	binary.BigEndian.PutUint16(hhea[34:], 96)
+
+	var hmtx []byte
+	for gid := 0; gid < 96; gid++ {
+		w := 500
+		switch rune(gid + 0x1f) {
+		case 'W':
+			w = 1000
+		case 'i':
+			w = 250
+		}
+		hmtx = be16(hmtx, w, 0)
+	}
+
+	// format 4: 0x20-0x7e to glyphs 1-95, and the closing 0xffff segment
+	sub := be16(nil, 4, 32, 0, 4, 4, 1, 0)
+	sub = be16(sub, 0x7e, 0xffff, 0, 0x20, 0xffff, 1-0x20, 1, 0, 0)
+	cmap := be16(nil, 0, 1, 3, 1)
+	cmap = binary.BigEndian.AppendUint32(cmap, 12)
+	cmap = append(cmap, sub...)
+
+	ps := utf16.Encode([]rune("TestSans"))
+	name := be16(nil, 0, 1, 18, 3, 1, 0x409, 6, 2*len(ps), 0)
+	for _, u := range ps {
+		name = be16(name, int(u))
+	}
+
+	tables := map[string][]byte{"head": head, "hhea": hhea, "hmtx": hmtx, "cmap": cmap, "glyf": {0, 0, 0, 0}, "name": name}
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	font := be16([]byte{0, 1, 0, 0}, len(tags), 0, 0, 0)
+	off := len(font) + 16*len(tags)
+	var data []byte
+	for _, tag := range tags {
+		font = append(font, tag...)
+		font = binary.BigEndian.AppendUint32(font, 0) // checksum, unchecked
+		font = binary.BigEndian.AppendUint32(font, uint32(off+len(data)))
+		font = binary.BigEndian.AppendUint32(font, uint32(len(tables[tag])))
+		data = append(data, tables[tag]...)
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+	return append(font, data...)
+}
+
+func TestParseTrueType(t *testing.T) {
+	f, err := parseTrueType(testTrueType())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.name != "TestSans" {
+		t.Errorf("name = %q", f.name)
+	}
+	if f.widths['W'] != 1000 || f.widths['i'] != 250 || f.widths['a'] != 500 {
+		t.Errorf("widths W, i, a = %d, %d, %d; want 1000, 250, 500", f.widths['W'], f.widths['i'], f.widths['a'])
+	}
+	if got := f.cover("§ 1 “x”"); got != "? 1 ?x?" {
+		t.Errorf("cover = %q, want the characters without glyphs as ?", got)
+	}
+	if got := f.measure("Wi"); got != 12.5 {
+		t.Errorf("measure(Wi) = %g points, want 12.5", got)
+	}
+
+	if _, err := parseTrueType(append([]byte("OTTO"), testTrueType()[4:]...)); err == nil {
+		t.Error("CFF OpenType font accepted")
+	}
+}
+
+func TestPDFA(t *testing.T) {
+	font, err := parseTrueType(testTrueType())
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := pdfMeta{
+		Title:        "40 CFR Part 60 as of 2024-01-02",
+		SourceURL:    "https://www.ecfr.gov/api/versioner/v1/full/2024-01-02/title-40.xml?part=60",
+		SourceSHA256: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		SnapshotDate: "2024-01-02",
+		Retrieved:    time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+	var b bytes.Buffer
+	text := strings.Repeat("W", 60) + " " + strings.Repeat("i", 10) + "\n"
+	if err := writePDFA(&b, "40 CFR § 60.4", "footer", strings.NewReader(text), font, meta); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b.Bytes(), []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")) {
+		t.Error("no PDF 1.7 header with binary marker")
+	}
+	objs := checkPDF(t, b.Bytes())
+	n := len(objs)
+	if !strings.Contains(objs[1], "/Metadata 8 0 R") || n != 8 {
+		t.Fatalf("catalog %s with %d objects, want metadata as object 8", objs[1], n)
+	}
+	if !strings.Contains(objs[3], "/Subtype /TrueType /BaseFont /TestSans") || !strings.Contains(objs[3], "/FontDescriptor 6 0 R") {
+		t.Errorf("font dictionary %s", objs[3])
+	}
+	if !strings.Contains(objs[5], "/CS0 cs 0 sc\n") {
+		t.Error("text is not drawn in the calibrated colour space")
+	}
+	// 60 W's are 600 points, wider than the 504 point text width, so the
+	// i's go on a line of their own.
+	if !strings.Contains(objs[5], "("+strings.Repeat("W", 60)+") Tj") || !strings.Contains(objs[5], "("+strings.Repeat("i", 10)+") Tj") {
+		t.Error("text not wrapped by the font's widths")
+	}
+	if !strings.Contains(objs[5], "(40 CFR ? 60.4) Tj") {
+		t.Error("header characters without a glyph not replaced")
+	}
+
+	program := regexp.MustCompile(`(?s)^<< /Length (\d+) /Length1 (\d+) /Filter /FlateDecode >>\nstream\n(.*)\nendstream$`).FindStringSubmatch(objs[7])
+	if program == nil {
+		t.Fatalf("font program object %.80q", objs[7])
+	}
+	zr, err := zlib.NewReader(strings.NewReader(program[3]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	embedded, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(embedded, testTrueType()) {
+		t.Error("embedded font program differs from the font")
+	}
+
+	for _, want := range []string{"<pdfaid:part>2</pdfaid:part>", "<pdfaid:conformance>B</pdfaid:conformance>", "<efcr:snapshotDate>2024-01-02</efcr:snapshotDate>", "<xmp:CreateDate>2024-03-01T12:00:00Z</xmp:CreateDate>"} {
+		if !strings.Contains(objs[8], want) {
+			t.Errorf("XMP metadata has no %s", want)
+		}
+	}
+	if !regexp.MustCompile(`/ID \[<[0-9a-f]{32}> <[0-9a-f]{32}>\]`).Match(b.Bytes()) {
+		t.Error("trailer has no file identifier")
+	}
+}
@@ -0,0 +1,74 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+)
+
+// Limiter is a counting semaphore whose size can change while it is in
+// use. Shrinking it doesn't interrupt holders; new acquirers just wait
+// until enough of them have released.
+type Limiter struct {
+	mu      sync.Mutex
+	limit   int
+	active  int
+	waiting int
+	wake    chan struct{} // closed and replaced whenever a slot may be free
+}
+
+// NewLimiter returns a Limiter of n slots, at least one.
+func NewLimiter(n int) *Limiter {
+	return &Limiter{limit: max(n, 1), wake: make(chan struct{})}
+}
+
+// Acquire waits for a slot, or until ctx is done.
+func (l *Limiter) Acquire(ctx context.Context) error {
+	l.mu.Lock()
+	for l.active >= l.limit {
+		wake := l.wake
+		l.waiting++
+		l.mu.Unlock()
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			l.mu.Lock()
+			l.waiting--
+			l.mu.Unlock()
+			return ctx.Err()
+		}
+		l.mu.Lock()
+		l.waiting--
+	}
+	l.active++
+	l.mu.Unlock()
+	return nil
+}
+
+// Release frees a slot taken with Acquire.
+func (l *Limiter) Release() {
+	l.mu.Lock()
+	l.active--
+	l.signal()
+	l.mu.Unlock()
+}
+
+// signal wakes every waiter to recheck. Callers hold l.mu.
+func (l *Limiter) signal() {
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+// SetLimit resizes the Limiter to n slots, at least one.
+func (l *Limiter) SetLimit(n int) {
+	l.mu.Lock()
+	l.limit = max(n, 1)
+	l.signal()
+	l.mu.Unlock()
+}
+
+// State returns the limit and how many callers are waiting for a slot.
+func (l *Limiter) State() (limit, waiting int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit, l.waiting
+}
@@ -0,0 +1,701 @@
+// Package pipeline crawls the eCFR: it fetches every substantive snapshot
+// of every title through an ecfr.Client, counts its words and hands the
+// parsed document to registered callbacks and cacheable analyzers.
+//
+//	p := pipeline.New(ecfr.NewClient(http.DefaultClient))
+//	p.Titles = map[int]bool{6: true}
+//	p.OnDocument(func(meta pipeline.DocMeta, doc *core.ECFRFile) error {
+//		fmt.Println(meta.Title, meta.Date, len(doc.Root().Sections()))
+//		return nil
+//	})
+//	results, err := p.Run(ctx)
+//
+// The pipeline does no caching or rate limiting of its own; give it a
+// client whose Doer does. Its optional collaborators (Results, Checkpoint,
+// Tuner, Progress, Metrics) are interfaces, which the efcr command
+// implements on disk and for its displays.
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultWorkers is the Window and Workers of a Pipeline that sets neither.
+const DefaultWorkers = 6
+
+// ContentHashHeader carries the SHA-256 of a response's content, as set by
+// efcr's response cache. Snapshots fetched without it are never looked up
+// in, or stored to, Results.
+const ContentHashHeader = "X-Efcr-Content-Sha256"
+
+// DocMeta identifies the snapshot a DocumentFunc is being called for.
+type DocMeta struct {
+	Title     int
+	TitleName string
+	Part      string // set when the crawl is restricted to parts
+	Date      string
+	URL       string
+}
+
+// DocumentFunc receives every parsed snapshot the pipeline fetches. A
+// returned error is recorded against the snapshot's title like a fetch error.
+type DocumentFunc func(meta DocMeta, doc *core.ECFRFile) error
+
+// TitleResult is the pipeline's per-title outcome.
+type TitleResult struct {
+	Title ecfr.Title
+	Words int64            // summed over every snapshot date
+	Dates map[string]int64 // words per snapshot date
+	// Planned counts the snapshots within Since and Until, Dates having
+	// only a sample of them when the Pipeline samples.
+	Planned int
+	Errs    []error
+}
+
+// Analyzer is a per-document analysis whose result can be cached. Compute
+// runs on the parsed document; Apply receives the JSON of the result, fresh
+// or from Results, and must be the analyzer's only side effect.
+//
+// Documents past Pipeline.SpillBytes are computed a part at a time and the
+// results merged with mergeResults, so a result has to add up over parts:
+// counts and sums, maps of them, lists of per-section values.
+type Analyzer struct {
+	Name     string // identity in the cache key
+	Settings string // every option that changes Compute's output
+	Compute  func(meta DocMeta, doc *core.ECFRFile) (any, error)
+	Apply    func(meta DocMeta, result json.RawMessage) error
+}
+
+// ResultStore keeps analyzer results by the content hash of the document
+// they were computed on, the analyzer and its settings. Put may drop
+// results; a miss only costs a recompute.
+type ResultStore interface {
+	Get(contentHash, analyzer, settings string) (json.RawMessage, bool)
+	Put(contentHash, analyzer, settings string, result json.RawMessage)
+}
+
+// Snapshot records one finished (title, date) snapshot, or one part of it
+// when the crawl was restricted to parts.
+type Snapshot struct {
+	Title  int    `json:"title"`
+	Part   string `json:"part,omitempty"`
+	Date   string `json:"date"`
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+	Words  int64  `json:"words"`
+	// Excluded lists the table parts left out of Words, comma separated, so
+	// a count made under other table settings isn't reused.
+	Excluded string `json:"excluded,omitempty"`
+}
+
+// Journal remembers finished snapshots so that a rerun can skip them.
+type Journal interface {
+	// Lookup returns the snapshot's record, if it was finished and still
+	// holds; ctx bounds any checking it does.
+	Lookup(ctx context.Context, title int, part, date string) (Snapshot, bool)
+	Record(Snapshot) error
+	// Resumed counts a snapshot skipped thanks to Lookup.
+	Resumed()
+}
+
+// Tuner adjusts the number of fetch and parse workers while a crawl runs.
+type Tuner interface {
+	// Tune runs until ctx is done, resizing fetch and parse.
+	Tune(ctx context.Context, fetch, parse *Limiter)
+	// Finished counts one processed snapshot towards throughput.
+	Finished()
+}
+
+// Progress receives a crawl's progress as it goes, for a live display. Its
+// methods are called from several goroutines at once.
+type Progress interface {
+	Start(titles int)
+	// Planned reports the snapshots of a title once they are listed.
+	Planned(snapshots int)
+	SnapshotStarted()
+	SnapshotDone()
+	TitleDone()
+}
+
+// Recorder counts the titles a pipeline processes, e.g. for /metrics.
+type Recorder interface {
+	TitleDone(failed bool)
+}
+
+// Pipeline fetches every substantive snapshot of every title, counts its
+// words and hands the parsed document to any registered callbacks.
+type Pipeline struct {
+	API     *ecfr.Client
+	Results ResultStore // optional; skips recomputing cached analyses
+	// Logger, when set, gets a line per planned title and per failure.
+	Logger *slog.Logger
+	// Window bounds how many titles are in flight or waiting on the
+	// consumer; zero means DefaultWorkers.
+	Window int
+	// Workers bounds how many snapshots are fetched and analyzed at once,
+	// across all titles; zero means DefaultWorkers.
+	Workers int
+	// Tuner, when set, adjusts the number of fetch and parse workers while
+	// the crawl runs, starting from Workers.
+	Tuner Tuner
+	// Ordered delivers title results in title order instead of completion
+	// order.
+	Ordered bool
+	// TableParts lists, per title, parts whose words are left out of the
+	// word count.
+	TableParts map[int][]string
+	// Checkpoint, when set, skips snapshots a previous run finished and
+	// records each one this run finishes.
+	Checkpoint Journal
+	// Titles, when non-empty, restricts the crawl to these title numbers.
+	Titles map[int]bool
+	// Parts restricts every title's versions and documents to these parts;
+	// titles containing none of them contribute nothing.
+	Parts []string
+	// Since and Until bound snapshot dates, inclusive (YYYY-MM-DD). Empty
+	// means unbounded.
+	Since, Until string
+	// OnVersions, when set, receives each title's versions as listed for
+	// planning, once per part when the crawl is restricted to parts. It is
+	// called from several goroutines at once.
+	OnVersions func(title int, versions []ecfr.Version)
+	// SpillBytes, when positive, caps the size of document parsed as one
+	// tree. Bigger ones are spilled to a temp file and analyzed a part at a
+	// time (unless OnDocument hooks need the whole tree).
+	SpillBytes int64
+	// FailFast stops the crawl at the first title that fails, and Run
+	// returns that title's error instead of carrying on without it.
+	FailFast bool
+	// Metrics, when set, counts the titles processed.
+	Metrics Recorder
+	// Progress, when set, counts titles and snapshots as they go.
+	Progress Progress
+	// Sample, when positive, crawls only that fraction of each title's
+	// snapshots (see SampleItems), chosen with Seed, for estimates.
+	Sample float64
+	Seed   int64
+
+	hooks     []DocumentFunc
+	analyzers []Analyzer
+	parse     *Limiter // bounds snapshots being parsed and analyzed
+
+	// The optional collaborators, or stand-ins doing nothing; see setup.
+	log      *slog.Logger
+	results  ResultStore
+	journal  Journal
+	tuner    Tuner
+	progress Progress
+
+	failOnce sync.Once
+	failErr  error // the error that stopped a FailFast crawl
+}
+
+// New returns a Pipeline crawling through api.
+func New(api *ecfr.Client) *Pipeline {
+	return &Pipeline{API: api}
+}
+
+// nop stands in for the collaborators a Pipeline wasn't given.
+type nop struct{}
+
+func (nop) Get(string, string, string) (json.RawMessage, bool)           { return nil, false }
+func (nop) Put(string, string, string, json.RawMessage)                  {}
+func (nop) Lookup(context.Context, int, string, string) (Snapshot, bool) { return Snapshot{}, false }
+func (nop) Record(Snapshot) error                                        { return nil }
+func (nop) Resumed()                                                     {}
+func (nop) Tune(context.Context, *Limiter, *Limiter)                     {}
+func (nop) Finished()                                                    {}
+func (nop) Start(int)                                                    {}
+func (nop) Planned(int)                                                  {}
+func (nop) SnapshotStarted()                                             {}
+func (nop) SnapshotDone()                                                {}
+func (nop) TitleDone()                                                   {}
+
+// setup fills in the collaborators for a run, so the crawl can call them
+// unconditionally.
+func (p *Pipeline) setup() {
+	p.log, p.results, p.journal, p.tuner, p.progress = p.Logger, p.Results, p.Checkpoint, p.Tuner, p.Progress
+	if p.log == nil {
+		p.log = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	if p.results == nil {
+		p.results = nop{}
+	}
+	if p.journal == nil {
+		p.journal = nop{}
+	}
+	if p.tuner == nil {
+		p.tuner = nop{}
+	}
+	if p.progress == nil {
+		p.progress = nop{}
+	}
+}
+
+// OnDocument registers fn to run for each snapshot. Documents are only
+// parsed into a tree when at least one callback is registered.
+func (p *Pipeline) OnDocument(fn DocumentFunc) {
+	p.hooks = append(p.hooks, fn)
+}
+
+// AddAnalyzer registers a cacheable analysis. When the word count and every
+// analyzer are cached for a snapshot (and no plain OnDocument hooks are
+// registered) the document is not parsed at all.
+func (p *Pipeline) AddAnalyzer(a Analyzer) {
+	p.analyzers = append(p.analyzers, a)
+}
+
+// Run crawls all titles and returns one result per title, in completion
+// order unless Ordered is set.
+func (p *Pipeline) Run(ctx context.Context) ([]TitleResult, error) {
+	results, err := p.Stream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []TitleResult
+	for r := range results {
+		out = append(out, r)
+	}
+	if p.failErr != nil {
+		return out, p.failErr
+	}
+	return out, ctx.Err()
+}
+
+// Stream crawls all titles and sends one result per title on the returned
+// channel, which is closed once every title is done or ctx is cancelled.
+//
+// At most Window titles are in flight or waiting for the consumer, so a slow
+// consumer (say, one writing to a remote sink) slows the crawl down rather
+// than letting results pile up in memory. Producers never block on the
+// consumer themselves; only the merge stage does, and it gives up when ctx
+// is done. With Ordered set results arrive in the titles endpoint's order,
+// otherwise as they complete.
+//
+// Snapshots of every in-flight title share one pool of Workers, so the
+// number of concurrent requests stays bounded however many dates a title
+// has. On cancellation the channel is only closed once every worker has
+// returned, so nothing the pipeline started outlives it. With FailFast set,
+// the first failed title cancels the rest the same way.
+func (p *Pipeline) Stream(ctx context.Context) (<-chan TitleResult, error) {
+	p.setup()
+	// 1. Fetch all titles
+	all, err := p.API.Titles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetch titles: %w", err)
+	}
+	var titles []ecfr.Title
+	for _, t := range all {
+		if len(p.Titles) == 0 || p.Titles[t.Number] {
+			titles = append(titles, t)
+		}
+	}
+	window := p.Window
+	if window <= 0 {
+		window = DefaultWorkers
+	}
+	workers := p.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	stop := context.CancelCauseFunc(func(error) {})
+	if p.FailFast {
+		ctx, stop = context.WithCancelCause(ctx)
+	}
+	p.progress.Start(len(titles))
+	fetch := NewLimiter(workers)
+	p.parse = NewLimiter(workers)
+	go p.tuner.Tune(ctx, fetch, p.parse)
+
+	type indexed struct {
+		i int
+		r TitleResult
+	}
+	// 2. Concurrently fetch versions per title, window titles at a time.
+	// done has room for every title so a finished producer never waits.
+	slots := make(chan struct{}, window)
+	done := make(chan indexed, len(titles))
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		var inflight errgroup.Group
+		defer inflight.Wait()
+		for i, t := range titles {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			inflight.Go(func() error {
+				r := p.runTitle(ctx, t, fetch)
+				if p.Metrics != nil {
+					p.Metrics.TitleDone(len(r.Errs) > 0)
+				}
+				p.progress.TitleDone()
+				if p.FailFast && len(r.Errs) > 0 {
+					p.failOnce.Do(func() {
+						p.failErr = fmt.Errorf("title %d, %s: %w", t.Number, t.Name, errors.Join(r.Errs...))
+						stop(p.failErr)
+					})
+				}
+				done <- indexed{i, r}
+				return nil
+			})
+		}
+	}()
+
+	// 3. Merge. In ordered mode results wait in pending until every earlier
+	// title has been sent; titles are dispatched in order, so the one being
+	// waited on always holds a slot and can't be starved.
+	out := make(chan TitleResult)
+	go func() {
+		defer func() {
+			<-finished
+			stop(nil)
+			close(out)
+		}()
+		pending := map[int]TitleResult{}
+		next := 0
+		for sent := 0; sent < len(titles); {
+			var got indexed
+			select {
+			case got = <-done:
+			case <-ctx.Done():
+				return
+			}
+			if !p.Ordered {
+				got.i = next
+			}
+			pending[got.i] = got.r
+			for {
+				r, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				select {
+				case out <- r:
+				case <-ctx.Done():
+					return
+				}
+				<-slots
+				next++
+				sent++
+			}
+		}
+	}()
+	return out, nil
+}
+
+// runTitle processes every snapshot of a title, each holding a slot of
+// fetch, and sums them.
+func (p *Pipeline) runTitle(ctx context.Context, title ecfr.Title, fetch *Limiter) TitleResult {
+	res := TitleResult{Title: title}
+	dates, err := p.snapshots(ctx, title.Number)
+	if err != nil {
+		res.Errs = []error{err}
+		return res
+	}
+	res.Planned = len(dates)
+	if p.Sample > 0 {
+		sampled := map[string][]string{}
+		all := make([]string, 0, len(dates))
+		for d := range dates {
+			all = append(all, d)
+		}
+		for _, d := range SampleItems(all, p.Sample, p.Seed, title.Number) {
+			sampled[d] = dates[d]
+		}
+		dates = sampled
+	}
+	p.progress.Planned(len(dates))
+	p.log.Info("planned title", "title", title.Number, "name", title.Name, "dates", len(dates))
+
+	type dateResult struct {
+		date  string
+		count int64
+		err   error
+	}
+	dateresults := make(chan dateResult, len(dates))
+	queued := 0
+	for d, parts := range dates {
+		if err := fetch.Acquire(ctx); err != nil {
+			res.Errs = append(res.Errs, err)
+			break
+		}
+		queued++
+		go func() {
+			defer fetch.Release()
+			p.progress.SnapshotStarted()
+			defer p.progress.SnapshotDone()
+			var total int64
+			for _, part := range parts {
+				n, err := p.runDate(ctx, title, part, d)
+				if err != nil {
+					dateresults <- dateResult{d, 0, err}
+					return
+				}
+				total += n
+			}
+			dateresults <- dateResult{d, total, nil}
+		}()
+	}
+	res.Dates = make(map[string]int64, queued)
+	for range queued {
+		r := <-dateresults
+		if r.err != nil {
+			res.Errs = append(res.Errs, r.err)
+			continue
+		}
+		res.Words += r.count
+		res.Dates[r.date] = r.count
+	}
+	return res
+}
+
+// snapshots lists the dates with substantive changes to a title within
+// Since and Until, each with the scopes to fetch on it: the whole title
+// (""), or every part in Parts that exists by then.
+func (p *Pipeline) snapshots(ctx context.Context, title int) (map[string][]string, error) {
+	scopes := p.Parts
+	if len(scopes) == 0 {
+		scopes = []string{""}
+	}
+	first := map[string]string{} // scope -> earliest version date
+	changed := map[string]bool{}
+	for _, part := range scopes {
+		versions, err := p.API.Versions(ctx, title, ecfr.Hierarchy{Part: part})
+		var status *ecfr.StatusError
+		if part != "" && errors.As(err, &status) && status.Code == http.StatusNotFound {
+			continue // not a part of this title
+		}
+		if err != nil {
+			return nil, err
+		}
+		if p.OnVersions != nil {
+			p.OnVersions(title, versions)
+		}
+		for _, v := range versions {
+			if f, ok := first[part]; !ok || v.Date < f {
+				first[part] = v.Date
+			}
+			if v.Substantive && !v.Removed && (p.Since == "" || v.Date >= p.Since) && (p.Until == "" || v.Date <= p.Until) {
+				changed[v.Date] = true
+			}
+		}
+	}
+	dates := map[string][]string{}
+	for d := range changed {
+		for _, part := range scopes {
+			if f, ok := first[part]; ok && f <= d {
+				dates[d] = append(dates[d], part)
+			}
+		}
+	}
+	return dates, nil
+}
+
+// wordsAnalyzer names the built-in word count in the result cache.
+const wordsAnalyzer = "words"
+
+// runDate counts the words of one snapshot (or one part of it) and, if
+// there are callbacks, parses it from the same stream so the body is only
+// fetched once.
+func (p *Pipeline) runDate(ctx context.Context, title ecfr.Title, part, date string) (int64, error) {
+	furl := p.API.FullURL(title.Number, date, ecfr.Hierarchy{Part: part})
+	meta := DocMeta{Title: title.Number, TitleName: title.Name, Part: part, Date: date, URL: furl}
+	excluded := strings.Join(p.TableParts[title.Number], ",")
+	if e, ok := p.journal.Lookup(ctx, title.Number, part, date); ok {
+		// Finished last run. A bare word count needs nothing more; otherwise
+		// analyzers still have to be applied, which the result cache can do
+		// without opening the body.
+		if len(p.hooks) == 0 && len(p.analyzers) == 0 && e.Excluded == excluded {
+			p.journal.Resumed()
+			return e.Words, nil
+		}
+		n, ok, err := p.fromCache(meta, e.SHA256)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			p.journal.Resumed()
+			return n, nil
+		}
+	}
+
+	n, hash, err := p.processDate(ctx, meta)
+	if err != nil {
+		return 0, err
+	}
+	p.tuner.Finished()
+	if err := p.journal.Record(Snapshot{Title: title.Number, Part: part, Date: date, URL: furl, SHA256: hash, Words: n, Excluded: excluded}); err != nil {
+		p.log.Warn("checkpoint: not recorded", "title", title.Number, "date", date, "part", part, "err", err)
+	}
+	return n, nil
+}
+
+// processDate fetches and analyzes one snapshot, returning its word count
+// and content hash.
+func (p *Pipeline) processDate(ctx context.Context, meta DocMeta) (int64, string, error) {
+	furl := meta.URL
+	resp, err := p.API.Full(ctx, meta.Title, meta.Date, ecfr.Hierarchy{Part: meta.Part})
+	if err != nil {
+		p.log.Warn("fetch failed", "title", meta.Title, "date", meta.Date, "url", furl, "err", err)
+		return 0, "", err
+	}
+	body := resp.Body
+	defer body.Close()
+	hash := resp.Header.Get(ContentHashHeader)
+
+	if n, ok, err := p.fromCache(meta, hash); err != nil || ok {
+		return n, hash, err
+	}
+
+	// The body streams into the parser, so past here the snapshot is
+	// mostly CPU work and holds a parse worker too.
+	if err := p.parse.Acquire(ctx); err != nil {
+		return 0, "", err
+	}
+	defer p.parse.Release()
+
+	excluded := p.TableParts[meta.Title]
+	if len(p.hooks) == 0 && len(p.analyzers) == 0 && len(excluded) == 0 {
+		n, err := core.CountXMLWords(body)
+		if err != nil {
+			return 0, "", err
+		}
+		p.store(hash, wordsAnalyzer, "", json.RawMessage(strconv.FormatInt(n, 10)))
+		return n, hash, nil
+	}
+
+	var words int64
+	var byPart map[string]int64
+	var results []json.RawMessage
+	if p.SpillBytes > 0 && len(p.hooks) == 0 {
+		words, byPart, results, err = p.analyzeSpilled(meta, body, excluded)
+	} else {
+		words, byPart, results, err = p.analyzeStream(meta, body, excluded)
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	for _, part := range excluded {
+		words -= byPart[part]
+	}
+	p.store(hash, wordsAnalyzer, strings.Join(excluded, ","), json.RawMessage(strconv.FormatInt(words, 10)))
+	for i, a := range p.analyzers {
+		p.store(hash, a.Name, a.Settings, results[i])
+		if err := a.Apply(meta, results[i]); err != nil {
+			return 0, "", fmt.Errorf("%d %s: %s: %w", meta.Title, meta.Date, a.Name, err)
+		}
+	}
+	return words, hash, nil
+}
+
+// analyzeStream parses the body as it is read, counting its words from the
+// same stream so it is only fetched once, and runs the hooks and analyzers
+// on the tree.
+func (p *Pipeline) analyzeStream(meta DocMeta, body io.Reader, excluded []string) (int64, map[string]int64, []json.RawMessage, error) {
+	pr, pw := io.Pipe()
+	type wc struct {
+		n   int64
+		err error
+	}
+	counted := make(chan wc)
+	go func() {
+		n, err := core.CountXMLWords(pr)
+		pr.CloseWithError(err) // a counter that gave up mustn't block the tee
+		counted <- wc{n, err}
+	}()
+	tee := io.TeeReader(body, pw)
+	doc, err := core.ParseFile(tee)
+	if err == nil {
+		_, err = io.Copy(io.Discard, tee)
+	}
+	pw.CloseWithError(err)
+	words := <-counted
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("parse %s: %w", meta.URL, err)
+	}
+	if words.err != nil {
+		return 0, nil, nil, words.err
+	}
+	var byPart map[string]int64
+	if len(excluded) > 0 {
+		byPart = core.PartWords(doc.Root())
+	}
+	for _, fn := range p.hooks {
+		if err := fn(meta, doc); err != nil {
+			return 0, nil, nil, fmt.Errorf("%d %s: %w", meta.Title, meta.Date, err)
+		}
+	}
+	results, err := p.compute(meta, doc)
+	return words.n, byPart, results, err
+}
+
+// compute runs every analyzer on doc and returns their results as JSON.
+func (p *Pipeline) compute(meta DocMeta, doc *core.ECFRFile) ([]json.RawMessage, error) {
+	results := make([]json.RawMessage, len(p.analyzers))
+	for i, a := range p.analyzers {
+		res, err := a.Compute(meta, doc)
+		if err != nil {
+			return nil, fmt.Errorf("%d %s: %s: %w", meta.Title, meta.Date, a.Name, err)
+		}
+		if results[i], err = json.Marshal(res); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// fromCache applies every analyzer from the result cache and returns the
+// cached word count, but only if all of them are present and no uncached
+// hooks need the document.
+func (p *Pipeline) fromCache(meta DocMeta, hash string) (int64, bool, error) {
+	if len(p.hooks) > 0 || hash == "" {
+		return 0, false, nil
+	}
+	raw, ok := p.results.Get(hash, wordsAnalyzer, strings.Join(p.TableParts[meta.Title], ","))
+	if !ok {
+		return 0, false, nil
+	}
+	n, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return 0, false, nil
+	}
+	results := make([]json.RawMessage, len(p.analyzers))
+	for i, a := range p.analyzers {
+		if results[i], ok = p.results.Get(hash, a.Name, a.Settings); !ok {
+			return 0, false, nil
+		}
+	}
+	// Past this point results are being applied, so a failure can't fall
+	// back to recomputing without double counting.
+	for i, a := range p.analyzers {
+		if err := a.Apply(meta, results[i]); err != nil {
+			return 0, false, fmt.Errorf("%d %s: cached %s: %w", meta.Title, meta.Date, a.Name, err)
+		}
+	}
+	return n, true, nil
+}
+
+// store puts a result in Results, unless the content it was computed on is
+// unknown.
+func (p *Pipeline) store(hash, analyzer, settings string, result json.RawMessage) {
+	if hash != "" {
+		p.results.Put(hash, analyzer, settings, result)
+	}
+}
@@ -0,0 +1,26 @@
+package pipeline
+
+import (
+	"math"
+	"math/rand/v2"
+	"sort"
+)
+
+// MinSample is the fewest items an estimate samples, however small the
+// fraction, so its interval means something.
+const MinSample = 5
+
+// SampleItems picks fraction of items, at least MinSample of them, at
+// random but reproducibly for a seed and key. The result is sorted.
+func SampleItems(items []string, fraction float64, seed int64, key int) []string {
+	sorted := append([]string(nil), items...)
+	sort.Strings(sorted)
+	n := min(len(sorted), max(MinSample, int(math.Ceil(fraction*float64(len(sorted))))))
+	rng := rand.New(rand.NewPCG(uint64(seed), uint64(key)))
+	var out []string
+	for _, i := range rng.Perm(len(sorted))[:n] {
+		out = append(out, sorted[i])
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,157 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/paulgmiller/efcr/core"
+)
+
+// spillBuffer holds a document body in memory up to limit bytes and moves
+// it to a temp file once it grows past that.
+type spillBuffer struct {
+	limit int64
+	buf   bytes.Buffer
+	f     *os.File
+	size  int64
+}
+
+func (s *spillBuffer) Write(b []byte) (int, error) {
+	if s.f == nil && s.size+int64(len(b)) > s.limit {
+		f, err := os.CreateTemp("", "efcr-spill-*.xml")
+		if err != nil {
+			return 0, err
+		}
+		s.f = f
+		if _, err := f.Write(s.buf.Bytes()); err != nil {
+			return 0, err
+		}
+		s.buf = bytes.Buffer{}
+	}
+	s.size += int64(len(b))
+	if s.f != nil {
+		return s.f.Write(b)
+	}
+	return s.buf.Write(b)
+}
+
+// Close removes the temp file, if any.
+func (s *spillBuffer) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	s.f.Close()
+	return os.Remove(s.f.Name())
+}
+
+// analyzeSpilled is processDate's path when SpillBytes is set: the body is
+// buffered while its words are counted from the stream, and if it turned
+// out bigger than SpillBytes the analyzers run over it one part at a time
+// from disk (see core.SplitParts) and their results are merged. Peak memory
+// is then one part's tree rather than the whole title's.
+//
+// It returns the word count, the words per part when excluded parts need
+// subtracting, and the marshalled result of every analyzer.
+func (p *Pipeline) analyzeSpilled(meta DocMeta, body io.Reader, excluded []string) (int64, map[string]int64, []json.RawMessage, error) {
+	spill := &spillBuffer{limit: p.SpillBytes}
+	defer spill.Close()
+	pr, pw := io.Pipe()
+	type wc struct {
+		n   int64
+		err error
+	}
+	counted := make(chan wc)
+	go func() {
+		n, err := core.CountXMLWords(pr)
+		pr.CloseWithError(err) // a counter that gave up mustn't block the copy
+		counted <- wc{n, err}
+	}()
+	_, err := io.Copy(io.MultiWriter(spill, pw), body)
+	pw.CloseWithError(err)
+	words := <-counted
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("read %s: %w", meta.URL, err)
+	}
+	if words.err != nil {
+		return 0, nil, nil, fmt.Errorf("parse %s: %w", meta.URL, words.err)
+	}
+
+	if spill.f == nil {
+		doc, err := core.ParseFile(&spill.buf)
+		if err != nil {
+			return 0, nil, nil, fmt.Errorf("parse %s: %w", meta.URL, err)
+		}
+		var byPart map[string]int64
+		if len(excluded) > 0 {
+			byPart = core.PartWords(doc.Root())
+		}
+		results, err := p.compute(meta, doc)
+		return words.n, byPart, results, err
+	}
+
+	p.log.Info("large document, analyzing a part at a time", "title", meta.Title, "date", meta.Date,
+		"bytes", spill.size, "spill", spill.f.Name())
+	byPart := map[string]int64{}
+	merged := make([]any, len(p.analyzers))
+	err = core.SplitParts(spill.f, spill.size, func(part string, r io.Reader) error {
+		doc, err := core.ParseFile(r)
+		if err != nil {
+			return fmt.Errorf("parse %s part %q: %w", meta.URL, part, err)
+		}
+		if len(excluded) > 0 {
+			for k, n := range core.PartWords(doc.Root()) {
+				byPart[k] += n
+			}
+		}
+		results, err := p.compute(meta, doc)
+		if err != nil {
+			return err
+		}
+		for i, raw := range results {
+			var v any
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return err
+			}
+			merged[i] = mergeResults(merged[i], v)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	results := make([]json.RawMessage, len(merged))
+	for i, v := range merged {
+		if results[i], err = json.Marshal(v); err != nil {
+			return 0, nil, nil, err
+		}
+	}
+	return words.n, byPart, results, nil
+}
+
+// mergeResults combines an analyzer's results over two pieces of one
+// document: numbers add up, objects merge key by key and arrays
+// concatenate. That covers every built-in analyzer; see Analyzer.
+func mergeResults(a, b any) any {
+	switch a := a.(type) {
+	case nil:
+		return b
+	case float64:
+		if b, ok := b.(float64); ok {
+			return a + b
+		}
+	case map[string]any:
+		if b, ok := b.(map[string]any); ok {
+			for k, v := range b {
+				a[k] = mergeResults(a[k], v)
+			}
+		}
+	case []any:
+		if b, ok := b.([]any); ok {
+			return append(a, b...)
+		}
+	}
+	return a
+}
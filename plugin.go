@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/pipeline"
+)
+
+// Plugins are external analyzers spoken to over a line-oriented JSON
+// protocol, so they can be written in any language. The process is started
+// once per run; for every section we write one PluginRequest line to its
+// stdin and read exactly one PluginResponse line from its stdout:
+//
+//	→ {"title":6,"date":"2024-01-01","section":"11.4","heading":"§ 11.4 …","text":"…"}
+//	← {"metrics":{"sentences":12,"grade_level":14.2}}
+//	← {"error":"could not parse"}
+//
+// Metrics are summed per title and appear as extra report columns. Anything
+// the plugin writes to stderr is passed through.
+type PluginRequest struct {
+	Title   int    `json:"title"`
+	Date    string `json:"date"`
+	Section string `json:"section"`
+	Heading string `json:"heading"`
+	Text    string `json:"text"`
+}
+
+type PluginResponse struct {
+	Metrics map[string]float64 `json:"metrics"`
+	Error   string             `json:"error,omitempty"`
+}
+
+type Plugin struct {
+	Command string
+
+	mu  sync.Mutex
+	cmd *exec.Cmd
+	in  io.WriteCloser
+	enc *json.Encoder
+	out *bufio.Scanner
+}
+
+// StartPlugin launches command (split on whitespace) and returns once the
+// pipes are connected.
+func StartPlugin(ctx context.Context, command string) (*Plugin, error) {
+	argv := strings.Fields(command)
+	if len(argv) == 0 {
+		return nil, errors.New("empty plugin command")
+	}
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start plugin %q: %w", command, err)
+	}
+	scanner := bufio.NewScanner(out)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &Plugin{Command: command, cmd: cmd, in: in, enc: json.NewEncoder(in), out: scanner}, nil
+}
+
+// Analyze sends one section and waits for its metrics. Calls are serialized
+// since the protocol is strictly request/response.
+func (p *Plugin) Analyze(req PluginRequest) (map[string]float64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.enc.Encode(req); err != nil {
+		return nil, fmt.Errorf("plugin %q: %w", p.Command, err)
+	}
+	if !p.out.Scan() {
+		if err := p.out.Err(); err != nil {
+			return nil, fmt.Errorf("plugin %q: %w", p.Command, err)
+		}
+		return nil, fmt.Errorf("plugin %q exited", p.Command)
+	}
+	var resp PluginResponse
+	if err := json.Unmarshal(p.out.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("plugin %q: bad response: %w", p.Command, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("plugin %q: %s", p.Command, resp.Error)
+	}
+	return resp.Metrics, nil
+}
+
+// Close ends the plugin's input and waits for it to exit.
+func (p *Plugin) Close() error {
+	p.in.Close()
+	return p.cmd.Wait()
+}
+
+// pluginMetrics sums plugin metrics per title across every snapshot.
+type pluginMetrics struct {
+	mu      sync.Mutex
+	byTitle map[int]map[string]float64
+	names   map[string]bool
+}
+
+// analyzer runs every section of a document through plugins and sums the
+// metrics per document; the plugin command lines are the cache settings.
+func (pm *pluginMetrics) analyzer(plugins []*Plugin, commands []string) pipeline.Analyzer {
+	pm.byTitle = map[int]map[string]float64{}
+	pm.names = map[string]bool{}
+	return pipeline.Analyzer{
+		Name:     "plugin",
+		Settings: strings.Join(commands, "\x00"),
+		Compute: func(meta pipeline.DocMeta, doc *core.ECFRFile) (any, error) {
+			sum := map[string]float64{}
+			var err error
+			core.WalkSections(doc.Root(), func(s *core.Div) {
+				if err != nil {
+					return
+				}
+				req := PluginRequest{Title: meta.Title, Date: meta.Date, Section: s.N, Heading: s.Head, Text: core.ParaText(s)}
+				for _, p := range plugins {
+					var m map[string]float64
+					if m, err = p.Analyze(req); err != nil {
+						return
+					}
+					for k, v := range m {
+						sum[k] += v
+					}
+				}
+			})
+			return sum, err
+		},
+		Apply: func(meta pipeline.DocMeta, result json.RawMessage) error {
+			var m map[string]float64
+			if err := json.Unmarshal(result, &m); err != nil {
+				return err
+			}
+			pm.add(meta.Title, m)
+			return nil
+		},
+	}
+}
+
+func (pm *pluginMetrics) add(title int, m map[string]float64) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.byTitle[title] == nil {
+		pm.byTitle[title] = map[string]float64{}
+	}
+	for k, v := range m {
+		pm.byTitle[title][k] += v
+		pm.names[k] = true
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Progress counts a pipeline's work as it goes, for a live display; it is
+// the crawl's pipeline.Progress. All methods are safe to call concurrently,
+// and on a nil *Progress.
+type Progress struct {
+	titles        atomic.Int64 // to crawl
+	titlesPlanned atomic.Int64 // whose snapshots are known
+	titlesDone    atomic.Int64
+	dates         atomic.Int64 // snapshots planned so far
+	datesDone     atomic.Int64
+	inFlight      atomic.Int64
+}
+
+func (p *Progress) Start(titles int) {
+	if p != nil {
+		p.titles.Store(int64(titles))
+	}
+}
+
+func (p *Progress) Planned(dates int) {
+	if p != nil {
+		p.titlesPlanned.Add(1)
+		p.dates.Add(int64(dates))
+	}
+}
+
+func (p *Progress) SnapshotStarted() {
+	if p != nil {
+		p.inFlight.Add(1)
+	}
+}
+
+func (p *Progress) SnapshotDone() {
+	if p != nil {
+		p.inFlight.Add(-1)
+		p.datesDone.Add(1)
+	}
+}
+
+func (p *Progress) TitleDone() {
+	if p != nil {
+		p.titlesDone.Add(1)
+	}
+}
+
+// progressSnapshot is the display's view of a Progress at one moment.
+type progressSnapshot struct {
+	Titles, TitlesDone     int64
+	Dates, DatesDone       int64
+	InFlight               int64
+	CacheHits, CacheLookup int
+	Percent                float64       // complete, by the same measure as ETA
+	ETA                    time.Duration // 0 while unknown
+}
+
+// snapshot reads the counters. The ETA extrapolates the snapshot rate once
+// every title is planned, and the title rate before that.
+func (p *Progress) snapshot(m *Metrics, elapsed time.Duration) progressSnapshot {
+	s := progressSnapshot{
+		Titles: p.titles.Load(), TitlesDone: p.titlesDone.Load(),
+		Dates: p.dates.Load(), DatesDone: p.datesDone.Load(), InFlight: p.inFlight.Load(),
+	}
+	if m != nil {
+		s.CacheHits, s.CacheLookup = m.cacheCounts()
+	}
+	done, total := s.TitlesDone, s.Titles
+	if p.titlesPlanned.Load() == s.Titles {
+		done, total = s.DatesDone, s.Dates
+	}
+	if total > 0 {
+		s.Percent = 100 * float64(done) / float64(total)
+	}
+	if done > 0 && total > done {
+		s.ETA = time.Duration(float64(elapsed) / float64(done) * float64(total-done)).Round(time.Second)
+	}
+	return s
+}
+
+func (s progressSnapshot) String() string {
+	line := fmt.Sprintf("titles %d/%d  snapshots %d/%d (%d in flight)", s.TitlesDone, s.Titles, s.DatesDone, s.Dates, s.InFlight)
+	if s.CacheLookup > 0 {
+		line += fmt.Sprintf("  cache hits %.0f%%", 100*float64(s.CacheHits)/float64(s.CacheLookup))
+	}
+	if s.ETA > 0 {
+		line += "  ETA " + s.ETA.String()
+	}
+	return line
+}
+
+// Progress display modes for crawl --progress.
+const (
+	progressAuto = "auto" // bar on a terminal, log otherwise
+	progressBar  = "bar"  // a status line redrawn in place on stderr
+	progressLog  = "log"  // a log line every progressLogEvery
+	progressOff  = "off"
+)
+
+const progressLogEvery = 30 * time.Second
+
+// showProgress displays p in mode until ctx is done or the returned stop
+// is called, which clears the status line. m supplies the cache hit rate.
+func showProgress(ctx context.Context, p *Progress, m *Metrics, mode string) (stop func()) {
+	if mode == progressAuto {
+		mode = progressLog
+		if isTerminal(os.Stderr) {
+			mode = progressBar
+		}
+	}
+	if mode == progressOff {
+		return func() {}
+	}
+	every := progressLogEvery
+	if mode == progressBar {
+		every = 250 * time.Millisecond
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	start := time.Now()
+	go func() {
+		defer wg.Done()
+		tick := time.NewTicker(every)
+		defer tick.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick.C:
+			}
+			s := p.snapshot(m, time.Since(start))
+			if mode == progressBar {
+				stderr.setStatus(s.String())
+				continue
+			}
+			slog.Info("progress", "titles", s.TitlesDone, "of", s.Titles, "snapshots", s.DatesDone, "planned", s.Dates,
+				"in_flight", s.InFlight, "cache_hits", s.CacheHits, "cache_lookups", s.CacheLookup, "eta", s.ETA)
+		}
+	}()
+	return func() {
+		cancel()
+		wg.Wait()
+		stderr.setStatus("")
+	}
+}
+
+// isTerminal reports whether f is a terminal that can redraw a line.
+func isTerminal(f *os.File) bool {
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// stderr is where logs go. A progress bar is a status line kept at its
+// foot: each log line clears it, is written, and redraws it below.
+var stderr = &statusWriter{w: os.Stderr}
+
+type statusWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	status string
+}
+
+func (s *statusWriter) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status == "" {
+		return s.w.Write(b)
+	}
+	io.WriteString(s.w, "\r\033[K")
+	n, err := s.w.Write(b)
+	io.WriteString(s.w, s.status)
+	return n, err
+}
+
+// setStatus replaces the status line; "" removes it.
+func (s *statusWriter) setStatus(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status != "" || line != "" {
+		io.WriteString(s.w, "\r\033[K"+line)
+	}
+	s.status = line
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProgressEvent is one line of -progress-events: a machine-readable account
+// of how far a command has got, for wrappers and UIs that drive efcr.
+type ProgressEvent struct {
+	Time    string  `json:"time"` // RFC 3339, UTC
+	Command string  `json:"command"`
+	Event   string  `json:"event"`           // start, stage, progress or finish
+	Stage   string  `json:"stage,omitempty"` // stage and progress events
+	Done    int64   `json:"done"`            // progress: units finished
+	Total   int64   `json:"total"`           // progress: units known so far
+	Unit    string  `json:"unit,omitempty"`  // progress: titles or snapshots
+	Percent float64 `json:"percent"`         // progress: of the stage; finish: 100
+	// ETASeconds estimates the time left in the stage, 0 while unknown.
+	ETASeconds float64 `json:"eta_seconds,omitempty"`
+	// Status is how the command finished: ok, partial or failed, with
+	// Error saying why for the last two.
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// progressEvents is where -progress-events go; nil writes nothing.
+var progressEvents *eventStream
+
+// eventStream writes ProgressEvents as NDJSON, a line per write so a reader
+// sees each as soon as it happens.
+type eventStream struct {
+	mu      sync.Mutex
+	f       *os.File
+	command string
+	stage   string
+}
+
+// openEventStream opens -progress-events: fd:N for an inherited file
+// descriptor, or a file path, truncated.
+func openEventStream(spec, command string) (*eventStream, error) {
+	if n, ok := strings.CutPrefix(spec, "fd:"); ok {
+		fd, err := strconv.Atoi(n)
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("bad -progress-events %q: want fd:N or a path", spec)
+		}
+		return &eventStream{f: os.NewFile(uintptr(fd), "fd"+n), command: command}, nil
+	}
+	f, err := os.Create(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &eventStream{f: f, command: command}, nil
+}
+
+func (s *eventStream) emit(e ProgressEvent) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.Time = time.Now().UTC().Format(time.RFC3339)
+	e.Command = s.command
+	if e.Stage == "" && e.Event == "progress" {
+		e.Stage = s.stage
+	}
+	b, _ := json.Marshal(e)
+	s.f.Write(append(b, '\n'))
+}
+
+func (s *eventStream) start() { s.emit(ProgressEvent{Event: "start"}) }
+
+// enter marks the start of a stage of the command.
+func (s *eventStream) enter(stage string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.stage = stage
+	s.mu.Unlock()
+	s.emit(ProgressEvent{Event: "stage", Stage: stage})
+}
+
+// progress reports done of total units of the current stage.
+func (s *eventStream) progress(done, total int64, unit string, eta time.Duration) {
+	e := ProgressEvent{Event: "progress", Done: done, Total: total, Unit: unit, ETASeconds: eta.Seconds()}
+	if total > 0 {
+		e.Percent = 100 * float64(done) / float64(total)
+	}
+	s.emit(e)
+}
+
+// finish reports how the command ended, and closes the stream.
+func (s *eventStream) finish(err error) {
+	if s == nil {
+		return
+	}
+	e := ProgressEvent{Event: "finish", Status: "ok", Percent: 100}
+	var partial *PartialFailure
+	switch {
+	case errors.As(err, &partial):
+		e.Status, e.Error = "partial", err.Error()
+	case err != nil:
+		e.Status, e.Error, e.Percent = "failed", err.Error(), 0
+	}
+	s.emit(e)
+	s.f.Close()
+}
+
+// track reports a pipeline's progress every second until the returned stop
+// is called, which sends a last report.
+func (s *eventStream) track(ctx context.Context, p *Progress) (stop func()) {
+	if s == nil {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	start := time.Now()
+	report := func() {
+		// the same measure as the snapshot's Percent and ETA
+		snap := p.snapshot(nil, time.Since(start))
+		if p.titlesPlanned.Load() == snap.Titles {
+			s.progress(snap.DatesDone, snap.Dates, "snapshots", snap.ETA)
+		} else {
+			s.progress(snap.TitlesDone, snap.Titles, "titles", snap.ETA)
+		}
+	}
+	go func() {
+		defer close(done)
+		tick := time.NewTicker(time.Second)
+		defer tick.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick.C:
+				report()
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+		report()
+	}
+}
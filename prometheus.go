@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// promContentType is the Prometheus text exposition format.
+const promContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// wantsPrometheus reports whether a GET /metrics request is a Prometheus
+// scrape rather than a client expecting JSON: scrapers ask for text/plain
+// or OpenMetrics, and ?format=prometheus forces it.
+func wantsPrometheus(r *http.Request) bool {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return f == "prometheus"
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "text/plain") || strings.Contains(accept, "application/openmetrics-text")
+}
+
+// prometheusHandler serves m and the rate limiter rl in the Prometheus text
+// format.
+func prometheusHandler(m *Metrics, rl *RateLimitedClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", promContentType)
+		bw := bufio.NewWriter(w)
+		m.writePrometheus(bw)
+		rl.writePrometheus(bw)
+		bw.Flush()
+	}
+}
+
+// promFamily writes a metric family's HELP and TYPE lines.
+func promFamily(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writePrometheus writes the crawler's counters: requests by endpoint,
+// source and status code, their latency, bytes downloaded, cache lookups
+// and titles processed. Label values come from fixed sets, so need no
+// escaping.
+func (m *Metrics) writePrometheus(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	promFamily(w, "efcr_requests_total", "counter", "Requests by endpoint, source (api or cache) and status code (error for no response).")
+	codes := make([][3]string, 0, len(m.codes))
+	for k := range m.codes {
+		codes = append(codes, k)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		return strings.Join(codes[i][:], "\x00") < strings.Join(codes[j][:], "\x00")
+	})
+	for _, k := range codes {
+		fmt.Fprintf(w, "efcr_requests_total{endpoint=%q,source=%q,code=%q} %d\n", k[0], k[1], k[2], m.codes[k])
+	}
+
+	promFamily(w, "efcr_request_duration_seconds", "summary", "Request latency until the body is closed, by endpoint and source.")
+	keys := make([][2]string, 0, len(m.samples))
+	for k := range m.samples {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i][0]+"\x00"+keys[i][1] < keys[j][0]+"\x00"+keys[j][1] })
+	for _, k := range keys {
+		sorted := append([]time.Duration(nil), m.samples[k]...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		var sum time.Duration
+		for _, d := range sorted {
+			sum += d
+		}
+		labels := fmt.Sprintf("endpoint=%q,source=%q", k[0], k[1])
+		for _, q := range []int{50, 95} {
+			fmt.Fprintf(w, "efcr_request_duration_seconds{%s,quantile=\"%g\"} %g\n", labels, float64(q)/100, percentile(sorted, q).Seconds())
+		}
+		fmt.Fprintf(w, "efcr_request_duration_seconds_sum{%s} %g\n", labels, sum.Seconds())
+		fmt.Fprintf(w, "efcr_request_duration_seconds_count{%s} %d\n", labels, len(sorted))
+	}
+
+	promFamily(w, "efcr_downloaded_bytes_total", "counter", "Response body bytes read from the eCFR API, by endpoint.")
+	for _, e := range sortedKeys(m.bytes) {
+		fmt.Fprintf(w, "efcr_downloaded_bytes_total{endpoint=%q} %d\n", e, m.bytes[e])
+	}
+
+	promFamily(w, "efcr_cache_requests_total", "counter", "Requests through the response cache by result: hit, revalidated (a 304 upstream) or miss.")
+	for _, result := range []string{"hit", "revalidated", "miss"} {
+		fmt.Fprintf(w, "efcr_cache_requests_total{result=%q} %d\n", result, m.cache[result])
+	}
+
+	promFamily(w, "efcr_titles_processed_total", "counter", "Titles the crawl pipeline finished, by result: ok or failed.")
+	for _, result := range []string{"ok", "failed"} {
+		fmt.Fprintf(w, "efcr_titles_processed_total{result=%q} %d\n", result, m.titles[result])
+	}
+}
+
+// writePrometheus writes the limiter's rate, throttling and queueing.
+func (rlc *RateLimitedClient) writePrometheus(w io.Writer) {
+	rlc.mu.Lock()
+	rate, lowest, throttled := rlc.rate, rlc.lowest, rlc.limited
+	rlc.mu.Unlock()
+	promFamily(w, "efcr_rate_limit_requests_per_second", "gauge", "The adaptive rate limit now.")
+	fmt.Fprintf(w, "efcr_rate_limit_requests_per_second %g\n", rate)
+	promFamily(w, "efcr_rate_limit_lowest_requests_per_second", "gauge", "The lowest the rate limit has been since start.")
+	fmt.Fprintf(w, "efcr_rate_limit_lowest_requests_per_second %g\n", lowest)
+	promFamily(w, "efcr_rate_limit_throttled_total", "counter", "429 responses from the eCFR API.")
+	fmt.Fprintf(w, "efcr_rate_limit_throttled_total %d\n", throttled)
+	promFamily(w, "efcr_rate_limit_wait_seconds_total", "counter", "Time requests have spent waiting for the rate limit.")
+	fmt.Fprintf(w, "efcr_rate_limit_wait_seconds_total %g\n", rlc.Waited().Seconds())
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// protoMessage builds a protobuf encoding of one of the messages in
+// proto/efcr.proto. The messages are flat and small, so this is written out
+// by hand rather than pulling in generated code. As in proto3, fields at
+// their zero value are left out.
+type protoMessage []byte
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func (m protoMessage) tag(field, wire int) protoMessage {
+	return binary.AppendUvarint(m, uint64(field)<<3|uint64(wire))
+}
+
+func (m protoMessage) string(field int, s string) protoMessage {
+	if s == "" {
+		return m
+	}
+	m = binary.AppendUvarint(m.tag(field, wireBytes), uint64(len(s)))
+	return append(m, s...)
+}
+
+func (m protoMessage) int(field int, v int64) protoMessage {
+	if v == 0 {
+		return m
+	}
+	return binary.AppendUvarint(m.tag(field, wireVarint), uint64(v))
+}
+
+func (m protoMessage) bool(field int, b bool) protoMessage {
+	if !b {
+		return m
+	}
+	return append(m.tag(field, wireVarint), 1)
+}
+
+func (m protoMessage) double(field int, v float64) protoMessage {
+	if v == 0 {
+		return m
+	}
+	return binary.LittleEndian.AppendUint64(m.tag(field, wireFixed64), math.Float64bits(v))
+}
+
+// writeDelimited writes m preceded by its varint length.
+func writeDelimited(w io.Writer, m protoMessage) error {
+	b := binary.AppendUvarint(make([]byte, 0, len(m)+binary.MaxVarintLen64), uint64(len(m)))
+	_, err := w.Write(append(b, m...))
+	return err
+}
+
+// sectionProto encodes an efcr.v1.Section message.
+func sectionProto(id core.SectionID, snapshot string, s *core.Div) protoMessage {
+	return protoMessage(nil).
+		int(1, int64(id.Title)).
+		string(2, id.Part).
+		string(3, s.N).
+		string(4, s.Head).
+		string(5, core.ParaText(s)).
+		string(6, snapshot).
+		string(7, id.String()).
+		string(10, textHash(s))
+}
+
+// tombstoneProto encodes a removed section as an efcr.v1.Section message
+// with no heading or text.
+func tombstoneProto(t Tombstone, snapshot string) protoMessage {
+	return protoMessage(nil).
+		int(1, int64(t.Title)).
+		string(2, t.Part).
+		string(3, t.Section).
+		string(6, snapshot).
+		string(7, t.ID).
+		string(8, t.Removed).
+		string(9, t.LastSeen).
+		string(10, t.TextSHA256)
+}
+
+// versionProto encodes an efcr.v1.Version message.
+func versionProto(v ecfr.Version) protoMessage {
+	var subpart string
+	if v.Subpart != nil {
+		subpart = *v.Subpart
+	}
+	return protoMessage(nil).
+		string(1, v.Date).
+		string(2, v.AmendmentDate).
+		string(3, v.IssueDate).
+		string(4, v.Identifier).
+		string(5, v.Name).
+		string(6, v.Part).
+		bool(7, v.Substantive).
+		bool(8, v.Removed).
+		string(9, subpart).
+		string(10, v.Title).
+		string(11, v.Type)
+}
+
+// factProto encodes an efcr.v1.Measurement message.
+func factProto(f Fact) protoMessage {
+	return protoMessage(nil).
+		int(1, int64(f.Title)).
+		string(2, f.Chapter).
+		string(3, f.Part).
+		string(4, f.Section).
+		string(5, f.Agency).
+		string(6, f.Date).
+		string(7, f.Metric).
+		double(8, f.Value)
+}
+
+// writeSectionsProto writes every section under root, then each removed
+// one, as a delimited efcr.v1.Section message. root may be nil when only
+// tombstones are left.
+func writeSectionsProto(w io.Writer, root *core.Div, title int, snapshot string, removed []Tombstone) error {
+	var err error
+	if root != nil {
+		core.WalkSectionIDs(root, title, func(id core.SectionID, d *core.Div) {
+			if err == nil {
+				err = writeDelimited(w, sectionProto(id, snapshot, d))
+			}
+		})
+	}
+	for _, t := range removed {
+		if err == nil {
+			err = writeDelimited(w, tombstoneProto(t, snapshot))
+		}
+	}
+	return err
+}
+
+// writeFactsProto is writeFacts for --facts-format proto.
+func writeFactsProto(path string, facts []Fact) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	for _, fact := range facts {
+		if err := writeDelimited(w, factProto(fact)); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
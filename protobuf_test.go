@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFactsProtoGolden(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "facts.pb")
+	if err := writeFactsProto(path, testFacts); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "facts.pb", b)
+}
+
+func TestVersionsProtoGolden(t *testing.T) {
+	var b bytes.Buffer
+	for _, v := range testVersions {
+		if err := writeDelimited(&b, versionProto(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	golden(t, "versions.pb", b.Bytes())
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+)
+
+// Queries are a small SQL-flavoured language over saved fact files:
+//
+//	select agency, sum(value) where metric = 'words' and date >= '2020-01-01'
+//	  per year order by value desc limit 10
+//
+// Plain columns in the select list (title, chapter, part, section, agency)
+// are the grouping; exactly one aggregate (sum, count, avg, min, max) is
+// computed per group, per metric and, with per, per day/month/quarter/year.
+// Conditions compare title, chapter, part, section, agency, date, metric or
+// value with = != < <= > >= and are joined by and.
+type query struct {
+	dims    []string
+	agg     string
+	bin     string
+	where   []condition
+	orderBy string
+	desc    bool
+	limit   int
+}
+
+type condition struct {
+	field, op, value string
+}
+
+// runQuery evaluates a query against facts saved with --save-facts.
+// Facts brought in with `efcr import` sit beside efcr's own, told apart by
+// source.
+//
+//	efcr query --facts crawl.ndjson "select part, sum(value) where title = 40"
+//	efcr query --facts crawl.ndjson "select title, source, sum(value) where metric = words per year"
+func runQuery(args []string) error {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	var files stringsFlag
+	fs.Var(&files, "facts", "NDJSON fact file written by --save-facts (repeatable)")
+	fs.Parse(args)
+	if fs.NArg() != 1 || len(files) == 0 {
+		return errors.New(`usage: query --facts file "select …"`)
+	}
+	q, err := parseQuery(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var facts []Fact
+	for _, f := range files {
+		ff, err := readFacts(f)
+		if err != nil {
+			return err
+		}
+		facts = append(facts, ff...)
+	}
+	return q.run(facts)
+}
+
+func tokenize(s string) ([]string, error) {
+	var toks []string
+	for i := 0; i < len(s); {
+		r := rune(s[i])
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'' || r == '"':
+			j := strings.IndexByte(s[i+1:], s[i])
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			toks = append(toks, s[i:i+j+2])
+			i += j + 2
+		case strings.ContainsRune("(),*", r):
+			toks = append(toks, string(r))
+			i++
+		case strings.ContainsRune("=!<>", r):
+			j := i + 1
+			if j < len(s) && s[j] == '=' {
+				j++
+			}
+			toks = append(toks, s[i:j])
+			i = j
+		default:
+			j := i
+			for j < len(s) && !unicode.IsSpace(rune(s[j])) && !strings.ContainsRune("(),*=!<>'\"", rune(s[j])) {
+				j++
+			}
+			toks = append(toks, s[i:j])
+			i = j
+		}
+	}
+	return toks, nil
+}
+
+var queryFields = map[string]bool{"title": true, "chapter": true, "part": true, "section": true, "agency": true, "date": true, "metric": true, "value": true, "source": true}
+
+func parseQuery(s string) (*query, error) {
+	toks, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	pos := 0
+	peek := func() string {
+		if pos < len(toks) {
+			return strings.ToLower(toks[pos])
+		}
+		return ""
+	}
+	next := func() string {
+		t := ""
+		if pos < len(toks) {
+			t = toks[pos]
+			pos++
+		}
+		return t
+	}
+	expect := func(want string) error {
+		if got := strings.ToLower(next()); got != want {
+			return fmt.Errorf("expected %q, got %q", want, got)
+		}
+		return nil
+	}
+
+	q := &query{}
+	if err := expect("select"); err != nil {
+		return nil, err
+	}
+	for {
+		t := strings.ToLower(next())
+		switch t {
+		case "sum", "count", "avg", "min", "max":
+			if q.agg != "" {
+				return nil, errors.New("only one aggregate is allowed")
+			}
+			q.agg = t
+			if err := expect("("); err != nil {
+				return nil, err
+			}
+			if arg := strings.ToLower(next()); arg != "value" && arg != "*" {
+				return nil, fmt.Errorf("%s(%s): only value or * can be aggregated", t, arg)
+			}
+			if err := expect(")"); err != nil {
+				return nil, err
+			}
+		default:
+			if rollupDims[t] == nil {
+				return nil, fmt.Errorf("unknown column %q", t)
+			}
+			q.dims = append(q.dims, t)
+		}
+		if peek() != "," {
+			break
+		}
+		next()
+	}
+	if q.agg == "" {
+		return nil, errors.New("select needs an aggregate such as sum(value)")
+	}
+
+	for pos < len(toks) {
+		switch kw := strings.ToLower(next()); kw {
+		case "where":
+			for {
+				c := condition{field: strings.ToLower(next()), op: next(), value: strings.Trim(next(), `'"`)}
+				if !queryFields[c.field] {
+					return nil, fmt.Errorf("unknown field %q", c.field)
+				}
+				switch c.op {
+				case "=", "!=", "<", "<=", ">", ">=":
+				default:
+					return nil, fmt.Errorf("unknown operator %q", c.op)
+				}
+				q.where = append(q.where, c)
+				if peek() != "and" {
+					break
+				}
+				next()
+			}
+		case "per":
+			q.bin = strings.ToLower(next())
+			if _, err := binBucket(q.bin); err != nil {
+				return nil, err
+			}
+		case "order":
+			if err := expect("by"); err != nil {
+				return nil, err
+			}
+			q.orderBy = strings.ToLower(next())
+			if q.orderBy != "value" && !contains(q.dims, q.orderBy) {
+				return nil, fmt.Errorf("can only order by value or a selected column, not %q", q.orderBy)
+			}
+			if d := peek(); d == "asc" || d == "desc" {
+				q.desc = next() == "desc"
+			}
+		case "limit":
+			if q.limit, err = strconv.Atoi(next()); err != nil {
+				return nil, fmt.Errorf("limit: %w", err)
+			}
+		default:
+			return nil, fmt.Errorf("unexpected %q", kw)
+		}
+	}
+	return q, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether f satisfies every condition. Numeric fields compare
+// numerically, the rest as strings (dates are ISO so that orders correctly).
+func (q *query) match(f *Fact) bool {
+	for _, c := range q.where {
+		var cmp int
+		switch c.field {
+		case "title", "value":
+			want, err := strconv.ParseFloat(c.value, 64)
+			if err != nil {
+				return false
+			}
+			got := f.Value
+			if c.field == "title" {
+				got = float64(f.Title)
+			}
+			switch {
+			case got < want:
+				cmp = -1
+			case got > want:
+				cmp = 1
+			}
+		default:
+			got := map[string]string{"chapter": f.Chapter, "part": f.Part, "section": f.Section,
+				"agency": f.Agency, "date": f.Date, "metric": f.Metric, "source": f.source()}[c.field]
+			cmp = strings.Compare(got, c.value)
+		}
+		ok := map[string]bool{"=": cmp == 0, "!=": cmp != 0, "<": cmp < 0, "<=": cmp <= 0, ">": cmp > 0, ">=": cmp >= 0}[c.op]
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (q *query) run(facts []Fact) error {
+	var kept []Fact
+	for i := range facts {
+		if q.match(&facts[i]) {
+			kept = append(kept, facts[i])
+		}
+	}
+	r := Rollup{GroupBy: q.dims}
+	if q.bin != "" {
+		r.Bucket, _ = binBucket(q.bin)
+	}
+	rows, err := r.Run(kept)
+	if err != nil {
+		return err
+	}
+	value := func(row RollupRow) float64 {
+		switch q.agg {
+		case "count":
+			return float64(row.Facts)
+		case "avg":
+			return row.Value / float64(row.Facts)
+		case "min":
+			return row.Min
+		case "max":
+			return row.Max
+		}
+		return row.Value
+	}
+	if q.orderBy != "" {
+		col := indexOf(q.dims, q.orderBy)
+		sort.SliceStable(rows, func(i, j int) bool {
+			a, b := rows[i], rows[j]
+			if q.desc {
+				a, b = b, a
+			}
+			if col < 0 {
+				return value(a) < value(b)
+			}
+			return a.Key[col] < b.Key[col]
+		})
+	}
+	if q.limit > 0 && len(rows) > q.limit {
+		rows = rows[:q.limit]
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	header := append([]string(nil), q.dims...)
+	if q.bin != "" {
+		header = append(header, q.bin)
+	}
+	header = append(header, "metric", q.agg)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		cols := append([]string(nil), row.Key...)
+		if q.bin != "" {
+			cols = append(cols, row.Period)
+		}
+		cols = append(cols, row.Metric, strconv.FormatFloat(value(row), 'f', -1, 64))
+		fmt.Fprintln(tw, strings.Join(cols, "\t"))
+	}
+	return tw.Flush()
+}
+
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// writeFacts saves facts as NDJSON for later queries.
+func writeFacts(path string, facts []Fact) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	if err := writeSchemaHeader(w, factsSchema, factsVersion); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	for i := range facts {
+		if err := enc.Encode(&facts[i]); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func readFacts(path string) ([]Fact, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var facts []Fact
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for i := 0; dec.More(); i++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if i == 0 {
+			// v1 files differ only in lacking the header and v2 in
+			// lacking sources, so there is nothing to migrate beyond
+			// accepting them
+			_, isHeader, err := checkSchema(path, raw, factsSchema, factsVersion)
+			if err != nil {
+				return nil, err
+			}
+			if isHeader {
+				continue
+			}
+		}
+		var fact Fact
+		if err := json.Unmarshal(raw, &fact); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		facts = append(facts, fact)
+	}
+	return facts, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testFacts covers each column, with the empty and zero values writers
+// are tempted to drop.
+var testFacts = []Fact{
+	{Title: 40, Chapter: "I", Part: "60", Section: "60.4", Agency: "environmental-protection-agency", Date: "2024-01-02", Metric: "words", Value: 1234},
+	{Title: 40, Chapter: "I", Part: "60", Date: "2024-01-02", Metric: "conditions", Value: 0.5},
+	{Title: 7, Part: "1", Date: "1999-12-31", Metric: "words", Value: 0},
+}
+
+func TestParseQuery(t *testing.T) {
+	got, err := parseQuery(`SELECT agency, part, sum(value) where metric = 'words' and date >= "2020-01-01" and value!=0 per year order by value desc limit 10`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &query{
+		dims: []string{"agency", "part"},
+		agg:  "sum",
+		bin:  "year",
+		where: []condition{
+			{"metric", "=", "words"},
+			{"date", ">=", "2020-01-01"},
+			{"value", "!=", "0"},
+		},
+		orderBy: "value",
+		desc:    true,
+		limit:   10,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseQuery = %+v, want %+v", got, want)
+	}
+
+	for _, bad := range []string{
+		"",
+		"select part",
+		"select sum(value), count(*)",
+		"select sum(words)",
+		"select colour, sum(value)",
+		"select sum(value) where colour = red",
+		"select sum(value) where title ~ 40",
+		"select sum(value) where metric = 'words",
+		"select sum(value) per fortnight",
+		"select part, sum(value) order by agency",
+		"select sum(value) limit ten",
+		"select sum(value) group by part",
+	} {
+		if _, err := parseQuery(bad); err == nil {
+			t.Errorf("parseQuery(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	for _, tc := range []struct {
+		q    string
+		want []bool // for each of testFacts
+	}{
+		{"select sum(value)", []bool{true, true, true}},
+		{"select sum(value) where title = 40", []bool{true, true, false}},
+		{"select sum(value) where title > 8", []bool{true, true, false}},
+		{"select sum(value) where metric = words and value > 0", []bool{true, false, false}},
+		{"select sum(value) where date < '2000-01-01'", []bool{false, false, true}},
+		{"select sum(value) where section != ''", []bool{true, false, false}},
+	} {
+		q, err := parseQuery(tc.q)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.q, err)
+		}
+		for i := range testFacts {
+			if got := q.match(&testFacts[i]); got != tc.want[i] {
+				t.Errorf("%s: match(fact %d) = %v", tc.q, i, got)
+			}
+		}
+	}
+}
+
+func TestFactsFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "facts.ndjson")
+	if err := writeFacts(path, testFacts); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readFacts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, testFacts) {
+		t.Errorf("read back %+v", got)
+	}
+}
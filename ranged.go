@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// resumable reports whether a broken 200 response can be finished with
+// range requests: the server must take byte ranges, say how long the body
+// is and give a validator so a changed document isn't spliced onto the
+// old one. Transparently decompressed bodies have no usable length.
+func resumable(resp *http.Response) bool {
+	return resp.ContentLength > 0 &&
+		resp.Header.Get("Accept-Ranges") == "bytes" &&
+		ifRange(resp.Header) != ""
+}
+
+// ifRange returns the validator to send as If-Range: a strong ETag, or
+// failing that Last-Modified.
+func ifRange(h http.Header) string {
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return h.Get("Last-Modified")
+}
+
+// errRangeChanged means the document changed while it was being fetched.
+var errRangeChanged = errors.New("document changed during download")
+
+// resume fetches bytes [written, ContentLength) of first's body as
+// RangeChunk sized range requests, RangeWorkers at a time, each verified
+// against the Content-Range it should have and retried a few times when
+// its own connection breaks. Completed chunks are never fetched again, so
+// a dropped connection late in a 400MB title costs one chunk, not the
+// title. Chunks land in a spill file in whatever order they finish and are
+// copied to w, after the bytes already written, once all are in.
+func (c *CachingClient) resume(ctx context.Context, req *http.Request, first *http.Response, w io.Writer, written int64) error {
+	total := first.ContentLength
+	validator := ifRange(first.Header)
+	f, err := os.CreateTemp(c.CacheDir, tempPrefix+"range-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(1, c.RangeWorkers))
+	for start := written; start < total; start += c.RangeChunk {
+		end := min(start+c.RangeChunk, total) - 1
+		g.Go(func() error {
+			var err error
+			for attempt := 0; attempt < 3; attempt++ {
+				if err = c.fetchRange(gctx, req, validator, f, written, start, end, total); err == nil || errors.Is(err, errRangeChanged) || gctx.Err() != nil {
+					break
+				}
+			}
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, io.NewSectionReader(f, 0, total-written))
+	return err
+}
+
+// fetchRange GETs bytes start..end (inclusive) and writes them to f at
+// start-base.
+func (c *CachingClient) fetchRange(ctx context.Context, orig *http.Request, validator string, f *os.File, base, start, end, total int64) error {
+	req := orig.Clone(ctx)
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	req.Header.Set("If-Range", validator)
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		return errRangeChanged // If-Range failed: the whole new document came back
+	default:
+		return fmt.Errorf("range %d-%d of %s: HTTP %d", start, end, orig.URL, resp.StatusCode)
+	}
+	want := fmt.Sprintf("bytes %d-%d/%d", start, end, total)
+	if got := resp.Header.Get("Content-Range"); got != want {
+		return fmt.Errorf("range %d-%d of %s: got Content-Range %q", start, end, orig.URL, got)
+	}
+	buf := make([]byte, end-start+1)
+	if _, err := io.ReadFull(resp.Body, buf); err != nil {
+		return fmt.Errorf("range %d-%d of %s: %w", start, end, orig.URL, err)
+	}
+	_, err = f.WriteAt(buf, start-base)
+	return err
+}
+
+// checkDigest compares the SHA-256 of a reassembled download with the
+// server's Repr-Digest or Digest header, when it sent one.
+func checkDigest(sum []byte, h http.Header) error {
+	if want := headerSHA256(h); want != nil && !bytes.Equal(want, sum) {
+		return fmt.Errorf("reassembled body has SHA-256 %x, server says %x", sum, want)
+	}
+	return nil
+}
+
+// headerSHA256 extracts a SHA-256 from Repr-Digest (RFC 9530,
+// sha-256=:b64:) or the older Digest (RFC 3230, SHA-256=b64).
+func headerSHA256(h http.Header) []byte {
+	for _, field := range []string{h.Get("Repr-Digest"), h.Get("Digest")} {
+		for _, d := range strings.Split(field, ",") {
+			alg, val, ok := strings.Cut(strings.TrimSpace(d), "=")
+			if !ok || !strings.EqualFold(alg, "sha-256") {
+				continue
+			}
+			if b, err := base64.StdEncoding.DecodeString(strings.Trim(val, ":")); err == nil && len(b) == sha256.Size {
+				return b
+			}
+		}
+	}
+	return nil
+}
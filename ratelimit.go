@@ -0,0 +1,139 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateLimitedClient spaces requests to the API with a token bucket whose
+// rate adapts to how the API copes: every 429 halves it, down to MinRate,
+// and each healthy response lets it climb back by Recover requests/s per
+// second since the last change, up to MaxRate. That is TCP's additive
+// increase, multiplicative decrease: quick to back off, slow to push again.
+type RateLimitedClient struct {
+	Client  httpclient
+	MinRate float64 // requests per second
+	MaxRate float64
+	Recover float64 // requests/s regained per second without a 429
+	Burst   float64 // requests that may go back to back after a lull
+
+	mu      sync.Mutex
+	rate    float64
+	tokens  float64
+	filled  time.Time // tokens were last topped up
+	changed time.Time // rate was last adjusted
+	lowest  float64
+	limited int // 429s seen
+
+	waited atomic.Int64 // nanoseconds requests spent waiting for a token
+}
+
+// NewRateLimitedClient starts at one request per every, lets the rate fall
+// to a sixteenth of that and rise to four times it.
+func NewRateLimitedClient(client httpclient, every time.Duration) *RateLimitedClient {
+	rate := float64(time.Second) / float64(every)
+	now := time.Now()
+	return &RateLimitedClient{
+		Client:  client,
+		MinRate: rate / 16,
+		MaxRate: rate * 4,
+		Recover: rate / 60,
+		Burst:   1,
+		rate:    rate,
+		tokens:  1,
+		filled:  now,
+		changed: now,
+		lowest:  rate,
+	}
+}
+
+// reserve takes a token, going into debt if there is none, and returns how
+// long to wait until it is due. Debt makes waiters queue in order.
+func (rlc *RateLimitedClient) reserve() time.Duration {
+	rlc.mu.Lock()
+	defer rlc.mu.Unlock()
+	now := time.Now()
+	rlc.tokens = min(rlc.tokens+now.Sub(rlc.filled).Seconds()*rlc.rate, rlc.Burst)
+	rlc.filled = now
+	rlc.tokens--
+	if rlc.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-rlc.tokens / rlc.rate * float64(time.Second))
+}
+
+func (rlc *RateLimitedClient) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if wait := rlc.reserve(); wait > 0 {
+		if err := sleepCtx(ctx, wait); err != nil {
+			return nil, err
+		}
+		rlc.waited.Add(int64(wait))
+	}
+	resp, err := rlc.Client.Do(req)
+	if err == nil {
+		rlc.observe(resp.StatusCode)
+	}
+	return resp, err
+}
+
+// observe adapts the rate to a response.
+func (rlc *RateLimitedClient) observe(code int) {
+	rlc.mu.Lock()
+	defer rlc.mu.Unlock()
+	now := time.Now()
+	old := rlc.rate
+	if code == http.StatusTooManyRequests {
+		rlc.limited++
+		rlc.rate = max(rlc.rate/2, rlc.MinRate)
+		rlc.lowest = min(rlc.lowest, rlc.rate)
+		// whatever was banked went to the throttling; start from empty
+		rlc.tokens = min(rlc.tokens, 0)
+		rlc.changed = now
+		slog.Warn("rate limit: throttled (429), slowing", "rate", round2(rlc.rate))
+		return
+	}
+	if rlc.rate < rlc.MaxRate {
+		rlc.rate = min(rlc.rate+rlc.Recover*now.Sub(rlc.changed).Seconds(), rlc.MaxRate)
+		rlc.changed = now
+		if rlc.rate == rlc.MaxRate && old < rlc.MaxRate {
+			slog.Info("rate limit: back up to full speed", "rate", round2(rlc.rate))
+		}
+	}
+}
+
+// Waited returns the total time requests have spent waiting on the limit.
+func (rlc *RateLimitedClient) Waited() time.Duration {
+	return time.Duration(rlc.waited.Load())
+}
+
+// RateStats is the limiter's state for logs and /metrics.
+type RateStats struct {
+	Rate    float64 `json:"rate"`   // requests per second now
+	Lowest  float64 `json:"lowest"` // lowest rate this run
+	Limited int     `json:"limited"`
+	Waited  string  `json:"waited"` // total time requests queued
+}
+
+func (rlc *RateLimitedClient) Stats() RateStats {
+	rlc.mu.Lock()
+	defer rlc.mu.Unlock()
+	return RateStats{
+		Rate:    rlc.rate,
+		Lowest:  rlc.lowest,
+		Limited: rlc.limited,
+		Waited:  rlc.Waited().Round(time.Millisecond).String(),
+	}
+}
+
+// Log writes the limiter's state to the log, if it had anything to do.
+func (rlc *RateLimitedClient) Log() {
+	s := rlc.Stats()
+	if s.Limited == 0 && rlc.Waited() == 0 {
+		return
+	}
+	slog.Info("rate limit", "rate", round2(s.Rate), "lowest", round2(s.Lowest), "throttled", s.Limited, "queued", s.Waited)
+}
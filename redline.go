@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// runRedline diffs a section (or part) between two dates and writes the
+// result as a Word document with tracked changes.
+//
+//	efcr redline --title 6 --section 11.4 --from 2017-01-19 --to 2024-01-01
+func runRedline(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("redline", flag.ExitOnError)
+	title := fs.Int("title", 0, "title number")
+	part := fs.String("part", "", "part number")
+	section := fs.String("section", "", "section identifier, e.g. 11.4")
+	from := fs.String("from", "", "old snapshot date YYYY-MM-DD")
+	to := fs.String("to", "", "new snapshot date YYYY-MM-DD")
+	out := fs.String("out", "", "output file (default redline-<cite>-FROM-TO.docx)")
+	fs.Parse(args)
+	if *title == 0 || *from == "" || *to == "" || (*part == "" && *section == "") {
+		return errors.New("--title, --from, --to and one of --part/--section are required")
+	}
+
+	h := ecfr.Hierarchy{Part: *part, Section: *section}
+	tokens := core.DivTokens
+	if cfg.isTable(*title, partOf(*part, *section)) {
+		tokens = core.RowTokens
+	}
+	var texts [2][]string
+	var notes [2][]core.Note
+	for i, d := range []string{*from, *to} {
+		doc, err := newAPI(c).Document(ctx, *title, d, h)
+		if err != nil {
+			return err
+		}
+		root := doc.Root()
+		n := *section
+		if n == "" {
+			n = *part
+		}
+		if found := core.FindDiv(root, n); found != nil {
+			root = found
+		}
+		texts[i] = tokens(root)
+		notes[i] = root.AllNotes()
+	}
+	had := map[string]bool{}
+	for _, n := range notes[0] {
+		had[core.NormalizeTypography(n.Text)] = true
+	}
+	var current []redlineNote
+	for _, n := range notes[1] {
+		current = append(current, redlineNote{n, !had[core.NormalizeTypography(n.Text)]})
+	}
+
+	cite := citation(*title, *part, *section)
+	if *out == "" {
+		*out = fmt.Sprintf("redline-%d-%s%s-%s-%s.docx", *title, *part, *section, *from, *to)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	toDate, err := time.Parse("2006-01-02", *to)
+	if err != nil {
+		return err
+	}
+	heading := fmt.Sprintf("%s: changes from %s to %s", cite, *from, *to)
+	if err := writeDOCX(f, heading, "eCFR", toDate, core.DiffTokens(texts[0], texts[1]), current); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// partOf returns part, or the part a section number like "172.101" is in.
+func partOf(part, section string) string {
+	if part != "" {
+		return part
+	}
+	p, _, _ := strings.Cut(section, ".")
+	return p
+}
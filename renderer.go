@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// The renderer API serves the same HTML the eCFR website shows, so it is the
+// authoritative formatting for a section rather than our plainText rebuild.
+// It takes the same ?part=&section= filter as the versioner (ecfr.Hierarchy).
+const (
+	rendererURL = "https://www.ecfr.gov/api/renderer/v1/content/enhanced/%s/title-%d"
+)
+
+// fetchHTML GETs url from the renderer and returns the HTML body. Caller closes.
+func fetchHTML(ctx context.Context, c httpclient, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html")
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("HTTP %d %s", resp.StatusCode, url)
+	}
+	return resp.Body, nil
+}
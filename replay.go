@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// runEventsReplay re-sends the amendments watch journaled (watch --journal)
+// to one channel, so a consumer that was down can catch up without
+// re-crawling. --to takes any watch --notify spec and defaults to NDJSON
+// on stdout. Events are selected on when watch detected them, or with
+// --date-field date on the amendment date, and sent oldest first; a
+// failure stops the replay, naming the last event sent so it can resume.
+//
+//	efcr events replay --from 2025-01-01 --to https://example.com/hook
+//	efcr events replay --from 2025-01-01 --until 2025-02-01 --titles 40 --to file:missed.ndjson
+func runEventsReplay(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("events replay", flag.ExitOnError)
+	journal := fs.String("journal", filepath.Join(cacheDir, "events.ndjson"), "watch --journal file to replay")
+	from := fs.String("from", "", "replay events on or after this date YYYY-MM-DD")
+	until := fs.String("until", "", "replay events on or before this date YYYY-MM-DD")
+	dateField := fs.String("date-field", "detected", "date --from and --until select on: detected or date (of the amendment)")
+	titleList := fs.String("titles", "", "comma separated title numbers to replay (default all)")
+	to := fs.String("to", "", "webhook URL, slack:WEBHOOK_URL, cmd:COMMAND or file:PATH (default NDJSON on stdout)")
+	fs.Parse(args)
+	if *from == "" {
+		return errors.New("--from is required")
+	}
+	for _, d := range []string{*from, *until} {
+		if _, err := time.Parse("2006-01-02", d); d != "" && err != nil {
+			return fmt.Errorf("bad date %q: want YYYY-MM-DD", d)
+		}
+	}
+	if *dateField != "detected" && *dateField != "date" {
+		return fmt.Errorf("bad --date-field %q: want detected or date", *dateField)
+	}
+	titles, err := parseTitles(*titleList)
+	if err != nil {
+		return err
+	}
+	var n Notifier = stdoutNotifier{json.NewEncoder(os.Stdout)}
+	if *to != "" {
+		if n, err = newNotifier(*to); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Open(*journal)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var events []WatchEvent
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 16<<20)
+	for line := 1; sc.Scan(); line++ {
+		var e WatchEvent
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return fmt.Errorf("%s:%d: %w", *journal, line, err)
+		}
+		d := e.Date
+		if *dateField == "detected" {
+			d = e.Detected[:min(len(e.Detected), 10)]
+		}
+		if d < *from || (*until != "" && d > *until) || (len(titles) > 0 && !titles[e.Title]) {
+			continue
+		}
+		events = append(events, e)
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("%s: %w", *journal, err)
+	}
+	if *dateField == "date" { // the journal is in detection order already
+		sort.SliceStable(events, func(i, j int) bool { return events[i].Date < events[j].Date })
+	}
+
+	for i, e := range events {
+		if err := n.Notify(ctx, e); err != nil {
+			if i > 0 {
+				last := events[i-1]
+				return fmt.Errorf("title %d %s: %w (sent %d of %d, through title %d %s)", e.Title, e.Date, err, i, len(events), last.Title, last.Date)
+			}
+			return fmt.Errorf("title %d %s: %w (nothing sent)", e.Title, e.Date, err)
+		}
+	}
+	slog.Info("replayed events", "events", len(events), "journal", *journal)
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/paulgmiller/efcr/pipeline"
+)
+
+// titleReport is one title's crawl result as --output json emits it.
+type titleReport struct {
+	Title             int                `json:"title"`
+	Name              string             `json:"name"`
+	Versions          int                `json:"versions"`
+	Words             int64              `json:"words"`
+	Sections          *int               `json:"sections,omitempty"`
+	StructureSections *int               `json:"structure_sections,omitempty"`
+	Metrics           map[string]float64 `json:"metrics,omitempty"`
+	Dates             []dateReport       `json:"dates"`
+	Errors            []string           `json:"errors,omitempty"`
+}
+
+// dateReport is the word count of one snapshot.
+type dateReport struct {
+	Date  string `json:"date"`
+	Words int64  `json:"words"`
+}
+
+// titleReports converts crawl results for machine output, each title's
+// dates in order. sections and metrics may be nil.
+func titleReports(results []pipeline.TitleResult, sections *sectionSanity, metrics *pluginMetrics) []titleReport {
+	reports := make([]titleReport, 0, len(results))
+	for _, r := range results {
+		rep := titleReport{
+			Title:    r.Title.Number,
+			Name:     r.Title.Name,
+			Versions: len(r.Dates),
+			Words:    r.Words,
+			Dates:    []dateReport{},
+		}
+		for _, d := range sortedKeys(r.Dates) {
+			rep.Dates = append(rep.Dates, dateReport{d, r.Dates[d]})
+		}
+		for _, err := range r.Errs {
+			rep.Errors = append(rep.Errors, err.Error())
+		}
+		if sections != nil {
+			xml, structure := sections.totals(r.Title.Number)
+			rep.Sections, rep.StructureSections = &xml, &structure
+		}
+		if metrics != nil {
+			rep.Metrics = metrics.byTitle[r.Title.Number]
+		}
+		reports = append(reports, rep)
+	}
+	return reports
+}
+
+func writeReportJSON(w io.Writer, reports []titleReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(reports)
+}
+
+// writeReportCSV writes one row per title and snapshot date, the long form
+// spreadsheets pivot easily; a title's errors get a row each with no date.
+func writeReportCSV(w io.Writer, reports []titleReport) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"title", "name", "date", "words", "error"})
+	for _, r := range reports {
+		title := strconv.Itoa(r.Title)
+		for _, d := range r.Dates {
+			cw.Write([]string{title, r.Name, d.Date, strconv.FormatInt(d.Words, 10), ""})
+		}
+		for _, e := range r.Errors {
+			cw.Write([]string{title, r.Name, "", "", e})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
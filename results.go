@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ResultCache stores computed per-document results keyed by (content hash,
+// analyzer, settings), so changing one report option only recomputes the
+// analyses it affects. A nil *ResultCache caches nothing.
+type ResultCache struct {
+	Dir string
+}
+
+func NewResultCache(dir string) *ResultCache {
+	return &ResultCache{Dir: dir}
+}
+
+func (rc *ResultCache) path(contentHash, analyzer, settings string) string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("v%d\x00%s\x00%s\x00%s", resultsVersion, contentHash, analyzer, settings)))
+	return filepath.Join(rc.Dir, hex.EncodeToString(h[:])+".json")
+}
+
+// Get returns the stored result, if any. An unknown content hash never hits.
+func (rc *ResultCache) Get(contentHash, analyzer, settings string) (json.RawMessage, bool) {
+	if rc == nil || contentHash == "" {
+		return nil, false
+	}
+	b, err := os.ReadFile(rc.path(contentHash, analyzer, settings))
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// Put stores an already marshalled result. Failures only cost a recompute
+// later, so they are not reported.
+func (rc *ResultCache) Put(contentHash, analyzer, settings string, result json.RawMessage) {
+	if rc == nil || contentHash == "" {
+		return
+	}
+	if err := os.MkdirAll(rc.Dir, 0o755); err != nil {
+		return
+	}
+	os.WriteFile(rc.path(contentHash, analyzer, settings), result, 0o644)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retention thins out the history a long-running deployment accumulates
+// in its stores: every crawl adds a row to the --db runs table and a
+// version of a --facts-format delta table. Within Days of now one run per
+// day is kept; before that one per month, for Months months (0 for ever).
+// The zero Retention keeps everything.
+type Retention struct {
+	Days   int
+	Months int
+}
+
+// parseRetention reads a --retain spec: DAYS"d", optionally followed by
+// ","MONTHS"m", e.g. "90d" or "90d,24m". An empty spec keeps everything.
+func parseRetention(spec string) (Retention, error) {
+	var r Retention
+	if spec == "" {
+		return r, nil
+	}
+	days, months, hasMonths := strings.Cut(spec, ",")
+	n, err := strconv.Atoi(strings.TrimSuffix(days, "d"))
+	if err != nil || !strings.HasSuffix(days, "d") || n <= 0 {
+		return r, fmt.Errorf("bad --retain %q: want DAYSd[,MONTHSm], e.g. 90d,24m", spec)
+	}
+	r.Days = n
+	if hasMonths {
+		n, err := strconv.Atoi(strings.TrimSuffix(months, "m"))
+		if err != nil || !strings.HasSuffix(months, "m") || n <= 0 {
+			return r, fmt.Errorf("bad --retain %q: want DAYSd[,MONTHSm], e.g. 90d,24m", spec)
+		}
+		r.Months = n
+	}
+	return r, nil
+}
+
+func (r Retention) String() string {
+	switch {
+	case r.Days == 0:
+		return "everything"
+	case r.Months == 0:
+		return fmt.Sprintf("daily for %d days, then monthly", r.Days)
+	}
+	return fmt.Sprintf("daily for %d days, then monthly for %d months", r.Days, r.Months)
+}
+
+// keep reports which of times (one per run, oldest first) to keep as of
+// now: the latest of each day or month bucket, and always the latest run.
+// Ties go to the later run.
+func (r Retention) keep(times []time.Time, now time.Time) []bool {
+	out := make([]bool, len(times))
+	if r.Days == 0 {
+		for i := range out {
+			out[i] = true
+		}
+		return out
+	}
+	dailyFrom := now.AddDate(0, 0, -r.Days)
+	var oldest time.Time
+	if r.Months > 0 {
+		oldest = dailyFrom.AddDate(0, -r.Months, 0)
+	}
+	latest := map[string]int{} // bucket -> index of its latest run
+	newest := -1
+	for i, t := range times {
+		if newest < 0 || !t.Before(times[newest]) {
+			newest = i
+		}
+		var bucket string
+		switch {
+		case !t.Before(dailyFrom):
+			bucket = t.UTC().Format("2006-01-02")
+		case t.After(oldest):
+			bucket = t.UTC().Format("2006-01")
+		default:
+			continue
+		}
+		if j, ok := latest[bucket]; !ok || !t.Before(times[j]) {
+			latest[bucket] = i
+		}
+	}
+	for _, i := range latest {
+		out[i] = true
+	}
+	if newest >= 0 {
+		out[newest] = true
+	}
+	return out
+}
+
+// pruneRuns drops runs the Retain policy doesn't keep and returns how many.
+// Rows they last wrote stay: they are the current data, whichever run
+// stored them. The caller holds db.mu.
+func (db *corpusDB) pruneRuns(now time.Time) int {
+	times := make([]time.Time, len(db.runs))
+	for i, run := range db.runs {
+		if s, ok := run.Values[1].(string); ok {
+			times[i], _ = time.Parse(time.RFC3339, s)
+		}
+	}
+	keep := db.Retain.keep(times, now)
+	var kept []sqliteRow
+	for i, run := range db.runs {
+		if keep[i] {
+			kept = append(kept, run)
+		}
+	}
+	dropped := len(db.runs) - len(kept)
+	db.runs = kept
+	return dropped
+}
+
+// compactDelta deletes the data files of delta table versions the policy
+// doesn't keep, like a Delta VACUUM: those versions stay in the log but can
+// no longer be read by time travel. Every efcr commit overwrites the
+// table, so a version's files are the ones it added.
+func compactDelta(dir string, r Retention, now time.Time) (int, error) {
+	logDir := filepath.Join(dir, "_delta_log")
+	type version struct {
+		time time.Time
+		adds []string
+	}
+	var versions []version
+	for {
+		f, err := os.Open(filepath.Join(logDir, fmt.Sprintf("%020d.json", len(versions))))
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		var v version
+		sc := bufio.NewScanner(f)
+		sc.Buffer(nil, 16<<20)
+		for sc.Scan() {
+			var a struct {
+				CommitInfo *struct{ Timestamp int64 } `json:"commitInfo"`
+				Add        *struct{ Path string }     `json:"add"`
+			}
+			if err := json.Unmarshal(sc.Bytes(), &a); err != nil {
+				f.Close()
+				return 0, fmt.Errorf("%s: %w", f.Name(), err)
+			}
+			if a.CommitInfo != nil {
+				v.time = time.UnixMilli(a.CommitInfo.Timestamp)
+			}
+			if a.Add != nil {
+				v.adds = append(v.adds, a.Add.Path)
+			}
+		}
+		f.Close()
+		if err := sc.Err(); err != nil {
+			return 0, err
+		}
+		versions = append(versions, v)
+	}
+	times := make([]time.Time, len(versions))
+	for i, v := range versions {
+		times[i] = v.time
+	}
+	keep := r.keep(times, now)
+	removed := 0
+	for i, v := range versions {
+		if keep[i] {
+			continue
+		}
+		for _, p := range v.adds {
+			err := os.Remove(filepath.Join(dir, filepath.FromSlash(p)))
+			if err == nil {
+				removed++
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return removed, err
+			}
+		}
+	}
+	return removed, nil
+}
+
+// runCompact applies a retention policy to the stores a scheduled crawl
+// keeps adding to, for deployments that would rather compact on their own
+// schedule than on every crawl --retain.
+//
+//	efcr compact --retain 90d,24m --db corpus.db --delta facts/
+func runCompact(args []string) error {
+	fs := flag.NewFlagSet("compact", flag.ExitOnError)
+	retain := fs.String("retain", "90d", "keep one run a day for DAYS, then one a month (for MONTHS, if given): DAYSd[,MONTHSm]")
+	dbPath := fs.String("db", "", "crawl --db database whose runs to prune")
+	deltaDir := fs.String("delta", "", "crawl --facts-format delta table whose old versions' files to delete")
+	fs.Parse(args)
+	policy, err := parseRetention(*retain)
+	if err != nil {
+		return err
+	}
+	if *dbPath == "" && *deltaDir == "" {
+		return errors.New("nothing to compact: give --db, --delta or both")
+	}
+	return applyRetention(policy, *dbPath, *deltaDir, time.Now())
+}
+
+// applyRetention compacts the corpus database at dbPath and the delta table
+// at deltaDir, either of which may be empty.
+func applyRetention(policy Retention, dbPath, deltaDir string, now time.Time) error {
+	if dbPath != "" {
+		db, err := openCorpusDB(dbPath, nil)
+		if err != nil {
+			return err
+		}
+		db.Retain = policy
+		n, err := db.compact(now)
+		if err != nil {
+			return err
+		}
+		slog.Info("pruned runs", "db", dbPath, "runs", n, "keeping", policy.String())
+	}
+	if deltaDir != "" {
+		n, err := compactDelta(deltaDir, policy, now)
+		if err != nil {
+			return err
+		}
+		slog.Info("deleted files of old versions", "dir", deltaDir, "files", n, "keeping", policy.String())
+	}
+	return nil
+}
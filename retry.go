@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errRetryBudget is the cancellation cause of a run that exhausted its
+// RetryBudget.
+var errRetryBudget = errors.New("retry budget exhausted")
+
+// RetryBudget caps retries at a fraction of all requests across a run.
+// Backoff alone copes with a blip; when the API is down or throttling
+// everyone, hundreds of goroutines backing off would just keep a crawl
+// limping for hours, so once the budget is spent the run is aborted with a
+// clear error instead.
+type RetryBudget struct {
+	Ratio float64 // retries allowed per request, e.g. 0.05
+	// Min retries are always allowed, so a short run isn't aborted by the
+	// first few failures before the ratio means anything.
+	Min int
+	// Abort is called once, when the budget runs out.
+	Abort func(cause error)
+
+	mu        sync.Mutex
+	requests  int
+	retries   int
+	exhausted bool
+}
+
+func (b *RetryBudget) request() {
+	b.mu.Lock()
+	b.requests++
+	b.mu.Unlock()
+}
+
+// spend takes one retry from the budget, or reports it exhausted.
+func (b *RetryBudget) spend() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.exhausted {
+		return false
+	}
+	if b.retries >= b.Min && float64(b.retries+1) > b.Ratio*float64(b.requests) {
+		b.exhausted = true
+		err := fmt.Errorf("%w: %d retries for %d requests (limit %g%%); the API looks unhealthy",
+			errRetryBudget, b.retries, b.requests, b.Ratio*100)
+		slog.Error(err.Error())
+		if b.Abort != nil {
+			b.Abort(err)
+		}
+		return false
+	}
+	b.retries++
+	return true
+}
+
+// RetryClient retries transient failures (network errors, 429 and 5xx)
+// with exponential backoff and jitter, drawing every retry from a shared
+// budget. A Retry-After from the server replaces the backoff for that wait.
+type RetryClient struct {
+	Client   httpclient
+	Budget   *RetryBudget
+	Attempts int           // including the first
+	Backoff  time.Duration // before the first retry, doubling after
+	// MaxBackoff caps the doubling, and any Retry-After asked for.
+	MaxBackoff time.Duration
+	// Deadline bounds the time spent on one request, retries and waits
+	// included; zero means no bound beyond Attempts. A retry whose wait
+	// would end past it is not made.
+	Deadline time.Duration
+}
+
+func NewRetryClient(budget *RetryBudget, client httpclient) *RetryClient {
+	return &RetryClient{Client: client, Budget: budget, Attempts: 4, Backoff: time.Second, MaxBackoff: time.Minute}
+}
+
+// retryable reports whether a status is worth asking again for.
+func retryable(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// retryAfter reads a Retry-After header, either delay-seconds or an HTTP
+// date, as a wait from now; ok is false when there is none.
+func retryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// jitter spreads a wait over [d/2, d) so clients throttled together don't
+// come back together.
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	return d/2 + rand.N(d/2)
+}
+
+func (rc *RetryClient) Do(req *http.Request) (*http.Response, error) {
+	rc.Budget.request()
+	start := time.Now()
+	backoff := rc.Backoff
+	for attempt := 1; ; attempt++ {
+		resp, err := rc.Client.Do(req)
+		ctx := req.Context()
+		if ctx.Err() != nil || attempt >= rc.Attempts {
+			return resp, err
+		}
+		if err == nil && !retryable(resp.StatusCode) {
+			return resp, nil
+		}
+		wait := jitter(backoff)
+		if err == nil {
+			if d, ok := retryAfter(resp.Header, time.Now()); ok {
+				wait = d
+			}
+		}
+		if rc.MaxBackoff > 0 {
+			wait = min(wait, rc.MaxBackoff)
+		}
+		if rc.Deadline > 0 && time.Since(start)+wait > rc.Deadline {
+			slog.Warn("giving up: retry would pass the deadline", append(urlAttrs(req.URL.String()),
+				"url", req.URL.String(), "wait", wait.Round(time.Millisecond), "deadline", rc.Deadline)...)
+			return resp, err
+		}
+		if !rc.Budget.spend() {
+			return resp, err
+		}
+		attrs := append(urlAttrs(req.URL.String()), "url", req.URL.String(), "wait", wait.Round(time.Millisecond))
+		if err != nil {
+			slog.Warn("retry", append(attrs, "err", err)...)
+		} else {
+			slog.Warn("retry", append(attrs, "status", resp.StatusCode)...)
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := sleepCtx(ctx, wait); err != nil {
+			return nil, err
+		}
+		backoff *= 2
+	}
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
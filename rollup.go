@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Fact is one measurement at the finest grain we record. Reports build a
+// slice of facts and let a Rollup do all grouping and date bucketing.
+type Fact struct {
+	Title   int     `json:"title"`
+	Chapter string  `json:"chapter,omitempty"`
+	Part    string  `json:"part,omitempty"`
+	Section string  `json:"section,omitempty"`
+	Agency  string  `json:"agency,omitempty"`
+	Date    string  `json:"date"` // YYYY-MM-DD
+	Metric  string  `json:"metric"`
+	Value   float64 `json:"value"`
+	// Source names the dataset an imported fact came from (see `efcr
+	// import`); empty for efcr's own measurements.
+	Source string `json:"source,omitempty"`
+}
+
+// ownSource is the source of facts efcr measured itself.
+const ownSource = "efcr"
+
+func (f *Fact) source() string {
+	if f.Source == "" {
+		return ownSource
+	}
+	return f.Source
+}
+
+// Bucket maps a fact date to the label of the period it falls in; ok is
+// false for dates outside every period.
+type Bucket func(date string) (label string, ok bool)
+
+// binBucket buckets by day, month, quarter or year. An empty bin puts every
+// date in one unlabelled bucket.
+func binBucket(bin string) (Bucket, error) {
+	switch bin {
+	case "":
+		return func(string) (string, bool) { return "", true }, nil
+	case "day":
+		return func(d string) (string, bool) { return d, true }, nil
+	}
+	if _, err := binStart("2000-01-01", bin); err != nil {
+		return nil, err
+	}
+	return func(d string) (string, bool) {
+		t, err := binStart(d, bin)
+		if err != nil {
+			return "", false
+		}
+		return binLabel(t, bin), true
+	}, nil
+}
+
+// periodBucket buckets into named [start, end) periods.
+func periodBucket(periods []period) Bucket {
+	return func(d string) (string, bool) {
+		for _, p := range periods {
+			if d >= p.start && (p.end == "" || d < p.end) {
+				return p.name, true
+			}
+		}
+		return "", false
+	}
+}
+
+// Rollup sums fact values grouped by any of the dimensions title, chapter,
+// part, section and agency, per metric and per date bucket, in one pass.
+type Rollup struct {
+	GroupBy []string
+	Bucket  Bucket // nil means no date dimension
+}
+
+// RollupRow is one aggregated cell. Key holds the group-by values in order.
+type RollupRow struct {
+	Key    []string
+	Period string
+	Metric string
+	Value  float64 // sum
+	Min    float64
+	Max    float64
+	Facts  int // how many facts were summed
+}
+
+var rollupDims = map[string]func(f *Fact) string{
+	"title":   func(f *Fact) string { return fmt.Sprintf("Title %d", f.Title) },
+	"chapter": func(f *Fact) string { return f.Chapter },
+	"part":    func(f *Fact) string { return citation(f.Title, f.Part, "") },
+	"section": func(f *Fact) string { return f.Section },
+	"agency": func(f *Fact) string {
+		if f.Agency == "" {
+			return "(unassigned)"
+		}
+		return f.Agency
+	},
+	"source": (*Fact).source,
+}
+
+func (r Rollup) validate() error {
+	for _, d := range r.GroupBy {
+		if rollupDims[d] == nil {
+			return fmt.Errorf("unknown dimension %q (title|chapter|part|section|agency|source)", d)
+		}
+	}
+	return nil
+}
+
+// Run aggregates facts. Rows come back sorted by key, period, then metric.
+func (r Rollup) Run(facts []Fact) ([]RollupRow, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	cells := map[string]*RollupRow{}
+	key := make([]string, len(r.GroupBy))
+	for i := range facts {
+		f := &facts[i]
+		period := ""
+		if r.Bucket != nil {
+			var ok bool
+			if period, ok = r.Bucket(f.Date); !ok {
+				continue
+			}
+		}
+		for j, d := range r.GroupBy {
+			key[j] = rollupDims[d](f)
+		}
+		id := strings.Join(key, "\x00") + "\x01" + period + "\x01" + f.Metric
+		c := cells[id]
+		if c == nil {
+			c = &RollupRow{Key: append([]string(nil), key...), Period: period, Metric: f.Metric, Min: f.Value, Max: f.Value}
+			cells[id] = c
+		}
+		c.Value += f.Value
+		c.Min = min(c.Min, f.Value)
+		c.Max = max(c.Max, f.Value)
+		c.Facts++
+	}
+
+	rows := make([]RollupRow, 0, len(cells))
+	for _, c := range cells {
+		rows = append(rows, *c)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if k := strings.Join(a.Key, "\x00"); k != strings.Join(b.Key, "\x00") {
+			return k < strings.Join(b.Key, "\x00")
+		}
+		if a.Period != b.Period {
+			return a.Period < b.Period
+		}
+		return a.Metric < b.Metric
+	})
+	return rows, nil
+}
+
+// eventFacts turns amendment events into count facts: "amendments" for
+// every event plus one named after its type (added, modified, removed).
+func eventFacts(events []AmendmentEvent) []Fact {
+	facts := make([]Fact, 0, 2*len(events))
+	for _, e := range events {
+		base := Fact{Title: e.Title, Part: e.Part, Section: e.Section, Agency: e.Agency, Date: e.Date, Value: 1}
+		base.Metric = "amendments"
+		facts = append(facts, base)
+		base.Metric = e.Type
+		facts = append(facts, base)
+	}
+	return facts
+}
+
+// setAgencies fills in Agency on facts from an ownership index.
+func setAgencies(facts []Fact, own ownership) {
+	for i := range facts {
+		facts[i].Agency = own.lookup(facts[i].Title, facts[i].Part).Agency
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Cache is a Cache in an S3 bucket or any store speaking its API (MinIO,
+// R2, GCS's interoperability mode), so crawlers in containers and CI can
+// share one durable cache. Each entry is two objects under the prefix: the
+// body, named by its key, and key.meta, its CacheMeta as JSON.
+//
+// Requests are signed with AWS Signature Version 4 by hand, keeping efcr
+// free of the AWS SDK. Credentials and endpoint come from the environment
+// variables the SDKs read: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY,
+// AWS_SESSION_TOKEN, AWS_REGION (or AWS_DEFAULT_REGION; default us-east-1)
+// and AWS_ENDPOINT_URL_S3 (or AWS_ENDPOINT_URL) for stores other than AWS,
+// which are addressed path-style.
+type s3Cache struct {
+	Bucket   string
+	Prefix   string // with a trailing slash, or empty
+	Region   string
+	Endpoint string // scheme and host; empty for AWS
+	Client   *http.Client
+
+	accessKey, secretKey, sessionToken string
+}
+
+// newS3Cache configures an s3Cache for s3://BUCKET/PREFIX from the
+// environment.
+func newS3Cache(spec string) (*s3Cache, error) {
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(spec, "s3://"), "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("bad -cache-store %q: want s3://BUCKET/PREFIX", spec)
+	}
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		prefix += "/"
+	}
+	sc := &s3Cache{
+		Bucket:       bucket,
+		Prefix:       prefix,
+		Region:       firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		Endpoint:     strings.TrimSuffix(firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"), "/"),
+		Client:       &http.Client{Timeout: 5 * time.Minute},
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if sc.Region == "" {
+		sc.Region = "us-east-1"
+	}
+	if sc.accessKey == "" || sc.secretKey == "" {
+		return nil, fmt.Errorf("-cache-store %s: set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY", spec)
+	}
+	return sc, nil
+}
+
+func firstEnv(names ...string) string {
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// objectURL returns the URL of the object name under the prefix.
+func (sc *s3Cache) objectURL(name string) string {
+	path := "/" + s3Escape(sc.Prefix+name)
+	if sc.Endpoint != "" {
+		return sc.Endpoint + "/" + s3Escape(sc.Bucket) + path
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com%s", sc.Bucket, sc.Region, path)
+}
+
+// s3Escape percent-encodes a key as SigV4 canonicalizes it: everything but
+// unreserved characters and slashes.
+func s3Escape(key string) string {
+	var b strings.Builder
+	for _, c := range []byte(key) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', strings.IndexByte("-._~/", c) >= 0:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// do sends a signed request for an object. A 404 is fs.ErrNotExist; other
+// failures carry S3's status. The caller closes the body of a 200.
+func (sc *s3Cache) do(ctx context.Context, method, name string, body io.Reader, size int64) (*http.Response, error) {
+	if body != nil {
+		// not the caller's file itself, which the transport would close
+		body = io.LimitReader(body, size)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, sc.objectURL(name), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+	sc.sign(req, time.Now().UTC())
+	resp, err := sc.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3://%s/%s%s: %w", sc.Bucket, sc.Prefix, name, fs.ErrNotExist)
+	case resp.StatusCode/100 != 2:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s: %s: %s", method, name, resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp, nil
+}
+
+// sign adds AWS Signature Version 4 headers to req. Bodies go unsigned
+// (UNSIGNED-PAYLOAD), which TLS makes safe and saves hashing them twice.
+func (sc *s3Cache) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	if sc.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sc.sessionToken)
+	}
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		if k = strings.ToLower(k); strings.HasPrefix(k, "x-amz-") {
+			headers[k] = strings.TrimSpace(v[0])
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonical strings.Builder
+	for _, k := range names {
+		canonical.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+	request := strings.Join([]string{req.Method, req.URL.EscapedPath(), req.URL.RawQuery, canonical.String(), signed, "UNSIGNED-PAYLOAD"}, "\n")
+	scope := day + "/" + sc.Region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(request))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := []byte("AWS4" + sc.secretKey)
+	for _, part := range []string{day, sc.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sc.accessKey, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+func (sc *s3Cache) Stat(ctx context.Context, key string) (CacheMeta, error) {
+	resp, err := sc.do(ctx, http.MethodGet, key+".meta", nil, 0)
+	if err != nil {
+		return CacheMeta{}, err
+	}
+	defer resp.Body.Close()
+	var meta CacheMeta
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		return CacheMeta{}, fmt.Errorf("s3 %s.meta: %w", key, err)
+	}
+	return meta, nil
+}
+
+func (sc *s3Cache) Get(ctx context.Context, key string) (io.ReadCloser, CacheMeta, error) {
+	meta, err := sc.Stat(ctx, key)
+	if err != nil {
+		return nil, CacheMeta{}, err
+	}
+	resp, err := sc.do(ctx, http.MethodGet, key, nil, 0)
+	if err != nil {
+		return nil, CacheMeta{}, err
+	}
+	return resp.Body, meta, nil
+}
+
+// Put uploads the body, then the metadata, so an entry is never visible
+// (Stat finds no .meta) before its body is complete.
+func (sc *s3Cache) Put(ctx context.Context, key string, body io.Reader, meta CacheMeta) error {
+	if body != nil {
+		size := int64(-1)
+		if f, ok := body.(*os.File); ok {
+			if info, err := f.Stat(); err == nil {
+				pos, _ := f.Seek(0, io.SeekCurrent)
+				size = info.Size() - pos
+			}
+		}
+		if size < 0 {
+			b, err := io.ReadAll(body)
+			if err != nil {
+				return err
+			}
+			body, size = bytes.NewReader(b), int64(len(b))
+		}
+		resp, err := sc.do(ctx, http.MethodPut, key, body, size)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		meta.Size = size
+	}
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	resp, err := sc.do(ctx, http.MethodPut, key+".meta", bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Delete removes the metadata first, so a half-deleted entry is a miss.
+func (sc *s3Cache) Delete(ctx context.Context, key string) error {
+	for _, name := range []string{key + ".meta", key} {
+		resp, err := sc.do(ctx, http.MethodDelete, name, nil, 0)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/pipeline"
+)
+
+// sectionCount compares the sections parsed from a snapshot's XML with the
+// sections the structure endpoint lists for the same title and date, summed
+// over the parts crawled when the crawl is restricted to parts.
+type sectionCount struct {
+	XML       int
+	Structure int
+	Err       error
+}
+
+// mismatch reports whether the two counts differ by more than threshold,
+// as a fraction of the larger.
+func (s sectionCount) mismatch(threshold float64) bool {
+	hi := max(s.XML, s.Structure)
+	if hi == 0 {
+		return false
+	}
+	return float64(abs(s.XML-s.Structure))/float64(hi) > threshold
+}
+
+// sectionSanity is a built-in correctness check: if parsing drops or
+// invents sections it shows up as a disagreement with the structure API.
+type sectionSanity struct {
+	mu      sync.Mutex
+	byTitle map[int]map[string]sectionCount
+}
+
+func (ss *sectionSanity) analyzer(ctx context.Context, c httpclient) pipeline.Analyzer {
+	return pipeline.Analyzer{
+		Name: "sections",
+		Compute: func(meta pipeline.DocMeta, doc *core.ECFRFile) (any, error) {
+			n := 0
+			core.WalkSections(doc.Root(), func(*core.Div) { n++ })
+			return n, nil
+		},
+		Apply: func(meta pipeline.DocMeta, result json.RawMessage) error {
+			var sc sectionCount
+			if err := json.Unmarshal(result, &sc.XML); err != nil {
+				return err
+			}
+			// structure fetches are cached, so re-runs cost nothing extra
+			root, err := newAPI(c).Structure(ctx, meta.Title, meta.Date)
+			if err != nil {
+				sc.Err = err
+			} else if meta.Part == "" {
+				sc.Structure = root.Sections()
+			} else if node := root.Find("part", meta.Part); node != nil {
+				sc.Structure = node.Sections()
+			}
+			ss.mu.Lock()
+			defer ss.mu.Unlock()
+			if ss.byTitle == nil {
+				ss.byTitle = map[int]map[string]sectionCount{}
+			}
+			if ss.byTitle[meta.Title] == nil {
+				ss.byTitle[meta.Title] = map[string]sectionCount{}
+			}
+			prev := ss.byTitle[meta.Title][meta.Date]
+			sc.XML += prev.XML
+			sc.Structure += prev.Structure
+			if sc.Err == nil {
+				sc.Err = prev.Err
+			}
+			ss.byTitle[meta.Title][meta.Date] = sc
+			return nil
+		},
+	}
+}
+
+// totals sums both counts over every measured date of a title.
+func (ss *sectionSanity) totals(title int) (xml, structure int) {
+	for _, sc := range ss.byTitle[title] {
+		xml += sc.XML
+		structure += sc.Structure
+	}
+	return xml, structure
+}
+
+// printMismatches lists every (title, date) whose counts disagree by more
+// than threshold, or whose structure could not be fetched.
+func (ss *sectionSanity) printMismatches(w io.Writer, threshold float64) {
+	var titles []int
+	for t := range ss.byTitle {
+		titles = append(titles, t)
+	}
+	sort.Ints(titles)
+	for _, t := range titles {
+		var dates []string
+		for d := range ss.byTitle[t] {
+			dates = append(dates, d)
+		}
+		sort.Strings(dates)
+		for _, d := range dates {
+			sc := ss.byTitle[t][d]
+			switch {
+			case sc.Err != nil:
+				fmt.Fprintf(w, "SANITY\ttitle %d %s: structure unavailable: %v\n", t, d, sc.Err)
+			case sc.mismatch(threshold):
+				fmt.Fprintf(w, "SANITY\ttitle %d %s: %d sections parsed, structure lists %d\n", t, d, sc.XML, sc.Structure)
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// Every file efcr keeps across runs carries a schema version so stores
+// outlive tool upgrades: older versions are migrated when opened, newer ones
+// are refused rather than misread.
+const (
+	factsSchema       = "efcr-facts"
+	factsVersion      = 3 // v1: no header line; v2: no source
+	checkpointSchema  = "efcr-checkpoint"
+	checkpointVersion = 3 // v1: no header line; v2: no excluded parts
+	manifestVersion   = 1
+	// corpusDBSchema is the crawl --db SQLite database, whose version is
+	// its user_version.
+	corpusDBSchema  = "efcr-sqlite"
+	corpusDBVersion = 2 // v1: no versions.section_id
+	// resultsVersion is folded into result cache keys, so bumping it simply
+	// makes older entries miss.
+	resultsVersion = 1
+)
+
+// schemaHeader is the first line of every NDJSON file efcr writes.
+type schemaHeader struct {
+	Schema  string `json:"schema"`
+	Version int    `json:"version"`
+}
+
+func writeSchemaHeader(w io.Writer, schema string, version int) error {
+	return json.NewEncoder(w).Encode(schemaHeader{schema, version})
+}
+
+// checkSchema inspects the first record of an NDJSON file. Files from before
+// headers existed report version 1 with isHeader false, and first is then an
+// ordinary record the caller still has to process.
+func checkSchema(path string, first json.RawMessage, schema string, current int) (version int, isHeader bool, err error) {
+	var h schemaHeader
+	if json.Unmarshal(first, &h) != nil || h.Schema == "" {
+		return 1, false, nil
+	}
+	if h.Schema != schema {
+		return 0, true, fmt.Errorf("%s is a %s file, not %s", path, h.Schema, schema)
+	}
+	if h.Version > current {
+		return 0, true, fmt.Errorf("%s was written by a newer efcr (%s v%d, this build reads up to v%d); "+
+			"upgrade with `go install github.com/paulgmiller/efcr@latest`", path, schema, h.Version, current)
+	}
+	return h.Version, true, nil
+}
+
+// printVersion reports the tool version and the file schemas it reads and
+// writes, for matching a result store to the build that made it.
+func printVersion() {
+	fmt.Printf("efcr %s\n", toolVersion())
+	fmt.Printf("%s\tv%d\n", factsSchema, factsVersion)
+	fmt.Printf("%s\tv%d\n", checkpointSchema, checkpointVersion)
+	fmt.Printf("%s\tv%d\n", deadlinesSchema, deadlinesVersion)
+	fmt.Printf("%s\tv%d\n", graphicsSchema, graphicsVersion)
+	fmt.Printf("%s\tv%d\n", bundleSchema, bundleVersion)
+	fmt.Printf("%s\tv%d\n", cacheIndexSchema, cacheIndexVersion)
+	fmt.Printf("%s\tv%d\n", corpusDBSchema, corpusDBVersion)
+	fmt.Printf("efcr-manifest\tv%d\n", manifestVersion)
+	fmt.Printf("efcr-results\tv%d\n", resultsVersion)
+}
+
+// schemas holds a JSON Schema for every machine-readable output: NDJSON
+// records, the run and bundle manifests, the crawl report, serve responses
+// and the plugin protocol. Keep them in step with the structs they describe.
+//
+//go:embed schemas/*.schema.json
+var schemas embed.FS
+
+// runSchema prints the named JSON Schema, or lists them all.
+//
+//	efcr schema            # names and descriptions
+//	efcr schema facts      # the schema itself
+func runSchema(args []string) error {
+	if len(args) == 0 {
+		names, err := fs.Glob(schemas, "schemas/*.schema.json")
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			b, err := schemas.ReadFile(name)
+			if err != nil {
+				return err
+			}
+			var doc struct {
+				Title string `json:"title"`
+			}
+			if err := json.Unmarshal(b, &doc); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			fmt.Printf("%s\t%s\n", strings.TrimSuffix(path.Base(name), ".schema.json"), doc.Title)
+		}
+		return nil
+	}
+	b, err := schemas.ReadFile("schemas/" + args[0] + ".schema.json")
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("unknown schema %q; run `efcr schema` for the list", args[0])
+	}
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(b)
+	return err
+}
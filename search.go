@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+const (
+	searchResultsURL = "https://www.ecfr.gov/api/search/v1/results"
+	searchCountURL   = "https://www.ecfr.gov/api/search/v1/count"
+)
+
+// SearchParams is a query to the eCFR Search Service. Zero fields are left
+// to the service's defaults (every agency, title and date; page 1 of 20).
+type SearchParams struct {
+	Query    string
+	Agencies []string // agency slugs, as in `efcr agencies`
+	Title    int
+	Part     string
+	Date     string // search the text in effect on this date
+	// ModifiedAfter and ModifiedBefore bound when hits last changed,
+	// exclusive (YYYY-MM-DD).
+	ModifiedAfter, ModifiedBefore string
+	Page, PerPage                 int
+}
+
+func (p SearchParams) values() url.Values {
+	v := url.Values{}
+	v.Set("query", p.Query)
+	for _, a := range p.Agencies {
+		v.Add("agency_slugs[]", a)
+	}
+	if p.Title != 0 {
+		v.Set("hierarchy[title]", strconv.Itoa(p.Title))
+	}
+	if p.Part != "" {
+		v.Set("hierarchy[part]", p.Part)
+	}
+	set := func(k, val string) {
+		if val != "" {
+			v.Set(k, val)
+		}
+	}
+	set("date", p.Date)
+	set("last_modified_after", p.ModifiedAfter)
+	set("last_modified_before", p.ModifiedBefore)
+	if p.Page > 0 {
+		v.Set("page", strconv.Itoa(p.Page))
+	}
+	if p.PerPage > 0 {
+		v.Set("per_page", strconv.Itoa(p.PerPage))
+	}
+	return v
+}
+
+// SearchHit is one search result, reduced to where it is and what matched.
+type SearchHit struct {
+	Citation string  `json:"citation"`
+	ID       string  `json:"id"` // core.SectionID
+	Title    int     `json:"title"`
+	Part     string  `json:"part,omitempty"`
+	Section  string  `json:"section,omitempty"`
+	Type     string  `json:"type"`
+	Heading  string  `json:"heading"`
+	Snippet  string  `json:"snippet"` // plain text, matches not marked
+	StartsOn string  `json:"starts_on,omitempty"`
+	EndsOn   string  `json:"ends_on,omitempty"`
+	Score    float64 `json:"score"`
+	Removed  bool    `json:"removed,omitempty"`
+}
+
+// searchResult is the service's shape for one result.
+type searchResult struct {
+	StartsOn  string            `json:"starts_on"`
+	EndsOn    string            `json:"ends_on"`
+	Type      string            `json:"type"`
+	Hierarchy map[string]string `json:"hierarchy"`
+	Headings  map[string]string `json:"headings"`
+	Excerpt   string            `json:"full_text_excerpt"`
+	Score     float64           `json:"score"`
+	Removed   bool              `json:"removed"`
+}
+
+// searchPage is one page of results.
+type searchPage struct {
+	Hits       []SearchHit
+	Page       int
+	TotalPages int
+	TotalCount int
+}
+
+// searchLevels are the hierarchy levels a result's heading is taken from,
+// innermost first.
+var searchLevels = []string{"appendix", "section", "subject_group", "subpart", "part", "subchapter", "chapter", "subtitle", "title"}
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// hit converts a result, formatting its citation like core.Ref.
+func (r searchResult) hit() SearchHit {
+	title, _ := strconv.Atoi(r.Hierarchy["title"])
+	h := SearchHit{Title: title, Part: r.Hierarchy["part"], Section: r.Hierarchy["section"], Type: r.Type,
+		StartsOn: r.StartsOn, EndsOn: r.EndsOn, Score: r.Score, Removed: r.Removed}
+	h.Snippet = strings.Join(strings.Fields(html.UnescapeString(htmlTagPattern.ReplaceAllString(r.Excerpt, ""))), " ")
+	for _, l := range searchLevels {
+		if heading := r.Headings[l]; heading != "" {
+			h.Heading = strings.TrimSpace(heading)
+			break
+		}
+	}
+	switch {
+	case h.Section != "" || h.Part != "":
+		h.Citation = core.Ref{Title: title, Part: h.Part, Section: h.Section}.String()
+	default:
+		h.Citation = citation(title, "", "")
+	}
+	id := core.SectionID{Title: title, Chapter: r.Hierarchy["chapter"], Part: h.Part, Section: h.Section}
+	if a := r.Hierarchy["appendix"]; a != "" && h.Section == "" {
+		h.Citation += ", " + a
+		id.Section = a
+	}
+	h.ID = id.String()
+	return h
+}
+
+// searchResults fetches one page of results for p.
+func searchResults(ctx context.Context, c httpclient, p SearchParams) (searchPage, error) {
+	var resp struct {
+		Results []searchResult `json:"results"`
+		Meta    struct {
+			CurrentPage int `json:"current_page"`
+			TotalPages  int `json:"total_pages"`
+			TotalCount  int `json:"total_count"`
+		} `json:"meta"`
+	}
+	if err := ecfr.GetJSON(ctx, c, searchResultsURL+"?"+p.values().Encode(), &resp); err != nil {
+		return searchPage{}, fmt.Errorf("search %q: %w", p.Query, err)
+	}
+	page := searchPage{Page: resp.Meta.CurrentPage, TotalPages: resp.Meta.TotalPages, TotalCount: resp.Meta.TotalCount}
+	for _, r := range resp.Results {
+		page.Hits = append(page.Hits, r.hit())
+	}
+	return page, nil
+}
+
+// searchCount asks how many results p has, without fetching them.
+func searchCount(ctx context.Context, c httpclient, p SearchParams) (int, error) {
+	var resp struct {
+		Meta struct {
+			TotalCount int `json:"total_count"`
+		} `json:"meta"`
+	}
+	if err := ecfr.GetJSON(ctx, c, searchCountURL+"?"+p.values().Encode(), &resp); err != nil {
+		return 0, fmt.Errorf("search count %q: %w", p.Query, err)
+	}
+	return resp.Meta.TotalCount, nil
+}
+
+// runSearch runs a full-text query against the eCFR Search Service and
+// prints the hits with their citation, heading and a snippet of the match.
+//
+//	efcr search "small business"
+//	efcr search --agency environmental-protection-agency --title 40 --modified-after 2024-01-01 --limit 200 emission
+func runSearch(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	var agencies stringsFlag
+	fs.Var(&agencies, "agency", "only hits in this agency's regulations, by slug (repeatable)")
+	title := fs.Int("title", 0, "only hits in this title")
+	part := fs.String("part", "", "only hits in this part (with --title)")
+	date := fs.String("date", "", "search the text in effect on this date YYYY-MM-DD (default current)")
+	after := fs.String("modified-after", "", "only hits last changed after this date YYYY-MM-DD")
+	before := fs.String("modified-before", "", "only hits last changed before this date YYYY-MM-DD")
+	page := fs.Int("page", 1, "first page of results to fetch")
+	perPage := fs.Int("per-page", 20, "results per page")
+	limit := fs.Int("limit", 20, "stop after this many hits, fetching further pages as needed (0 for all)")
+	asJSON := fs.Bool("json", false, "print one JSON object per hit")
+	fs.Parse(args)
+	query := strings.Join(fs.Args(), " ")
+	if query == "" {
+		return errors.New(`give a query, e.g. efcr search "small business"`)
+	}
+	if *part != "" && *title == 0 {
+		return errors.New("--part needs --title")
+	}
+	p := SearchParams{Query: query, Agencies: agencies, Title: *title, Part: *part, Date: *date,
+		ModifiedAfter: *after, ModifiedBefore: *before, Page: *page, PerPage: *perPage}
+
+	var hits []SearchHit
+	total := 0
+	for {
+		res, err := searchResults(ctx, c, p)
+		if err != nil {
+			return err
+		}
+		hits = append(hits, res.Hits...)
+		total = res.TotalCount
+		if len(res.Hits) == 0 || p.Page >= res.TotalPages || (*limit > 0 && len(hits) >= *limit) {
+			break
+		}
+		p.Page++
+	}
+	if *limit > 0 && len(hits) > *limit {
+		hits = hits[:*limit]
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, h := range hits {
+			if err := enc.Encode(h); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "Citation\tHeading\tSnippet")
+	for _, h := range hits {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", h.Citation, h.Heading, h.Snippet)
+	}
+	w.Flush()
+	fmt.Printf("%d of %d hits\n", len(hits), total)
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// defaultSearchQueries are run when searchcheck is given none: common
+// regulatory terms and phrases, a mix of single words and quoted phrases.
+var defaultSearchQueries = []string{
+	"emission", "inspection", "recordkeeping", "fee", "waiver",
+	`"small business"`, `"effective date"`, `"civil penalty"`, `"hazardous waste"`, `"Freedom of Information Act"`,
+}
+
+// SearchCheck is one searchcheck row: how many sections of a title match a
+// query locally and according to eCFR search on the same date.
+type SearchCheck struct {
+	Title      int     `json:"title"`
+	Date       string  `json:"date"`
+	Query      string  `json:"query"`
+	Local      int     `json:"local"`
+	Remote     int     `json:"remote"`
+	Divergence float64 `json:"divergence"` // (local - remote) / remote
+}
+
+// searchQuery is a parsed query: every term and every quoted phrase must
+// occur in a section for it to match, as in eCFR search's default mode.
+type searchQuery [][]string
+
+func parseSearchQuery(q string) searchQuery {
+	var out searchQuery
+	for i, chunk := range strings.Split(q, `"`) {
+		words := searchWords(chunk)
+		if i%2 == 1 { // inside quotes
+			if len(words) > 0 {
+				out = append(out, words)
+			}
+			continue
+		}
+		for _, w := range words {
+			out = append(out, []string{w})
+		}
+	}
+	return out
+}
+
+// searchWords splits text into lower-cased words the way the query and the
+// sections are compared: typography folded, punctuation dropped.
+func searchWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(core.NormalizeTypography(s)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// matches reports whether every phrase of q occurs in words.
+func (q searchQuery) matches(words []string) bool {
+	for _, phrase := range q {
+		found := false
+		for i := 0; i+len(phrase) <= len(words) && !found; i++ {
+			found = true
+			for j, w := range phrase {
+				if words[i+j] != w {
+					found = false
+					break
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return len(q) > 0
+}
+
+// runSearchCheck cross-checks local full-text matching against eCFR search:
+// for sample queries it counts matching sections in each title's text and
+// compares with the search API's count on the same date. Persistent gaps
+// point at sections missing from one index or the other, or at differences
+// in how queries are interpreted (eCFR search stems words; this doesn't).
+//
+//	efcr searchcheck --titles 21,40
+//	efcr searchcheck --titles 7 --date 2024-01-01 --query '"organic food"' --query labeling
+func runSearchCheck(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("searchcheck", flag.ExitOnError)
+	titleList := fs.String("titles", "", "comma separated title numbers to check")
+	date := fs.String("date", "", "snapshot date YYYY-MM-DD (default each title's latest)")
+	var queries stringsFlag
+	fs.Var(&queries, "query", `query to check; quote phrases, e.g. '"small business"' (repeatable; default a built-in sample)`)
+	queryFile := fs.String("queries", "", "file of queries to check, one per line")
+	tolerance := fs.Float64("tolerance", 0.1, "relative divergence counted as agreement")
+	asJSON := fs.Bool("json", false, "print one JSON object per title and query")
+	fs.Parse(args)
+	titles, err := parseTitles(*titleList)
+	if err != nil {
+		return err
+	}
+	if len(titles) == 0 {
+		return errors.New("--titles is required")
+	}
+	if *queryFile != "" {
+		f, err := os.Open(*queryFile)
+		if err != nil {
+			return err
+		}
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			if q := strings.TrimSpace(sc.Text()); q != "" && !strings.HasPrefix(q, "#") {
+				queries = append(queries, q)
+			}
+		}
+		f.Close()
+		if err := sc.Err(); err != nil {
+			return err
+		}
+	}
+	if len(queries) == 0 {
+		queries = defaultSearchQueries
+	}
+
+	nums := make([]int, 0, len(titles))
+	for t := range titles {
+		nums = append(nums, t)
+	}
+	sort.Ints(nums)
+	api := newAPI(c)
+	var checks []SearchCheck
+	for _, title := range nums {
+		d := *date
+		if d == "" {
+			if d, err = latestDate(ctx, api, title); err != nil {
+				return err
+			}
+		}
+		doc, err := api.Document(ctx, title, d, ecfr.Hierarchy{})
+		if err != nil {
+			return err
+		}
+		var sections [][]string
+		core.WalkSections(doc.Root(), func(s *core.Div) {
+			sections = append(sections, searchWords(strings.Join(core.DivTokens(s), " ")))
+		})
+		for _, q := range queries {
+			parsed := parseSearchQuery(q)
+			local := 0
+			for _, words := range sections {
+				if parsed.matches(words) {
+					local++
+				}
+			}
+			remote, err := searchCount(ctx, c, SearchParams{Query: q, Title: title, Date: d})
+			if err != nil {
+				return err
+			}
+			checks = append(checks, SearchCheck{Title: title, Date: d, Query: q, Local: local, Remote: remote,
+				Divergence: float64(local-remote) / float64(max(remote, 1))})
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, ch := range checks {
+			if err := enc.Encode(ch); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Title\tDate\tLocal\tRemote\tDivergence\tQuery\t")
+	var divs []float64
+	agree := 0
+	for _, ch := range checks {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%+.1f%%\t%s\t\n", ch.Title, ch.Date, ch.Local, ch.Remote, ch.Divergence*100, ch.Query)
+		divs = append(divs, math.Abs(ch.Divergence))
+		if math.Abs(ch.Divergence) <= *tolerance {
+			agree++
+		}
+	}
+	w.Flush()
+	sort.Float64s(divs)
+	fmt.Printf("%d of %d checks within %.0f%%; median absolute divergence %.1f%%\n",
+		agree, len(checks), *tolerance*100, divs[len(divs)/2]*100)
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// partChapters maps each part of title to the chapter holding it on date,
+// from the structure endpoint. Records that name a part but not its
+// chapter, like the versions endpoint's, take it from here for their
+// core.SectionID.
+func partChapters(ctx context.Context, c httpclient, title int, date string) (map[string]string, error) {
+	root, err := newAPI(c).Structure(ctx, title, date)
+	if err != nil {
+		return nil, fmt.Errorf("title %d structure: %w", title, err)
+	}
+	out := map[string]string{}
+	var walk func(n *ecfr.StructureNode, chapter string)
+	walk = func(n *ecfr.StructureNode, chapter string) {
+		switch n.Type {
+		case "chapter":
+			chapter = n.Identifier
+		case "part":
+			out[n.Identifier] = chapter
+			return
+		}
+		for i := range n.Children {
+			walk(&n.Children[i], chapter)
+		}
+	}
+	walk(root, "")
+	return out, nil
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// runServe exposes computed data over HTTP as JSON, for dashboards and
+// services that would otherwise shell out to the CLI.
+//
+//	efcr serve --addr :8080
+//
+// Statistics endpoints take a title (except /titles) and optional part;
+// dates default to the title's latest:
+//
+//	GET /titles                                     titles and currency dates
+//	GET /versions?title=40&part=60                  version history counts
+//	GET /words?title=40&part=60&date=2024-01-01     word count, as wordcount
+//	GET /diff?title=40&part=60&from=2023-01-01&to=2024-01-01&edits=true
+//	                                                changed sections, as diff --json
+//
+// Timeline endpoints take either title (+ optional part) or agency (slug)
+// an optional bin of month, quarter or year, and an optional date_field of
+// amendment or issue:
+//
+//	GET /timeline/amendments?title=6&part=11&bin=month&date_field=issue
+//	GET /timeline/words?agency=homeland-security-department&bin=quarter
+//
+// Section endpoints list a part's sections, or return one with its text,
+// as of date (default the title's latest). Removed sections are tombstones
+// (see Tombstone): listed under removed, and a 410 Gone with the tombstone
+// for one asked for by name, where a section that never existed is a 404:
+//
+//	GET /sections?title=40&part=60&date=2024-01-01
+//	GET /section?title=40&section=60.5
+//
+// GET /metrics reports upstream request latency and error rate per endpoint,
+// and GET /metrics/rate the adaptive rate limit's current state. A
+// Prometheus scrape of /metrics (Accept: text/plain, or ?format=prometheus)
+// gets the crawler's counters in the text format instead: requests by
+// status code, latency, bytes downloaded, cache hits and misses, rate limit
+// waits and titles processed.
+//
+// With -read-only the server answers from the cache a crawler filled and
+// never contacts the eCFR, so it can run with read access to that cache
+// only; timelines needing anything uncached are 404s:
+//
+//	efcr -read-only serve --addr :80
+//
+// With --tenants the data endpoints move under /ns/{namespace}/, need one
+// of the namespace's API keys and only answer for its watchlist (see
+// Tenant), and GET /ns/{namespace}/watchlist lists that:
+//
+//	efcr serve --tenants tenants.json
+//	curl -H "Authorization: Bearer $KEY" localhost:8080/ns/air/timeline/words?title=40&part=60
+//
+// Run watch --tenants with the same file to send each namespace its
+// notifications.
+func runServe(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "listen address")
+	tenantsPath := fs.String("tenants", "", "JSON file of namespaces with their API keys and watchlists; serve data endpoints per namespace only")
+	fs.Parse(args)
+
+	mux := http.NewServeMux()
+	// data endpoints, under /ns/{ns} with --tenants
+	handle := func(path string, h http.HandlerFunc) { mux.HandleFunc("GET "+path, h) }
+	if *tenantsPath != "" {
+		tenants, err := loadTenants(*tenantsPath)
+		if err != nil {
+			return err
+		}
+		handle = func(path string, h http.HandlerFunc) { mux.HandleFunc("GET /ns/{ns}"+path, withTenant(tenants, h)) }
+		handle("/watchlist", watchlistHandler(c))
+		slog.Info("serving namespaces", "namespaces", len(tenants))
+	}
+	handle("/timeline/amendments", timelineHandler(c, "amendments", "month", amendmentTimeline))
+	handle("/timeline/words", timelineHandler(c, "words", "quarter", wordsTimeline))
+	handle("/titles", titlesHandler(c))
+	handle("/versions", versionsHandler(c))
+	handle("/words", wordsHandler(c))
+	handle("/diff", diffHandler(c))
+	handle("/sections", sectionsHandler(c))
+	handle("/section", sectionHandler(c))
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		if wantsPrometheus(r) {
+			prometheusHandler(fetchMetrics, limited)(w, r)
+			return
+		}
+		writeJSON(w, fetchMetrics.Stats())
+	})
+	mux.HandleFunc("GET /metrics/rate", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, limited.Stats())
+	})
+
+	srv := &http.Server{Addr: *addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+	slog.Info("serving", "addr", *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// timelineResponse is shaped for charting libraries: one labelled series.
+type timelineResponse struct {
+	Metric    string          `json:"metric"`
+	Bin       string          `json:"bin"`
+	DateField string          `json:"date_field"`
+	Title     int             `json:"title,omitempty"`
+	Part      string          `json:"part,omitempty"`
+	Agency    string          `json:"agency,omitempty"`
+	Points    []TimelinePoint `json:"points"`
+}
+
+type timelineFunc func(ctx context.Context, c httpclient, scopes []scope, bin, dateField string) ([]TimelinePoint, error)
+
+func timelineHandler(c httpclient, metric, defaultBin string, fn timelineFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		resp := timelineResponse{Metric: metric, Bin: q.Get("bin"), DateField: q.Get("date_field"), Part: q.Get("part"), Agency: q.Get("agency")}
+		if resp.Bin == "" {
+			resp.Bin = defaultBin
+		}
+		if resp.DateField == "" {
+			resp.DateField = "amendment"
+		}
+		if err := validDateField(resp.DateField); err != nil {
+			httpError(w, http.StatusBadRequest, err)
+			return
+		}
+		if _, err := binStart("2000-01-01", resp.Bin); err != nil {
+			httpError(w, http.StatusBadRequest, err)
+			return
+		}
+		scopes, err := requestScopes(r.Context(), c, q)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, err)
+			return
+		}
+		if !tenantOf(r.Context()).allows(scopes) {
+			httpError(w, http.StatusForbidden, errors.New("not on this namespace's watchlist"))
+			return
+		}
+		if resp.Agency == "" {
+			resp.Title = scopes[0].title
+		}
+		if resp.Points, err = fn(r.Context(), c, scopes, resp.Bin, resp.DateField); err != nil {
+			httpError(w, upstreamStatus(err), err)
+			return
+		}
+		writeJSON(w, resp)
+	}
+}
+
+// requestScopes reads title/part or agency from a query string.
+func requestScopes(ctx context.Context, c httpclient, q url.Values) ([]scope, error) {
+	if slug := q.Get("agency"); slug != "" {
+		agencies, err := fetchAgencies(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		a := findAgency(agencies, slug)
+		if a == nil {
+			return nil, fmt.Errorf("unknown agency %q", slug)
+		}
+		return agencyScopes(ctx, c, a)
+	}
+	title, err := strconv.Atoi(q.Get("title"))
+	if err != nil || title <= 0 {
+		return nil, errors.New("title or agency is required")
+	}
+	return []scope{{title, q.Get("part")}}, nil
+}
+
+// sectionRecord is a live section in a sections response.
+type sectionRecord struct {
+	ID         string `json:"id"` // core.SectionID
+	Title      int    `json:"title"`
+	Part       string `json:"part"`
+	Section    string `json:"section"`
+	Heading    string `json:"heading"`
+	TextSHA256 string `json:"text_sha256"`    // see textHash
+	Text       string `json:"text,omitempty"` // GET /section only
+}
+
+// sectionsResponse is what GET /sections returns.
+type sectionsResponse struct {
+	Title    int             `json:"title"`
+	Part     string          `json:"part"`
+	Date     string          `json:"date"`
+	Sections []sectionRecord `json:"sections"`
+	Removed  []Tombstone     `json:"removed"`
+}
+
+// sectionsAt reads the sections in h as of date, and the tombstones of
+// those removed by then (see documentWithRemoved).
+func sectionsAt(ctx context.Context, c httpclient, title int, h ecfr.Hierarchy, date string) ([]sectionRecord, []Tombstone, error) {
+	root, removed, err := documentWithRemoved(ctx, c, title, h, date)
+	var se *ecfr.StatusError
+	if errors.As(err, &se) && se.Code == http.StatusNotFound {
+		return []sectionRecord{}, []Tombstone{}, nil // nothing by that name, then or ever
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	sections := []sectionRecord{}
+	if root != nil {
+		core.WalkSectionIDs(root, title, func(id core.SectionID, d *core.Div) {
+			rec := sectionRecord{ID: id.String(), Title: title, Part: id.Part, Section: strings.TrimSpace(strings.TrimLeft(d.N, "§ ")),
+				Heading: d.Head, TextSHA256: textHash(d)}
+			if h.Section != "" {
+				rec.Text = core.ParaText(d)
+			}
+			sections = append(sections, rec)
+		})
+	}
+	if removed == nil {
+		removed = []Tombstone{}
+	}
+	return sections, removed, nil
+}
+
+// dateParam reads an optional date parameter, defaulting to the title's
+// latest.
+func dateParam(ctx context.Context, c httpclient, q url.Values, name string, title int) (string, error) {
+	if q.Get(name) != "" {
+		return requiredDate(q, name)
+	}
+	return latestDate(ctx, newAPI(c), title)
+}
+
+// sectionsHandler serves GET /sections: a part's sections and tombstones.
+func sectionsHandler(c httpclient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		title, err := strconv.Atoi(q.Get("title"))
+		if err != nil || title <= 0 || q.Get("part") == "" {
+			httpError(w, http.StatusBadRequest, errors.New("title and part are required"))
+			return
+		}
+		resp := sectionsResponse{Title: title, Part: q.Get("part")}
+		if !tenantOf(r.Context()).allows([]scope{{title, resp.Part}}) {
+			httpError(w, http.StatusForbidden, errors.New("not on this namespace's watchlist"))
+			return
+		}
+		if resp.Date, err = dateParam(r.Context(), c, q, "date", title); err != nil {
+			httpError(w, http.StatusBadRequest, err)
+			return
+		}
+		resp.Sections, resp.Removed, err = sectionsAt(r.Context(), c, title, ecfr.Hierarchy{Part: resp.Part}, resp.Date)
+		if err != nil {
+			httpError(w, upstreamStatus(err), err)
+			return
+		}
+		writeJSON(w, resp)
+	}
+}
+
+// sectionHandler serves GET /section: one section with its text, or its
+// tombstone with 410 Gone.
+func sectionHandler(c httpclient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		title, err := strconv.Atoi(q.Get("title"))
+		if err != nil || title <= 0 || q.Get("section") == "" {
+			httpError(w, http.StatusBadRequest, errors.New("title and section are required"))
+			return
+		}
+		date, err := dateParam(r.Context(), c, q, "date", title)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, err)
+			return
+		}
+		sections, removed, err := sectionsAt(r.Context(), c, title, ecfr.Hierarchy{Section: q.Get("section")}, date)
+		if err != nil {
+			httpError(w, upstreamStatus(err), err)
+			return
+		}
+		want := core.SectionID{Title: title, Section: q.Get("section")}
+		for _, s := range sections {
+			if want.Same(core.SectionID{Title: title, Section: s.Section}) {
+				if !tenantOf(r.Context()).allows([]scope{{title, s.Part}}) {
+					httpError(w, http.StatusForbidden, errors.New("not on this namespace's watchlist"))
+					return
+				}
+				writeJSON(w, s)
+				return
+			}
+		}
+		for _, t := range removed {
+			if want.Same(core.SectionID{Title: title, Section: t.Section}) {
+				if !tenantOf(r.Context()).allows([]scope{{title, t.Part}}) {
+					httpError(w, http.StatusForbidden, errors.New("not on this namespace's watchlist"))
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusGone)
+				json.NewEncoder(w).Encode(t)
+				return
+			}
+		}
+		httpError(w, http.StatusNotFound, fmt.Errorf("%s does not exist as of %s", citation(title, "", want.Section), date))
+	}
+}
+
+// upstreamStatus is the response code for a failure to get data: 404 when
+// a read-only cache doesn't have it, 502 when the eCFR API failed.
+func upstreamStatus(err error) int {
+	if errors.Is(err, errNotCached) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadGateway
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("write response", "err", err)
+	}
+}
+
+func httpError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
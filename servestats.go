@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// titlesResponse is what GET /titles returns.
+type titlesResponse struct {
+	Titles []ecfr.Title `json:"titles"`
+}
+
+// versionStats is what GET /versions returns: how much a title or part has
+// changed over its history.
+type versionStats struct {
+	Title       int    `json:"title"`
+	Part        string `json:"part,omitempty"`
+	Versions    int    `json:"versions"` // entries, one per section per change
+	Substantive int    `json:"substantive"`
+	Removed     int    `json:"removed"`
+	Dates       int    `json:"dates"`    // distinct dates with a change
+	Sections    int    `json:"sections"` // distinct sections ever changed
+	First       string `json:"first,omitempty"`
+	Latest      string `json:"latest,omitempty"`
+}
+
+// wordsResponse is what GET /words returns.
+type wordsResponse struct {
+	Title   int    `json:"title"`
+	Part    string `json:"part,omitempty"`
+	Section string `json:"section,omitempty"`
+	Date    string `json:"date"`
+	Words   int64  `json:"words"`
+}
+
+// diffChange is a SectionChange with its edits, which GET /diff includes
+// on request.
+type diffChange struct {
+	SectionChange
+	Edits []core.Edit `json:"edits,omitempty"`
+}
+
+// diffResponse is what GET /diff returns.
+type diffResponse struct {
+	Title    int          `json:"title"`
+	Part     string       `json:"part,omitempty"`
+	From     string       `json:"from"`
+	To       string       `json:"to"`
+	Added    int          `json:"added"` // sections
+	Removed  int          `json:"removed"`
+	Modified int          `json:"modified"`
+	Changes  []diffChange `json:"changes"`
+}
+
+// titleParams reads title and the optional part, checking them against the
+// request's namespace.
+func titleParams(r *http.Request) (int, string, int, error) {
+	q := r.URL.Query()
+	title, err := strconv.Atoi(q.Get("title"))
+	if err != nil || title <= 0 {
+		return 0, "", http.StatusBadRequest, errors.New("title is required")
+	}
+	if !tenantOf(r.Context()).allows([]scope{{title, q.Get("part")}}) {
+		return 0, "", http.StatusForbidden, errors.New("not on this namespace's watchlist")
+	}
+	return title, q.Get("part"), 0, nil
+}
+
+// titlesHandler serves GET /titles: every title with its currency dates,
+// or in a namespace the titles on its watchlist.
+func titlesHandler(c httpclient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		titles, err := newAPI(c).Titles(r.Context())
+		if err != nil {
+			httpError(w, upstreamStatus(err), err)
+			return
+		}
+		resp := titlesResponse{Titles: []ecfr.Title{}}
+		t := tenantOf(r.Context())
+		for _, title := range titles {
+			if t.allows([]scope{{title.Number, ""}}) || t.watchesPartOf(title.Number) {
+				resp.Titles = append(resp.Titles, title)
+			}
+		}
+		writeJSON(w, resp)
+	}
+}
+
+// versionsHandler serves GET /versions?title=&part=: counts over the
+// version history.
+func versionsHandler(c httpclient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		title, part, code, err := titleParams(r)
+		if err != nil {
+			httpError(w, code, err)
+			return
+		}
+		versions, err := newAPI(c).Versions(r.Context(), title, ecfr.Hierarchy{Part: part})
+		if err != nil {
+			httpError(w, upstreamStatus(err), err)
+			return
+		}
+		resp := versionStats{Title: title, Part: part, Versions: len(versions)}
+		dates, sections := map[string]bool{}, map[string]bool{}
+		for _, v := range versions {
+			if v.Substantive {
+				resp.Substantive++
+			}
+			if v.Removed {
+				resp.Removed++
+			}
+			dates[v.Date] = true
+			sections[v.Part+"/"+v.Identifier] = true
+			if resp.First == "" || v.Date < resp.First {
+				resp.First = v.Date
+			}
+			resp.Latest = max(resp.Latest, v.Date)
+		}
+		resp.Dates, resp.Sections = len(dates), len(sections)
+		writeJSON(w, resp)
+	}
+}
+
+// wordsHandler serves GET /words?title=&part=&section=&date=: the word
+// count of a snapshot, as wordcount prints it.
+func wordsHandler(c httpclient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		title, part, code, err := titleParams(r)
+		if err != nil {
+			httpError(w, code, err)
+			return
+		}
+		q := r.URL.Query()
+		resp := wordsResponse{Title: title, Part: part, Section: q.Get("section")}
+		if resp.Date, err = dateParam(r.Context(), c, q, "date", title); err != nil {
+			httpError(w, http.StatusBadRequest, err)
+			return
+		}
+		text, err := newAPI(c).Text(r.Context(), title, resp.Date, ecfr.Hierarchy{Part: part, Section: resp.Section})
+		if err != nil {
+			httpError(w, upstreamStatus(err), err)
+			return
+		}
+		if resp.Words, err = core.CountWords(text); err != nil {
+			httpError(w, http.StatusBadGateway, err)
+			return
+		}
+		writeJSON(w, resp)
+	}
+}
+
+// diffHandler serves GET /diff?title=&part=&from=&to=&edits=true: the
+// sections that changed between two snapshots, as diff --json finds them.
+func diffHandler(c httpclient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		title, part, code, err := titleParams(r)
+		if err != nil {
+			httpError(w, code, err)
+			return
+		}
+		q := r.URL.Query()
+		resp := diffResponse{Title: title, Part: part, Changes: []diffChange{}}
+		if resp.From, err = requiredDate(q, "from"); err != nil {
+			httpError(w, http.StatusBadRequest, err)
+			return
+		}
+		if resp.To, err = dateParam(r.Context(), c, q, "to", title); err != nil {
+			httpError(w, http.StatusBadRequest, err)
+			return
+		}
+		edits := q.Get("edits") == "true"
+		changes, err := snapshotChanges(r.Context(), c, title, ecfr.Hierarchy{Part: part}, resp.From, resp.To)
+		if err != nil {
+			httpError(w, upstreamStatus(err), err)
+			return
+		}
+		for _, ch := range changes {
+			switch ch.Change {
+			case "added":
+				resp.Added++
+			case "removed":
+				resp.Removed++
+			case "modified":
+				resp.Modified++
+			}
+			dc := diffChange{SectionChange: ch}
+			if edits {
+				dc.Edits = ch.Edits
+			}
+			resp.Changes = append(resp.Changes, dc)
+		}
+		writeJSON(w, resp)
+	}
+}
+
+// requiredDate reads a date parameter that has no default.
+func requiredDate(q url.Values, name string) (string, error) {
+	d := q.Get(name)
+	if d == "" {
+		return "", fmt.Errorf("%s is required", name)
+	}
+	if _, err := time.Parse("2006-01-02", d); err != nil {
+		return "", fmt.Errorf("bad %s %q: want YYYY-MM-DD", name, d)
+	}
+	return d, nil
+}
@@ -0,0 +1,534 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A minimal SQLite database file reader and writer for --db, so the corpus
+// can be queried with the sqlite3 shell or any SQLite library without efcr
+// linking one. Like the Arrow and Parquet writers it covers only what efcr
+// needs: ordinary rowid tables, written whole. A database is read into
+// memory, changed, and written back as a fresh file (one B-tree per table,
+// no free pages), so views and triggers survive a rewrite but indexes and
+// WITHOUT ROWID tables can't and are refused.
+//
+// The file format is https://www.sqlite.org/fileformat2.html.
+
+const (
+	sqlitePageSize = 4096
+	sqliteVersion  = 3040000 // SQLITE_VERSION_NUMBER recorded in the header
+
+	sqliteInteriorTable = 0x05
+	sqliteLeafTable     = 0x0d
+)
+
+// sqliteRow is one table row: its rowid and column values, each nil,
+// int64, float64, string or []byte.
+type sqliteRow struct {
+	ID     int64
+	Values []any
+}
+
+// sqliteTable is one entry of sqlite_schema. Views and triggers have no
+// rows.
+type sqliteTable struct {
+	Type string // table, view or trigger
+	Name string
+	SQL  string
+	Rows []sqliteRow
+}
+
+// sqliteAppendVarint appends v as a SQLite varint: big-endian, seven bits
+// a byte with the high bit set on all but the last, except that a ninth
+// byte carries a full eight bits.
+func sqliteAppendVarint(b []byte, v uint64) []byte {
+	if v > 1<<56-1 {
+		var buf [9]byte
+		buf[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			buf[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(b, buf[:]...)
+	}
+	var buf [8]byte
+	i := len(buf) - 1
+	buf[i] = byte(v & 0x7f)
+	for v >>= 7; v > 0; v >>= 7 {
+		i--
+		buf[i] = byte(v&0x7f) | 0x80
+	}
+	return append(b, buf[i:]...)
+}
+
+// sqliteVarint decodes a varint from the start of b, returning it and its
+// length, or length 0 if b is too short.
+func sqliteVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 9; i++ {
+		if i >= len(b) {
+			return 0, 0
+		}
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return v, 9
+}
+
+// sqliteRecord encodes values in the record format: a header of serial
+// types, then the values.
+func sqliteRecord(values []any) ([]byte, error) {
+	var types, body []byte
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			types = append(types, 0)
+		case int64:
+			switch {
+			case v == 0:
+				types = append(types, 8)
+			case v == 1:
+				types = append(types, 9)
+			case v >= math.MinInt8 && v <= math.MaxInt8:
+				types = append(types, 1)
+				body = append(body, byte(v))
+			case v >= math.MinInt16 && v <= math.MaxInt16:
+				types = append(types, 2)
+				body = binary.BigEndian.AppendUint16(body, uint16(v))
+			case v >= -1<<23 && v < 1<<23:
+				types = append(types, 3)
+				body = append(body, byte(v>>16), byte(v>>8), byte(v))
+			case v >= math.MinInt32 && v <= math.MaxInt32:
+				types = append(types, 4)
+				body = binary.BigEndian.AppendUint32(body, uint32(v))
+			case v >= -1<<47 && v < 1<<47:
+				types = append(types, 5)
+				body = append(body, byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+			default:
+				types = append(types, 6)
+				body = binary.BigEndian.AppendUint64(body, uint64(v))
+			}
+		case float64:
+			types = append(types, 7)
+			body = binary.BigEndian.AppendUint64(body, math.Float64bits(v))
+		case string:
+			types = sqliteAppendVarint(types, uint64(len(v))*2+13)
+			body = append(body, v...)
+		case []byte:
+			types = sqliteAppendVarint(types, uint64(len(v))*2+12)
+			body = append(body, v...)
+		default:
+			return nil, fmt.Errorf("sqlite: can't store %T", v)
+		}
+	}
+	// the header length counts itself
+	n := len(types) + 1
+	if n > 127 {
+		n++
+	}
+	rec := sqliteAppendVarint(nil, uint64(n))
+	rec = append(rec, types...)
+	return append(rec, body...), nil
+}
+
+// sqliteDecodeRecord is sqliteRecord's inverse.
+func sqliteDecodeRecord(rec []byte) ([]any, error) {
+	bad := errors.New("sqlite: malformed record")
+	hlen, n := sqliteVarint(rec)
+	if n == 0 || hlen > uint64(len(rec)) {
+		return nil, bad
+	}
+	header, body := rec[n:hlen], rec[hlen:]
+	var values []any
+	for len(header) > 0 {
+		t, n := sqliteVarint(header)
+		if n == 0 {
+			return nil, bad
+		}
+		header = header[n:]
+		size := map[uint64]int{0: 0, 1: 1, 2: 2, 3: 3, 4: 4, 5: 6, 6: 8, 7: 8, 8: 0, 9: 0}[t]
+		if t >= 12 {
+			size = int((t - 12) / 2)
+		}
+		if size > len(body) {
+			return nil, bad
+		}
+		v := body[:size]
+		body = body[size:]
+		switch {
+		case t == 0:
+			values = append(values, nil)
+		case t >= 1 && t <= 6:
+			x := int64(int8(v[0])) // sign extend from the first byte
+			for _, c := range v[1:] {
+				x = x<<8 | int64(c)
+			}
+			values = append(values, x)
+		case t == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(v)))
+		case t == 8, t == 9:
+			values = append(values, int64(t-8))
+		case t >= 13 && t%2 == 1:
+			values = append(values, string(v))
+		case t >= 12:
+			values = append(values, append([]byte(nil), v...))
+		default:
+			return nil, bad
+		}
+	}
+	return values, nil
+}
+
+// sqliteLocal returns how much of a table cell payload of size p is kept
+// on its B-tree page; the rest goes to overflow pages.
+func sqliteLocal(usable, p int) int {
+	x := usable - 35
+	if p <= x {
+		return p
+	}
+	m := (usable-12)*32/255 - 23
+	if k := m + (p-m)%(usable-4); k <= x {
+		return k
+	}
+	return m
+}
+
+// sqliteFile assembles a database page by page.
+type sqliteFile struct {
+	pages [][]byte // pages[0] is page 1
+}
+
+func (f *sqliteFile) alloc() int {
+	f.pages = append(f.pages, make([]byte, sqlitePageSize))
+	return len(f.pages)
+}
+
+// writePage lays out a B-tree page of the given type, cells in order,
+// starting its header at off (100 on page 1, after the file header).
+func (f *sqliteFile) writePage(pgno int, off int, kind byte, cells [][]byte, right int) {
+	page := f.pages[pgno-1]
+	page[off] = kind
+	binary.BigEndian.PutUint16(page[off+3:], uint16(len(cells)))
+	ptrs := off + 8
+	if kind == sqliteInteriorTable {
+		binary.BigEndian.PutUint32(page[off+8:], uint32(right))
+		ptrs += 4
+	}
+	end := sqlitePageSize
+	for i, c := range cells {
+		end -= len(c)
+		copy(page[end:], c)
+		binary.BigEndian.PutUint16(page[ptrs+2*i:], uint16(end))
+	}
+	binary.BigEndian.PutUint16(page[off+5:], uint16(end%65536))
+}
+
+// leafCell encodes a table leaf cell, spilling the payload past what
+// fits on the page to a chain of overflow pages.
+func (f *sqliteFile) leafCell(r sqliteRow) ([]byte, error) {
+	payload, err := sqliteRecord(r.Values)
+	if err != nil {
+		return nil, err
+	}
+	cell := sqliteAppendVarint(nil, uint64(len(payload)))
+	cell = sqliteAppendVarint(cell, uint64(r.ID))
+	local := sqliteLocal(sqlitePageSize, len(payload))
+	cell = append(cell, payload[:local]...)
+	rest := payload[local:]
+	if len(rest) == 0 {
+		return cell, nil
+	}
+	first := f.alloc()
+	cell = binary.BigEndian.AppendUint32(cell, uint32(first))
+	for pg := first; ; {
+		n := copy(f.pages[pg-1][4:], rest)
+		rest = rest[n:]
+		if len(rest) == 0 {
+			return cell, nil
+		}
+		next := f.alloc()
+		binary.BigEndian.PutUint32(f.pages[pg-1], uint32(next))
+		pg = next
+	}
+}
+
+// writeTree writes rows (in rowid order) as a table B-tree and returns
+// its root page. The root is at page 1 when onFirst is set, which only
+// works if everything fits there.
+func (f *sqliteFile) writeTree(rows []sqliteRow, onFirst bool) (int, error) {
+	type child struct {
+		pgno int
+		max  int64
+	}
+	off := 0
+	if onFirst {
+		off = 100
+	}
+	var cells [][]byte
+	var leaves []child
+	room := sqlitePageSize - off - 8
+	flush := func(last int64) {
+		pgno := 1
+		if !onFirst {
+			pgno = f.alloc()
+		}
+		f.writePage(pgno, off, sqliteLeafTable, cells, 0)
+		leaves = append(leaves, child{pgno, last})
+		cells, room = nil, sqlitePageSize-8
+	}
+	for i, r := range rows {
+		c, err := f.leafCell(r)
+		if err != nil {
+			return 0, err
+		}
+		if len(c)+2 > room {
+			if onFirst {
+				return 0, errors.New("sqlite: schema too large for the first page")
+			}
+			flush(rows[i-1].ID)
+		}
+		cells = append(cells, c)
+		room -= len(c) + 2
+	}
+	if len(cells) > 0 || len(leaves) == 0 {
+		var last int64
+		if len(rows) > 0 {
+			last = rows[len(rows)-1].ID
+		}
+		flush(last)
+	}
+
+	// Interior levels until one page holds them all. A cell is at most a
+	// page number and a nine byte varint, plus its pointer, and children are
+	// spread evenly so no page is left with a lone right pointer.
+	const fanout = (sqlitePageSize - 12) / (4 + 9 + 2)
+	level := leaves
+	for len(level) > 1 {
+		var up []child
+		pages := (len(level) + fanout - 1) / fanout
+		for p := 0; p < pages; p++ {
+			group := level[len(level)*p/pages : len(level)*(p+1)/pages]
+			var cells [][]byte
+			for _, c := range group[:len(group)-1] {
+				cell := binary.BigEndian.AppendUint32(nil, uint32(c.pgno))
+				cells = append(cells, sqliteAppendVarint(cell, uint64(c.max)))
+			}
+			last := group[len(group)-1]
+			pgno := f.alloc()
+			f.writePage(pgno, 0, sqliteInteriorTable, cells, last.pgno)
+			up = append(up, child{pgno, last.max})
+		}
+		level = up
+	}
+	return level[0].pgno, nil
+}
+
+// writeSQLite writes tables as a new database at path, replacing any file
+// there only once the new one is complete.
+func writeSQLite(path string, tables []sqliteTable, userVersion uint32) error {
+	f := &sqliteFile{}
+	f.alloc() // page 1: header and sqlite_schema
+	var schema []sqliteRow
+	for _, t := range tables {
+		var root int64
+		if t.Type == "table" {
+			pg, err := f.writeTree(t.Rows, false)
+			if err != nil {
+				return fmt.Errorf("%s: %w", t.Name, err)
+			}
+			root = int64(pg)
+		}
+		name := t.Name
+		tblName := name
+		if t.Type == "trigger" {
+			tblName = triggerTable(t.SQL)
+		}
+		schema = append(schema, sqliteRow{int64(len(schema) + 1), []any{t.Type, name, tblName, root, t.SQL}})
+	}
+	if _, err := f.writeTree(schema, true); err != nil {
+		return err
+	}
+
+	h := f.pages[0]
+	copy(h, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(h[16:], sqlitePageSize)
+	h[18], h[19] = 1, 1 // rollback journal, not WAL
+	h[21], h[22], h[23] = 64, 32, 32
+	binary.BigEndian.PutUint32(h[24:], 1) // change counter
+	binary.BigEndian.PutUint32(h[28:], uint32(len(f.pages)))
+	binary.BigEndian.PutUint32(h[40:], 1) // schema cookie
+	binary.BigEndian.PutUint32(h[44:], 4) // schema format
+	binary.BigEndian.PutUint32(h[56:], 1) // UTF-8
+	binary.BigEndian.PutUint32(h[60:], userVersion)
+	binary.BigEndian.PutUint32(h[92:], 1) // version-valid-for, matching the counter
+	binary.BigEndian.PutUint32(h[96:], sqliteVersion)
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	for _, p := range f.pages {
+		if _, err := tmp.Write(p); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// triggerTable returns the table a CREATE TRIGGER statement is ON.
+func triggerTable(sql string) string {
+	fields := strings.Fields(sql)
+	for i, f := range fields {
+		if strings.EqualFold(f, "ON") && i+1 < len(fields) {
+			return strings.Trim(fields[i+1], `"[]`+"`")
+		}
+	}
+	return ""
+}
+
+// readSQLite loads every table of the database at path, and its
+// user_version. A missing file is an empty database.
+func readSQLite(path string) ([]sqliteTable, uint32, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(data) < 100 || string(data[:16]) != "SQLite format 3\x00" {
+		return nil, 0, fmt.Errorf("%s is not a SQLite database", path)
+	}
+	if fi, err := os.Stat(path + "-wal"); err == nil && fi.Size() > 0 {
+		return nil, 0, fmt.Errorf("%s has an unapplied write-ahead log; run `sqlite3 %s 'PRAGMA wal_checkpoint(TRUNCATE)'` first", path, path)
+	}
+	pageSize := int(binary.BigEndian.Uint16(data[16:]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	usable := pageSize - int(data[20])
+	if enc := binary.BigEndian.Uint32(data[56:]); enc > 1 {
+		return nil, 0, fmt.Errorf("%s: only UTF-8 databases are supported", path)
+	}
+	page := func(pgno int) ([]byte, error) {
+		if pgno < 1 || pgno*pageSize > len(data) {
+			return nil, fmt.Errorf("%s: page %d out of range", path, pgno)
+		}
+		return data[(pgno-1)*pageSize : pgno*pageSize], nil
+	}
+
+	var walk func(pgno, depth int, fn func(sqliteRow) error) error
+	walk = func(pgno, depth int, fn func(sqliteRow) error) error {
+		if depth > 64 {
+			return fmt.Errorf("%s: B-tree too deep at page %d", path, pgno)
+		}
+		p, err := page(pgno)
+		if err != nil {
+			return err
+		}
+		off := 0
+		if pgno == 1 {
+			off = 100
+		}
+		kind := p[off]
+		n := int(binary.BigEndian.Uint16(p[off+3:]))
+		ptrs := off + 8
+		if kind == sqliteInteriorTable {
+			ptrs += 4
+		} else if kind != sqliteLeafTable {
+			return fmt.Errorf("%s: page %d is not a table B-tree page", path, pgno)
+		}
+		for i := 0; i < n; i++ {
+			c := p[binary.BigEndian.Uint16(p[ptrs+2*i:]):]
+			if kind == sqliteInteriorTable {
+				if err := walk(int(binary.BigEndian.Uint32(c)), depth+1, fn); err != nil {
+					return err
+				}
+				continue
+			}
+			size, a := sqliteVarint(c)
+			rowid, b := sqliteVarint(c[a:])
+			c = c[a+b:]
+			local := sqliteLocal(usable, int(size))
+			payload := append([]byte(nil), c[:local]...)
+			for next := 0; len(payload) < int(size); {
+				if next == 0 {
+					next = int(binary.BigEndian.Uint32(c[local:]))
+				}
+				op, err := page(next)
+				if err != nil {
+					return err
+				}
+				take := min(usable-4, int(size)-len(payload))
+				payload = append(payload, op[4:4+take]...)
+				next = int(binary.BigEndian.Uint32(op))
+			}
+			values, err := sqliteDecodeRecord(payload)
+			if err != nil {
+				return fmt.Errorf("%s: page %d: %w", path, pgno, err)
+			}
+			if err := fn(sqliteRow{int64(rowid), values}); err != nil {
+				return err
+			}
+		}
+		if kind == sqliteInteriorTable {
+			return walk(int(binary.BigEndian.Uint32(p[off+8:])), depth+1, fn)
+		}
+		return nil
+	}
+
+	var tables []sqliteTable
+	var roots []int64
+	err = walk(1, 0, func(r sqliteRow) error {
+		if len(r.Values) < 5 {
+			return fmt.Errorf("%s: malformed schema", path)
+		}
+		typ, _ := r.Values[0].(string)
+		name, _ := r.Values[1].(string)
+		sql, _ := r.Values[4].(string)
+		root, _ := r.Values[3].(int64)
+		switch {
+		case typ == "index":
+			return fmt.Errorf("%s has index %s, which efcr can't keep when it rewrites the file; drop it, or query a copy", path, name)
+		case typ == "table" && strings.Contains(strings.ToUpper(sql), "WITHOUT ROWID"):
+			return fmt.Errorf("%s has WITHOUT ROWID table %s, which efcr can't rewrite", path, name)
+		}
+		tables = append(tables, sqliteTable{Type: typ, Name: name, SQL: sql})
+		roots = append(roots, root)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range tables {
+		if tables[i].Type != "table" {
+			continue
+		}
+		t := &tables[i]
+		if err := walk(int(roots[i]), 0, func(r sqliteRow) error {
+			t.Rows = append(t.Rows, r)
+			return nil
+		}); err != nil {
+			return nil, 0, err
+		}
+	}
+	return tables, binary.BigEndian.Uint32(data[60:]), nil
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// sqliteCacheTable is the one table of a -cache-store sqlite-index:PATH
+// index, so the cache can be inspected with any SQLite tool.
+const sqliteCacheTable = `CREATE TABLE responses (key TEXT, url TEXT, sha256 TEXT, header TEXT, fetched TEXT, size INTEGER)`
+
+// sqliteCacheVersion 2 moved bodies out of the table into files; version 1
+// files, with a body BLOB column, are migrated when opened.
+const sqliteCacheVersion = 2
+
+// sqliteCacheFlushEvery is how many changes go to the journal before the
+// index is rewritten and the journal emptied.
+const sqliteCacheFlushEvery = 500
+
+// sqliteIndexCache is a Cache on local disk, indexed by a SQLite file. It
+// is not one shareable file: like --db it goes through the minimal reader
+// and writer in sqlite.go, which rewrite the whole file, so only metadata
+// lives in the database. Bodies are files in PATH.bodies, and every change
+// is also appended to the journal PATH.journal, synced, before Put or
+// Delete returns. The index is rewritten from memory every
+// sqliteCacheFlushEvery changes and by Close; opening replays the journal
+// over it, so a crash loses nothing already stored.
+//
+// One process at a time may have the cache open, as PATH.lock enforces:
+// each keeps the index in memory and would overwrite the other's. To share
+// a cache between machines use s3://.
+type sqliteIndexCache struct {
+	path string
+	dir  string   // bodies, by key
+	lock *os.File // PATH.lock, held until Close
+
+	mu      sync.Mutex
+	entries map[string]CacheMeta
+	journal *os.File
+	changes int // journalled since the index was written
+}
+
+// sqliteJournalRecord is a line of the journal: a put of meta under key, or
+// its deletion.
+type sqliteJournalRecord struct {
+	Op   string     `json:"op"` // put or delete
+	Key  string     `json:"key"`
+	Meta *CacheMeta `json:"meta,omitempty"`
+}
+
+// openSQLiteIndex loads the cache indexed at path, locking it; a missing
+// file is an empty cache.
+func openSQLiteIndex(path string) (_ *sqliteIndexCache, err error) {
+	lock, err := lockFile(path + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			unlockFile(lock)
+		}
+	}()
+	tables, version, err := readSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+	if version > sqliteCacheVersion {
+		return nil, fmt.Errorf("%s was written by a newer efcr (cache v%d, this build reads up to v%d)", path, version, sqliteCacheVersion)
+	}
+	sc := &sqliteIndexCache{path: path, dir: path + ".bodies", lock: lock, entries: map[string]CacheMeta{}}
+	if err := os.MkdirAll(sc.dir, 0o755); err != nil {
+		return nil, err
+	}
+	for _, t := range tables {
+		if t.Type != "table" || t.Name != "responses" {
+			continue
+		}
+		for _, r := range t.Rows {
+			if len(r.Values) < 6 {
+				return nil, fmt.Errorf("%s: responses row %d has %d columns, want 6", path, r.ID, len(r.Values))
+			}
+			key, _ := r.Values[0].(string)
+			if !cacheKeyPattern.MatchString(key) {
+				return nil, fmt.Errorf("%s: responses row %d: %q is not a cache key", path, r.ID, key)
+			}
+			var meta CacheMeta
+			meta.URL, _ = r.Values[1].(string)
+			meta.SHA256, _ = r.Values[2].(string)
+			if h, ok := r.Values[3].(string); ok {
+				json.Unmarshal([]byte(h), &meta.Header)
+			}
+			if f, ok := r.Values[4].(string); ok {
+				meta.Fetched, _ = time.Parse(time.RFC3339Nano, f)
+			}
+			switch v := r.Values[5].(type) {
+			case int64:
+				meta.Size = v
+			case []byte:
+				// a version 1 body, moved out to its file
+				if err := sc.writeBody(key, v); err != nil {
+					return nil, err
+				}
+				meta.Size = int64(len(v))
+				sc.changes++
+			}
+			sc.entries[key] = meta
+		}
+	}
+	if err := sc.replay(); err != nil {
+		return nil, err
+	}
+	if sc.changes > 0 {
+		if err := sc.flush(); err != nil {
+			return nil, err
+		}
+	}
+	if sc.journal, err = os.OpenFile(sc.journalPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+func (sc *sqliteIndexCache) journalPath() string { return sc.path + ".journal" }
+
+// replay applies the journal left by a run that didn't reach flush.
+func (sc *sqliteIndexCache) replay() error {
+	f, err := os.Open(sc.journalPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for dec.More() {
+		var rec sqliteJournalRecord
+		if err := dec.Decode(&rec); err != nil {
+			// a torn final line from a crash; everything before it is good
+			slog.Warn("cache: ignoring unreadable journal tail", "path", sc.journalPath(), "err", err)
+			break
+		}
+		if !cacheKeyPattern.MatchString(rec.Key) {
+			return fmt.Errorf("%s: %q is not a cache key", sc.journalPath(), rec.Key)
+		}
+		switch {
+		case rec.Op == "put" && rec.Meta != nil:
+			sc.entries[rec.Key] = *rec.Meta
+		case rec.Op == "delete":
+			delete(sc.entries, rec.Key)
+		}
+		sc.changes++
+	}
+	return nil
+}
+
+// writeBody stores a body under key, replacing any there only once it is
+// complete.
+func (sc *sqliteIndexCache) writeBody(key string, b []byte) error {
+	tmp, err := os.CreateTemp(sc.dir, tempPrefix+key+"-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(sc.dir, key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (sc *sqliteIndexCache) Stat(_ context.Context, key string) (CacheMeta, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	meta, ok := sc.entries[key]
+	if !ok {
+		return CacheMeta{}, fmt.Errorf("%s: %s: %w", sc.path, key, fs.ErrNotExist)
+	}
+	return meta, nil
+}
+
+func (sc *sqliteIndexCache) Get(_ context.Context, key string) (io.ReadCloser, CacheMeta, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	meta, ok := sc.entries[key]
+	if !ok {
+		return nil, CacheMeta{}, fmt.Errorf("%s: %s: %w", sc.path, key, fs.ErrNotExist)
+	}
+	f, err := os.Open(filepath.Join(sc.dir, key))
+	if err != nil {
+		return nil, CacheMeta{}, err
+	}
+	return f, meta, nil
+}
+
+func (sc *sqliteIndexCache) Put(_ context.Context, key string, body io.Reader, meta CacheMeta) error {
+	if body != nil {
+		b, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		if err := sc.writeBody(key, b); err != nil {
+			return err
+		}
+		meta.Size = int64(len(b))
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if body == nil {
+		old, ok := sc.entries[key]
+		if !ok {
+			return fmt.Errorf("%s: %s: %w", sc.path, key, fs.ErrNotExist)
+		}
+		meta.Size = old.Size
+	}
+	sc.entries[key] = meta
+	return sc.record(sqliteJournalRecord{Op: "put", Key: key, Meta: &meta})
+}
+
+func (sc *sqliteIndexCache) Delete(_ context.Context, key string) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if _, ok := sc.entries[key]; !ok {
+		return fmt.Errorf("%s: %s: %w", sc.path, key, fs.ErrNotExist)
+	}
+	delete(sc.entries, key)
+	if err := os.Remove(filepath.Join(sc.dir, key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return sc.record(sqliteJournalRecord{Op: "delete", Key: key})
+}
+
+// record journals a change, flushing the index every
+// sqliteCacheFlushEvery. Callers hold sc.mu.
+func (sc *sqliteIndexCache) record(rec sqliteJournalRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := sc.journal.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err := sc.journal.Sync(); err != nil {
+		return err
+	}
+	if sc.changes++; sc.changes >= sqliteCacheFlushEvery {
+		return sc.flush()
+	}
+	return nil
+}
+
+// flush rewrites the index from memory and empties the journal it now
+// covers. A crash between the two only replays changes already indexed.
+// Callers hold sc.mu or own sc.
+func (sc *sqliteIndexCache) flush() error {
+	keys := sortedKeys(sc.entries)
+	rows := make([]sqliteRow, len(keys))
+	for i, k := range keys {
+		meta := sc.entries[k]
+		header, _ := json.Marshal(meta.Header)
+		rows[i] = sqliteRow{ID: int64(i + 1), Values: []any{k, meta.URL, meta.SHA256, string(header), meta.Fetched.UTC().Format(time.RFC3339Nano), meta.Size}}
+	}
+	table := sqliteTable{Type: "table", Name: "responses", SQL: sqliteCacheTable, Rows: rows}
+	if err := writeSQLite(sc.path, []sqliteTable{table}, sqliteCacheVersion); err != nil {
+		return fmt.Errorf("write %s: %w", sc.path, err)
+	}
+	if sc.journal != nil {
+		if err := sc.journal.Truncate(0); err != nil {
+			return err
+		}
+	} else if err := os.Remove(sc.journalPath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	sc.changes = 0
+	return nil
+}
+
+// Close writes the index if it is behind the journal, and unlocks it.
+func (sc *sqliteIndexCache) Close() error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	var err error
+	if sc.changes > 0 {
+		if err = sc.flush(); err == nil {
+			slog.Info("cache: stored", "db", sc.path, "entries", len(sc.entries))
+		}
+	}
+	if cerr := sc.journal.Close(); err == nil {
+		err = cerr
+	}
+	if uerr := unlockFile(sc.lock); err == nil {
+		err = uerr
+	}
+	return err
+}
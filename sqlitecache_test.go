@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLiteCacheSurvivesCrash(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cache.db")
+	key := cacheKey("https://www.ecfr.gov/api/versioner/v1/titles.json")
+	sc, err := openSQLiteIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := CacheMeta{URL: "https://www.ecfr.gov/api/versioner/v1/titles.json", SHA256: "abc", Fetched: time.Now().UTC()}
+	if err := sc.Put(ctx, key, strings.NewReader(`{"titles":[]}`), meta); err != nil {
+		t.Fatal(err)
+	}
+	// no Close, as after a kill: the journal has to carry the entry, and
+	// the lock goes with the process
+	sc.journal.Close()
+	unlockFile(sc.lock)
+
+	for _, step := range []string{"replayed", "flushed"} {
+		sc, err = openSQLiteIndex(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, got, err := sc.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("%s: %v", step, err)
+		}
+		b, _ := io.ReadAll(body)
+		body.Close()
+		if string(b) != `{"titles":[]}` || got.URL != meta.URL || got.Size != int64(len(b)) {
+			t.Errorf("%s: got %q, %+v", step, b, got)
+		}
+		if err := sc.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if info, err := os.Stat(path + ".journal"); err != nil || info.Size() != 0 {
+		t.Errorf("journal not emptied by the flush on open: %v, %v", info, err)
+	}
+}
+
+func TestSQLiteCacheMigratesV1(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cache.db")
+	key := cacheKey("https://www.ecfr.gov/api/versioner/v1/titles.json")
+	v1 := sqliteTable{Type: "table", Name: "responses",
+		SQL:  `CREATE TABLE responses (key TEXT, url TEXT, sha256 TEXT, header TEXT, fetched TEXT, body BLOB)`,
+		Rows: []sqliteRow{{ID: 1, Values: []any{key, "https://www.ecfr.gov/api/versioner/v1/titles.json", "abc", "null", "2024-01-01T00:00:00Z", []byte("body")}}}}
+	if err := writeSQLite(path, []sqliteTable{v1}, 1); err != nil {
+		t.Fatal(err)
+	}
+	sc, err := openSQLiteIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+	if b, err := os.ReadFile(filepath.Join(path+".bodies", key)); err != nil || string(b) != "body" {
+		t.Fatalf("body not moved to its file: %q, %v", b, err)
+	}
+	if _, version, err := readSQLite(path); err != nil || version != sqliteCacheVersion {
+		t.Errorf("index is v%d (%v), want v%d", version, err, sqliteCacheVersion)
+	}
+	if meta, err := sc.Stat(ctx, key); err != nil || meta.Size != 4 {
+		t.Errorf("Stat = %+v, %v", meta, err)
+	}
+}
+
+func TestSQLiteCacheRefusesSecondWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	sc, err := openSQLiteIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other, err := openSQLiteIndex(path); err == nil {
+		other.Close()
+		t.Fatal("a second open of the cache succeeded while the first held it")
+	}
+	if err := sc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sc, err = openSQLiteIndex(path)
+	if err != nil {
+		t.Fatalf("reopening after Close: %v", err)
+	}
+	sc.Close()
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+	"golang.org/x/sync/errgroup"
+)
+
+// Distribution summarises one measure over the sections or parts of the
+// corpus, or of one title.
+type Distribution struct {
+	Measure string  `json:"measure"`
+	Title   int     `json:"title,omitempty"` // with --by title
+	Per     string  `json:"per"`             // what one value is of: section or part
+	N       int     `json:"n"`
+	Mean    float64 `json:"mean"`
+	StdDev  float64 `json:"stddev"`
+	Min     float64 `json:"min"`
+	P10     float64 `json:"p10"`
+	P25     float64 `json:"p25"`
+	Median  float64 `json:"median"`
+	P75     float64 `json:"p75"`
+	P90     float64 `json:"p90"`
+	P99     float64 `json:"p99"`
+	Max     float64 `json:"max"`
+}
+
+// statsMeasures are what stats summarises, in report order, with what each
+// value is of.
+var statsMeasures = []struct{ name, per string }{
+	{"words_per_section", "section"},
+	{"words_per_part", "part"},
+	{"sections_per_part", "part"},
+	{"amendments_per_year", "part"},
+}
+
+// summarize computes the distribution of values; percentiles use nearest
+// rank, as crawl --measure does, and the deviation is the population one.
+func summarize(measure, per string, values []float64) Distribution {
+	d := Distribution{Measure: measure, Per: per, N: len(values)}
+	if len(values) == 0 {
+		return d
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	var sum, sumSq float64
+	for _, v := range sorted {
+		sum += v
+		sumSq += v * v
+	}
+	n := float64(len(sorted))
+	d.Mean = sum / n
+	d.StdDev = math.Sqrt(max(0, sumSq/n-d.Mean*d.Mean))
+	d.Min, d.Max = sorted[0], sorted[len(sorted)-1]
+	d.P10, d.P25, d.Median = nearestRank(sorted, 10), nearestRank(sorted, 25), nearestRank(sorted, 50)
+	d.P75, d.P90, d.P99 = nearestRank(sorted, 75), nearestRank(sorted, 90), nearestRank(sorted, 99)
+	return d
+}
+
+// titleSamples are one title's values of every measure.
+type titleSamples map[string][]float64
+
+// sampleTitle measures a title as of its latest date: the words (headings
+// included, as PartWords counts them) of each section and appendix, and
+// the words, sections and amendment dates per year of each part. Parts the
+// config marks as tables are left out, as in crawl. Amendment rates count
+// the distinct dates a part changed substantively, from since, or the
+// title's first version date, to its latest date.
+func sampleTitle(ctx context.Context, api *ecfr.Client, t ecfr.Title, since string) (titleSamples, error) {
+	doc, err := api.Document(ctx, t.Number, t.UpToDateAsOf, ecfr.Hierarchy{})
+	if err != nil {
+		return nil, err
+	}
+	versions, err := api.Versions(ctx, t.Number, ecfr.Hierarchy{})
+	if err != nil {
+		return nil, err
+	}
+	s := titleSamples{}
+	sections := map[string]int{}
+	core.WalkSectionIDs(doc.Root(), t.Number, func(id core.SectionID, d *core.Div) {
+		if id.Part == "" || cfg.isTable(t.Number, id.Part) {
+			return
+		}
+		s["words_per_section"] = append(s["words_per_section"], float64(core.CountDivWords(d).Words))
+		sections[id.Part]++
+	})
+	words := core.PartWords(doc.Root())
+	var parts []string
+	for p, n := range words {
+		if p == "" || cfg.isTable(t.Number, p) {
+			continue // front matter outside any part, or tables
+		}
+		parts = append(parts, p)
+		s["words_per_part"] = append(s["words_per_part"], float64(n))
+		s["sections_per_part"] = append(s["sections_per_part"], float64(sections[p]))
+	}
+
+	first := since
+	if first == "" {
+		for _, v := range versions {
+			if first == "" || v.Date < first {
+				first = v.Date
+			}
+		}
+	}
+	amended := map[string]map[string]bool{} // part -> dates
+	for _, v := range versions {
+		// Without --since the first date is where the history starts, not
+		// an amendment.
+		if !v.Substantive || v.Date < first || (since == "" && v.Date == first) || v.Date > t.UpToDateAsOf {
+			continue
+		}
+		if amended[v.Part] == nil {
+			amended[v.Part] = map[string]bool{}
+		}
+		amended[v.Part][v.Date] = true
+	}
+	years := 1.0
+	from, err1 := time.Parse("2006-01-02", first)
+	to, err2 := time.Parse("2006-01-02", t.UpToDateAsOf)
+	if err1 == nil && err2 == nil && to.After(from) {
+		years = to.Sub(from).Hours() / 24 / 365.25
+	}
+	for _, p := range parts {
+		s["amendments_per_year"] = append(s["amendments_per_year"], float64(len(amended[p]))/years)
+	}
+	slog.Info("measured title", titleAttr(t.Number), "name", t.Name, "parts", len(parts), "sections", len(s["words_per_section"]))
+	return s, nil
+}
+
+// runStats prints distributional summaries across the corpus as of each
+// title's latest date: words per section, and words, sections and
+// amendments per year per part (see sampleTitle). --by title summarises
+// each title separately.
+//
+//	efcr stats
+//	efcr stats --titles 21,40 --by title --since 2020-01-01 --json
+func runStats(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	titleList := fs.String("titles", "", "comma separated title numbers to include (default all)")
+	since := fs.String("since", "", "count amendments from this date YYYY-MM-DD (default each title's first version)")
+	by := fs.String("by", "corpus", "summarise the whole corpus, or each title")
+	asJSON := fs.Bool("json", false, "print one JSON object per distribution")
+	fs.Parse(args)
+	if *by != "corpus" && *by != "title" {
+		return fmt.Errorf("unknown --by %q (corpus|title)", *by)
+	}
+	if _, err := time.Parse("2006-01-02", *since); *since != "" && err != nil {
+		return fmt.Errorf("bad date %q: want YYYY-MM-DD", *since)
+	}
+	only, err := parseTitles(*titleList)
+	if err != nil {
+		return err
+	}
+	api := newAPI(c)
+	all, err := api.Titles(ctx)
+	if err != nil {
+		return err
+	}
+	var titles []ecfr.Title
+	for _, t := range all {
+		if !t.Reserved && (len(only) == 0 || only[t.Number]) {
+			titles = append(titles, t)
+		}
+	}
+
+	samples := map[int]titleSamples{}
+	var mu sync.Mutex
+	progressEvents.enter("measure")
+	progressEvents.progress(0, int64(len(titles)), "titles", 0)
+	var g errgroup.Group
+	g.SetLimit(2) // whole titles are parsed at once
+	for _, t := range titles {
+		g.Go(func() error {
+			s, err := sampleTitle(ctx, api, t, *since)
+			if err != nil {
+				return fmt.Errorf("title %d: %w", t.Number, err)
+			}
+			mu.Lock()
+			samples[t.Number] = s
+			progressEvents.progress(int64(len(samples)), int64(len(titles)), "titles", 0)
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	var out []Distribution
+	if *by == "title" {
+		for _, t := range titles {
+			for _, m := range statsMeasures {
+				d := summarize(m.name, m.per, samples[t.Number][m.name])
+				d.Title = t.Number
+				out = append(out, d)
+			}
+		}
+	} else {
+		for _, m := range statsMeasures {
+			var values []float64
+			for _, t := range titles {
+				values = append(values, samples[t.Number][m.name]...)
+			}
+			out = append(out, summarize(m.name, m.per, values))
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, d := range out {
+			if err := enc.Encode(d); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	header := "Measure\tPer\tN\tMean\tStdDev\tMin\tP10\tP25\tMedian\tP75\tP90\tP99\tMax"
+	if *by == "title" {
+		header = "Title\t" + header
+	}
+	fmt.Fprintln(w, header)
+	for _, d := range out {
+		if *by == "title" {
+			fmt.Fprintf(w, "%d\t", d.Title)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\n",
+			d.Measure, d.Per, d.N, d.Mean, d.StdDev, d.Min, d.P10, d.P25, d.Median, d.P75, d.P90, d.P99, d.Max)
+	}
+	return w.Flush()
+}
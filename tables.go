@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// runTables extracts every table in a part or section to CSV, one file per
+// table named after its section, e.g. 172.101-1.csv.
+//
+//	efcr tables --title 49 --part 172 --date 2024-01-01 --out hazmat/
+func runTables(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("tables", flag.ExitOnError)
+	title := fs.Int("title", 0, "title number")
+	date := fs.String("date", "", "snapshot date YYYY-MM-DD")
+	part := fs.String("part", "", "part number")
+	section := fs.String("section", "", "section identifier, e.g. 172.101")
+	out := fs.String("out", ".", "directory to write CSV files to")
+	fs.Parse(args)
+	if *title == 0 || *date == "" || (*part == "" && *section == "") {
+		return errors.New("--title, --date and one of --part/--section are required")
+	}
+
+	doc, err := newAPI(c).Document(ctx, *title, *date, ecfr.Hierarchy{Part: *part, Section: *section})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+	written := 0
+	var werr error
+	core.WalkSections(doc.Root(), func(s *core.Div) {
+		n := 0
+		var walk func(d *core.Div)
+		walk = func(d *core.Div) {
+			for _, p := range d.Paras {
+				if p.Rows == nil || werr != nil {
+					continue
+				}
+				n++
+				name := fmt.Sprintf("%s-%d.csv", strings.ReplaceAll(s.N, "/", "_"), n)
+				if werr = writeCSV(filepath.Join(*out, name), p.Rows); werr == nil {
+					written++
+				}
+			}
+			for i := range d.Children {
+				walk(&d.Children[i])
+			}
+		}
+		walk(s)
+	})
+	if werr != nil {
+		return werr
+	}
+	slog.Info("wrote tables", "tables", written, "from", citation(*title, *part, *section), "dir", *out)
+	return nil
+}
+
+func writeCSV(path string, rows [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	if err := w.WriteAll(rows); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// Tenant is one namespace of a shared serve instance: a team with its own
+// API keys, watchlist and notifications. A tenant's endpoints only answer
+// for scopes on its watchlist, so one deployment can serve several groups
+// without them seeing each other's interests; watch --tenants tells each
+// about the amendments on its own watchlist.
+type Tenant struct {
+	// APIKeys are accepted as "Authorization: Bearer KEY" or "X-API-Key:
+	// KEY". Rotate by listing the old and new key together.
+	APIKeys []string `json:"api_keys"`
+	// Watch lists "title" or "title/part" entries. Empty allows everything.
+	Watch []string `json:"watch"`
+	// Notify lists targets as watch --notify takes them (see newNotifier).
+	Notify []string `json:"notify,omitempty"`
+
+	name   string
+	watch  []scope
+	notify []watchChannel
+}
+
+// loadTenants reads a serve or watch --tenants file, a JSON object of
+// namespace name to Tenant:
+//
+//	{"air": {"api_keys": ["…"], "watch": ["40/60", "40/63"],
+//	         "notify": ["slack:https://hooks.slack.com/services/T000/B000/XXXX"]},
+//	 "food": {"api_keys": ["…"], "watch": ["21"], "notify": ["https://food.example.com/hook"]}}
+func loadTenants(path string) (map[string]*Tenant, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tenants map[string]*Tenant
+	if err := json.Unmarshal(b, &tenants); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for name, t := range tenants {
+		if name == "" || strings.ContainsAny(name, "/?#") {
+			return nil, fmt.Errorf("%s: bad namespace name %q", path, name)
+		}
+		if t == nil || len(t.APIKeys) == 0 {
+			return nil, fmt.Errorf("%s: namespace %s has no api_keys", path, name)
+		}
+		for _, k := range t.APIKeys {
+			if len(k) < 16 {
+				return nil, fmt.Errorf("%s: namespace %s: API keys must be at least 16 characters", path, name)
+			}
+		}
+		t.name = name
+		for _, w := range t.Watch {
+			title, part, hasPart := strings.Cut(w, "/")
+			n, err := strconv.Atoi(title)
+			if err != nil || n <= 0 || (hasPart && part == "") {
+				return nil, fmt.Errorf("%s: namespace %s: watch entry %q is not title or title/part", path, name, w)
+			}
+			t.watch = append(t.watch, scope{n, part})
+		}
+		for _, spec := range t.Notify {
+			n, err := newNotifier(spec)
+			if err != nil {
+				return nil, fmt.Errorf("%s: namespace %s: %w", path, name, err)
+			}
+			// named per namespace, so two sharing a target each hear
+			t.notify = append(t.notify, watchChannel{channelName("ns:"+name, spec), tenantNotifier{t, n}})
+		}
+	}
+	return tenants, nil
+}
+
+// authorized reports whether r carries one of t's API keys.
+func (t *Tenant) authorized(r *http.Request) bool {
+	key := r.Header.Get("X-API-Key")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		key = bearer
+	}
+	if key == "" {
+		return false
+	}
+	ok := false
+	for _, k := range t.APIKeys {
+		// no early exit, so timing doesn't say which key matched
+		ok = subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 || ok
+	}
+	return ok
+}
+
+// allows reports whether every scope is on t's watchlist: a whole-title
+// entry covers each of its parts, a part entry only that part.
+func (t *Tenant) allows(scopes []scope) bool {
+	if t == nil || len(t.watch) == 0 {
+		return true
+	}
+	for _, s := range scopes {
+		covered := false
+		for _, w := range t.watch {
+			if w.title == s.title && (w.part == "" || w.part == s.part) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// covers reports whether e changed anything on t's watchlist: the title,
+// or one of the parts listed.
+func (t *Tenant) covers(e WatchEvent) bool {
+	if len(t.watch) == 0 {
+		return true
+	}
+	for _, w := range t.watch {
+		if w.title == e.Title && (w.part == "" || contains(e.Parts, w.part)) {
+			return true
+		}
+	}
+	return false
+}
+
+// tenantNotifier passes on the events its namespace watches and drops the
+// rest.
+type tenantNotifier struct {
+	t *Tenant
+	Notifier
+}
+
+func (n tenantNotifier) Notify(ctx context.Context, e WatchEvent) error {
+	if !n.t.covers(e) {
+		return nil
+	}
+	return n.Notifier.Notify(ctx, e)
+}
+
+// watchesPartOf reports whether the watchlist has any part of title.
+func (t *Tenant) watchesPartOf(title int) bool {
+	for _, w := range t.watch {
+		if w.title == title {
+			return true
+		}
+	}
+	return false
+}
+
+type tenantKey struct{}
+
+// tenantOf returns the namespace a request was authenticated for, or nil
+// outside namespaces.
+func tenantOf(ctx context.Context) *Tenant {
+	t, _ := ctx.Value(tenantKey{}).(*Tenant)
+	return t
+}
+
+// withTenant serves h under /ns/{ns}/ for requests bearing one of that
+// namespace's keys.
+func withTenant(tenants map[string]*Tenant, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t := tenants[r.PathValue("ns")]
+		if t == nil {
+			httpError(w, http.StatusNotFound, fmt.Errorf("unknown namespace %q", r.PathValue("ns")))
+			return
+		}
+		if !t.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+t.name+`"`)
+			httpError(w, http.StatusUnauthorized, errors.New("missing or wrong API key"))
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), tenantKey{}, t)))
+	}
+}
+
+// watchEntry is one watchlist scope with the latest substantive change to
+// it.
+type watchEntry struct {
+	Title       int    `json:"title"`
+	Part        string `json:"part,omitempty"`
+	LastAmended string `json:"last_amended,omitempty"`
+}
+
+// watchlistHandler lists the namespace's watchlist with when each entry
+// last changed.
+func watchlistHandler(c httpclient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t := tenantOf(r.Context())
+		resp := struct {
+			Namespace string       `json:"namespace"`
+			Watch     []watchEntry `json:"watch"`
+		}{Namespace: t.name, Watch: []watchEntry{}}
+		api := newAPI(c)
+		for _, s := range t.watch {
+			versions, err := api.Versions(r.Context(), s.title, ecfr.Hierarchy{Part: s.part})
+			if err != nil {
+				httpError(w, upstreamStatus(err), err)
+				return
+			}
+			e := watchEntry{Title: s.title, Part: s.part}
+			for _, v := range versions {
+				if v.Substantive && v.Date > e.LastAmended {
+					e.LastAmended = v.Date
+				}
+			}
+			resp.Watch = append(resp.Watch, e)
+		}
+		writeJSON(w, resp)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTenantNotifyFollowsWatchlist(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tenants.json")
+	air, food := filepath.Join(dir, "air.ndjson"), filepath.Join(dir, "food.ndjson")
+	os.WriteFile(path, []byte(`{
+		"air": {"api_keys": ["0123456789abcdef"], "watch": ["40/60"], "notify": ["file:`+air+`"]},
+		"food": {"api_keys": ["fedcba9876543210"], "watch": ["21"], "notify": ["file:`+food+`"]}
+	}`), 0o644)
+	tenants, err := loadTenants(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var channels []watchChannel
+	for _, name := range sortedKeys(tenants) {
+		channels = append(channels, tenants[name].notify...)
+	}
+	for _, e := range []WatchEvent{
+		{Title: 40, Date: "2024-01-02", Parts: []string{"60", "61"}},
+		{Title: 40, Date: "2024-01-03", Parts: []string{"63"}},
+		{Title: 21, Date: "2024-01-04", Parts: []string{"101"}},
+	} {
+		for _, c := range channels {
+			if err := c.Notify(context.Background(), e); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for file, want := range map[string]string{air: "2024-01-02", food: "2024-01-04"} {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+		if len(lines) != 1 || !strings.Contains(lines[0], want) {
+			t.Errorf("%s got %q, want just the %s event", filepath.Base(file), lines, want)
+		}
+	}
+}
+
+func TestLoadTenantsRejectsBadNotifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	os.WriteFile(path, []byte(`{"air": {"api_keys": ["0123456789abcdef"], "notify": ["ftp://nowhere"]}}`), 0o644)
+	if _, err := loadTenants(path); err == nil || !strings.Contains(err.Error(), "namespace air") {
+		t.Errorf("loadTenants = %v, want an error naming the namespace", err)
+	}
+}
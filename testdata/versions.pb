@@ -0,0 +1,9 @@
+R
+
+2024-01-02
+2024-01-02
+2024-01-05"60.4*§ 60.4 Address.2608JAR40ZsectionQ
+
+2016-12-22
+2016-12-22
+2016-12-22"25.2*§ 25.2 [Reserved]225@R40Zsection
\ No newline at end of file
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/paulgmiller/efcr/core"
+)
+
+// textWriter renders a Div tree as plain text or Markdown for NLP and
+// publishing pipelines: one heading per Div, in the tree's order and
+// nesting, then its paragraphs one per block with a blank line between.
+// Paragraph text is as parsed, so labels like "(b)(1)" and the
+// citations in CITA and SOURCE blocks come through untouched. Removed
+// sections close their part as tombstones.
+type textWriter struct {
+	w        *bufio.Writer
+	markdown bool
+	notes    int                    // Markdown footnotes so far, to number them uniquely
+	removed  map[string][]Tombstone // by part, until written
+}
+
+// writeText writes root under a header naming what it is and where it came
+// from: YAML front matter for Markdown, a line for plain text. root may be
+// nil when only tombstones are left.
+func writeText(w io.Writer, root *core.Div, name, date, source string, removed []Tombstone, markdown bool) error {
+	t := &textWriter{w: bufio.NewWriter(w), markdown: markdown, removed: map[string][]Tombstone{}}
+	for _, r := range removed {
+		t.removed[r.Part] = append(t.removed[r.Part], r)
+	}
+	if markdown {
+		fmt.Fprintf(t.w, "---\ntitle: %q\ndate: %s\nsource: %q\n---\n", name, date, source)
+	} else {
+		fmt.Fprintf(t.w, "%s\nSource: %s\n", name, source)
+	}
+	if root != nil {
+		t.div(root, 1)
+	}
+	for _, r := range removed {
+		if _, ok := t.removed[r.Part]; ok {
+			t.tombstone(r, 2) // its part isn't in the tree
+		}
+	}
+	return t.w.Flush()
+}
+
+// tombstone writes a removed section the way the eCFR shows reserved ones,
+// "§ 60.5 [Removed]", with when and the hash of its last text.
+func (t *textWriter) tombstone(r Tombstone, level int) {
+	head := "§ " + r.Section + " [Removed]"
+	if strings.HasPrefix(r.Section, "Appendix") {
+		head = r.Section + " [Removed]"
+	}
+	body := fmt.Sprintf("Removed %s.", r.Removed)
+	if r.LastSeen != "" {
+		body += fmt.Sprintf(" Last text as of %s, SHA-256 %s.", r.LastSeen, r.TextSHA256)
+	}
+	if t.markdown {
+		fmt.Fprintf(t.w, "\n%s %s\n\n%s\n", strings.Repeat("#", min(level, 6)), mdEscape(head), mdEscape(body))
+	} else {
+		fmt.Fprintf(t.w, "\n%s\n\n%s\n", head, body)
+	}
+}
+
+func (t *textWriter) div(d *core.Div, level int) {
+	t.w.WriteString("\n")
+	if t.markdown {
+		fmt.Fprintf(t.w, "%s %s\n", strings.Repeat("#", min(level, 6)), mdEscape(divLabel(d)))
+	} else {
+		t.w.WriteString(divLabel(d) + "\n")
+	}
+	marks := map[string]string{} // footnote mark -> Markdown label
+	for _, f := range d.Footnotes {
+		t.notes++
+		marks[f.Mark] = fmt.Sprint(t.notes)
+	}
+	for _, p := range d.Paras {
+		t.w.WriteString("\n")
+		switch {
+		case p.Rows != nil:
+			t.table(p.Rows)
+		case t.markdown && (p.Tag == "CITA" || p.Tag == "SOURCE" || p.Tag == "AUTH"):
+			t.w.WriteString("*" + strings.TrimSpace(t.words(p, marks)) + "*\n")
+		default:
+			t.w.WriteString(t.words(p, marks) + "\n")
+		}
+	}
+	for _, f := range d.Footnotes {
+		if t.markdown {
+			fmt.Fprintf(t.w, "\n[^%s]: %s\n", marks[f.Mark], mdEscape(f.Text))
+		} else {
+			fmt.Fprintf(t.w, "\n%s\n", f.String())
+		}
+	}
+	for i := range d.Children {
+		t.div(&d.Children[i], level+1)
+	}
+	if d.Type == core.TypePart {
+		for _, r := range t.removed[d.N] {
+			t.tombstone(r, level+1)
+		}
+		delete(t.removed, d.N)
+	}
+}
+
+// words is p's text, with its footnote references in Markdown. Plain text
+// leaves them out, as word counts do; the footnotes follow the Div.
+func (t *textWriter) words(p core.Para, marks map[string]string) string {
+	if !t.markdown {
+		return p.Text
+	}
+	words := strings.Fields(p.Text)
+	var b strings.Builder
+	i := 0
+	for _, a := range p.Anchors {
+		for ; i < a.Word && i < len(words); i++ {
+			b.WriteString(" " + mdInline.Replace(words[i]))
+		}
+		if label, ok := marks[a.Mark]; ok {
+			b.WriteString("[^" + label + "]")
+		}
+	}
+	for ; i < len(words); i++ {
+		b.WriteString(" " + mdInline.Replace(words[i]))
+	}
+	return mdBlockStart(strings.TrimSpace(b.String()))
+}
+
+// table writes a GPOTABLE's rows: tab separated in plain text, a pipe table
+// under its first row in Markdown.
+func (t *textWriter) table(rows [][]string) {
+	for i, r := range rows {
+		if !t.markdown {
+			t.w.WriteString(strings.Join(r, "\t") + "\n")
+			continue
+		}
+		cells := make([]string, len(r))
+		for j, c := range r {
+			cells[j] = strings.ReplaceAll(mdEscape(c), "|", `\|`)
+		}
+		t.w.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+		if i == 0 {
+			t.w.WriteString(strings.Repeat("| --- ", len(r)) + "|\n")
+		}
+	}
+}
+
+// mdInline are the characters that would start Markdown emphasis, links,
+// code or HTML mid-line.
+var mdInline = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`)
+
+// mdEscape makes s literal Markdown text.
+func mdEscape(s string) string {
+	return mdBlockStart(mdInline.Replace(s))
+}
+
+// mdBlockStart escapes the "#", ">", "-", "+" or "1." that would make a line
+// starting with s open a block.
+func mdBlockStart(s string) string {
+	switch {
+	case strings.HasPrefix(s, "#"), strings.HasPrefix(s, ">"), strings.HasPrefix(s, "- "), strings.HasPrefix(s, "+ "):
+		return `\` + s
+	}
+	if n := len(s) - len(strings.TrimLeft(s, "0123456789")); n > 0 && n < len(s) && (s[n] == '.' || s[n] == ')') {
+		return s[:n] + `\` + s[n:]
+	}
+	return s
+}
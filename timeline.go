@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// TimelinePoint is one bin of a timeline series. Series are dense: every
+// bin between the first and last observation is present.
+type TimelinePoint struct {
+	Period string `json:"period"`
+	Value  int64  `json:"value"`
+}
+
+// binStart truncates date (YYYY-MM-DD) to the start of its month, quarter
+// or year.
+func binStart(date, bin string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch bin {
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+	case "quarter":
+		return time.Date(t.Year(), (t.Month()-1)/3*3+1, 1, 0, 0, 0, 0, time.UTC), nil
+	case "year":
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC), nil
+	}
+	return time.Time{}, fmt.Errorf("unknown bin %q (month|quarter|year)", bin)
+}
+
+func binNext(t time.Time, bin string) time.Time {
+	switch bin {
+	case "quarter":
+		return t.AddDate(0, 3, 0)
+	case "year":
+		return t.AddDate(1, 0, 0)
+	}
+	return t.AddDate(0, 1, 0)
+}
+
+func binLabel(t time.Time, bin string) string {
+	switch bin {
+	case "quarter":
+		return fmt.Sprintf("%d-Q%d", t.Year(), (t.Month()-1)/3+1)
+	case "year":
+		return fmt.Sprintf("%d", t.Year())
+	}
+	return t.Format("2006-01")
+}
+
+// parseBinLabel inverts binLabel.
+func parseBinLabel(label, bin string) (time.Time, error) {
+	switch bin {
+	case "quarter":
+		var y, q int
+		if _, err := fmt.Sscanf(label, "%d-Q%d", &y, &q); err != nil {
+			return time.Time{}, err
+		}
+		return time.Date(y, time.Month(3*(q-1)+1), 1, 0, 0, 0, 0, time.UTC), nil
+	case "year":
+		return time.Parse("2006", label)
+	}
+	return time.Parse("2006-01", label)
+}
+
+// denseSeries expands sparse per-bin values (keyed by bin label) into a
+// continuous series. With carry set, empty bins repeat the previous value
+// (levels); otherwise they are zero (counts).
+func denseSeries(values map[string]int64, bin string, carry bool) ([]TimelinePoint, error) {
+	if len(values) == 0 {
+		return []TimelinePoint{}, nil
+	}
+	var first, last time.Time
+	for label := range values {
+		t, err := parseBinLabel(label, bin)
+		if err != nil {
+			return nil, err
+		}
+		if first.IsZero() || t.Before(first) {
+			first = t
+		}
+		if t.After(last) {
+			last = t
+		}
+	}
+	var out []TimelinePoint
+	var prev int64
+	for t := first; !t.After(last); t = binNext(t, bin) {
+		label := binLabel(t, bin)
+		v, ok := values[label]
+		if !ok && carry {
+			v = prev
+		}
+		prev = v
+		out = append(out, TimelinePoint{Period: label, Value: v})
+	}
+	return out, nil
+}
+
+// amendmentTimeline counts section amendment events per bin across scopes.
+func amendmentTimeline(ctx context.Context, c httpclient, scopes []scope, bin, dateField string) ([]TimelinePoint, error) {
+	var facts []Fact
+	for _, s := range scopes {
+		versions, err := newAPI(c).Versions(ctx, s.title, ecfr.Hierarchy{Part: s.part})
+		if err != nil {
+			return nil, err
+		}
+		facts = append(facts, eventFacts(amendmentEvents(s.title, versions, dateField))...)
+	}
+	bucket, err := binBucket(bin)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := Rollup{Bucket: bucket}.Run(facts)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int64{}
+	for _, r := range rows {
+		if r.Metric == "amendments" {
+			counts[r.Period] = int64(r.Value)
+		}
+	}
+	return denseSeries(counts, bin, false)
+}
+
+// wordsTimeline reports total words per bin, measured at the last snapshot
+// inside each bin and carried forward through bins without one. Snapshots
+// only exist on the versioner date, so dateField is ignored.
+func wordsTimeline(ctx context.Context, c httpclient, scopes []scope, bin, _ string) ([]TimelinePoint, error) {
+	bucket, err := binBucket(bin)
+	if err != nil {
+		return nil, err
+	}
+	span := map[string]int64{} // every bin any scope has a snapshot in
+	perScope := make([]map[string]int64, len(scopes))
+	for i, s := range scopes {
+		versions, err := newAPI(c).Versions(ctx, s.title, ecfr.Hierarchy{Part: s.part})
+		if err != nil {
+			return nil, err
+		}
+		lastInBin := map[string]string{}
+		for _, v := range versions {
+			b, _ := bucket(v.Date)
+			if v.Date > lastInBin[b] {
+				lastInBin[b] = v.Date
+			}
+		}
+		perScope[i] = map[string]int64{}
+		for b, date := range lastInBin {
+			n, err := scopeWords(ctx, c, s, date)
+			if err != nil {
+				return nil, err
+			}
+			perScope[i][b] = n
+			span[b] = 0
+		}
+	}
+
+	// Scopes start at different times; sum each one's carried-forward level
+	// over the union of bins.
+	out, err := denseSeries(span, bin, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, words := range perScope {
+		var last int64
+		for i := range out {
+			if v, ok := words[out[i].Period]; ok {
+				last = v
+			}
+			out[i].Value += last
+		}
+	}
+	return out, nil
+}
+
+// scopeWords counts the words of a title or part as of a snapshot date.
+func scopeWords(ctx context.Context, c httpclient, s scope, date string) (int64, error) {
+	r, err := newAPI(c).Text(ctx, s.title, date, ecfr.Hierarchy{Part: s.part})
+	if err != nil {
+		return 0, err
+	}
+	return core.CountWords(r)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// Tombstone stands in for a section or appendix that has been removed, so
+// exports and the API can tell "removed" from "never existed".
+type Tombstone struct {
+	ID      string `json:"id"` // core.SectionID
+	Title   int    `json:"title"`
+	Part    string `json:"part"`
+	Section string `json:"section"`
+	Removed string `json:"removed"` // date of the version that removed it
+	// LastSeen is the date of the last version with text, and TextSHA256
+	// the hash of that text (see textHash). Both are empty if the history
+	// has no such version.
+	LastSeen   string `json:"last_seen,omitempty"`
+	TextSHA256 string `json:"text_sha256,omitempty"`
+}
+
+// Citation formats the tombstone's section as a CFR citation.
+func (t Tombstone) Citation() string {
+	return citation(t.Title, t.Part, t.Section)
+}
+
+// textHash is the SHA-256 of a section's text as exports carry it: its
+// paragraphs, one per line (core.ParaText).
+func textHash(d *core.Div) string {
+	sum := sha256.Sum256([]byte(core.ParaText(d)))
+	return hex.EncodeToString(sum[:])
+}
+
+// removedSections returns a tombstone for each section and appendix in h
+// whose latest version on or before date removed it, sorted by ID.
+// chapters places parts for the IDs (see core.PartChapters). The text
+// hashed is read from the part as it stood on LastSeen.
+func removedSections(ctx context.Context, c httpclient, title int, h ecfr.Hierarchy, date string, chapters map[string]string) ([]Tombstone, error) {
+	api := newAPI(c)
+	versions, err := api.Versions(ctx, title, h)
+	if err != nil {
+		return nil, err
+	}
+	history := map[core.SectionID][]ecfr.Version{}
+	for _, v := range versions {
+		if (v.Type == "section" || v.Type == "appendix") && v.Date <= date {
+			id := core.SectionID{Title: title, Part: v.Part, Section: v.Identifier}
+			history[id] = append(history[id], v)
+		}
+	}
+	var out []Tombstone
+	parts := map[string]*core.Div{} // part/date -> root, fetched once
+	for id, vs := range history {
+		sort.SliceStable(vs, func(i, j int) bool { return vs[i].Date < vs[j].Date })
+		last := vs[len(vs)-1]
+		if !last.Removed {
+			continue
+		}
+		t := Tombstone{Title: title, Part: id.Part, Section: id.Section, Removed: last.Date}
+		id.Chapter = chapters[id.Part]
+		t.ID = id.String()
+		for i := len(vs) - 1; i >= 0; i-- {
+			if !vs[i].Removed && vs[i].Date < last.Date {
+				t.LastSeen = vs[i].Date
+				break
+			}
+		}
+		if t.LastSeen != "" {
+			key := id.Part + "/" + t.LastSeen
+			root, ok := parts[key]
+			if !ok {
+				doc, err := api.Document(ctx, title, t.LastSeen, ecfr.Hierarchy{Part: id.Part})
+				if err != nil {
+					return nil, fmt.Errorf("%s as of %s: %w", t.Citation(), t.LastSeen, err)
+				}
+				root = doc.Root()
+				parts[key] = root
+			}
+			core.WalkSectionIDs(root, title, func(found core.SectionID, d *core.Div) {
+				if found.Same(id) {
+					t.TextSHA256 = textHash(d)
+				}
+			})
+		}
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+// documentWithRemoved fetches h as of date along with the tombstones of the
+// sections removed from it by then. A section filter naming a removed
+// section returns a nil root and just its tombstone.
+func documentWithRemoved(ctx context.Context, c httpclient, title int, h ecfr.Hierarchy, date string) (*core.Div, []Tombstone, error) {
+	var root *core.Div
+	doc, fetchErr := newAPI(c).Document(ctx, title, date, h)
+	var se *ecfr.StatusError
+	switch {
+	case fetchErr == nil:
+		root = doc.Root()
+	case h.Section == "" || !errors.As(fetchErr, &se) || se.Code != http.StatusNotFound:
+		return nil, nil, fetchErr
+	}
+	var chapters map[string]string
+	var err error
+	if root != nil {
+		chapters = core.PartChapters(root)
+	} else if chapters, err = partChapters(ctx, c, title, date); err != nil {
+		return nil, nil, err
+	}
+	removed, err := removedSections(ctx, c, title, h, date, chapters)
+	if err != nil {
+		return nil, nil, err
+	}
+	if root == nil && len(removed) == 0 {
+		return nil, nil, fetchErr
+	}
+	return root, removed, nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// placement is where a part sits in a title's structure on one date.
+type placement struct {
+	Chapter     string // chapter identifier, e.g. "I"
+	ChapterName string // chapter label_description, usually the agency
+	Heading     string
+}
+
+// placements maps every non-reserved part in the tree to its chapter.
+func placements(n *ecfr.StructureNode) map[string]placement {
+	out := map[string]placement{}
+	var walk func(n *ecfr.StructureNode, chapter, name string)
+	walk = func(n *ecfr.StructureNode, chapter, name string) {
+		switch n.Type {
+		case "chapter":
+			chapter, name = n.Identifier, n.LabelDescription
+		case "part":
+			if !n.Reserved {
+				out[n.Identifier] = placement{Chapter: chapter, ChapterName: name, Heading: n.LabelDescription}
+			}
+			return
+		}
+		for i := range n.Children {
+			walk(&n.Children[i], chapter, name)
+		}
+	}
+	walk(n, "", "")
+	return out
+}
+
+// TransferEvent is one change in who a part belongs to, found between two
+// structure snapshots.
+type TransferEvent struct {
+	Title       int    `json:"title"`
+	Since       string `json:"since"` // earlier snapshot
+	Date        string `json:"date"`  // snapshot where the change is first seen
+	Kind        string `json:"kind"`  // transferred, redesignated or chapter-renamed
+	Part        string `json:"part,omitempty"`
+	NewPart     string `json:"new_part,omitempty"`
+	FromChapter string `json:"from_chapter"`
+	ToChapter   string `json:"to_chapter"`
+	FromAgency  string `json:"from_agency"`
+	ToAgency    string `json:"to_agency"`
+}
+
+// diffPlacements compares two snapshots. A part that vanished while a new
+// one with the same heading appeared is a redesignation; a part whose
+// chapter changed is a transfer; a chapter whose heading changed is a
+// rename, which is how reorganisations usually show up.
+func diffPlacements(title int, since, date string, old, cur map[string]placement) []TransferEvent {
+	var out []TransferEvent
+	ev := func(kind, part, newPart string, a, b placement) {
+		out = append(out, TransferEvent{Title: title, Since: since, Date: date, Kind: kind, Part: part, NewPart: newPart,
+			FromChapter: a.Chapter, ToChapter: b.Chapter, FromAgency: a.ChapterName, ToAgency: b.ChapterName})
+	}
+
+	added := map[string]string{} // heading -> new part
+	for p, b := range cur {
+		if _, ok := old[p]; !ok && b.Heading != "" {
+			added[b.Heading] = p
+		}
+	}
+	renamed := map[string]bool{}
+	for _, p := range sortedKeys(old) {
+		a := old[p]
+		b, ok := cur[p]
+		if !ok {
+			if np, ok := added[a.Heading]; ok && a.Heading != "" {
+				ev("redesignated", p, np, a, cur[np])
+			}
+			continue
+		}
+		switch {
+		case a.Chapter != b.Chapter:
+			ev("transferred", p, "", a, b)
+		case a.ChapterName != b.ChapterName && !renamed[a.Chapter]:
+			renamed[a.Chapter] = true
+			ev("chapter-renamed", "", "", a, b)
+		}
+	}
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// runTransfers diffs a title's structure across its history and logs parts
+// that moved between chapters (agencies), were redesignated, or whose
+// chapter was renamed in a reorganisation.
+//
+//	efcr transfers --title 6 --bin year [--out transfers.ndjson]
+//
+// One structure snapshot is taken per bin (the last version date in it), so
+// a coarser bin costs fewer requests but dates each change less precisely.
+func runTransfers(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("transfers", flag.ExitOnError)
+	title := fs.Int("title", 0, "title number")
+	bin := fs.String("bin", "year", "sample one structure snapshot per day, month, quarter or year")
+	out := fs.String("out", "", "write the transfer log as NDJSON here instead of a table")
+	fs.Parse(args)
+	if *title == 0 {
+		return errors.New("--title is required")
+	}
+
+	versions, err := newAPI(c).Versions(ctx, *title, ecfr.Hierarchy{})
+	if err != nil {
+		return err
+	}
+	last := map[string]string{} // bin label -> latest version date in it
+	for _, v := range versions {
+		t, err := binStart(v.Date, *bin)
+		if err != nil {
+			return err
+		}
+		label := binLabel(t, *bin)
+		if v.Date > last[label] {
+			last[label] = v.Date
+		}
+	}
+	var dates []string
+	for _, d := range last {
+		dates = append(dates, d)
+	}
+	sort.Strings(dates)
+
+	var events []TransferEvent
+	var prev map[string]placement
+	for i, d := range dates {
+		root, err := newAPI(c).Structure(ctx, *title, d)
+		if err != nil {
+			return err
+		}
+		cur := placements(root)
+		if prev != nil {
+			events = append(events, diffPlacements(*title, dates[i-1], d, prev, cur)...)
+		}
+		prev = cur
+	}
+
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		enc := json.NewEncoder(f)
+		for i := range events {
+			if err := enc.Encode(&events[i]); err != nil {
+				return err
+			}
+		}
+		return f.Close()
+	}
+	fmt.Printf("Title %d: %d change(s) across %d structure snapshots\n", *title, len(events), len(dates))
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "Since\tDate\tKind\tPart\tFrom\tTo")
+	for _, e := range events {
+		part := e.Part
+		if e.NewPart != "" {
+			part += " -> " + e.NewPart
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s %s\t%s %s\n", e.Since, e.Date, e.Kind, part, e.FromChapter, e.FromAgency, e.ToChapter, e.ToAgency)
+	}
+	return tw.Flush()
+}
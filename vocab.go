@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+)
+
+// runVocabDiff reports the terms whose frequency changed most in a title or
+// part between two dates: terminology introduced, dropped or reweighted.
+//
+//	efcr vocab-diff --title 6 --part 27 --from 2017-01-19 --to 2024-01-01 --top 30
+func runVocabDiff(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("vocab-diff", flag.ExitOnError)
+	title := fs.Int("title", 0, "title number")
+	part := fs.String("part", "", "restrict to one part")
+	from := fs.String("from", "", "old snapshot date YYYY-MM-DD")
+	to := fs.String("to", "", "new snapshot date YYYY-MM-DD")
+	top := fs.Int("top", 25, "number of terms to report")
+	minCount := fs.Int64("min-count", 3, "ignore terms seen fewer times than this on both dates")
+	fs.Parse(args)
+	if *title == 0 || *from == "" || *to == "" {
+		return errors.New("--title, --from and --to are required")
+	}
+
+	type dist struct {
+		counts map[string]int64
+		total  int64
+	}
+	var d [2]dist
+	for i, date := range []string{*from, *to} {
+		text, err := newAPI(c).Text(ctx, *title, date, ecfr.Hierarchy{Part: *part})
+		if err != nil {
+			return err
+		}
+		if d[i].counts, d[i].total, err = core.TermCounts(text); err != nil {
+			return err
+		}
+	}
+
+	deltas := core.VocabDiff(d[0].counts, d[0].total, d[1].counts, d[1].total, *minCount)
+	if len(deltas) > *top {
+		deltas = deltas[:*top]
+	}
+	fmt.Printf("%s: %d words on %s, %d on %s\n", citation(*title, *part, ""), d[0].total, *from, d[1].total, *to)
+	fmt.Println("Term\tOld\tNew\tOldPer10k\tNewPer10k\tChange\tStatus")
+	for _, t := range deltas {
+		status := ""
+		switch {
+		case t.Old == 0:
+			status = "new"
+		case t.New == 0:
+			status = "dropped"
+		}
+		fmt.Printf("%s\t%d\t%d\t%.2f\t%.2f\t%+.2f\t%s\n", t.Term, t.Old, t.New, t.OldRate, t.NewRate, t.Change(), status)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// walRecord is one line of watch's write-ahead log.
+type walRecord struct {
+	Op string `json:"op"` // event, sent, fetch or fetched
+	// event: an amendment detected; sent: delivered to Channel.
+	Event   *WatchEvent `json:"event,omitempty"`
+	Key     string      `json:"key,omitempty"` // of the event, see eventKey
+	Channel string      `json:"channel,omitempty"`
+	// fetch: a part to archive as of a date; fetched: archived.
+	Title int    `json:"title,omitempty"`
+	Part  string `json:"part,omitempty"`
+	Date  string `json:"date,omitempty"`
+}
+
+// eventKey identifies an amendment across polls and restarts.
+func eventKey(e WatchEvent) string {
+	return fmt.Sprintf("%d/%s", e.Title, e.Date)
+}
+
+// channelName identifies a notification channel in the log without
+// writing its spec, which may hold a webhook secret, to disk.
+func channelName(kind, spec string) string {
+	sum := sha256.Sum256([]byte(spec))
+	return kind + ":" + hex.EncodeToString(sum[:6])
+}
+
+// watchWAL is watch's write-ahead log of work not yet finished: detected
+// amendments with the channels that still have to hear about them, and
+// parts still to archive. Each record is synced before the work it
+// describes starts, and the state file only advances after that, so a
+// crash neither loses a detected amendment nor, since deliveries are
+// recorded per channel, repeats one after recovery. Once a poll's state is
+// saved the log is compacted down to what is still pending.
+type watchWAL struct {
+	path    string
+	f       *os.File
+	events  []WatchEvent               // in detection order
+	sent    map[string]map[string]bool // event key -> channels delivered
+	fetches map[walRecord]bool         // archive fetches pending
+}
+
+// openWatchWAL replays the log at path, if any, and opens it for appending.
+// A torn last line, from a crash mid-write, is dropped.
+func openWatchWAL(path string) (*watchWAL, error) {
+	l := &watchWAL{path: path, sent: map[string]map[string]bool{}, fetches: map[walRecord]bool{}}
+	f, err := os.Open(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		sc := bufio.NewScanner(f)
+		sc.Buffer(nil, 16<<20)
+		for n := 1; sc.Scan(); n++ {
+			var r walRecord
+			if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+				slog.Warn("wal: ignoring unreadable tail", "path", path, "line", n, "err", err)
+				break
+			}
+			l.apply(r)
+		}
+		f.Close()
+		if err := sc.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := l.rewrite(); err != nil { // drops a torn line before appending
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *watchWAL) apply(r walRecord) {
+	switch r.Op {
+	case "event":
+		key := eventKey(*r.Event)
+		if _, ok := l.sent[key]; !ok {
+			l.events = append(l.events, *r.Event)
+			l.sent[key] = map[string]bool{}
+		}
+	case "sent":
+		if l.sent[r.Key] != nil {
+			l.sent[r.Key][r.Channel] = true
+		}
+	case "fetch":
+		l.fetches[walRecord{Title: r.Title, Part: r.Part, Date: r.Date}] = true
+	case "fetched":
+		delete(l.fetches, walRecord{Title: r.Title, Part: r.Part, Date: r.Date})
+	}
+}
+
+// append records r durably, then applies it.
+func (l *watchWAL) append(r walRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := l.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err := l.f.Sync(); err != nil {
+		return err
+	}
+	l.apply(r)
+	return nil
+}
+
+// detect records a new amendment, reporting false if the log already has
+// it: a repeat of a poll that crashed before saving its state.
+func (l *watchWAL) detect(e WatchEvent) (bool, error) {
+	if _, ok := l.sent[eventKey(e)]; ok {
+		return false, nil
+	}
+	return true, l.append(walRecord{Op: "event", Event: &e})
+}
+
+// pendingOn reports whether channel has yet to get e.
+func (l *watchWAL) pendingOn(e WatchEvent, channel string) bool {
+	sent, ok := l.sent[eventKey(e)]
+	return ok && !sent[channel]
+}
+
+// pending returns the events some channel has yet to get.
+func (l *watchWAL) pending(channels []string) []WatchEvent {
+	var out []WatchEvent
+	for _, e := range l.events {
+		for _, c := range channels {
+			if !l.sent[eventKey(e)][c] {
+				out = append(out, e)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// pendingFetches returns the archive fetches not yet done, oldest first.
+func (l *watchWAL) pendingFetches() []walRecord {
+	var out []walRecord
+	for r := range l.fetches {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Date != out[j].Date {
+			return out[i].Date < out[j].Date
+		}
+		return archiveKey(out[i].Title, out[i].Part, "") < archiveKey(out[j].Title, out[j].Part, "")
+	})
+	return out
+}
+
+// compact drops everything finished: events every channel has, and done
+// fetches. It is only safe once the state file covers those events, or a
+// crash before the next save would detect and send them again.
+func (l *watchWAL) compact(channels []string) error {
+	keep := l.pending(channels)
+	l.events = keep
+	sent := map[string]map[string]bool{}
+	for _, e := range keep {
+		sent[eventKey(e)] = l.sent[eventKey(e)]
+	}
+	l.sent = sent
+	return l.rewrite()
+}
+
+// rewrite replaces the log with the records for what it holds now, and
+// reopens it for appending.
+func (l *watchWAL) rewrite() error {
+	if l.f != nil {
+		l.f.Close()
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for i := range l.events {
+		e := &l.events[i]
+		if err == nil {
+			err = enc.Encode(walRecord{Op: "event", Event: e})
+		}
+		for c := range l.sent[eventKey(*e)] {
+			if err == nil {
+				err = enc.Encode(walRecord{Op: "sent", Key: eventKey(*e), Channel: c})
+			}
+		}
+	}
+	for _, r := range l.pendingFetches() {
+		if err == nil {
+			r.Op = "fetch"
+			err = enc.Encode(r)
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), l.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	l.f, err = os.OpenFile(l.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	return err
+}
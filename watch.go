@@ -0,0 +1,495 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/paulgmiller/efcr/core"
+	"github.com/paulgmiller/efcr/ecfr"
+	"github.com/paulgmiller/efcr/pipeline"
+)
+
+// WatchEvent is one line of the `watch` NDJSON stream: a substantive
+// amendment to a title on a date no earlier poll had seen.
+type WatchEvent struct {
+	Title int    `json:"title"`
+	Name  string `json:"name"`
+	Date  string `json:"date"`
+	// Parts lists the parts with substantive changes on Date, and Sections
+	// the core.SectionID of each section or appendix changed.
+	Parts    []string `json:"parts"`
+	Sections []string `json:"sections"`
+	// Words is the title's word count as of Date, tables excluded as in
+	// crawl, and WordDelta its change from the snapshot before.
+	Words     int64  `json:"words"`
+	WordDelta int64  `json:"word_delta"`
+	URL       string `json:"url"`      // the amended text on the eCFR site
+	Detected  string `json:"detected"` // RFC 3339 time of the poll that found it
+}
+
+// watchURL links to what an event changed as of its date: the part, if it
+// was just one, else the title.
+func watchURL(e WatchEvent) string {
+	u := fmt.Sprintf("%s/on/%s/title-%d", ecfrSite, e.Date, e.Title)
+	if len(e.Parts) == 1 {
+		u += "/part-" + e.Parts[0]
+	}
+	return u
+}
+
+// watchState is the watch --state file: per title, the latest version date
+// already handled.
+type watchState map[int]string
+
+func loadWatchState(path string) (watchState, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return watchState{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := watchState{}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// save replaces the state file, so a crash leaves the old one intact.
+func (s watchState) save(path string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(append(b, '\n'))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// watcher is one `efcr watch` process between polls.
+type watcher struct {
+	c       httpclient
+	titles  map[int]bool
+	state   watchState
+	path    string // of state
+	dbPath  string
+	args    []string // recorded as the --db run's arguments
+	workers int
+	notify  []watchChannel // stdout, --exec and --notify
+	wal     *watchWAL
+	archive *Archive // --archive, if set
+}
+
+// watchChannel is a Notifier under the name the WAL knows it by.
+type watchChannel struct {
+	name string
+	Notifier
+}
+
+// stdoutNotifier writes events to the NDJSON stream on stdout.
+type stdoutNotifier struct {
+	enc *json.Encoder
+}
+
+func (s stdoutNotifier) Notify(_ context.Context, e WatchEvent) error {
+	return s.enc.Encode(e)
+}
+
+func (w *watcher) channelNames() []string {
+	var names []string
+	for _, c := range w.notify {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// runWatch turns efcr into a change-tracking service: every --interval it
+// polls the titles and versions endpoints, and for each title amended since
+// the last poll fetches just the new snapshots, adds them to the --db store
+// and reports each new amendment date as a WatchEvent on stdout, in the log
+// and to the --exec hook (which gets the event's JSON on stdin) and each
+// --notify target (see newNotifier): a webhook gets the JSON, Slack a
+// summary of the sections changed, the word delta and a link. With
+// --tenants, each namespace's notify targets also get the amendments on its
+// watchlist.
+//
+// The first poll of a title records where it stands without reporting
+// anything, fetching only its latest snapshot. What has been seen is kept
+// in --state, so a restarted watch picks up where it stopped. With
+// --archive, every part an amendment changed is also rendered to PDF/A
+// into that archive (see runArchive).
+//
+// Deliveries and archive fetches go through a write-ahead log next to
+// --state (see watchWAL): ones that fail, or that a crash or restart
+// interrupts, are retried at the start of each poll until they succeed,
+// and none is repeated once it has. Every event also goes to --journal,
+// from which `efcr events replay` re-sends them to consumers that missed
+// them.
+//
+// With --metrics-addr, watch also listens there for Prometheus scrapes of
+// GET /metrics (see prometheusHandler), the crawler's health while it
+// runs unattended.
+//
+//	efcr watch --titles 21,40 --interval 1h --db corpus.db
+//	efcr watch --once --exec ./notify.sh
+//	efcr watch --titles 40 --notify slack:https://hooks.slack.com/services/T000/B000/XXXX
+//	efcr watch --tenants tenants.json
+//	efcr watch --titles 40 --archive archive --font DejaVuSans.ttf
+//	efcr watch --metrics-addr :9090
+func runWatch(ctx context.Context, c httpclient, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	titleList := fs.String("titles", "", "comma separated title numbers to watch (default all)")
+	interval := fs.Duration("interval", time.Hour, "time between polls")
+	statePath := fs.String("state", filepath.Join(cacheDir, "watch.json"), "file recording the latest version date handled per title")
+	dbPath := fs.String("db", "", "store new titles, versions and word counts in this SQLite database, as crawl --db does")
+	execCmd := fs.String("exec", "", "command to run per new amendment, with the event as JSON on stdin")
+	var notifySpecs stringsFlag
+	fs.Var(&notifySpecs, "notify", "also report each new amendment to this webhook URL, slack:WEBHOOK_URL, cmd:COMMAND or file:PATH (repeatable)")
+	tenantsPath := fs.String("tenants", "", "JSON file of namespaces, as serve takes; also report each new amendment on a namespace's watchlist to its notify targets")
+	journal := fs.String("journal", filepath.Join(cacheDir, "events.ndjson"), "append every new amendment to this file, for `efcr events replay`; empty for none")
+	workers := fs.Int("workers", maxWorkers, "snapshots to fetch and analyze concurrently")
+	once := fs.Bool("once", false, "poll once and exit, e.g. from cron")
+	archiveDir := fs.String("archive", "", "also render each changed part to PDF/A into this archive directory")
+	fontPath := fs.String("font", "", "TrueType font to embed in --archive PDFs")
+	metricsAddr := fs.String("metrics-addr", "", "serve Prometheus metrics on GET /metrics at this address, e.g. :9090")
+	fs.Parse(args)
+	if *readOnly {
+		return errors.New("watch fetches upstream; it can't run with -read-only")
+	}
+	if *interval < time.Minute {
+		return fmt.Errorf("--interval %v is too short; the API asks for restraint", *interval)
+	}
+	titles, err := parseTitles(*titleList)
+	if err != nil {
+		return err
+	}
+	state, err := loadWatchState(*statePath)
+	if err != nil {
+		return err
+	}
+	// Titles and versions are normally cached for a day; a poll has to see
+	// anything older than the previous one.
+	if responseCache != nil {
+		responseCache.TTLs = append([]CacheTTL{
+			{regexp.MustCompile(`/titles\.json$`), *interval},
+			{regexp.MustCompile(`/versions/`), *interval},
+		}, responseCache.TTLs...)
+	}
+	wal, err := openWatchWAL(strings.TrimSuffix(*statePath, ".json") + ".wal")
+	if err != nil {
+		return err
+	}
+	w := &watcher{c: c, titles: titles, state: state, path: *statePath, dbPath: *dbPath,
+		args: append([]string{"watch"}, args...), workers: *workers, wal: wal,
+		notify: []watchChannel{{"stdout", stdoutNotifier{json.NewEncoder(os.Stdout)}}}}
+	if *journal != "" {
+		w.notify = append(w.notify, watchChannel{"journal", fileNotifier(*journal)})
+	}
+	if hook := strings.Fields(*execCmd); len(hook) > 0 {
+		w.notify = append(w.notify, watchChannel{channelName("exec", *execCmd), commandNotifier(hook)})
+	}
+	for _, spec := range notifySpecs {
+		n, err := newNotifier(spec)
+		if err != nil {
+			return err
+		}
+		w.notify = append(w.notify, watchChannel{channelName("notify", spec), n})
+	}
+	if *tenantsPath != "" {
+		tenants, err := loadTenants(*tenantsPath)
+		if err != nil {
+			return err
+		}
+		for _, name := range sortedKeys(tenants) {
+			w.notify = append(w.notify, tenants[name].notify...)
+		}
+	}
+	if *archiveDir != "" {
+		if *fontPath == "" {
+			return errors.New("--archive needs a --font to embed")
+		}
+		font, err := loadTrueType(*fontPath)
+		if err != nil {
+			return err
+		}
+		if w.archive, err = OpenArchive(*archiveDir, font); err != nil {
+			return err
+		}
+	}
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /metrics", prometheusHandler(fetchMetrics, limited))
+		srv := &http.Server{Addr: *metricsAddr, Handler: mux}
+		ln, err := net.Listen("tcp", *metricsAddr)
+		if err != nil {
+			return err
+		}
+		go srv.Serve(ln)
+		defer srv.Shutdown(context.Background())
+		slog.Info("serving metrics", "addr", ln.Addr().String())
+	}
+	for {
+		progressEvents.enter("poll")
+		err := w.poll(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err != nil && *once:
+			return err
+		case err != nil:
+			slog.Warn("watch: poll failed; trying again", "err", err, "in", *interval)
+		}
+		if *once {
+			return nil
+		}
+		progressEvents.enter("idle")
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(*interval):
+		}
+	}
+}
+
+// poll retries what the WAL holds pending, handles every watched title
+// amended since it was last seen, then saves the store and the state, in
+// that order, so a crash between them repeats work rather than losing it,
+// and last compacts the WAL.
+func (w *watcher) poll(ctx context.Context) error {
+	var errs []error
+	for _, e := range w.wal.pending(w.channelNames()) {
+		if err := w.deliver(ctx, e); err != nil {
+			return err
+		}
+	}
+	for _, f := range w.wal.pendingFetches() {
+		if err := w.fetch(ctx, f.Title, f.Part, f.Date); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	api := newAPI(w.c)
+	titles, err := api.Titles(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	var db *corpusDB
+	var results []pipeline.TitleResult
+	for _, t := range titles {
+		if t.Reserved || (len(w.titles) > 0 && !w.titles[t.Number]) {
+			continue
+		}
+		seen := w.state[t.Number]
+		if seen != "" && t.LatestAmendedOn != "" && t.LatestAmendedOn <= seen {
+			continue
+		}
+		versions, err := api.Versions(ctx, t.Number, ecfr.Hierarchy{})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("title %d: %w", t.Number, err))
+			continue
+		}
+		latest, since, prev := "", "", ""
+		parts := map[string][]string{}         // new date -> changed parts
+		changed := map[string][]ecfr.Version{} // new date -> its substantive versions
+		for _, v := range versions {
+			latest = max(latest, v.Date)
+			if v.Substantive && !v.Removed && v.Date <= seen {
+				prev = max(prev, v.Date) // the snapshot word deltas count from
+			}
+			if !v.Substantive || v.Date <= seen {
+				continue
+			}
+			changed[v.Date] = append(changed[v.Date], v)
+			if seen == "" {
+				since = max(since, v.Date) // a new title starts from its latest snapshot
+			} else if since == "" || v.Date < since {
+				since = v.Date
+			}
+			if !contains(parts[v.Date], v.Part) {
+				parts[v.Date] = append(parts[v.Date], v.Part)
+			}
+		}
+		if since == "" {
+			w.state[t.Number] = max(seen, latest) // only editorial changes
+			continue
+		}
+
+		if db == nil && w.dbPath != "" {
+			if db, err = openCorpusDB(w.dbPath, w.args); err != nil {
+				return err
+			}
+		}
+		p := pipeline.New(newAPI(w.c))
+		p.Logger = slog.Default()
+		p.Results = NewResultCache(filepath.Join(cacheDir, "results"))
+		p.Workers = w.workers
+		p.Metrics = fetchMetrics
+		p.TableParts = cfg.tableParts()
+		p.Titles = map[int]bool{t.Number: true}
+		p.Since = since
+		if seen != "" && prev != "" {
+			p.Since = prev // already in the result cache; needed for WordDelta
+		}
+		if db != nil {
+			p.OnVersions = db.addVersions
+		}
+		res, err := p.Run(ctx)
+		if err != nil {
+			return err
+		}
+		if len(res) != 1 {
+			errs = append(errs, fmt.Errorf("title %d: no longer listed", t.Number))
+			continue
+		}
+		if len(res[0].Errs) > 0 {
+			errs = append(errs, fmt.Errorf("title %d: %w", t.Number, errors.Join(res[0].Errs...)))
+			continue
+		}
+		results = append(results, res[0])
+		w.state[t.Number] = latest
+
+		if seen == "" {
+			slog.Info("watching", titleAttr(t.Number), "name", t.Name, "from", since)
+			continue
+		}
+		chapters, err := partChapters(ctx, w.c, t.Number, t.UpToDateAsOf)
+		if err != nil {
+			errs = append(errs, err) // the events go out with chapterless IDs
+		}
+		var dates []string
+		for d := range res[0].Dates {
+			dates = append(dates, d)
+		}
+		sort.Strings(dates)
+		for i, d := range dates {
+			if d <= seen {
+				continue
+			}
+			sort.Strings(parts[d])
+			e := WatchEvent{Title: t.Number, Name: t.Name, Date: d, Parts: parts[d], Sections: versionIDs(t.Number, changed[d], chapters),
+				Words: res[0].Dates[d], Detected: now}
+			if i > 0 {
+				e.WordDelta = e.Words - res[0].Dates[dates[i-1]]
+			}
+			e.URL = watchURL(e)
+			isNew, err := w.wal.detect(e)
+			if err != nil {
+				return err
+			}
+			if !isNew {
+				continue // the poll before crashed before saving its state
+			}
+			slog.Info("amended", titleAttr(e.Title), dateAttr(e.Date), "parts", strings.Join(e.Parts, ","), "sections", len(e.Sections), "word_delta", e.WordDelta)
+			if w.archive != nil {
+				for _, part := range parts[d] {
+					if err := w.wal.append(walRecord{Op: "fetch", Title: t.Number, Part: part, Date: d}); err != nil {
+						return err
+					}
+				}
+			}
+			if err := w.deliver(ctx, e); err != nil {
+				return err
+			}
+			if w.archive == nil {
+				continue
+			}
+			for _, part := range parts[d] {
+				if err := w.fetch(ctx, t.Number, part, d); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+	if db != nil && len(results) > 0 {
+		db.addResults(results, nil, cfg.tableParts())
+		if err := db.addSectionIDs(ctx, w.c, results); err != nil {
+			return err
+		}
+		if err := db.save(); err != nil {
+			return err
+		}
+	}
+	if err := w.state.save(w.path); err != nil {
+		return err
+	}
+	if err := w.wal.compact(w.channelNames()); err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+// versionIDs returns the sorted, distinct IDs of the sections and
+// appendices versions changed, placing parts in chapters.
+func versionIDs(title int, versions []ecfr.Version, chapters map[string]string) []string {
+	ids := []string{}
+	for _, v := range versions {
+		if v.Type != "section" && v.Type != "appendix" {
+			continue
+		}
+		id := core.SectionID{Title: title, Chapter: chapters[v.Part], Part: v.Part, Section: v.Identifier}.String()
+		if !contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// deliver sends an amendment to each channel the WAL says hasn't had it. A
+// failing channel is logged, not fatal: the WAL keeps the event for the
+// next poll to retry. Only failing to write the WAL is an error.
+func (w *watcher) deliver(ctx context.Context, e WatchEvent) error {
+	for _, c := range w.notify {
+		if !w.wal.pendingOn(e, c.name) {
+			continue
+		}
+		if err := c.Notify(ctx, e); err != nil {
+			slog.Warn("watch: notification failed; will retry", "channel", c.name, titleAttr(e.Title), dateAttr(e.Date), "err", err)
+			continue
+		}
+		if err := w.wal.append(walRecord{Op: "sent", Key: eventKey(e), Channel: c.name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetch archives part as of date for a WAL fetch record, marking it done
+// on success. Without --archive the record waits for a watch that has one.
+func (w *watcher) fetch(ctx context.Context, title int, part, date string) error {
+	if w.archive == nil {
+		return nil
+	}
+	if _, _, err := w.archive.Add(ctx, w.c, title, part, date); err != nil {
+		return fmt.Errorf("archive %s on %s: %w; will retry", citation(title, part, ""), date, err)
+	}
+	return w.wal.append(walRecord{Op: "fetched", Title: title, Part: part, Date: date})
+}